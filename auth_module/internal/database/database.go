@@ -124,6 +124,14 @@ func (db *DB) createIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create invitation_logs index: %w", err)
 	}
 
+	// InvitationLogs: {domain, claimed_by} for orders_module's checkout lookups
+	_, err = db.InvitationLogs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "claimed_by", Value: 1}, {Key: "claimed_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invitation_logs claimed_by index: %w", err)
+	}
+
 	// MagicLinkTokens: unique index on token
 	_, err = db.MagicLinkTokens.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "token", Value: 1}},
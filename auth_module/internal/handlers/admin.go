@@ -169,6 +169,7 @@ type CreateInvitationRequest struct {
 	Source          string  `json:"source,omitempty"`
 	Ref             string  `json:"ref,omitempty"`
 	DiscountPercent float64 `json:"discount_percent,omitempty"`
+	DiscountOrders  int     `json:"discount_orders,omitempty"`
 }
 
 // InviteUser handles POST /admin/users/invite
@@ -189,14 +190,21 @@ func (h *AdminHandler) InviteUser(c echo.Context) error {
 		singleUse = *req.SingleUse
 	}
 
+	if req.DiscountPercent < 0 || req.DiscountPercent > 100 || req.DiscountOrders < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "discount_percent must be between 0 and 100 and discount_orders can't be negative",
+		})
+	}
+
 	// Prepare metadata
 	var metadata *models.InvitationMetadata
-	if req.PromoCode != "" || req.Source != "" || req.Ref != "" {
+	if req.PromoCode != "" || req.Source != "" || req.Ref != "" || req.DiscountPercent > 0 {
 		metadata = &models.InvitationMetadata{
 			PromoCode:       req.PromoCode,
 			Source:          req.Source,
 			Ref:             req.Ref,
 			DiscountPercent: req.DiscountPercent,
+			DiscountOrders:  req.DiscountOrders,
 		}
 	}
 
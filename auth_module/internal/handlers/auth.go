@@ -123,6 +123,9 @@ func (h *AuthHandler) VerifyInvitation(c echo.Context) error {
 	if invitation.Metadata != nil {
 		response["promo_code"] = invitation.Metadata.PromoCode
 		response["discount_percent"] = invitation.Metadata.DiscountPercent
+		if invitation.Metadata.DiscountPercent > 0 {
+			response["discount_orders"] = max(invitation.Metadata.DiscountOrders, 1)
+		}
 	}
 
 	return c.JSON(http.StatusOK, response)
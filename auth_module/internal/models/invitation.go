@@ -32,7 +32,8 @@ type InvitationMetadata struct {
 	PromoCode       string  `bson:"promo_code,omitempty" json:"promo_code,omitempty"`
 	Source          string  `bson:"source,omitempty" json:"source,omitempty"`                       // "booth", "instagram", etc.
 	Ref             string  `bson:"ref,omitempty" json:"ref,omitempty"`                             // Referrer (sales rep, affiliate)
-	DiscountPercent float64 `bson:"discount_percent,omitempty" json:"discount_percent,omitempty"`
+	DiscountPercent float64 `bson:"discount_percent,omitempty" json:"discount_percent,omitempty"`   // Applied at checkout by orders_module
+	DiscountOrders  int     `bson:"discount_orders,omitempty" json:"discount_orders,omitempty"`     // Number of orders that get the discount (default 1)
 	CustomData      map[string]interface{} `bson:"custom_data,omitempty" json:"custom_data,omitempty"`
 }
 
@@ -48,6 +49,10 @@ type InvitationLog struct {
 	ClaimedBy    string             `bson:"claimed_by" json:"claimed_by"`                           // User ID
 	ClaimedAt    time.Time          `bson:"claimed_at" json:"claimed_at"`
 	UserEmail    string             `bson:"user_email" json:"user_email"`
+
+	// Discount terms at the time of the claim, read by orders_module at checkout
+	DiscountPercent float64 `bson:"discount_percent,omitempty" json:"discount_percent,omitempty"`
+	DiscountOrders  int     `bson:"discount_orders,omitempty" json:"discount_orders,omitempty"`
 }
 
 // MagicLinkToken represents a temporary token for magic link authentication
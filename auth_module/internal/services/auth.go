@@ -226,6 +226,13 @@ func (s *AuthService) AcceptInvitation(ctx context.Context, token, email, authPr
 		invitationLog.PromoCode = invitation.Metadata.PromoCode
 		invitationLog.Source = invitation.Metadata.Source
 		invitationLog.Ref = invitation.Metadata.Ref
+		if invitation.Metadata.DiscountPercent > 0 {
+			invitationLog.DiscountPercent = invitation.Metadata.DiscountPercent
+			invitationLog.DiscountOrders = invitation.Metadata.DiscountOrders
+			if invitationLog.DiscountOrders < 1 {
+				invitationLog.DiscountOrders = 1
+			}
+		}
 	}
 	_, _ = s.db.InvitationLogs.InsertOne(ctx, invitationLog)
 
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var customersCmd = &cobra.Command{
+	Use:   "customers",
+	Short: "Customer profiles",
+	Long:  `List customers by lifetime spend and rebuild their profiles from the orders.`,
+}
+
+var customersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a domain's customers with their order totals",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		sort, _ := cmd.Flags().GetString("sort")
+		limit, _ := cmd.Flags().GetInt64("limit")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		profiles, err := services.NewCustomerProfileService(db).ListProfiles(context.Background(), domain, sort, limit)
+		if err != nil {
+			log.Fatalf("❌ Failed to list customers: %v", err)
+		}
+
+		if len(profiles) == 0 {
+			fmt.Println("No customers found (run `customers rebuild` to backfill existing orders)")
+			return
+		}
+
+		fmt.Printf("\nCustomers: %d\n\n", len(profiles))
+		fmt.Printf("%-34s %6s %12s %10s %10s %-10s %-10s\n", "CUSTOMER", "ORDERS", "SPEND", "AVERAGE", "REFUNDED", "FIRST", "LAST")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, p := range profiles {
+			fmt.Printf("%-34s %6d %12.2f %10.2f %10.2f %-10s %-10s\n",
+				p.Email,
+				p.Orders,
+				p.LifetimeSpend,
+				p.AverageOrderValue,
+				p.Refunded,
+				p.FirstOrderAt.Format("2006-01-02"),
+				p.LastOrderAt.Format("2006-01-02"),
+			)
+		}
+	},
+}
+
+var customersRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Recompute every customer profile of a domain from its orders",
+	Long: `Profiles are kept up to date as orders are paid and refunded. Rebuild
+backfills orders placed before profiles existed or fixes profiles after
+orders were changed directly in the database.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+
+		db := connectDatabase()
+		defer db.Close()
+
+		count, err := services.NewCustomerProfileService(db).Rebuild(context.Background(), domain)
+		if err != nil {
+			log.Fatalf("❌ Failed to rebuild customer profiles: %v", err)
+		}
+
+		fmt.Printf("✅ Rebuilt %d customer profiles for %s\n", count, domain)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(customersCmd)
+	customersCmd.AddCommand(customersListCmd, customersRebuildCmd)
+
+	for _, c := range []*cobra.Command{customersListCmd, customersRebuildCmd} {
+		c.Flags().String("domain", "", "Domain name (e.g., example.com)")
+	}
+	customersListCmd.Flags().String("sort", "spend", "Sort by spend, orders, average or recent")
+	customersListCmd.Flags().Int64("limit", 50, "Maximum number of customers")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database maintenance",
+	Long:  `Maintenance tasks for the orders database.`,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Remove duplicates that block unique indexes and create them",
+	Long: `Unique indexes added to existing collections are skipped at startup
+while the collection has duplicates. Migrate gives orders sharing an order
+number a unique one (the oldest keeps it, the others get a -2, -3, ...
+suffix), lists orders that earned loyalty points more than once and creates
+the indexes that no longer have duplicates.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		db := connectDatabase()
+		defer db.Close()
+
+		renumbered, err := db.DedupeOrderNumbers(ctx)
+		for _, r := range renumbered {
+			fmt.Printf("  %s: order %s renumbered %s -> %s\n", r.Domain, r.OrderID, r.From, r.To)
+		}
+		if err != nil {
+			log.Fatalf("❌ Failed to dedupe order numbers: %v", err)
+		}
+		fmt.Printf("✅ Renumbered %d orders\n", len(renumbered))
+
+		earns, err := db.DuplicateEarns(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to check loyalty earns: %v", err)
+		}
+		if len(earns) > 0 {
+			fmt.Printf("\n⚠️  %d orders earned loyalty points more than once; correct the customers' points and remove the extra earn transactions:\n", len(earns))
+			for _, e := range earns {
+				fmt.Printf("  %s: order %s earned %d times\n", e.Domain, e.OrderID, e.Earns)
+			}
+		}
+
+		skipped, err := db.CreateUniqueIndexes(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to create indexes: %v", err)
+		}
+		if len(skipped) > 0 {
+			for _, index := range skipped {
+				fmt.Printf("⚠️  Unique index %s still has duplicates\n", index)
+			}
+			return
+		}
+		fmt.Println("✅ Unique indexes created")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var fulfillmentCmd = &cobra.Command{
+	Use:   "fulfillment",
+	Short: "Print warehouse documents",
+	Long:  `Generate packing slips and pick lists for paid orders as HTML (print from the browser) or PDF.`,
+}
+
+var packingSlipsCmd = &cobra.Command{
+	Use:   "packing-slips",
+	Short: "Print packing slips, a page per order",
+	Long:  `Without --orders every paid order that hasn't fully shipped yet is included, oldest first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, orderIDs, format, output := packingFlags(cmd, "packing-slips")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		slips, err := services.NewPackingService(db).PackingSlips(context.Background(), domain, orderIDs)
+		if err != nil {
+			log.Fatalf("❌ Failed to build packing slips: %v", err)
+		}
+
+		writePackingDocument(output, func(w io.Writer) error {
+			return services.WritePackingSlips(w, slips, format)
+		})
+		if output != "-" {
+			fmt.Printf("✅ %d packing slips written to %s\n", len(slips), output)
+		}
+	},
+}
+
+var pickListCmd = &cobra.Command{
+	Use:   "pick-list",
+	Short: "Print the units to pick for several orders, grouped by SKU",
+	Long:  `Without --orders every paid order that hasn't fully shipped yet is included.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, orderIDs, format, output := packingFlags(cmd, "pick-list")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		list, err := services.NewPackingService(db).PickList(context.Background(), domain, orderIDs)
+		if err != nil {
+			log.Fatalf("❌ Failed to build pick list: %v", err)
+		}
+
+		writePackingDocument(output, func(w io.Writer) error {
+			return services.WritePickList(w, list, format)
+		})
+		if output != "-" {
+			fmt.Printf("✅ Pick list of %d units across %d orders written to %s\n", list.TotalUnits, len(list.Orders), output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fulfillmentCmd)
+
+	for _, c := range []*cobra.Command{packingSlipsCmd, pickListCmd} {
+		fulfillmentCmd.AddCommand(c)
+		c.Flags().String("domain", "", "Domain name (e.g., example.com)")
+		c.Flags().String("orders", "", "Comma-separated order IDs (default: all paid orders not fully shipped)")
+		c.Flags().String("format", "pdf", "Output format: html or pdf")
+		c.Flags().String("output", "", "Output file, - for stdout (default: <command>.<format>)")
+	}
+}
+
+// packingFlags reads the flags shared by the fulfillment commands
+func packingFlags(cmd *cobra.Command, name string) (domain string, orderIDs []string, format, output string) {
+	domain, _ = cmd.Flags().GetString("domain")
+	orders, _ := cmd.Flags().GetString("orders")
+	format, _ = cmd.Flags().GetString("format")
+	output, _ = cmd.Flags().GetString("output")
+
+	if domain == "" {
+		log.Fatal("❌ --domain is required")
+	}
+	if format != "html" && format != "pdf" {
+		log.Fatal("❌ --format must be html or pdf")
+	}
+	if output == "" {
+		output = name + "." + format
+	}
+
+	for _, id := range strings.Split(orders, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			orderIDs = append(orderIDs, id)
+		}
+	}
+	return domain, orderIDs, format, output
+}
+
+// writePackingDocument renders a document to a file or stdout
+func writePackingDocument(output string, render func(io.Writer) error) {
+	if output == "-" {
+		if err := render(os.Stdout); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		log.Fatalf("❌ Failed to create %s: %v", output, err)
+	}
+	if err := render(file); err != nil {
+		file.Close()
+		log.Fatalf("❌ %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("❌ Failed to write %s: %v", output, err)
+	}
+}
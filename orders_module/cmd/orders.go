@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// orderStatuses are the statuses `orders status` accepts; orders are marked
+// paid by their payment, and cancelled and refunded with `orders cancel` and
+// `orders refund`
+var orderStatuses = []string{"processing", "partially_shipped", "shipped", "delivered"}
+
+var ordersCmd = &cobra.Command{
+	Use:   "orders",
+	Short: "Manage orders",
+	Long:  `List, inspect, update, refund, cancel and export orders directly from MongoDB.`,
+}
+
+var ordersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a domain's orders, newest first",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		filter := orderFilterFlags(cmd)
+		limit, _ := cmd.Flags().GetInt64("limit")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		orders, err := newOrderService(db).FindOrders(context.Background(), domain, filter, limit)
+		if err != nil {
+			log.Fatalf("❌ Failed to list orders: %v", err)
+		}
+
+		if len(orders) == 0 {
+			fmt.Println("No orders found")
+			return
+		}
+
+		fmt.Printf("\nOrders: %d\n\n", len(orders))
+		fmt.Printf("%-24s %-16s %-18s %-17s %-30s %10s\n", "ID", "NUMBER", "STATUS", "CREATED", "CUSTOMER", "TOTAL")
+		fmt.Println(strings.Repeat("-", 120))
+		for _, o := range orders {
+			fmt.Printf("%-24s %-16s %-18s %-17s %-30s %10.2f\n",
+				o.ID.Hex(),
+				o.OrderNumber,
+				o.Status,
+				o.CreatedAt.Format("2006-01-02 15:04"),
+				o.Customer.Email,
+				o.Total,
+			)
+		}
+	},
+}
+
+var ordersShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show an order's details",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		order := findOrder(cmd, newOrderService(db), domain)
+		if asJSON {
+			writeJSON(os.Stdout, order)
+			return
+		}
+		printOrder(order)
+	},
+}
+
+var ordersStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Change an order's status",
+	Long: `Moves a paid order along its lifecycle (paid → processing → shipped → delivered) and sends the status webhook, like the admin API.
+Orders are only marked paid when Stripe confirms the payment (or a held order is approved).
+Use "orders refund" or "orders cancel" to refund or cancel an order: they deal with the payment and give back points, gift card balances, coupon uses and commissions.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		status, _ := cmd.Flags().GetString("status")
+		actor, _ := cmd.Flags().GetString("actor")
+
+		valid := false
+		for _, s := range orderStatuses {
+			valid = valid || s == status
+		}
+		if !valid {
+			log.Fatalf("❌ --status must be one of %s", strings.Join(orderStatuses, ", "))
+		}
+
+		db := connectDatabase()
+		defer db.Close()
+
+		orderService := newOrderService(db)
+		order := findOrder(cmd, orderService, domain)
+		if err := orderService.UpdateOrderStatus(context.Background(), order.ID.Hex(), status, domain, actor); err != nil {
+			log.Fatalf("❌ Failed to update order: %v", err)
+		}
+
+		fmt.Printf("✅ Order %s: %s → %s\n", order.OrderNumber, order.Status, status)
+	},
+}
+
+var ordersRefundCmd = &cobra.Command{
+	Use:   "refund",
+	Short: "Refund an order in full through Stripe",
+	Long:  `Refunds what is still charged on the order (the payment and extra charges from item edits, minus earlier refunds) and marks it refunded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		reason, _ := cmd.Flags().GetString("reason")
+		actor, _ := cmd.Flags().GetString("actor")
+		requireStripeKey()
+
+		db := connectDatabase()
+		defer db.Close()
+
+		orderService := newOrderService(db)
+		order := findOrder(cmd, orderService, domain)
+		updated, err := orderService.RefundOrder(context.Background(), order.ID.Hex(), domain, reason, actor)
+		if err != nil {
+			log.Fatalf("❌ Failed to refund order: %v", err)
+		}
+
+		fmt.Printf("✅ Order %s refunded\n", updated.OrderNumber)
+		printRefunds(order, updated)
+	},
+}
+
+var ordersCancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel an order that hasn't shipped",
+	Long:  `Cancels the payment intent of an unpaid order, or refunds a paid order in full, and marks it cancelled.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		reason, _ := cmd.Flags().GetString("reason")
+		actor, _ := cmd.Flags().GetString("actor")
+		requireStripeKey()
+
+		db := connectDatabase()
+		defer db.Close()
+
+		orderService := newOrderService(db)
+		order := findOrder(cmd, orderService, domain)
+		updated, err := orderService.CancelOrder(context.Background(), order.ID.Hex(), domain, reason, actor)
+		if err != nil {
+			log.Fatalf("❌ Failed to cancel order: %v", err)
+		}
+
+		fmt.Printf("✅ Order %s cancelled\n", updated.OrderNumber)
+		printRefunds(order, updated)
+	},
+}
+
+var ordersExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export orders as CSV or JSON",
+	Long:  `Exports every order matching the filters, newest first. CSV has a row per order, JSON the full order documents.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		filter := orderFilterFlags(cmd)
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		if format != "csv" && format != "json" {
+			log.Fatal("❌ --format must be csv or json")
+		}
+
+		db := connectDatabase()
+		defer db.Close()
+
+		orders, err := newOrderService(db).FindOrders(context.Background(), domain, filter, 0)
+		if err != nil {
+			log.Fatalf("❌ Failed to list orders: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			file, err := os.Create(output)
+			if err != nil {
+				log.Fatalf("❌ Failed to create %s: %v", output, err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if format == "json" {
+			writeJSON(w, orders)
+		} else {
+			writeOrdersCSV(w, orders)
+		}
+
+		if output != "-" {
+			fmt.Printf("✅ %d orders exported to %s\n", len(orders), output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ordersCmd)
+
+	for _, c := range []*cobra.Command{ordersListCmd, ordersShowCmd, ordersStatusCmd, ordersRefundCmd, ordersCancelCmd, ordersExportCmd} {
+		ordersCmd.AddCommand(c)
+		c.Flags().String("domain", "", "Domain name (e.g., example.com)")
+	}
+
+	for _, c := range []*cobra.Command{ordersShowCmd, ordersStatusCmd, ordersRefundCmd, ordersCancelCmd} {
+		c.Flags().String("order", "", "Order ID or order number")
+	}
+	for _, c := range []*cobra.Command{ordersStatusCmd, ordersRefundCmd, ordersCancelCmd} {
+		c.Flags().String("actor", "cli", "Who made the change (order history)")
+	}
+	for _, c := range []*cobra.Command{ordersRefundCmd, ordersCancelCmd} {
+		c.Flags().String("reason", "", "Reason, stored with the refund")
+	}
+	for _, c := range []*cobra.Command{ordersListCmd, ordersExportCmd} {
+		c.Flags().String("status", "", "Only orders with this status")
+		c.Flags().String("from", "", "Created on or after (YYYY-MM-DD or RFC 3339)")
+		c.Flags().String("to", "", "Created on or before (YYYY-MM-DD or RFC 3339)")
+	}
+
+	ordersListCmd.Flags().Int64("limit", 20, "Maximum number of orders")
+	ordersShowCmd.Flags().Bool("json", false, "Print the full order document as JSON")
+	ordersStatusCmd.Flags().String("status", "", "New status ("+strings.Join(orderStatuses, ", ")+")")
+	ordersExportCmd.Flags().String("format", "csv", "Output format: csv or json")
+	ordersExportCmd.Flags().String("output", "-", "Output file (default: stdout)")
+}
+
+// newOrderService creates an order service with the configured Stripe key
+func newOrderService(db *database.MongoDB) *services.OrderService {
+	return services.NewOrderService(db, cfg.Stripe.SecretKey)
+}
+
+func requireDomain(cmd *cobra.Command) string {
+	domain, _ := cmd.Flags().GetString("domain")
+	if domain == "" {
+		log.Fatal("❌ --domain is required")
+	}
+	return domain
+}
+
+func requireStripeKey() {
+	if cfg.Stripe.SecretKey == "" {
+		log.Fatal("❌ stripe.secret_key is required to move money")
+	}
+}
+
+// findOrder loads the order given by --order, an order ID or order number
+func findOrder(cmd *cobra.Command, orderService *services.OrderService, domain string) *models.Order {
+	ref, _ := cmd.Flags().GetString("order")
+	if ref == "" {
+		log.Fatal("❌ --order is required")
+	}
+
+	ctx := context.Background()
+	var order *models.Order
+	var err error
+	if primitive.IsValidObjectID(ref) {
+		order, err = orderService.GetOrder(ctx, ref, domain)
+	} else {
+		order, err = orderService.GetOrderByNumber(ctx, ref, domain)
+	}
+	if err != nil {
+		log.Fatalf("❌ Failed to get order %s: %v", ref, err)
+	}
+	return order
+}
+
+// orderFilterFlags reads --status, --from and --to
+func orderFilterFlags(cmd *cobra.Command) services.OrderFilter {
+	var filter services.OrderFilter
+	filter.Status, _ = cmd.Flags().GetString("status")
+
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	filter.From = parseDateFlag("from", from, false)
+	filter.To = parseDateFlag("to", to, true)
+	return filter
+}
+
+// parseDateFlag parses a YYYY-MM-DD or RFC 3339 date. A plain date as the
+// end of a range includes the whole day.
+func parseDateFlag(name, value string, endOfDay bool) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		log.Fatalf("❌ Invalid --%s date %q, use YYYY-MM-DD or RFC 3339", name, value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t
+}
+
+func printOrder(o *models.Order) {
+	fmt.Printf("\n📦 Order %s (%s)\n\n", o.OrderNumber, o.ID.Hex())
+	fmt.Printf("Status: %s\n", o.Status)
+	fmt.Printf("Created: %s\n", o.CreatedAt.Format(time.RFC3339))
+	if o.PaidAt != nil {
+		fmt.Printf("Paid: %s\n", o.PaidAt.Format(time.RFC3339))
+	}
+	fmt.Printf("Customer: %s <%s>", o.Customer.Name, o.Customer.Email)
+	if o.Customer.UserID != "" {
+		fmt.Printf(" (user %s)", o.Customer.UserID)
+	}
+	fmt.Println()
+
+	a := o.ShippingAddress
+	fmt.Printf("Ship to: %s, %s, %s %s %s, %s\n", a.Name, a.AddressLine1, a.City, a.State, a.PostalCode, a.Country)
+
+	fmt.Println("\nItems:")
+	for _, item := range o.Items {
+		fmt.Printf("  %3d × %-40s %-16s %10.2f", item.Quantity, item.ProductName, item.VariantSKU, item.Total)
+		if item.ShippedQuantity > 0 || item.BackorderedQuantity > 0 {
+			fmt.Printf("  (shipped %d, backordered %d)", item.ShippedQuantity, item.BackorderedQuantity)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("\nSubtotal: %10.2f\n", o.Subtotal)
+	for _, d := range o.Discounts {
+		fmt.Printf("Discount: %10.2f  %s %s\n", -d.Amount, d.Type, d.Code)
+	}
+	fmt.Printf("Tax:      %10.2f\n", o.Tax)
+	fmt.Printf("Shipping: %10.2f\n", o.Shipping)
+	fmt.Printf("Total:    %10.2f %s\n", o.Total, strings.ToUpper(o.Currency))
+
+	fmt.Printf("\nPayment: %s %s", o.Payment.Provider, o.Payment.Status)
+	if o.Payment.PaymentIntentID != "" {
+		fmt.Printf(" (%s)", o.Payment.PaymentIntentID)
+	}
+	fmt.Println()
+	for _, adj := range o.PaymentAdjustments {
+		fmt.Printf("  %s %.2f %s %s\n", adj.Type, float64(adj.Amount)/100, adj.Status, adj.Reason)
+	}
+	if s := o.Settlement; s != nil {
+		fmt.Printf("Settled: %.2f - %.2f fees = %.2f net (%s)\n", s.Gross, s.Fees, s.Net, strings.Join(s.PayoutIDs, ", "))
+	}
+	for _, f := range o.Fulfillments {
+		fmt.Printf("Shipment %s: %s %s (%s)\n", f.ID, f.Carrier, f.TrackingNumber, f.CreatedAt.Format("2006-01-02"))
+	}
+
+	if len(o.History) > 0 {
+		fmt.Println("\nHistory:")
+		for _, e := range o.History {
+			fmt.Printf("  %s  %-8s %s\n", e.CreatedAt.Format("2006-01-02 15:04"), e.Actor, e.Message)
+		}
+	}
+	if o.Notes != "" {
+		fmt.Printf("\nNotes: %s\n", o.Notes)
+	}
+	if o.AdminNotes != "" {
+		fmt.Printf("Admin notes: %s\n", o.AdminNotes)
+	}
+}
+
+// printRefunds prints the refunds a command added to an order
+func printRefunds(before, after *models.Order) {
+	for _, adj := range after.PaymentAdjustments[len(before.PaymentAdjustments):] {
+		if adj.Type == "refund" {
+			fmt.Printf("Refund %s: %.2f (%s)\n", adj.RefundID, float64(adj.Amount)/100, adj.Status)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("❌ Failed to write JSON: %v", err)
+	}
+}
+
+// writeOrdersCSV writes a row per order
+func writeOrdersCSV(w io.Writer, orders []*models.Order) {
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	rows := [][]string{{"order_id", "order_number", "status", "created_at", "paid_at", "customer_email", "customer_name", "customer_user_id", "units", "subtotal", "discount", "tax", "shipping", "total", "currency", "payment_status", "ship_country"}}
+	for _, o := range orders {
+		units := 0
+		for _, item := range o.Items {
+			units += item.Quantity
+		}
+		paidAt := ""
+		if o.PaidAt != nil {
+			paidAt = o.PaidAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			o.ID.Hex(),
+			o.OrderNumber,
+			o.Status,
+			o.CreatedAt.Format(time.RFC3339),
+			paidAt,
+			o.Customer.Email,
+			o.Customer.Name,
+			o.Customer.UserID,
+			strconv.Itoa(units),
+			amount(o.Subtotal),
+			amount(o.Discount),
+			amount(o.Tax),
+			amount(o.Shipping),
+			amount(o.Total),
+			o.Currency,
+			o.Payment.Status,
+			o.ShippingAddress.Country,
+		})
+	}
+
+	if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+		log.Fatalf("❌ Failed to write CSV: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var payoutsCmd = &cobra.Command{
+	Use:   "payouts",
+	Short: "Reconcile Stripe payouts with orders",
+	Long: `Import Stripe payouts and their balance transactions, match them to orders
+by payment intent and report what doesn't match. Payouts cover the whole Stripe
+account, so they aren't limited to one domain.`,
+}
+
+var payoutsImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the payouts that arrived in a period",
+	Long: `Fetches the payouts (automatic payouts only) and their balance transactions,
+matches them to orders and records each order's fees and net amount. Importing
+a payout again updates it. With --fixture a JSON file stands in for Stripe.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to := payoutPeriodFlags(cmd)
+		fixture, _ := cmd.Flags().GetString("fixture")
+
+		var provider services.PaymentProvider
+		if fixture != "" {
+			p, err := services.NewFixtureProvider(fixture)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			provider = p
+		} else {
+			if cfg.Stripe.SecretKey == "" {
+				log.Fatal("❌ stripe.secret_key is required to import payouts (or use --fixture)")
+			}
+			provider = services.NewStripeProvider(cfg.Stripe.SecretKey)
+		}
+
+		db := connectDatabase()
+		defer db.Close()
+
+		payouts, err := services.NewPayoutService(db, provider).Import(context.Background(), from, to)
+		if err != nil {
+			log.Fatalf("❌ Failed to import payouts (%d imported): %v", len(payouts), err)
+		}
+
+		if len(payouts) == 0 {
+			fmt.Println("No payouts found")
+			return
+		}
+
+		fmt.Printf("\n✅ Imported %d payouts\n\n", len(payouts))
+		printPayouts(payouts)
+	},
+}
+
+var payoutsReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report imported payouts and the transactions that don't match an order",
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to := payoutPeriodFlags(cmd)
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		if format != "text" && format != "csv" && format != "json" {
+			log.Fatal("❌ --format must be text, csv or json")
+		}
+
+		db := connectDatabase()
+		defer db.Close()
+
+		report, err := services.NewPayoutService(db, nil).Report(context.Background(), from, to)
+		if err != nil {
+			log.Fatalf("❌ Failed to build payout report: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			file, err := os.Create(output)
+			if err != nil {
+				log.Fatalf("❌ Failed to create %s: %v", output, err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		switch format {
+		case "json":
+			writeJSON(w, report)
+		case "csv":
+			writePayoutProblemsCSV(w, report.Problems)
+		default:
+			printPayoutReport(w, report)
+		}
+
+		if output != "-" {
+			fmt.Printf("✅ Payout report written to %s\n", output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(payoutsCmd)
+
+	for _, c := range []*cobra.Command{payoutsImportCmd, payoutsReportCmd} {
+		payoutsCmd.AddCommand(c)
+		c.Flags().String("from", "", "Arrived on or after (YYYY-MM-DD or RFC 3339)")
+		c.Flags().String("to", "", "Arrived on or before (YYYY-MM-DD or RFC 3339)")
+	}
+
+	payoutsImportCmd.Flags().String("fixture", "", "Read payouts from a JSON file instead of Stripe")
+	payoutsReportCmd.Flags().String("format", "text", "Output format: text, csv (problems only) or json")
+	payoutsReportCmd.Flags().String("output", "-", "Output file (default: stdout)")
+}
+
+// payoutPeriodFlags reads --from and --to
+func payoutPeriodFlags(cmd *cobra.Command) (from, to time.Time) {
+	fromValue, _ := cmd.Flags().GetString("from")
+	toValue, _ := cmd.Flags().GetString("to")
+	return parseDateFlag("from", fromValue, false), parseDateFlag("to", toValue, true)
+}
+
+func printPayouts(payouts []models.StripePayout) {
+	fmt.Printf("%-30s %-10s %-11s %12s %12s %10s %12s %10s %s\n", "PAYOUT", "ARRIVAL", "STATUS", "AMOUNT", "GROSS", "FEES", "NET", "DIFF", "MATCHED/MISMATCHED/UNMATCHED")
+	fmt.Println(strings.Repeat("-", 150))
+	for _, p := range payouts {
+		fmt.Printf("%-30s %-10s %-11s %12.2f %12.2f %10.2f %12.2f %10.2f %d/%d/%d\n",
+			p.ID,
+			p.ArrivalDate.Format("2006-01-02"),
+			p.Status,
+			p.Amount,
+			p.Gross,
+			p.Fees,
+			p.Net,
+			p.Difference,
+			p.Matched, p.Mismatched, p.Unmatched,
+		)
+	}
+}
+
+func printPayoutReport(w io.Writer, report *models.PayoutReport) {
+	if len(report.Payouts) == 0 {
+		fmt.Fprintln(w, "No imported payouts in this period")
+		return
+	}
+
+	fmt.Fprintf(w, "\nPayouts: %d\n", len(report.Payouts))
+	fmt.Fprintf(w, "Paid out: %.2f (gross %.2f - fees %.2f = net %.2f)\n", report.Amount, report.Gross, report.Fees, report.Net)
+	fmt.Fprintf(w, "Transactions: %d matched, %d mismatched, %d unmatched\n", report.Matched, report.Mismatched, report.Unmatched)
+
+	for _, p := range report.Payouts {
+		if p.Difference != 0 {
+			fmt.Fprintf(w, "⚠️  Payout %s: amount %.2f differs from its transactions' net %.2f by %.2f\n", p.ID, p.Amount, p.Net, p.Difference)
+		}
+	}
+
+	if len(report.Problems) == 0 {
+		fmt.Fprintln(w, "\n✅ Every transaction matches an order")
+		return
+	}
+
+	fmt.Fprintf(w, "\n%-30s %-28s %-15s %10s %-11s %-16s %s\n", "PAYOUT", "TRANSACTION", "TYPE", "AMOUNT", "STATUS", "ORDER", "PROBLEM")
+	fmt.Fprintln(w, strings.Repeat("-", 150))
+	for _, t := range report.Problems {
+		fmt.Fprintf(w, "%-30s %-28s %-15s %10.2f %-11s %-16s %s\n", t.PayoutID, t.ID, t.Type, t.Amount, t.Status, t.OrderNumber, t.Problem)
+	}
+}
+
+// writePayoutProblemsCSV writes a row per mismatched or unmatched transaction
+func writePayoutProblemsCSV(w io.Writer, problems []models.BalanceTransaction) {
+	rows := [][]string{{
+		"payout_id", "transaction_id", "type", "created_at", "amount", "fee", "net", "currency",
+		"payment_intent_id", "source_id", "status", "problem", "domain", "order_number",
+	}}
+	for _, t := range problems {
+		rows = append(rows, []string{
+			t.PayoutID,
+			t.ID,
+			t.Type,
+			t.CreatedAt.Format(time.RFC3339),
+			fmt.Sprintf("%.2f", t.Amount),
+			fmt.Sprintf("%.2f", t.Fee),
+			fmt.Sprintf("%.2f", t.Net),
+			t.Currency,
+			t.PaymentIntentID,
+			t.SourceID,
+			t.Status,
+			t.Problem,
+			t.Domain,
+			t.OrderNumber,
+		})
+	}
+
+	if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+		log.Fatalf("❌ Failed to write CSV: %v", err)
+	}
+}
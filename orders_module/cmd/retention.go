@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Anonymize customer details on orders",
+	Long: `Apply a domain's PII retention policy or scrub one customer's details from
+their orders. Totals are kept and every run is audited.`,
+}
+
+var retentionRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Anonymize orders older than the domain's retention period",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		actor, _ := cmd.Flags().GetString("actor")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		audit, err := services.NewRetentionService(db).ApplyRetention(context.Background(), domain, actor)
+		if err != nil {
+			log.Fatalf("❌ Failed to apply retention policy: %v", err)
+		}
+
+		fmt.Printf("✅ Anonymized %d orders placed before %s (%d customer profiles updated)\n",
+			audit.Orders, audit.Cutoff.Format("2006-01-02"), audit.Profiles)
+	},
+}
+
+var retentionAnonymizeCmd = &cobra.Command{
+	Use:   "anonymize",
+	Short: "Scrub a customer's details from all their orders",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain := requireDomain(cmd)
+		email, _ := cmd.Flags().GetString("email")
+		reason, _ := cmd.Flags().GetString("reason")
+		actor, _ := cmd.Flags().GetString("actor")
+
+		if email == "" {
+			log.Fatal("❌ --email is required")
+		}
+
+		db := connectDatabase()
+		defer db.Close()
+
+		req := &models.AnonymizeCustomerRequest{Email: email, Reason: reason}
+		audit, err := services.NewRetentionService(db).AnonymizeCustomer(context.Background(), req, domain, actor)
+		if err != nil {
+			log.Fatalf("❌ Failed to anonymize customer: %v", err)
+		}
+
+		fmt.Printf("✅ Anonymized %d orders, removed %d profiles and %d saved addresses (audit %s)\n", audit.Orders, audit.Profiles, audit.Addresses, audit.ID.Hex())
+		fmt.Printf("   Not touched: %s\n", strings.Join(audit.Untouched, ", "))
+		for _, number := range audit.OrderNumbers {
+			fmt.Printf("   %s\n", number)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(retentionCmd)
+	retentionCmd.AddCommand(retentionRunCmd, retentionAnonymizeCmd)
+
+	for _, c := range []*cobra.Command{retentionRunCmd, retentionAnonymizeCmd} {
+		c.Flags().String("domain", "", "Domain name (e.g., example.com)")
+		c.Flags().String("actor", "cli", "Who ran it (anonymization audit)")
+	}
+	retentionAnonymizeCmd.Flags().String("email", "", "Customer email")
+	retentionAnonymizeCmd.Flags().String("reason", "", "Why, e.g. a support ticket reference")
+}
@@ -3,13 +3,15 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"strings"
 
+	"github.com/sparque/orders_module/config"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	cfg     *config.Config
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "orders-module",
@@ -29,21 +31,12 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is config.yaml)")
 }
 
+// initConfig reads in config file and ENV variables if set
 func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		viper.SetConfigName("config")
-		viper.SetConfigType("yaml")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("./config")
-	}
-
-	viper.SetEnvPrefix("ORDERS")
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	var err error
+	cfg, err = config.Load(cfgFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
 	}
 }
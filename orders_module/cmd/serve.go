@@ -1,15 +1,24 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/sparque/orders_module/internal/database"
 	"github.com/sparque/orders_module/internal/handlers"
+	ordersmiddleware "github.com/sparque/orders_module/internal/middleware"
+	"github.com/sparque/orders_module/internal/services"
 )
 
 var serveCmd = &cobra.Command{
@@ -24,45 +33,34 @@ func init() {
 }
 
 func runServer(cmd *cobra.Command, args []string) {
-	// Load configuration
-	port := viper.GetString("server.port")
-	if port == "" {
-		port = "9092"
+	// Report every configuration problem before starting anything
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("❌ %v", err)
 	}
-
-	mongoURI := viper.GetString("mongodb.uri")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
-	}
-
-	mongoDBName := viper.GetString("mongodb.database")
-	if mongoDBName == "" {
-		mongoDBName = "orders_module"
-	}
-
-	jwtSecret := viper.GetString("jwt.secret")
-	if jwtSecret == "" {
-		log.Fatal("JWT secret is required")
-	}
-
-	stripeKey := viper.GetString("stripe.secret_key")
-	if stripeKey == "" {
-		log.Fatal("Stripe secret key is required")
-	}
-
-	stripeWebhookSecret := viper.GetString("stripe.webhook_secret")
-	if stripeWebhookSecret == "" {
+	if cfg.Stripe.WebhookSecret == "" {
 		log.Println("⚠️  Warning: Stripe webhook secret not set - webhooks will not work")
 	}
 
 	// Connect to MongoDB
-	db, err := database.Connect(mongoURI, mongoDBName)
+	db, err := database.Connect(cfg.MongoDB.URI, cfg.MongoDB.Database, cfg.Products.Database, cfg.Auth.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer db.Close()
 
-	log.Printf("✅ Connected to MongoDB: %s/%s", mongoURI, mongoDBName)
+	log.Printf("✅ Connected to MongoDB: %s/%s", cfg.MongoDB.URI, cfg.MongoDB.Database)
+
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
 
 	// Initialize Echo
 	e := echo.New()
@@ -78,27 +76,297 @@ func runServer(cmd *cobra.Command, args []string) {
 	})
 
 	// Initialize handlers
-	orderHandler := handlers.NewOrderHandler(db, jwtSecret, stripeKey, stripeWebhookSecret)
+	orderHandler := handlers.NewOrderHandler(db, cfg.JWT.Secret, cfg.Stripe.SecretKey, cfg.Stripe.WebhookSecret, cfg.Tenant.DefaultDomain)
+	addressHandler := handlers.NewAddressHandler(db)
+	paymentMethodHandler := handlers.NewPaymentMethodHandler(services.NewPaymentCustomerService(db))
+
+	emailService := services.NewEmailService(services.EmailSettings{
+		Host:        cfg.Email.SMTP.Host,
+		Port:        cfg.Email.SMTP.Port,
+		User:        cfg.Email.SMTP.User,
+		Password:    cfg.Email.SMTP.Password,
+		FromAddress: cfg.Email.FromAddress,
+	})
+
+	paymentLinks := services.PaymentLinkSettings{
+		URL:         cfg.PaymentLinks.URL,
+		ExpiryHours: cfg.PaymentLinks.ExpiryHours,
+	}
+
+	draftOrderService := services.NewDraftOrderService(db, services.NewOrderService(db, cfg.Stripe.SecretKey), emailService, paymentLinks)
+	draftOrderHandler := handlers.NewDraftOrderHandler(draftOrderService)
+	settingsHandler := handlers.NewSettingsHandler(services.NewOrderNumberService(db), services.NewCheckoutService(db))
+	// Outbound order webhooks: first attempts are sent right away, the worker
+	// picks up retries
+	webhookService := services.NewWebhookService(db)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	runWorker(func(ctx context.Context) { webhookService.RunDeliveryWorker(ctx, 30*time.Second) })
+
+	riskHandler := handlers.NewRiskHandler(services.NewRiskService(db))
+	loyaltyHandler := handlers.NewLoyaltyHandler(services.NewLoyaltyService(db))
+
+	// Gift cards: issued when paid, the worker emails the codes (scheduled
+	// deliveries and retries included)
+	giftCardService := services.NewGiftCardService(db, emailService)
+	giftCardHandler := handlers.NewGiftCardHandler(giftCardService)
+	runWorker(func(ctx context.Context) { giftCardService.RunDeliveryWorker(ctx, time.Minute) })
+
+	couponHandler := handlers.NewCouponHandler(services.NewCouponService(db))
+	affiliateHandler := handlers.NewAffiliateHandler(services.NewAffiliateService(db))
+	packingHandler := handlers.NewPackingHandler(services.NewPackingService(db))
+	customerHandler := handlers.NewCustomerHandler(services.NewCustomerProfileService(db))
+	cartHandler := handlers.NewCartHandler(services.NewCartService(db, services.NewOrderService(db, cfg.Stripe.SecretKey)), cfg.Tenant.DefaultDomain)
+
+	// Subscriptions: the scheduler places renewal orders and retries
+	// declined renewal payments
+	subscriptionService := services.NewSubscriptionService(db, services.NewOrderService(db, cfg.Stripe.SecretKey), emailService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	runWorker(func(ctx context.Context) { subscriptionService.RunScheduler(ctx, cfg.Subscriptions.SchedulerInterval) })
+
+	reconciliationService := services.NewReconciliationService(db)
+	inventoryHandler := handlers.NewInventoryHandler(services.NewStockService(db), reconciliationService)
+
+	// Scheduled stock reconciliation (disabled unless an interval is set)
+	if every := cfg.Inventory.Reconciliation.Interval; every > 0 {
+		runWorker(func(ctx context.Context) {
+			reconciliationService.RunScheduled(ctx, every, cfg.Inventory.Reconciliation.Fix)
+		})
+		log.Printf("✅ Stock reconciliation scheduled every %s", every)
+	}
+
+	// PII retention: domains that enabled a policy get old orders anonymized
+	retentionService := services.NewRetentionService(db)
+	retentionHandler := handlers.NewRetentionHandler(retentionService)
+	if every := cfg.Retention.Interval; every > 0 {
+		runWorker(func(ctx context.Context) { retentionService.RunScheduled(ctx, every) })
+		log.Printf("✅ Retention policies applied every %s", every)
+	}
+
+	// Abandoned checkouts: unpaid orders are cancelled after a while so they
+	// give back their coupons, invitation discounts and gift card balances
+	if maxAge := cfg.Orders.PendingExpiry; maxAge > 0 {
+		orderService := services.NewOrderService(db, cfg.Stripe.SecretKey)
+		runWorker(func(ctx context.Context) { orderService.RunPendingExpiry(ctx, time.Hour, maxAge) })
+		log.Printf("✅ Unpaid orders expire after %s", maxAge)
+	}
+
+	// Auth middleware (user JWTs issued by auth_module)
+	requireUser := ordersmiddleware.JWTAuth(cfg.JWT.Secret)
+	optionalUser := ordersmiddleware.OptionalJWTAuth(cfg.JWT.Secret)
+	requireAdmin := ordersmiddleware.RequireRole("admin")
 
 	// API Routes
 	api := e.Group("/api/v1")
 
 	// Order routes
-	api.POST("/orders", orderHandler.CreateOrder)           // Create order and payment intent
-	api.GET("/orders/:id", orderHandler.GetOrder)           // Get order by ID
-	api.GET("/orders", orderHandler.ListOrders)             // List orders for user
-	api.PATCH("/orders/:id", orderHandler.UpdateOrderDetails) // Update order details (customer, addresses)
+	api.POST("/orders", orderHandler.CreateOrder, optionalUser) // Create order and payment intent
+	api.GET("/orders/:id", orderHandler.GetOrder, optionalUser)           // Get order by ID
+	api.GET("/orders", orderHandler.ListOrders, requireUser)              // List orders for user
+	api.PATCH("/orders/:id", orderHandler.UpdateOrderDetails, optionalUser) // Update order details (customer, addresses)
 	api.POST("/webhooks/stripe", orderHandler.StripeWebhook) // Stripe payment webhook
+	api.GET("/pay/:token", draftOrderHandler.GetPaymentLink)   // Show a draft order payment link
+	api.POST("/pay/:token", draftOrderHandler.OpenPaymentLink) // Pay: turn the draft into a pending order
+
+	// Shopping cart: anonymous shoppers by cookie, logged-in customers need
+	// the cart permissions
+	cart := api.Group("/cart", optionalUser)
+	cart.GET("", cartHandler.GetCart, ordersmiddleware.RequireUserPermission("cart.read"))
+	cart.DELETE("", cartHandler.ClearCart, ordersmiddleware.RequireUserPermission("cart.write"))
+	cart.POST("/items", cartHandler.AddCartItem, ordersmiddleware.RequireUserPermission("cart.write"))
+	cart.PATCH("/items/:id", cartHandler.UpdateCartItem, ordersmiddleware.RequireUserPermission("cart.write"))
+	cart.DELETE("/items/:id", cartHandler.RemoveCartItem, ordersmiddleware.RequireUserPermission("cart.write"))
+	cart.POST("/checkout", cartHandler.CheckoutCart, ordersmiddleware.RequireUserPermission("cart.write"))
+
+	// Address book (logged-in customers)
+	addresses := api.Group("/addresses", requireUser)
+	addresses.GET("", addressHandler.ListAddresses)
+	addresses.POST("", addressHandler.CreateAddress)
+	addresses.GET("/:id", addressHandler.GetAddress)
+	addresses.PATCH("/:id", addressHandler.UpdateAddress)
+	addresses.DELETE("/:id", addressHandler.DeleteAddress)
+
+	// Saved payment methods (logged-in customers)
+	paymentMethods := api.Group("/payment-methods", requireUser)
+	paymentMethods.GET("", paymentMethodHandler.ListPaymentMethods)
+	paymentMethods.DELETE("/:id", paymentMethodHandler.DeletePaymentMethod)
+
+	// Loyalty points balance (logged-in customers)
+	api.GET("/loyalty", loyaltyHandler.GetMyLoyaltyBalance, requireUser)
+
+	// Affiliate account (users linked to an affiliate)
+	api.GET("/affiliate", affiliateHandler.GetMyAffiliateAccount, requireUser)
+
+	// Subscriptions (logged-in customers)
+	subscriptions := api.Group("/subscriptions", requireUser)
+	subscriptions.GET("", subscriptionHandler.ListMySubscriptions)
+	subscriptions.POST("", subscriptionHandler.CreateSubscription)
+	subscriptions.GET("/:id", subscriptionHandler.GetMySubscription)
+	subscriptions.PATCH("/:id", subscriptionHandler.UpdateMySubscription)
+	subscriptions.POST("/:id/pause", subscriptionHandler.PauseMySubscription)
+	subscriptions.POST("/:id/resume", subscriptionHandler.ResumeMySubscription)
+	subscriptions.POST("/:id/skip", subscriptionHandler.SkipMySubscription)
+	subscriptions.POST("/:id/cancel", subscriptionHandler.CancelMySubscription)
+
+	// Public storefront routes (no auth)
+	public := api.Group("/public/:domain")
+	public.GET("/subscription-plans", subscriptionHandler.ListPublicSubscriptionPlans)
+	public.POST("/gift-cards/balance", giftCardHandler.CheckGiftCardBalance)
+	public.POST("/coupons/validate", couponHandler.ValidateCoupon, optionalUser)
 
 	// Admin routes (require admin role)
-	admin := api.Group("/admin")
-	admin.GET("/orders", orderHandler.ListAllOrders)         // List all orders
-	admin.PATCH("/orders/:id/status", orderHandler.UpdateOrderStatus) // Update order status
+	admin := api.Group("/admin", requireUser, requireAdmin)
+	admin.GET("/orders", orderHandler.ListAllOrders)                       // List the domain's orders
+	admin.PATCH("/orders/:id/status", orderHandler.UpdateOrderStatus)      // Update order status
+	admin.POST("/orders/:id/items", orderHandler.EditOrderItems)           // Edit line items before shipping
+	admin.POST("/orders/:id/fulfillments", orderHandler.CreateFulfillment) // Ship items that are in stock
+	admin.GET("/orders/:id/packing-slip", packingHandler.GetPackingSlip)   // Printable packing slip
+
+	// Warehouse documents (HTML to print from the browser, or PDF)
+	fulfillment := admin.Group("/fulfillment")
+	fulfillment.GET("/packing-slips", packingHandler.GetPackingSlips)
+	fulfillment.GET("/pick-list", packingHandler.GetPickList)
+
+	// Customer profiles: order count, lifetime spend and refunds per customer
+	customers := admin.Group("/customers")
+	customers.GET("", customerHandler.ListCustomers)
+	customers.GET("/:key", customerHandler.GetCustomer)
+
+	// Customer data retention and anonymization requests
+	retention := admin.Group("/retention")
+	retention.POST("/run", retentionHandler.ApplyRetention)
+	retention.POST("/anonymize", retentionHandler.AnonymizeCustomer)
+	retention.GET("/audits", retentionHandler.ListAnonymizationAudits)
+
+	// Draft orders (phone / DM orders, paid through an emailed link)
+	drafts := admin.Group("/draft-orders")
+	drafts.POST("", draftOrderHandler.CreateDraftOrder)
+	drafts.GET("", draftOrderHandler.ListDraftOrders)
+	drafts.GET("/:id", draftOrderHandler.GetDraftOrder)
+	drafts.PATCH("/:id", draftOrderHandler.UpdateDraftOrder)
+	drafts.DELETE("/:id", draftOrderHandler.CancelDraftOrder)
+	drafts.POST("/:id/send", draftOrderHandler.SendPaymentLink)
+
+	// Loyalty program
+	loyalty := admin.Group("/loyalty")
+	loyalty.GET("/customers/:userId", loyaltyHandler.GetCustomerLoyaltyBalance)
+	loyalty.POST("/bonuses", loyaltyHandler.AwardLoyaltyBonus)
+
+	// Gift cards
+	giftCards := admin.Group("/gift-cards")
+	giftCards.POST("", giftCardHandler.CreateGiftCard)
+	giftCards.GET("", giftCardHandler.ListGiftCards)
+	giftCards.GET("/:id", giftCardHandler.GetGiftCard)
+	giftCards.PATCH("/:id", giftCardHandler.UpdateGiftCard)
+	giftCards.GET("/:id/transactions", giftCardHandler.ListGiftCardTransactions)
+	giftCards.POST("/:id/resend", giftCardHandler.ResendGiftCard)
+
+	// Coupons (discount codes)
+	coupons := admin.Group("/coupons")
+	coupons.POST("", couponHandler.CreateCoupon)
+	coupons.GET("", couponHandler.ListCoupons)
+	coupons.GET("/:id", couponHandler.GetCoupon)
+	coupons.PATCH("/:id", couponHandler.UpdateCoupon)
+	coupons.GET("/:id/redemptions", couponHandler.ListCouponRedemptions)
+
+	// Affiliates, their commissions and payouts
+	affiliates := admin.Group("/affiliates")
+	affiliates.POST("", affiliateHandler.CreateAffiliate)
+	affiliates.GET("", affiliateHandler.ListAffiliates)
+	affiliates.GET("/commissions", affiliateHandler.ListAffiliateCommissions)
+	affiliates.GET("/report", affiliateHandler.GetAffiliateReport)
+	affiliates.GET("/payouts", affiliateHandler.ListAffiliatePayouts)
+	affiliates.GET("/:id", affiliateHandler.GetAffiliate)
+	affiliates.PATCH("/:id", affiliateHandler.UpdateAffiliate)
+	affiliates.POST("/:id/payouts", affiliateHandler.CreateAffiliatePayout)
+
+	// Subscription plans and customer subscriptions
+	plans := admin.Group("/subscription-plans")
+	plans.POST("", subscriptionHandler.CreateSubscriptionPlan)
+	plans.GET("", subscriptionHandler.ListSubscriptionPlans)
+	plans.GET("/:id", subscriptionHandler.GetSubscriptionPlan)
+	plans.PATCH("/:id", subscriptionHandler.UpdateSubscriptionPlan)
+
+	adminSubscriptions := admin.Group("/subscriptions")
+	adminSubscriptions.GET("", subscriptionHandler.ListSubscriptions)
+	adminSubscriptions.GET("/:id", subscriptionHandler.GetSubscription)
+	adminSubscriptions.POST("/:id/cancel", subscriptionHandler.CancelSubscription)
+
+	// Inventory (by permission, so staff without the admin role can manage stock)
+	inventory := api.Group("/admin/inventory", requireUser)
+	inventory.POST("/adjustments", inventoryHandler.RecordStockAdjustment, ordersmiddleware.RequirePermission("inventory.write"))
+	inventory.GET("/products/:productId/ledger", inventoryHandler.GetStockLedger, ordersmiddleware.RequirePermission("inventory.read"))
+	inventory.POST("/reconciliations", inventoryHandler.ReconcileStock, ordersmiddleware.RequirePermission("inventory.write"))
+	inventory.GET("/reconciliations", inventoryHandler.ListStockReconciliations, ordersmiddleware.RequirePermission("inventory.read"))
+
+	// Merchant webhooks (order events for fulfillment partners)
+	webhooks := admin.Group("/webhooks")
+	webhooks.POST("", webhookHandler.CreateWebhookEndpoint)
+	webhooks.GET("", webhookHandler.ListWebhookEndpoints)
+	webhooks.GET("/:id", webhookHandler.GetWebhookEndpoint)
+	webhooks.PATCH("/:id", webhookHandler.UpdateWebhookEndpoint)
+	webhooks.DELETE("/:id", webhookHandler.DeleteWebhookEndpoint)
+	webhooks.GET("/:id/deliveries", webhookHandler.ListWebhookDeliveries)
+	webhooks.POST("/:id/deliveries/:deliveryId/redeliver", webhookHandler.RedeliverWebhook)
+
+	// Fraud and velocity checks
+	risk := admin.Group("/risk")
+	risk.GET("/blocklist", riskHandler.ListBlocklist)
+	risk.POST("/blocklist", riskHandler.AddBlocklistEntry)
+	risk.DELETE("/blocklist/:id", riskHandler.DeleteBlocklistEntry)
+	risk.GET("/reviews", riskHandler.ListRiskReviews)
+	risk.POST("/reviews/:id/approve", riskHandler.ApproveRiskReview)
+	risk.POST("/reviews/:id/reject", riskHandler.RejectRiskReview)
+	risk.GET("/rejections", riskHandler.ListRiskRejections)
+
+	// Domain settings
+	settings := admin.Group("/settings")
+	settings.GET("/order-numbers", settingsHandler.GetOrderNumberFormat)
+	settings.PUT("/order-numbers", settingsHandler.UpdateOrderNumberFormat)
+	settings.GET("/checkout", settingsHandler.GetCheckoutSettings)
+	settings.PUT("/checkout", settingsHandler.UpdateCheckoutSettings)
+	settings.GET("/risk", riskHandler.GetRiskSettings)
+	settings.PUT("/risk", riskHandler.UpdateRiskSettings)
+	settings.GET("/loyalty", loyaltyHandler.GetLoyaltySettings)
+	settings.PUT("/loyalty", loyaltyHandler.UpdateLoyaltySettings)
+	settings.GET("/affiliates", affiliateHandler.GetAffiliateSettings)
+	settings.PUT("/affiliates", affiliateHandler.UpdateAffiliateSettings)
+	settings.GET("/retention", retentionHandler.GetRetentionSettings)
+	settings.PUT("/retention", retentionHandler.UpdateRetentionSettings)
 
 	// Start server
-	address := fmt.Sprintf(":%s", port)
-	log.Printf("🚀 Orders Module starting on port %s", port)
-	if err := e.Start(address); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		address := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+		log.Printf("🚀 Orders Module starting on %s", address)
+		if err := e.Start(address); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt or termination signal to shut down gracefully
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down server...")
+
+	// Let in-flight requests finish, then stop the workers after their current pass
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("ERROR: Server shutdown: %v", err)
 	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("⚠️  Background workers didn't stop in time")
+	}
+
+	log.Println("✅ Server stopped")
 }
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var stockCmd = &cobra.Command{
+	Use:   "stock",
+	Short: "Manage variant stock",
+	Long:  `Record restocks, adjustments and returns. Each change updates the variant stock in products_module and is written to the stock_transactions ledger.`,
+}
+
+var restockCmd = &cobra.Command{
+	Use:   "restock",
+	Short: "Add received stock to a variant",
+	Run: func(cmd *cobra.Command, args []string) {
+		runStockChange(cmd, "restock")
+	},
+}
+
+var adjustStockCmd = &cobra.Command{
+	Use:   "adjust",
+	Short: "Correct a variant's stock (damage, count differences, ...)",
+	Long:  `Adds --quantity to the variant stock. Use a negative quantity to remove stock, e.g. --quantity=-2. A --reason is required.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runStockChange(cmd, "adjustment")
+	},
+}
+
+var returnStockCmd = &cobra.Command{
+	Use:   "return",
+	Short: "Put returned items back into stock",
+	Run: func(cmd *cobra.Command, args []string) {
+		runStockChange(cmd, "return")
+	},
+}
+
+var reconcileStockCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Compare the stock ledger with catalog stock",
+	Long: `Replays stock_transactions per variant and compares the result with the variant stock in products_module.
+Without --domain every domain is checked. With --fix an adjustment transaction is recorded for each discrepancy so the ledger matches the catalog again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, _ := cmd.Flags().GetString("domain")
+		fix, _ := cmd.Flags().GetBool("fix")
+		createdBy, _ := cmd.Flags().GetString("created-by")
+
+		db := connectDatabase()
+		defer db.Close()
+
+		reconciliationService := services.NewReconciliationService(db)
+		ctx := context.Background()
+
+		var reports []*models.StockReconciliation
+		if domain != "" {
+			report, err := reconciliationService.Reconcile(ctx, domain, fix, createdBy)
+			if err != nil {
+				log.Fatalf("❌ Reconciliation failed: %v", err)
+			}
+			reports = append(reports, report)
+		} else {
+			var err error
+			reports, err = reconciliationService.ReconcileAll(ctx, fix, createdBy)
+			if err != nil {
+				log.Fatalf("❌ Reconciliation failed: %v", err)
+			}
+		}
+
+		for _, report := range reports {
+			fmt.Printf("\n📦 %s: %d variants checked, %d without ledger entries\n", report.Domain, report.VariantsChecked, report.UntrackedVariants)
+			if len(report.Discrepancies) == 0 {
+				fmt.Println("✅ Ledger matches catalog stock")
+				continue
+			}
+
+			fmt.Printf("⚠️  %d discrepancies:\n", len(report.Discrepancies))
+			for _, d := range report.Discrepancies {
+				fmt.Printf("  %s (%s / %s): ledger %d, catalog %d (%+d)", d.ProductName, d.ProductID, d.VariantID, d.LedgerStock, d.CatalogStock, d.Difference)
+				if d.TransactionID != "" {
+					fmt.Printf(" → corrected (%s)", d.TransactionID)
+				}
+				fmt.Println()
+			}
+		}
+	},
+}
+
+var stockHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show a product's stock ledger",
+	Long:  `Lists the stock transactions of a product (or one variant) oldest first, with the variant's stock after each one. Sales recorded before the ledger tracked stock levels are left out.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, _ := cmd.Flags().GetString("domain")
+		productID, _ := cmd.Flags().GetString("product")
+		variantID, _ := cmd.Flags().GetString("variant")
+		fromValue, _ := cmd.Flags().GetString("from")
+		toValue, _ := cmd.Flags().GetString("to")
+
+		if domain == "" || productID == "" {
+			log.Fatal("❌ --domain and --product are required")
+		}
+		from := parseDateFlag("from", fromValue, false)
+		to := parseDateFlag("to", toValue, true)
+
+		db := connectDatabase()
+		defer db.Close()
+
+		ledger, err := services.NewStockService(db).GetLedger(context.Background(), domain, productID, variantID, from, to)
+		if err != nil {
+			log.Fatalf("❌ Failed to get stock ledger: %v", err)
+		}
+
+		if len(ledger.OpeningBalances) > 0 {
+			printBalances("Opening balances", ledger.OpeningBalances)
+		}
+
+		if len(ledger.Entries) == 0 {
+			fmt.Println("\nNo stock transactions found")
+			return
+		}
+
+		fmt.Printf("\n%-17s %-24s %-11s %6s %8s %-16s %s\n", "DATE", "VARIANT", "TYPE", "QTY", "BALANCE", "ORDER", "REASON")
+		fmt.Println(strings.Repeat("-", 110))
+		for _, e := range ledger.Entries {
+			fmt.Printf("%-17s %-24s %-11s %+6d %8d %-16s %s\n",
+				e.CreatedAt.Format("2006-01-02 15:04"),
+				e.VariantID,
+				e.Type,
+				e.Quantity,
+				e.Balance,
+				e.OrderNumber,
+				e.Reason,
+			)
+		}
+
+		printBalances("Closing balances", ledger.ClosingBalances)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stockCmd)
+
+	stockCmd.AddCommand(stockHistoryCmd)
+	stockHistoryCmd.Flags().String("domain", "", "Domain name (e.g., example.com)")
+	stockHistoryCmd.Flags().String("product", "", "Product ID")
+	stockHistoryCmd.Flags().String("variant", "", "Variant ID (default: all variants)")
+	stockHistoryCmd.Flags().String("from", "", "Transactions on or after (YYYY-MM-DD or RFC 3339)")
+	stockHistoryCmd.Flags().String("to", "", "Transactions on or before (YYYY-MM-DD or RFC 3339)")
+
+	stockCmd.AddCommand(reconcileStockCmd)
+	reconcileStockCmd.Flags().String("domain", "", "Domain name (default: all domains)")
+	reconcileStockCmd.Flags().Bool("fix", false, "Record corrective adjustments for discrepancies")
+	reconcileStockCmd.Flags().String("created-by", "cli", "Who made the change")
+
+	for _, c := range []*cobra.Command{restockCmd, adjustStockCmd, returnStockCmd} {
+		stockCmd.AddCommand(c)
+		c.Flags().String("domain", "", "Domain name (e.g., example.com)")
+		c.Flags().String("product", "", "Product ID")
+		c.Flags().String("variant", "", "Variant ID")
+		c.Flags().Int("quantity", 0, "Quantity to add (negative to remove, adjust only)")
+		c.Flags().String("reason", "", "Reason for the change")
+		c.Flags().String("created-by", "cli", "Who made the change")
+	}
+	returnStockCmd.Flags().String("order", "", "Order ID the items were returned from")
+}
+
+func runStockChange(cmd *cobra.Command, txType string) {
+	domain, _ := cmd.Flags().GetString("domain")
+	productID, _ := cmd.Flags().GetString("product")
+	variantID, _ := cmd.Flags().GetString("variant")
+	quantity, _ := cmd.Flags().GetInt("quantity")
+	reason, _ := cmd.Flags().GetString("reason")
+	createdBy, _ := cmd.Flags().GetString("created-by")
+	orderID, _ := cmd.Flags().GetString("order")
+
+	if domain == "" || productID == "" || variantID == "" {
+		log.Fatal("❌ --domain, --product and --variant are required")
+	}
+
+	db := connectDatabase()
+	defer db.Close()
+
+	stockService := services.NewStockService(db)
+	tx, err := stockService.RecordAdjustment(context.Background(), &models.StockAdjustmentRequest{
+		ProductID: productID,
+		VariantID: variantID,
+		Type:      txType,
+		Quantity:  quantity,
+		Reason:    reason,
+		OrderID:   orderID,
+	}, domain, createdBy)
+	if err != nil {
+		log.Fatalf("❌ Failed to record %s: %v", txType, err)
+	}
+
+	fmt.Printf("\n✅ Recorded %s of %+d\n\n", tx.Type, tx.Quantity)
+	fmt.Printf("Product: %s\n", tx.ProductID)
+	fmt.Printf("Variant: %s\n", tx.VariantID)
+	fmt.Printf("Stock: %d → %d\n", tx.StockBefore, tx.StockAfter)
+	if tx.OrderNumber != "" {
+		fmt.Printf("Order: %s\n", tx.OrderNumber)
+	}
+	if tx.Reason != "" {
+		fmt.Printf("Reason: %s\n", tx.Reason)
+	}
+	fmt.Printf("Transaction ID: %s\n", tx.ID.Hex())
+}
+
+// printBalances prints ledger balances per variant
+func printBalances(title string, balances map[string]int) {
+	variants := make([]string, 0, len(balances))
+	for variant := range balances {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+
+	fmt.Printf("\n%s:\n", title)
+	for _, variant := range variants {
+		fmt.Printf("  %s: %d\n", variant, balances[variant])
+	}
+}
+
+// connectDatabase connects to MongoDB using the same settings as the server
+func connectDatabase() *database.MongoDB {
+	db, err := database.Connect(cfg.MongoDB.URI, cfg.MongoDB.Database, cfg.Products.Database, cfg.Auth.Database)
+	if err != nil {
+		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Config holds all configuration
+type Config struct {
+	Server        ServerConfig        `mapstructure:"server"`
+	MongoDB       MongoDBConfig       `mapstructure:"mongodb"`
+	Products      ProductsConfig      `mapstructure:"products"`
+	Auth          AuthConfig          `mapstructure:"auth"`
+	JWT           JWTConfig           `mapstructure:"jwt"`
+	Stripe        StripeConfig        `mapstructure:"stripe"`
+	Orders        OrdersConfig        `mapstructure:"orders"`
+	Email         EmailConfig         `mapstructure:"email"`
+	PaymentLinks  PaymentLinksConfig  `mapstructure:"payment_links"`
+	Inventory     InventoryConfig     `mapstructure:"inventory"`
+	Subscriptions SubscriptionsConfig `mapstructure:"subscriptions"`
+	Retention     RetentionConfig     `mapstructure:"retention"`
+	Tenant        TenantConfig        `mapstructure:"tenant"`
+}
+
+// ServerConfig holds server settings
+type ServerConfig struct {
+	Host            string        `mapstructure:"host"`
+	Port            string        `mapstructure:"port"`
+	Env             string        `mapstructure:"env"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"` // How long in-flight requests get to finish
+}
+
+// MongoDBConfig holds MongoDB connection settings
+type MongoDBConfig struct {
+	URI      string `mapstructure:"uri"`
+	Database string `mapstructure:"database"`
+}
+
+// ProductsConfig points at the products_module database (catalog prices and stock)
+type ProductsConfig struct {
+	Database string `mapstructure:"database"`
+}
+
+// AuthConfig points at the auth_module database (invitation claims)
+type AuthConfig struct {
+	Database string `mapstructure:"database"`
+}
+
+// JWTConfig holds JWT settings (shared secret with auth_module)
+type JWTConfig struct {
+	Secret string `mapstructure:"secret"`
+}
+
+// StripeConfig holds Stripe API keys
+type StripeConfig struct {
+	SecretKey      string `mapstructure:"secret_key"`
+	WebhookSecret  string `mapstructure:"webhook_secret"`
+	PublishableKey string `mapstructure:"publishable_key"` // For reference (used in frontend)
+}
+
+// OrdersConfig holds order lifecycle settings
+type OrdersConfig struct {
+	PendingExpiry time.Duration `mapstructure:"pending_expiry"` // Unpaid orders older than this are cancelled, 0 disables
+}
+
+// EmailConfig holds outgoing email settings. Without an SMTP host emails are logged.
+type EmailConfig struct {
+	SMTP        SMTPConfig `mapstructure:"smtp"`
+	FromAddress string     `mapstructure:"from_address"`
+}
+
+// SMTPConfig holds SMTP server settings
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+}
+
+// PaymentLinksConfig holds draft order payment link settings
+type PaymentLinksConfig struct {
+	URL         string `mapstructure:"url"` // {domain} and {token} are replaced
+	ExpiryHours int    `mapstructure:"expiry_hours"`
+}
+
+// InventoryConfig holds stock settings
+type InventoryConfig struct {
+	Reconciliation ReconciliationConfig `mapstructure:"reconciliation"`
+}
+
+// ReconciliationConfig schedules the stock ledger reconciliation
+type ReconciliationConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // 0 disables the scheduled job
+	Fix      bool          `mapstructure:"fix"`
+}
+
+// SubscriptionsConfig holds subscription renewal settings
+type SubscriptionsConfig struct {
+	SchedulerInterval time.Duration `mapstructure:"scheduler_interval"`
+}
+
+// RetentionConfig schedules the per-domain PII retention policies
+type RetentionConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // 0 disables the scheduled job
+}
+
+// TenantConfig holds multi-tenant settings
+type TenantConfig struct {
+	DefaultDomain string `mapstructure:"default_domain"` // Used when a request has no Host header
+}
+
+// Load reads configuration from file and environment variables
+// (ORDERS_ prefix, e.g. ORDERS_STRIPE_SECRET_KEY for stripe.secret_key)
+func Load(configPath string) (*Config, error) {
+	v := viper.New()
+
+	if configPath != "" {
+		v.SetConfigFile(configPath)
+	} else {
+		v.SetConfigName("config")
+		v.SetConfigType("yaml")
+		v.AddConfigPath(".")
+		v.AddConfigPath("./config")
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		log.Println("No config file found, using environment variables and defaults")
+	} else {
+		log.Printf("✅ Config file loaded: %s", v.ConfigFileUsed())
+	}
+
+	// Environment variables override config file
+	v.SetEnvPrefix("ORDERS")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	// Every key needs a default so environment variables are picked up
+	setDefaults(v)
+
+	// An empty interval or expiry disables the scheduled job
+	if v.GetString("inventory.reconciliation.interval") == "" {
+		v.Set("inventory.reconciliation.interval", "0s")
+	}
+	if v.GetString("retention.interval") == "" {
+		v.Set("retention.interval", "0s")
+	}
+	if v.GetString("orders.pending_expiry") == "" {
+		v.Set("orders.pending_expiry", "0s")
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+func setDefaults(v *viper.Viper) {
+	// Server defaults
+	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.port", "9092")
+	v.SetDefault("server.env", "development")
+	v.SetDefault("server.shutdown_timeout", "15s")
+
+	// Database defaults
+	v.SetDefault("mongodb.uri", "mongodb://localhost:27017")
+	v.SetDefault("mongodb.database", "orders_module")
+	v.SetDefault("products.database", "products_module")
+	v.SetDefault("auth.database", "auth_module")
+
+	// Secrets (no usable defaults, validated before serving)
+	v.SetDefault("jwt.secret", "")
+	v.SetDefault("stripe.secret_key", "")
+	v.SetDefault("stripe.webhook_secret", "")
+	v.SetDefault("stripe.publishable_key", "")
+
+	// Email defaults
+	v.SetDefault("email.smtp.host", "")
+	v.SetDefault("email.smtp.port", 587)
+	v.SetDefault("email.smtp.user", "")
+	v.SetDefault("email.smtp.password", "")
+	v.SetDefault("email.from_address", "")
+
+	// Payment link defaults
+	v.SetDefault("payment_links.url", "https://{domain}/pay.html?token={token}")
+	v.SetDefault("payment_links.expiry_hours", 72)
+
+	// Background job defaults
+	v.SetDefault("inventory.reconciliation.interval", "0s")
+	v.SetDefault("inventory.reconciliation.fix", false)
+	v.SetDefault("subscriptions.scheduler_interval", "5m")
+	v.SetDefault("retention.interval", "24h")
+	v.SetDefault("orders.pending_expiry", "72h")
+
+	// Tenant defaults
+	v.SetDefault("tenant.default_domain", "oilyourhair.com")
+}
+
+// Validate checks everything the server needs and reports all problems at once
+func (c *Config) Validate() error {
+	var problems []string
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port %q is not a valid port", c.Server.Port))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+
+	if c.MongoDB.URI == "" {
+		problems = append(problems, "mongodb.uri is required")
+	}
+	if c.MongoDB.Database == "" {
+		problems = append(problems, "mongodb.database is required")
+	}
+	if c.Products.Database == "" {
+		problems = append(problems, "products.database is required")
+	}
+	if c.Auth.Database == "" {
+		problems = append(problems, "auth.database is required")
+	}
+
+	if c.JWT.Secret == "" {
+		problems = append(problems, "jwt.secret is required (must match auth_module)")
+	}
+	if c.Stripe.SecretKey == "" {
+		problems = append(problems, "stripe.secret_key is required")
+	} else if !strings.HasPrefix(c.Stripe.SecretKey, "sk_") && !strings.HasPrefix(c.Stripe.SecretKey, "rk_") {
+		problems = append(problems, "stripe.secret_key must be a secret (sk_) or restricted (rk_) key")
+	}
+
+	if c.Email.SMTP.Host != "" {
+		if c.Email.SMTP.Port < 1 || c.Email.SMTP.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("email.smtp.port %d is not a valid port", c.Email.SMTP.Port))
+		}
+		if _, err := mail.ParseAddress(c.Email.FromAddress); err != nil {
+			problems = append(problems, "email.from_address must be a valid address when email.smtp.host is set")
+		}
+	}
+
+	if !strings.Contains(c.PaymentLinks.URL, "{token}") {
+		problems = append(problems, "payment_links.url must contain {token}")
+	}
+	if c.PaymentLinks.ExpiryHours <= 0 {
+		problems = append(problems, "payment_links.expiry_hours must be positive")
+	}
+
+	if c.Inventory.Reconciliation.Interval < 0 {
+		problems = append(problems, "inventory.reconciliation.interval can't be negative")
+	}
+	if c.Subscriptions.SchedulerInterval <= 0 {
+		problems = append(problems, "subscriptions.scheduler_interval must be positive")
+	}
+	if c.Retention.Interval < 0 {
+		problems = append(problems, "retention.interval can't be negative")
+	}
+	if c.Orders.PendingExpiry < 0 {
+		problems = append(problems, "orders.pending_expiry can't be negative")
+	}
+
+	if c.Tenant.DefaultDomain == "" {
+		problems = append(problems, "tenant.default_domain is required")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
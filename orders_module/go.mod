@@ -3,6 +3,8 @@ module github.com/sparque/orders_module
 go 1.24.0
 
 require (
+	github.com/go-pdf/fpdf v0.9.0
+	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/labstack/echo/v4 v4.12.0
 	github.com/spf13/cobra v1.10.2
 	github.com/spf13/viper v1.20.1
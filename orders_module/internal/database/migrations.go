@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RenumberedOrder is an order whose duplicate order number was changed
+type RenumberedOrder struct {
+	Domain  string
+	OrderID string
+	From    string
+	To      string
+}
+
+// DuplicateEarn is an order that earned loyalty points more than once
+type DuplicateEarn struct {
+	Domain  string
+	OrderID string
+	Earns   int
+}
+
+// duplicateGroup is a set of documents sharing a value that should be unique
+type duplicateGroup struct {
+	Key struct {
+		Domain      string `bson:"domain"`
+		OrderNumber string `bson:"order_number"`
+		OrderID     string `bson:"order_id"`
+	} `bson:"_id"`
+	IDs   []primitive.ObjectID `bson:"ids"`
+	Count int                  `bson:"count"`
+}
+
+// DedupeOrderNumbers gives orders that share an order number within a
+// domain a unique one: the oldest keeps it, the others get a -2, -3, ...
+// suffix. Safe to run again.
+func (m *MongoDB) DedupeOrderNumbers(ctx context.Context) ([]RenumberedOrder, error) {
+	collection := m.GetCollection("orders")
+
+	groups, err := findDuplicates(ctx, collection, bson.M{"order_number": bson.M{"$exists": true, "$ne": ""}},
+		bson.M{"domain": "$domain", "order_number": "$order_number"})
+	if err != nil {
+		return nil, err
+	}
+
+	var renumbered []RenumberedOrder
+	for _, group := range groups {
+		suffix := 2
+		for _, id := range group.IDs[1:] {
+			// Skip suffixes already taken by another order
+			var number string
+			for {
+				number = fmt.Sprintf("%s-%d", group.Key.OrderNumber, suffix)
+				suffix++
+				taken, err := collection.CountDocuments(ctx, bson.M{"domain": group.Key.Domain, "order_number": number})
+				if err != nil {
+					return renumbered, fmt.Errorf("failed to check order number %s: %w", number, err)
+				}
+				if taken == 0 {
+					break
+				}
+			}
+
+			_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+				"$set": bson.M{"order_number": number, "updated_at": time.Now()},
+			})
+			if err != nil {
+				return renumbered, fmt.Errorf("failed to renumber order %s: %w", id.Hex(), err)
+			}
+			renumbered = append(renumbered, RenumberedOrder{
+				Domain:  group.Key.Domain,
+				OrderID: id.Hex(),
+				From:    group.Key.OrderNumber,
+				To:      number,
+			})
+		}
+	}
+
+	return renumbered, nil
+}
+
+// DuplicateEarns lists the orders that earned loyalty points more than once.
+// They're left for an admin to correct, since the extra points may already
+// have been spent.
+func (m *MongoDB) DuplicateEarns(ctx context.Context) ([]DuplicateEarn, error) {
+	groups, err := findDuplicates(ctx, m.GetCollection("loyalty_transactions"), bson.M{"type": "earn"},
+		bson.M{"domain": "$domain", "order_id": "$order_id"})
+	if err != nil {
+		return nil, err
+	}
+
+	earns := make([]DuplicateEarn, 0, len(groups))
+	for _, group := range groups {
+		earns = append(earns, DuplicateEarn{
+			Domain:  group.Key.Domain,
+			OrderID: group.Key.OrderID,
+			Earns:   group.Count,
+		})
+	}
+	return earns, nil
+}
+
+// findDuplicates groups the documents matching filter by key and returns the
+// groups with more than one document, their IDs oldest first
+func findDuplicates(ctx context.Context, collection *mongo.Collection, filter, key bson.M) ([]duplicateGroup, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   key,
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicates in %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var groups []duplicateGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode duplicates in %s: %w", collection.Name(), err)
+	}
+	return groups, nil
+}
@@ -3,19 +3,23 @@ package database
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MongoDB struct {
-	Client   *mongo.Client
-	Database *mongo.Database
+	Client     *mongo.Client
+	Database   *mongo.Database
+	ProductsDB *mongo.Database // products_module database (catalog and variant stock)
+	AuthDB     *mongo.Database // auth_module database (invitation claims, read only)
 }
 
 // Connect establishes connection to MongoDB
-func Connect(uri, dbName string) (*MongoDB, error) {
+func Connect(uri, dbName, productsDBName, authDBName string) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -31,12 +35,397 @@ func Connect(uri, dbName string) (*MongoDB, error) {
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	db := client.Database(dbName)
+	db := &MongoDB{
+		Client:     client,
+		Database:   client.Database(dbName),
+		ProductsDB: client.Database(productsDBName),
+		AuthDB:     client.Database(authDBName),
+	}
+
+	// Create indexes
+	if err := db.createIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	return db, nil
+}
+
+// uniqueIndexes were added to collections that may already hold documents
+// breaking them. Duplicates don't stop the server from starting: the index
+// is skipped with a warning until `db migrate` cleans them up.
+var uniqueIndexes = []struct {
+	Collection  string
+	Description string
+	Model       mongo.IndexModel
+}{
+	{
+		// Order numbers are unique per domain
+		Collection:  "orders",
+		Description: "domain/order_number",
+		Model: mongo.IndexModel{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "order_number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	},
+	{
+		// Loyalty points are earned once per order
+		Collection:  "loyalty_transactions",
+		Description: "earn per order",
+		Model: mongo.IndexModel{
+			Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}, {Key: "type", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"type": "earn",
+			}),
+		},
+	},
+}
 
-	return &MongoDB{
-		Client:   client,
-		Database: db,
-	}, nil
+// CreateUniqueIndexes creates the unique indexes of uniqueIndexes and returns
+// the ones that couldn't be created because of duplicates
+func (m *MongoDB) CreateUniqueIndexes(ctx context.Context) ([]string, error) {
+	var skipped []string
+	for _, index := range uniqueIndexes {
+		_, err := m.GetCollection(index.Collection).Indexes().CreateOne(ctx, index.Model)
+		if mongo.IsDuplicateKeyError(err) {
+			skipped = append(skipped, index.Collection+" "+index.Description)
+			continue
+		}
+		if err != nil {
+			return skipped, fmt.Errorf("failed to create %s %s index: %w", index.Collection, index.Description, err)
+		}
+	}
+	return skipped, nil
+}
+
+// createIndexes creates required database indexes
+func (m *MongoDB) createIndexes(ctx context.Context) error {
+	skipped, err := m.CreateUniqueIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, index := range skipped {
+		log.Printf("⚠️  Unique index %s not created, the collection has duplicates: run `orders-module db migrate`", index)
+	}
+
+	// Stock transactions: ledger queries per product/variant in time order
+	_, err = m.GetCollection("stock_transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "domain", Value: 1},
+			{Key: "product_id", Value: 1},
+			{Key: "variant_id", Value: 1},
+			{Key: "created_at", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock_transactions ledger index: %w", err)
+	}
+
+	// Stock reconciliations: latest reports per domain
+	_, err = m.GetCollection("stock_reconciliations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "started_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock_reconciliations index: %w", err)
+	}
+
+	// Webhook endpoints: active endpoints per domain and event
+	_, err = m.GetCollection("webhook_endpoints").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "active", Value: 1}, {Key: "events", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook_endpoints index: %w", err)
+	}
+
+	// Webhook deliveries: due retries and the per-endpoint log
+	_, err = m.GetCollection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "endpoint_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook_deliveries indexes: %w", err)
+	}
+
+	// Orders: velocity counts per email, IP and card, and the review queue
+	_, err = m.GetCollection("orders").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "customer.email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "risk.email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "risk.ip", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "risk.card_fingerprint", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "risk.review_status", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders risk indexes: %w", err)
+	}
+
+	// Orders: listings and exports by status
+	_, err = m.GetCollection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders status index: %w", err)
+	}
+
+	// Payment customers: one Stripe Customer per user per domain
+	_, err = m.GetCollection("payment_customers").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create payment_customers index: %w", err)
+	}
+
+	// Risk blocklist: one entry per value
+	_, err = m.GetCollection("risk_blocklist").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "type", Value: 1}, {Key: "value", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create risk_blocklist index: %w", err)
+	}
+
+	// Risk rejections: latest per domain
+	_, err = m.GetCollection("risk_rejections").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create risk_rejections index: %w", err)
+	}
+
+	// Loyalty: one balance per customer, ledger per customer/order, bonuses
+	// once per reference (points earned once per order: uniqueIndexes)
+	_, err = m.GetCollection("loyalty_accounts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create loyalty_accounts index: %w", err)
+	}
+
+	_, err = m.GetCollection("loyalty_transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "domain", Value: 1}, {Key: "reference", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"reference": bson.M{"$exists": true},
+			}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create loyalty_transactions indexes: %w", err)
+	}
+
+	// Subscription plans: per product
+	_, err = m.GetCollection("subscription_plans").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "product_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscription_plans index: %w", err)
+	}
+
+	// Subscriptions: due renewals for the scheduler, and per customer
+	_, err = m.GetCollection("subscriptions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "customer.user_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscriptions indexes: %w", err)
+	}
+
+	// Gift cards: unique codes, cards issued once per order line unit, due
+	// emails for the delivery worker
+	_, err = m.GetCollection("gift_cards").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "source", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"source": bson.M{"$exists": true},
+			}),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "delivery_status", Value: 1}, {Key: "deliver_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create gift_cards indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("gift_card_transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "gift_card_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create gift_card_transactions indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("coupons").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create coupons indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("coupon_redemptions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "coupon_id", Value: 1}, {Key: "customer_key", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create coupon_redemptions indexes: %w", err)
+	}
+
+	// Coupon customer uses: one counter per customer per coupon
+	_, err = m.GetCollection("coupon_customer_uses").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "coupon_id", Value: 1}, {Key: "customer_key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create coupon_customer_uses index: %w", err)
+	}
+
+	_, err = m.GetCollection("invitation_discounts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}, {Key: "invitation_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "order_ids", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invitation_discounts indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("affiliates").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create affiliates indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("affiliate_commissions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// One accrual per order
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "order_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"type": "accrual"}),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "affiliate_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "customer_user_id", Value: 1}, {Key: "type", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "payout_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create affiliate_commissions indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("affiliate_payouts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "affiliate_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create affiliate_payouts indexes: %w", err)
+	}
+
+	// Customer profiles: one per customer, listed by spend or recency
+	_, err = m.GetCollection("customer_profiles").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "lifetime_spend", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "last_order_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create customer_profiles indexes: %w", err)
+	}
+
+	// Orders: a logged-in customer's orders (profiles and order history)
+	_, err = m.GetCollection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "customer.user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders customer index: %w", err)
+	}
+
+	// Orders: retention scans by age
+	_, err = m.GetCollection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders retention index: %w", err)
+	}
+
+	// Orders: payment intent lookups (webhooks, payout reconciliation)
+	_, err = m.GetCollection("orders").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "payment.payment_intent_id", Value: 1}}},
+		{Keys: bson.D{{Key: "payment_adjustments.payment_intent_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders payment intent indexes: %w", err)
+	}
+
+	// Orders: Checkout Session lookups (checkout.session.* webhooks)
+	_, err = m.GetCollection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "payment.checkout_session_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create orders checkout session index: %w", err)
+	}
+
+	// Payout reconciliation: a payout's problems and an order's transactions
+	_, err = m.GetCollection("stripe_payouts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "arrival_date", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stripe_payouts index: %w", err)
+	}
+
+	_, err = m.GetCollection("balance_transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "payout_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create balance_transactions indexes: %w", err)
+	}
+
+	_, err = m.GetCollection("anonymization_audits").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create anonymization_audits index: %w", err)
+	}
+
+	// Carts: one per customer or anonymous token, anonymous carts expire
+	_, err = m.GetCollection("carts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"user_id": bson.M{"$exists": true},
+			}),
+		},
+		{
+			Keys: bson.D{{Key: "domain", Value: 1}, {Key: "token", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"token": bson.M{"$exists": true},
+			}),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create carts indexes: %w", err)
+	}
+
+	return nil
 }
 
 // Close closes the MongoDB connection
@@ -50,3 +439,13 @@ func (m *MongoDB) Close() error {
 func (m *MongoDB) GetCollection(name string) *mongo.Collection {
 	return m.Database.Collection(name)
 }
+
+// GetProductsCollection returns a collection from the products_module database
+func (m *MongoDB) GetProductsCollection(name string) *mongo.Collection {
+	return m.ProductsDB.Collection(name)
+}
+
+// GetAuthCollection returns a collection from the auth_module database
+func (m *MongoDB) GetAuthCollection(name string) *mongo.Collection {
+	return m.AuthDB.Collection(name)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type AddressHandler struct {
+	addressService *services.AddressService
+}
+
+func NewAddressHandler(db *database.MongoDB) *AddressHandler {
+	return &AddressHandler{
+		addressService: services.NewAddressService(db),
+	}
+}
+
+// ListAddresses lists the logged-in customer's address book
+func (h *AddressHandler) ListAddresses(c echo.Context) error {
+	userID, _ := c.Get("user_id").(string)
+	domain, _ := c.Get("domain").(string)
+
+	addresses, err := h.addressService.ListAddresses(c.Request().Context(), userID, domain)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"addresses": addresses,
+		"count":     len(addresses),
+	})
+}
+
+// GetAddress retrieves a saved address
+func (h *AddressHandler) GetAddress(c echo.Context) error {
+	userID, _ := c.Get("user_id").(string)
+	domain, _ := c.Get("domain").(string)
+
+	address, err := h.addressService.GetAddress(c.Request().Context(), c.Param("id"), userID, domain)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, address)
+}
+
+// CreateAddress saves a new address to the address book
+func (h *AddressHandler) CreateAddress(c echo.Context) error {
+	userID, _ := c.Get("user_id").(string)
+	domain, _ := c.Get("domain").(string)
+
+	var req models.CreateAddressRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	address, err := h.addressService.CreateAddress(c.Request().Context(), &req, userID, domain)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, address)
+}
+
+// UpdateAddress updates a saved address or its default flags
+func (h *AddressHandler) UpdateAddress(c echo.Context) error {
+	userID, _ := c.Get("user_id").(string)
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateAddressRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	address, err := h.addressService.UpdateAddress(c.Request().Context(), c.Param("id"), &req, userID, domain)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, address)
+}
+
+// DeleteAddress removes a saved address
+func (h *AddressHandler) DeleteAddress(c echo.Context) error {
+	userID, _ := c.Get("user_id").(string)
+	domain, _ := c.Get("domain").(string)
+
+	if err := h.addressService.DeleteAddress(c.Request().Context(), c.Param("id"), userID, domain); err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Address deleted successfully",
+	})
+}
+
+// addressError maps address service errors to HTTP responses
+func addressError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAddressNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidAddress):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
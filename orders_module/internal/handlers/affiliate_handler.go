@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type AffiliateHandler struct {
+	affiliateService *services.AffiliateService
+}
+
+func NewAffiliateHandler(affiliateService *services.AffiliateService) *AffiliateHandler {
+	return &AffiliateHandler{
+		affiliateService: affiliateService,
+	}
+}
+
+// GetMyAffiliateAccount returns the logged-in affiliate's balance and recent commissions
+func (h *AffiliateHandler) GetMyAffiliateAccount(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	summary, err := h.affiliateService.GetSummary(c.Request().Context(), domain, userID)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
+
+// CreateAffiliate adds a referrer account (admin only)
+func (h *AffiliateHandler) CreateAffiliate(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateAffiliateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	affiliate, err := h.affiliateService.CreateAffiliate(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, affiliate)
+}
+
+// ListAffiliates lists the domain's affiliates (?status=, ?limit=, default 100) (admin only)
+func (h *AffiliateHandler) ListAffiliates(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit, err := parseAffiliateLimit(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid limit",
+		})
+	}
+
+	affiliates, err := h.affiliateService.ListAffiliates(c.Request().Context(), domain, c.QueryParam("status"), limit)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"affiliates": affiliates,
+		"count":      len(affiliates),
+	})
+}
+
+// GetAffiliate retrieves an affiliate (admin only)
+func (h *AffiliateHandler) GetAffiliate(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	affiliate, err := h.affiliateService.GetAffiliate(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, affiliate)
+}
+
+// UpdateAffiliate changes an affiliate's details, rate or status (admin only)
+func (h *AffiliateHandler) UpdateAffiliate(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateAffiliateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	affiliate, err := h.affiliateService.UpdateAffiliate(c.Request().Context(), c.Param("id"), &req, domain)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, affiliate)
+}
+
+// ListAffiliateCommissions lists commission ledger entries, newest first
+// (?affiliate_id=, ?paid=true|false, ?from=/?to= as RFC 3339, ?limit=,
+// default 100). With ?format=csv every matching entry is exported (admin only)
+func (h *AffiliateHandler) ListAffiliateCommissions(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	filter := services.CommissionFilter{AffiliateID: c.QueryParam("affiliate_id")}
+	if value := c.QueryParam("paid"); value != "" {
+		paid := value == "true"
+		filter.Paid = &paid
+	}
+	if err := parsePeriod(c, &filter.From, &filter.To); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	csvExport := c.QueryParam("format") == "csv"
+	limit, err := parseAffiliateLimit(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid limit",
+		})
+	}
+	if csvExport && c.QueryParam("limit") == "" {
+		limit = 0
+	}
+
+	commissions, err := h.affiliateService.ListCommissions(c.Request().Context(), domain, filter, limit)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	if csvExport {
+		rows := [][]string{{"created_at", "affiliate_code", "type", "order_number", "customer_user_id", "base", "percent", "amount", "reason", "payout_id"}}
+		for _, entry := range commissions {
+			rows = append(rows, []string{
+				entry.CreatedAt.Format(time.RFC3339),
+				entry.AffiliateCode,
+				entry.Type,
+				entry.OrderNumber,
+				entry.CustomerUserID,
+				formatAmount(entry.Base),
+				strconv.FormatFloat(entry.Percent, 'f', -1, 64),
+				formatAmount(entry.Amount),
+				entry.Reason,
+				entry.PayoutID,
+			})
+		}
+		return writeCSV(c, "affiliate-commissions.csv", rows)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"commissions": commissions,
+		"count":       len(commissions),
+	})
+}
+
+// GetAffiliateReport sums commissions per affiliate for a period (?from=/?to=
+// as RFC 3339): accrued, reversed, paid and owed. ?format=csv exports it (admin only)
+func (h *AffiliateHandler) GetAffiliateReport(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var from, to time.Time
+	if err := parsePeriod(c, &from, &to); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	report, err := h.affiliateService.Report(c.Request().Context(), domain, from, to)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	if c.QueryParam("format") == "csv" {
+		rows := [][]string{{"affiliate_code", "affiliate_id", "orders", "accrued", "reversed", "net", "paid", "owed"}}
+		for _, line := range report.Affiliates {
+			rows = append(rows, []string{
+				line.AffiliateCode,
+				line.AffiliateID,
+				strconv.Itoa(line.Orders),
+				formatAmount(line.Accrued),
+				formatAmount(line.Reversed),
+				formatAmount(line.Net),
+				formatAmount(line.Paid),
+				formatAmount(line.Owed),
+			})
+		}
+		return writeCSV(c, "affiliate-report.csv", rows)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// CreateAffiliatePayout marks an affiliate's unpaid commissions up to
+// `through` as paid (admin only)
+func (h *AffiliateHandler) CreateAffiliatePayout(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateAffiliatePayoutRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	payout, err := h.affiliateService.CreatePayout(c.Request().Context(), c.Param("id"), &req, domain, userID)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, payout)
+}
+
+// ListAffiliatePayouts lists payouts, newest first (?affiliate_id=, ?limit=,
+// default 100) (admin only)
+func (h *AffiliateHandler) ListAffiliatePayouts(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit, err := parseAffiliateLimit(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid limit",
+		})
+	}
+
+	payouts, err := h.affiliateService.ListPayouts(c.Request().Context(), domain, c.QueryParam("affiliate_id"), limit)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"payouts": payouts,
+		"count":   len(payouts),
+	})
+}
+
+// GetAffiliateSettings returns the domain's affiliate program rules (admin only)
+func (h *AffiliateHandler) GetAffiliateSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	settings, err := h.affiliateService.GetSettings(c.Request().Context(), domain)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateAffiliateSettings changes the domain's affiliate program rules (admin only)
+func (h *AffiliateHandler) UpdateAffiliateSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateAffiliateSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	settings, err := h.affiliateService.UpdateSettings(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return affiliateError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+func parseAffiliateLimit(c echo.Context) (int64, error) {
+	value := c.QueryParam("limit")
+	if value == "" {
+		return 100, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 1 {
+		return 0, errors.New("invalid limit")
+	}
+	return limit, nil
+}
+
+// parsePeriod reads the optional ?from= and ?to= (RFC 3339) query parameters
+func parsePeriod(c echo.Context, from, to *time.Time) error {
+	for param, target := range map[string]*time.Time{"from": from, "to": to} {
+		if value := c.QueryParam(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("Invalid %s date, use RFC 3339", param)
+			}
+			*target = parsed
+		}
+	}
+	return nil
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// writeCSV sends rows as a CSV file download
+func writeCSV(c echo.Context, filename string, rows [][]string) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	return csv.NewWriter(c.Response()).WriteAll(rows)
+}
+
+func affiliateError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAffiliateNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidAffiliate):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
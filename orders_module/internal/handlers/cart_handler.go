@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+// cartCookie holds an anonymous shopper's cart token
+const cartCookie = "cart_token"
+
+type CartHandler struct {
+	cartService   *services.CartService
+	defaultDomain string
+}
+
+func NewCartHandler(cartService *services.CartService, defaultDomain string) *CartHandler {
+	return &CartHandler{
+		cartService:   cartService,
+		defaultDomain: defaultDomain,
+	}
+}
+
+// GetCart returns the shopper's cart with live prices and stock
+func (h *CartHandler) GetCart(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	cart, err := h.cartService.GetCart(c.Request().Context(), domain, userID, token)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+// AddCartItem adds a product to the cart. Anonymous shoppers get a cart
+// cookie on their first item.
+func (h *CartHandler) AddCartItem(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	var req models.AddCartItemRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	if userID == "" {
+		if token == "" {
+			if token, err = services.NewCartToken(); err != nil {
+				return cartError(c, err)
+			}
+		}
+		setCartCookie(c, token)
+	}
+
+	cart, err := h.cartService.AddItem(c.Request().Context(), &req, domain, userID, token)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+// UpdateCartItem changes a line's quantity (0 removes it)
+func (h *CartHandler) UpdateCartItem(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	var req models.UpdateCartItemRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	cart, err := h.cartService.UpdateItem(c.Request().Context(), c.Param("id"), req.Quantity, domain, userID, token)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCartItem removes a line from the cart
+func (h *CartHandler) RemoveCartItem(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	cart, err := h.cartService.UpdateItem(c.Request().Context(), c.Param("id"), 0, domain, userID, token)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+// ClearCart empties the cart
+func (h *CartHandler) ClearCart(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	if err := h.cartService.Clear(c.Request().Context(), domain, userID, token); err != nil {
+		return cartError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CheckoutCart turns the cart into an order and its payment, like
+// POST /orders with the cart's items
+func (h *CartHandler) CheckoutCart(c echo.Context) error {
+	domain, userID, token, err := h.shopper(c)
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	var req models.CheckoutCartRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Logged-in customers are identified by their token, never the request body
+	req.Customer.UserID = userID
+
+	order, err := h.cartService.Checkout(c.Request().Context(), &req, domain, token, c.RealIP())
+	if err != nil {
+		return cartError(c, err)
+	}
+
+	order.Risk = nil
+	return c.JSON(http.StatusCreated, order)
+}
+
+// shopper identifies the cart of the request: the logged-in customer's or
+// the anonymous one in the cart cookie. Once a shopper with a cart cookie
+// logs in, that cart is merged into theirs and the cookie cleared.
+func (h *CartHandler) shopper(c echo.Context) (domain, userID, token string, err error) {
+	// Same domain as POST /orders, which checkout goes through
+	domain = shopDomain(c, h.defaultDomain)
+	userID, _ = c.Get("user_id").(string)
+	if cookie, err := c.Cookie(cartCookie); err == nil {
+		token = cookie.Value
+	}
+
+	if userID != "" && token != "" {
+		if err := h.cartService.Merge(c.Request().Context(), domain, userID, token); err != nil {
+			return "", "", "", err
+		}
+		clearCartCookie(c)
+		token = ""
+	}
+
+	return domain, userID, token, nil
+}
+
+// setCartCookie (re)sets the anonymous cart cookie for as long as the cart is kept
+func setCartCookie(c echo.Context, token string) {
+	c.SetCookie(&http.Cookie{
+		Name:     cartCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(services.CartTTL / time.Second),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearCartCookie removes the anonymous cart cookie
+func clearCartCookie(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     cartCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func cartError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrCartItemNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidCart) || errors.Is(err, services.ErrProductNotFound) || errors.Is(err, services.ErrInvalidGiftCard) ||
+		errors.Is(err, services.ErrAddressNotFound) || errors.Is(err, services.ErrInvalidAddress) || errors.Is(err, services.ErrInvalidRedemption) ||
+		errors.Is(err, services.ErrGiftCardNotFound) || errors.Is(err, services.ErrCouponNotFound) || errors.Is(err, services.ErrCouponNotApplicable):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrOutOfStock):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrOrderRejected):
+		// Don't tell the customer which rule matched
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": "We couldn't place this order. Please contact us for help.",
+		})
+	}
+
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": err.Error(),
+	})
+}
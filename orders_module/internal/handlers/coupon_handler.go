@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewCouponHandler(couponService *services.CouponService) *CouponHandler {
+	return &CouponHandler{
+		couponService: couponService,
+	}
+}
+
+// ValidateCoupon checks a code against the cart and returns the discount it
+// would give. Nothing is reserved, the code is checked again at checkout.
+func (h *CouponHandler) ValidateCoupon(c echo.Context) error {
+	var req models.ValidateCouponRequest
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Coupon code is required",
+		})
+	}
+
+	// Logged-in customers are identified by their token, never the request body
+	req.Customer.UserID, _ = c.Get("user_id").(string)
+
+	_, quote, err := h.couponService.Quote(c.Request().Context(), c.Param("domain"), req.Code, req.Items, req.Customer)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
+
+// CreateCoupon creates a discount code (admin only)
+func (h *CouponHandler) CreateCoupon(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateCouponRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	coupon, err := h.couponService.CreateCoupon(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, coupon)
+}
+
+// ListCoupons lists the domain's coupons, newest first (?active=true,
+// ?limit=, default 100) (admin only)
+func (h *CouponHandler) ListCoupons(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit, err := parseCouponLimit(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid limit",
+		})
+	}
+
+	coupons, err := h.couponService.ListCoupons(c.Request().Context(), domain, c.QueryParam("active") == "true", limit)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"coupons": coupons,
+		"count":   len(coupons),
+	})
+}
+
+// GetCoupon retrieves a coupon (admin only)
+func (h *CouponHandler) GetCoupon(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	coupon, err := h.couponService.GetCoupon(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, coupon)
+}
+
+// UpdateCoupon changes a coupon's conditions and limits, or deactivates it
+// (admin only)
+func (h *CouponHandler) UpdateCoupon(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateCouponRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	coupon, err := h.couponService.UpdateCoupon(c.Request().Context(), c.Param("id"), &req, domain)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, coupon)
+}
+
+// ListCouponRedemptions lists the orders a coupon was used on (admin only)
+func (h *CouponHandler) ListCouponRedemptions(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit, err := parseCouponLimit(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid limit",
+		})
+	}
+
+	redemptions, err := h.couponService.ListRedemptions(c.Request().Context(), c.Param("id"), domain, limit)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"redemptions": redemptions,
+		"count":       len(redemptions),
+	})
+}
+
+func parseCouponLimit(c echo.Context) (int64, error) {
+	value := c.QueryParam("limit")
+	if value == "" {
+		return 100, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 1 {
+		return 0, errors.New("invalid limit")
+	}
+	return limit, nil
+}
+
+func couponError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCouponNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCoupon), errors.Is(err, services.ErrCouponNotApplicable):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
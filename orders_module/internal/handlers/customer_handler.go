@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+// customerRecentOrders is how many orders a customer view includes
+const customerRecentOrders = 20
+
+type CustomerHandler struct {
+	profileService *services.CustomerProfileService
+}
+
+func NewCustomerHandler(profileService *services.CustomerProfileService) *CustomerHandler {
+	return &CustomerHandler{
+		profileService: profileService,
+	}
+}
+
+// ListCustomers lists the domain's customers with their order totals
+// (?sort=spend|orders|average|recent, default spend; ?limit=, default 100) (admin only)
+func (h *CustomerHandler) ListCustomers(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit := int64(100)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid limit",
+			})
+		}
+		limit = parsed
+	}
+
+	customers, err := h.profileService.ListProfiles(c.Request().Context(), domain, c.QueryParam("sort"), limit)
+	if err != nil {
+		return customerError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"customers": customers,
+		"count":     len(customers),
+	})
+}
+
+// GetCustomer returns a customer's profile and latest orders. The key is
+// the profile key (user:<id> or email:<address>), a user ID or an email (admin only)
+func (h *CustomerHandler) GetCustomer(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	ctx := c.Request().Context()
+
+	profile, err := h.profileService.GetProfile(ctx, domain, c.Param("key"))
+	if err != nil {
+		return customerError(c, err)
+	}
+
+	orders, err := h.profileService.ListOrders(ctx, profile, customerRecentOrders)
+	if err != nil {
+		return customerError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"customer": profile,
+		"orders":   orders,
+	})
+}
+
+// customerError maps customer profile errors to HTTP responses
+func customerError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCustomerNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCustomerSort):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type DraftOrderHandler struct {
+	draftService *services.DraftOrderService
+}
+
+func NewDraftOrderHandler(draftService *services.DraftOrderService) *DraftOrderHandler {
+	return &DraftOrderHandler{
+		draftService: draftService,
+	}
+}
+
+// CreateDraftOrder creates a draft order for a customer (admin only)
+func (h *DraftOrderHandler) CreateDraftOrder(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateDraftOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	draft, err := h.draftService.CreateDraft(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, draft)
+}
+
+// ListDraftOrders lists draft orders, optionally filtered by ?status= (admin only)
+func (h *DraftOrderHandler) ListDraftOrders(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	drafts, err := h.draftService.ListDrafts(c.Request().Context(), domain, c.QueryParam("status"), 100)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"draft_orders": drafts,
+		"count":        len(drafts),
+	})
+}
+
+// GetDraftOrder retrieves a draft order (admin only)
+func (h *DraftOrderHandler) GetDraftOrder(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	draft, err := h.draftService.GetDraft(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, draft)
+}
+
+// UpdateDraftOrder edits a draft order that hasn't been paid (admin only)
+func (h *DraftOrderHandler) UpdateDraftOrder(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateDraftOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	draft, err := h.draftService.UpdateDraft(c.Request().Context(), c.Param("id"), &req, domain)
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, draft)
+}
+
+// CancelDraftOrder cancels a draft order (admin only)
+func (h *DraftOrderHandler) CancelDraftOrder(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	if err := h.draftService.CancelDraft(c.Request().Context(), c.Param("id"), domain); err != nil {
+		return draftError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Draft order cancelled successfully",
+	})
+}
+
+// SendPaymentLink emails the customer a link to pay for the draft (admin only)
+func (h *DraftOrderHandler) SendPaymentLink(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	draft, err := h.draftService.SendPaymentLink(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":          "Payment link sent successfully",
+		"payment_link_url": draft.PaymentLinkURL,
+		"expires_at":       draft.PaymentLinkExpiry,
+	})
+}
+
+// GetPaymentLink shows what a payment link is for without creating a payment
+// (public, the token is the credential)
+func (h *DraftOrderHandler) GetPaymentLink(c echo.Context) error {
+	link, err := h.draftService.GetPaymentLink(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	if link.Order != nil {
+		link.Order.Risk = nil
+	}
+	return c.JSON(http.StatusOK, link)
+}
+
+// OpenPaymentLink converts the draft into a pending order and returns it with
+// the payment client secret (public, the token is the credential)
+func (h *DraftOrderHandler) OpenPaymentLink(c echo.Context) error {
+	order, err := h.draftService.OpenPaymentLink(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		return draftError(c, err)
+	}
+
+	order.Risk = nil
+	return c.JSON(http.StatusOK, order)
+}
+
+// draftError maps draft order service errors to HTTP responses
+func draftError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrDraftNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDraft):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrOutOfStock):
+		status = http.StatusConflict
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type GiftCardHandler struct {
+	giftCardService *services.GiftCardService
+}
+
+func NewGiftCardHandler(giftCardService *services.GiftCardService) *GiftCardHandler {
+	return &GiftCardHandler{
+		giftCardService: giftCardService,
+	}
+}
+
+// CheckGiftCardBalance returns the balance of a code entered at checkout.
+// The code is sent in the body so it doesn't end up in access logs.
+func (h *GiftCardHandler) CheckGiftCardBalance(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Gift card code is required",
+		})
+	}
+
+	balance, err := h.giftCardService.CheckBalance(c.Request().Context(), c.Param("domain"), req.Code)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, balance)
+}
+
+// CreateGiftCard issues a gift card without an order (admin only)
+func (h *GiftCardHandler) CreateGiftCard(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateGiftCardRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	card, err := h.giftCardService.CreateGiftCard(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, card)
+}
+
+// ListGiftCards lists the domain's gift cards, newest first (?status=,
+// ?q= code, last 4 or order number, ?limit=, default 100) (admin only)
+func (h *GiftCardHandler) ListGiftCards(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit := int64(100)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid limit",
+			})
+		}
+		limit = parsed
+	}
+
+	cards, err := h.giftCardService.ListGiftCards(c.Request().Context(), domain, c.QueryParam("status"), c.QueryParam("q"), limit)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"gift_cards": cards,
+		"count":      len(cards),
+	})
+}
+
+// GetGiftCard retrieves a gift card (admin only)
+func (h *GiftCardHandler) GetGiftCard(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	card, err := h.giftCardService.GetGiftCard(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, card)
+}
+
+// UpdateGiftCard disables / re-enables a card, changes its expiry or
+// corrects its balance (admin only)
+func (h *GiftCardHandler) UpdateGiftCard(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateGiftCardRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	card, err := h.giftCardService.UpdateGiftCard(c.Request().Context(), c.Param("id"), &req, domain, userID)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, card)
+}
+
+// ListGiftCardTransactions returns a gift card's ledger (admin only)
+func (h *GiftCardHandler) ListGiftCardTransactions(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	txs, err := h.giftCardService.ListTransactions(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"transactions": txs,
+		"count":        len(txs),
+	})
+}
+
+// ResendGiftCard emails a gift card again, optionally to a corrected
+// recipient_email (admin only)
+func (h *GiftCardHandler) ResendGiftCard(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req struct {
+		RecipientEmail string `json:"recipient_email"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	card, err := h.giftCardService.ResendGiftCard(c.Request().Context(), c.Param("id"), req.RecipientEmail, domain)
+	if err != nil {
+		return giftCardError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, card)
+}
+
+func giftCardError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrGiftCardNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidGiftCard):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type InventoryHandler struct {
+	stockService          *services.StockService
+	reconciliationService *services.ReconciliationService
+}
+
+func NewInventoryHandler(stockService *services.StockService, reconciliationService *services.ReconciliationService) *InventoryHandler {
+	return &InventoryHandler{
+		stockService:          stockService,
+		reconciliationService: reconciliationService,
+	}
+}
+
+// RecordStockAdjustment records a restock, adjustment or return for a
+// variant and updates its stock (admin only)
+func (h *InventoryHandler) RecordStockAdjustment(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.StockAdjustmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	tx, err := h.stockService.RecordAdjustment(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidStockAdjustment):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrOrderNotFound):
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, tx)
+}
+
+// GetStockLedger returns a product's stock ledger with running balances,
+// optionally narrowed by ?variant_id=, ?from= and ?to= (RFC 3339) (admin only)
+func (h *InventoryHandler) GetStockLedger(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var from, to time.Time
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := c.QueryParam(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Invalid " + param + " date, use RFC 3339",
+				})
+			}
+			*target = parsed
+		}
+	}
+
+	ledger, err := h.stockService.GetLedger(c.Request().Context(), domain, c.Param("productId"), c.QueryParam("variant_id"), from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, ledger)
+}
+
+// ReconcileStock compares the domain's ledger with catalog stock and returns
+// the report. With ?fix=true, corrective adjustments are recorded (admin only)
+func (h *InventoryHandler) ReconcileStock(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+	fix := c.QueryParam("fix") == "true"
+
+	report, err := h.reconciliationService.Reconcile(c.Request().Context(), domain, fix, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// ListStockReconciliations returns recent reconciliation reports, newest
+// first (?limit=, default 20) (admin only)
+func (h *InventoryHandler) ListStockReconciliations(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit := int64(20)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid limit",
+			})
+		}
+		limit = parsed
+	}
+
+	reports, err := h.reconciliationService.ListReconciliations(c.Request().Context(), domain, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"reconciliations": reports,
+		"count":           len(reports),
+	})
+}
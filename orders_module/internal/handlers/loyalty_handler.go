@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type LoyaltyHandler struct {
+	loyaltyService *services.LoyaltyService
+}
+
+func NewLoyaltyHandler(loyaltyService *services.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		loyaltyService: loyaltyService,
+	}
+}
+
+// GetMyLoyaltyBalance returns the logged-in customer's points and recent activity
+func (h *LoyaltyHandler) GetMyLoyaltyBalance(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	balance, err := h.loyaltyService.GetBalance(c.Request().Context(), domain, userID)
+	if err != nil {
+		return loyaltyError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, balance)
+}
+
+// GetCustomerLoyaltyBalance returns any customer's points (admin only)
+func (h *LoyaltyHandler) GetCustomerLoyaltyBalance(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	balance, err := h.loyaltyService.GetBalance(c.Request().Context(), domain, c.Param("userId"))
+	if err != nil {
+		return loyaltyError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, balance)
+}
+
+// AwardLoyaltyBonus credits review, referral or manual bonus points (admin only)
+func (h *LoyaltyHandler) AwardLoyaltyBonus(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.LoyaltyBonusRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	tx, err := h.loyaltyService.AwardBonus(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return loyaltyError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, tx)
+}
+
+// GetLoyaltySettings returns the domain's loyalty program rules (admin only)
+func (h *LoyaltyHandler) GetLoyaltySettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	settings, err := h.loyaltyService.GetSettings(c.Request().Context(), domain)
+	if err != nil {
+		return loyaltyError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateLoyaltySettings changes the domain's loyalty program rules (admin only)
+func (h *LoyaltyHandler) UpdateLoyaltySettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateLoyaltySettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	settings, err := h.loyaltyService.UpdateSettings(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return loyaltyError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+func loyaltyError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidLoyaltySettings):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrLoyaltyBonusExists):
+		status = http.StatusConflict
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
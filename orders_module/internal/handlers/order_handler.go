@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -14,14 +15,16 @@ import (
 type OrderHandler struct {
 	db            *database.MongoDB
 	jwtSecret     string
+	defaultDomain string
 	orderService  *services.OrderService
 	stripeService *services.StripeService
 }
 
-func NewOrderHandler(db *database.MongoDB, jwtSecret, stripeKey, webhookSecret string) *OrderHandler {
+func NewOrderHandler(db *database.MongoDB, jwtSecret, stripeKey, webhookSecret, defaultDomain string) *OrderHandler {
 	return &OrderHandler{
 		db:            db,
 		jwtSecret:     jwtSecret,
+		defaultDomain: defaultDomain,
 		orderService:  services.NewOrderService(db, stripeKey),
 		stripeService: services.NewStripeService(db, webhookSecret),
 	}
@@ -43,30 +46,46 @@ func (h *OrderHandler) CreateOrder(c echo.Context) error {
 			i, item.ProductID, item.ProductName, item.ProductImage)
 	}
 
-	// Get domain from header (multi-tenant)
-	domain := c.Request().Header.Get("Host")
-	if domain == "" {
-		domain = "oilyourhair.com" // Default for development
-	}
+	domain := shopDomain(c, h.defaultDomain)
+
+	// Logged-in customers are identified by their token, never the request body
+	req.Customer.UserID, _ = c.Get("user_id").(string)
+	req.ClientIP = c.RealIP()
 
 	// Create order
 	order, err := h.orderService.CreateOrder(c.Request().Context(), &req, domain)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidOrder) || errors.Is(err, services.ErrAddressNotFound) || errors.Is(err, services.ErrInvalidAddress) || errors.Is(err, services.ErrProductNotFound) ||
+			errors.Is(err, services.ErrInvalidRedemption) || errors.Is(err, services.ErrInvalidGiftCard) || errors.Is(err, services.ErrGiftCardNotFound) ||
+			errors.Is(err, services.ErrCouponNotFound) || errors.Is(err, services.ErrCouponNotApplicable) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrOutOfStock) {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrOrderRejected) {
+			// Don't tell the customer which rule matched
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+				"error": "We couldn't place this order. Please contact us for help.",
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": err.Error(),
 		})
 	}
 
+	order.Risk = nil
 	return c.JSON(http.StatusCreated, order)
 }
 
 // GetOrder retrieves an order by ID
 func (h *OrderHandler) GetOrder(c echo.Context) error {
 	orderID := c.Param("id")
-	domain := c.Request().Header.Get("Host")
-	if domain == "" {
-		domain = "oilyourhair.com"
-	}
+	domain := shopDomain(c, h.defaultDomain)
 
 	order, err := h.orderService.GetOrder(c.Request().Context(), orderID, domain)
 	if err != nil {
@@ -77,19 +96,14 @@ func (h *OrderHandler) GetOrder(c echo.Context) error {
 
 	// TODO: Verify user owns this order (JWT validation)
 
+	order.Risk = nil
 	return c.JSON(http.StatusOK, order)
 }
 
 // ListOrders lists orders for the authenticated user
 func (h *OrderHandler) ListOrders(c echo.Context) error {
-	// TODO: Get userID from JWT token
-	userID := "guest" // Placeholder
-	domain := c.Request().Header.Get("Host")
-	if domain == "" {
-		domain = "oilyourhair.com"
-	}
-
-	log.Printf("ListOrders handler - Host header: %s, domain: %s", c.Request().Header.Get("Host"), domain)
+	userID, _ := c.Get("user_id").(string)
+	domain := shopDomain(c, h.defaultDomain)
 
 	orders, err := h.orderService.ListOrders(c.Request().Context(), userID, domain, 50)
 	if err != nil {
@@ -98,6 +112,10 @@ func (h *OrderHandler) ListOrders(c echo.Context) error {
 		})
 	}
 
+	for _, order := range orders {
+		order.Risk = nil
+	}
+
 	log.Printf("ListOrders handler - returned %d orders", len(orders))
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -106,12 +124,9 @@ func (h *OrderHandler) ListOrders(c echo.Context) error {
 	})
 }
 
-// ListAllOrders lists all orders (admin only)
+// ListAllOrders lists all of the admin's domain's orders (admin only)
 func (h *OrderHandler) ListAllOrders(c echo.Context) error {
-	// TODO: Verify admin role from JWT token
-
-	// Get optional domain filter from query param
-	domain := c.QueryParam("domain")
+	domain, _ := c.Get("domain").(string)
 
 	// Get limit from query param (default 100)
 	limit := 100
@@ -134,10 +149,7 @@ func (h *OrderHandler) ListAllOrders(c echo.Context) error {
 // UpdateOrderDetails updates an order's customer and address information
 func (h *OrderHandler) UpdateOrderDetails(c echo.Context) error {
 	orderID := c.Param("id")
-	domain := c.Request().Header.Get("Host")
-	if domain == "" {
-		domain = "oilyourhair.com"
-	}
+	domain := shopDomain(c, h.defaultDomain)
 
 	var req models.UpdateOrderDetailsRequest
 	if err := c.Bind(&req); err != nil {
@@ -147,6 +159,11 @@ func (h *OrderHandler) UpdateOrderDetails(c echo.Context) error {
 	}
 
 	if err := h.orderService.UpdateOrderDetails(c.Request().Context(), orderID, &req, domain); err != nil {
+		if errors.Is(err, services.ErrInvalidAddress) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": err.Error(),
 		})
@@ -157,15 +174,11 @@ func (h *OrderHandler) UpdateOrderDetails(c echo.Context) error {
 	})
 }
 
-// UpdateOrderStatus updates an order's status (admin only)
+// UpdateOrderStatus updates an order's status (admin only). Cancelling or
+// refunding cancels or refunds the payment as well.
 func (h *OrderHandler) UpdateOrderStatus(c echo.Context) error {
-	// TODO: Verify admin role from JWT
-
 	orderID := c.Param("id")
-	domain := c.Request().Header.Get("Host")
-	if domain == "" {
-		domain = "oilyourhair.com"
-	}
+	domain, _ := c.Get("domain").(string)
 
 	var req struct {
 		Status string `json:"status"`
@@ -176,7 +189,31 @@ func (h *OrderHandler) UpdateOrderStatus(c echo.Context) error {
 		})
 	}
 
-	if err := h.orderService.UpdateOrderStatus(c.Request().Context(), orderID, req.Status, domain); err != nil {
+	actor, _ := c.Get("user_id").(string)
+	if actor == "" {
+		actor = "admin"
+	}
+
+	var err error
+	switch req.Status {
+	case "cancelled":
+		_, err = h.orderService.CancelOrder(c.Request().Context(), orderID, domain, "cancelled by admin", actor)
+	case "refunded":
+		_, err = h.orderService.RefundOrder(c.Request().Context(), orderID, domain, "refunded by admin", actor)
+	default:
+		err = h.orderService.UpdateOrderStatus(c.Request().Context(), orderID, req.Status, domain, actor)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidOrderStatus):
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": err.Error(),
 		})
@@ -187,6 +224,65 @@ func (h *OrderHandler) UpdateOrderStatus(c echo.Context) error {
 	})
 }
 
+// EditOrderItems adds, removes or changes quantities of line items on an
+// order that hasn't shipped (admin only)
+func (h *OrderHandler) EditOrderItems(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.EditOrderItemsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	order, err := h.orderService.EditOrderItems(c.Request().Context(), c.Param("id"), &req, domain, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrInvalidOrderEdit):
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
+// CreateFulfillment ships some or all of an order's items (admin only)
+func (h *OrderHandler) CreateFulfillment(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateFulfillmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	order, err := h.orderService.CreateFulfillment(c.Request().Context(), c.Param("id"), &req, domain, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrInvalidFulfillment):
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
 // StripeWebhook handles Stripe payment webhooks
 func (h *OrderHandler) StripeWebhook(c echo.Context) error {
 	// Read raw body
@@ -216,3 +312,17 @@ func (h *OrderHandler) StripeWebhook(c echo.Context) error {
 		"status": "success",
 	})
 }
+
+// shopDomain returns the domain a shopper's order or cart belongs to: the
+// domain of a logged-in customer's token, so their saved addresses, cards
+// and orders are all looked up on the same domain, or the Host header for
+// guests
+func shopDomain(c echo.Context, defaultDomain string) string {
+	if domain, _ := c.Get("domain").(string); domain != "" {
+		return domain
+	}
+	if domain := c.Request().Header.Get("Host"); domain != "" {
+		return domain
+	}
+	return defaultDomain
+}
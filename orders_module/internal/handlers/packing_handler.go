@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type PackingHandler struct {
+	packingService *services.PackingService
+}
+
+func NewPackingHandler(packingService *services.PackingService) *PackingHandler {
+	return &PackingHandler{
+		packingService: packingService,
+	}
+}
+
+// GetPackingSlip prints an order's packing slip (?format=html|pdf, default
+// html) (admin only)
+func (h *PackingHandler) GetPackingSlip(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	slips, err := h.packingService.PackingSlips(c.Request().Context(), domain, []string{c.Param("id")})
+	if err != nil {
+		return packingError(c, err)
+	}
+
+	return h.writeDocument(c, "packing-slip-"+slips[0].OrderNumber, func(buf *bytes.Buffer, format string) error {
+		return services.WritePackingSlips(buf, slips, format)
+	})
+}
+
+// GetPackingSlips prints the packing slips of several orders, a page per
+// order (?order_ids=a,b,c, default: every paid order not fully shipped yet;
+// ?format=html|pdf, default html) (admin only)
+func (h *PackingHandler) GetPackingSlips(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	slips, err := h.packingService.PackingSlips(c.Request().Context(), domain, parseOrderIDs(c.QueryParam("order_ids")))
+	if err != nil {
+		return packingError(c, err)
+	}
+
+	return h.writeDocument(c, "packing-slips", func(buf *bytes.Buffer, format string) error {
+		return services.WritePackingSlips(buf, slips, format)
+	})
+}
+
+// GetPickList prints the units to pick for several orders, grouped by SKU
+// (?order_ids=a,b,c, default: every paid order not fully shipped yet;
+// ?format=html|pdf, default html) (admin only)
+func (h *PackingHandler) GetPickList(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	list, err := h.packingService.PickList(c.Request().Context(), domain, parseOrderIDs(c.QueryParam("order_ids")))
+	if err != nil {
+		return packingError(c, err)
+	}
+
+	return h.writeDocument(c, "pick-list", func(buf *bytes.Buffer, format string) error {
+		return services.WritePickList(buf, list, format)
+	})
+}
+
+// writeDocument renders a document in the requested format. HTML opens in
+// the browser to print, PDF is downloaded.
+func (h *PackingHandler) writeDocument(c echo.Context, name string, render func(*bytes.Buffer, string) error) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = models.PackingFormatHTML
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf, format); err != nil {
+		return packingError(c, err)
+	}
+
+	if format == models.PackingFormatPDF {
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+".pdf"))
+		return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+	}
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// parseOrderIDs splits a comma-separated list of order IDs
+func parseOrderIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func packingError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrNotPackable), errors.Is(err, services.ErrInvalidDocumentFormat):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
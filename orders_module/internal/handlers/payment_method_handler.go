@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type PaymentMethodHandler struct {
+	customerService *services.PaymentCustomerService
+}
+
+func NewPaymentMethodHandler(customerService *services.PaymentCustomerService) *PaymentMethodHandler {
+	return &PaymentMethodHandler{
+		customerService: customerService,
+	}
+}
+
+// ListPaymentMethods lists the logged-in customer's saved cards
+func (h *PaymentMethodHandler) ListPaymentMethods(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	methods, err := h.customerService.ListPaymentMethods(c.Request().Context(), domain, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"payment_methods": methods,
+		"count":           len(methods),
+	})
+}
+
+// DeletePaymentMethod removes one of the logged-in customer's saved cards
+func (h *PaymentMethodHandler) DeletePaymentMethod(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	if err := h.customerService.DeletePaymentMethod(c.Request().Context(), domain, userID, c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPaymentMethodNotFound) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Payment method removed",
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type RetentionHandler struct {
+	retentionService *services.RetentionService
+}
+
+func NewRetentionHandler(retentionService *services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+// GetRetentionSettings returns the domain's PII retention policy (admin only)
+func (h *RetentionHandler) GetRetentionSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	settings, err := h.retentionService.GetSettings(c.Request().Context(), domain)
+	if err != nil {
+		return retentionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateRetentionSettings changes the domain's PII retention policy (admin only)
+func (h *RetentionHandler) UpdateRetentionSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateRetentionSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	settings, err := h.retentionService.UpdateSettings(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return retentionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// ApplyRetention anonymizes the orders older than the retention period now
+// instead of waiting for the scheduled job (admin only)
+func (h *RetentionHandler) ApplyRetention(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	audit, err := h.retentionService.ApplyRetention(c.Request().Context(), domain, userID)
+	if err != nil {
+		return retentionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, audit)
+}
+
+// AnonymizeCustomer scrubs a customer's details from all their orders (admin only)
+func (h *RetentionHandler) AnonymizeCustomer(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.AnonymizeCustomerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	audit, err := h.retentionService.AnonymizeCustomer(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return retentionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, audit)
+}
+
+// ListAnonymizationAudits lists what was anonymized, newest first
+// (?trigger=retention|request, ?limit=, default 100) (admin only)
+func (h *RetentionHandler) ListAnonymizationAudits(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit := int64(100)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid limit",
+			})
+		}
+		limit = parsed
+	}
+
+	audits, err := h.retentionService.ListAudits(c.Request().Context(), domain, c.QueryParam("trigger"), limit)
+	if err != nil {
+		return retentionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"audits": audits,
+		"count":  len(audits),
+	})
+}
+
+func retentionError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrInvalidRetention) {
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type RiskHandler struct {
+	riskService *services.RiskService
+}
+
+func NewRiskHandler(riskService *services.RiskService) *RiskHandler {
+	return &RiskHandler{
+		riskService: riskService,
+	}
+}
+
+// GetRiskSettings returns the domain's fraud and velocity rules (admin only)
+func (h *RiskHandler) GetRiskSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	settings, err := h.riskService.GetSettings(c.Request().Context(), domain)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateRiskSettings changes the domain's fraud and velocity rules (admin only)
+func (h *RiskHandler) UpdateRiskSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateRiskSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	settings, err := h.riskService.UpdateSettings(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// ListBlocklist lists blocked values, optionally filtered by ?type= (admin only)
+func (h *RiskHandler) ListBlocklist(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	entries, err := h.riskService.ListBlocklist(c.Request().Context(), domain, c.QueryParam("type"))
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"blocklist": entries,
+		"count":     len(entries),
+	})
+}
+
+// AddBlocklistEntry blocks an email, IP, card fingerprint or country (admin only)
+func (h *RiskHandler) AddBlocklistEntry(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateBlocklistEntryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	entry, err := h.riskService.AddBlocklistEntry(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteBlocklistEntry unblocks a value (admin only)
+func (h *RiskHandler) DeleteBlocklistEntry(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	if err := h.riskService.DeleteBlocklistEntry(c.Request().Context(), c.Param("id"), domain); err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Blocklist entry deleted",
+	})
+}
+
+// ListRiskReviews lists orders held for manual review (admin only)
+func (h *RiskHandler) ListRiskReviews(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	orders, err := h.riskService.ListReviews(c.Request().Context(), domain, 100)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"orders": orders,
+		"count":  len(orders),
+	})
+}
+
+// ListRiskRejections lists order attempts the risk checks rejected (admin only)
+func (h *RiskHandler) ListRiskRejections(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	rejections, err := h.riskService.ListRejections(c.Request().Context(), domain, 100)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rejections": rejections,
+		"count":      len(rejections),
+	})
+}
+
+// ApproveRiskReview releases a held order and captures its payment (admin only)
+func (h *RiskHandler) ApproveRiskReview(c echo.Context) error {
+	return h.review(c, h.riskService.ApproveReview)
+}
+
+// RejectRiskReview cancels a held order and releases its payment (admin only)
+func (h *RiskHandler) RejectRiskReview(c echo.Context) error {
+	return h.review(c, h.riskService.RejectReview)
+}
+
+func (h *RiskHandler) review(c echo.Context, decide func(ctx context.Context, orderID, domain, actor, note string) (*models.Order, error)) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.RiskReviewRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	order, err := decide(c.Request().Context(), c.Param("id"), domain, userID, req.Note)
+	if err != nil {
+		return riskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
+// riskError maps risk service errors to HTTP responses
+func riskError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidRiskSettings):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrNotUnderReview), errors.Is(err, services.ErrCheckoutIncomplete):
+		status = http.StatusConflict
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type SettingsHandler struct {
+	orderNumberService *services.OrderNumberService
+	checkoutService    *services.CheckoutService
+}
+
+func NewSettingsHandler(orderNumberService *services.OrderNumberService, checkoutService *services.CheckoutService) *SettingsHandler {
+	return &SettingsHandler{
+		orderNumberService: orderNumberService,
+		checkoutService:    checkoutService,
+	}
+}
+
+// GetOrderNumberFormat returns the domain's order number format (admin only)
+func (h *SettingsHandler) GetOrderNumberFormat(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	format, err := h.orderNumberService.GetFormat(c.Request().Context(), domain)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, orderNumberFormatResponse(format))
+}
+
+// UpdateOrderNumberFormat changes the domain's order number format (admin only)
+func (h *SettingsHandler) UpdateOrderNumberFormat(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateOrderNumberFormatRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	format, err := h.orderNumberService.UpdateFormat(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidOrderNumberFormat) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, orderNumberFormatResponse(format))
+}
+
+// GetCheckoutSettings returns how the domain's customers pay (admin only)
+func (h *SettingsHandler) GetCheckoutSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	settings, err := h.checkoutService.GetSettings(c.Request().Context(), domain)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateCheckoutSettings switches the domain between payment intents and
+// hosted Checkout Sessions (admin only)
+func (h *SettingsHandler) UpdateCheckoutSettings(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateCheckoutSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	settings, err := h.checkoutService.UpdateSettings(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidCheckoutSettings) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// orderNumberFormatResponse adds an example number to the format
+func orderNumberFormatResponse(format *models.OrderNumberFormat) map[string]interface{} {
+	suffix := ""
+	for i := 0; i < format.RandomSuffixLength; i++ {
+		suffix += "X"
+	}
+
+	return map[string]interface{}{
+		"format":  format,
+		"example": services.FormatOrderNumber(format, time.Now().Year(), 42, suffix),
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *services.SubscriptionService
+}
+
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+// ListPublicSubscriptionPlans lists a store's active plans, optionally for
+// one product (?product_id=)
+func (h *SubscriptionHandler) ListPublicSubscriptionPlans(c echo.Context) error {
+	plans, err := h.subscriptionService.ListPlans(c.Request().Context(), c.Param("domain"), c.QueryParam("product_id"), true)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"plans": plans,
+		"count": len(plans),
+	})
+}
+
+// CreateSubscription subscribes the logged-in customer to a plan
+func (h *SubscriptionHandler) CreateSubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+	email, _ := c.Get("email").(string)
+
+	var req models.CreateSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	customer := models.Customer{UserID: userID, Email: email}
+	sub, err := h.subscriptionService.CreateSubscription(c.Request().Context(), &req, customer, domain)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, sub)
+}
+
+// ListMySubscriptions lists the logged-in customer's subscriptions
+func (h *SubscriptionHandler) ListMySubscriptions(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	subs, err := h.subscriptionService.ListSubscriptions(c.Request().Context(), domain, userID, c.QueryParam("status"), 100)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// GetMySubscription retrieves one of the logged-in customer's subscriptions
+func (h *SubscriptionHandler) GetMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	sub, err := h.subscriptionService.GetSubscription(c.Request().Context(), c.Param("id"), domain, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// UpdateMySubscription changes quantity, interval, card, addresses or the
+// next delivery date
+func (h *SubscriptionHandler) UpdateMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.UpdateSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	sub, err := h.subscriptionService.UpdateSubscription(c.Request().Context(), c.Param("id"), &req, domain, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// PauseMySubscription pauses deliveries until a date, or until resumed
+func (h *SubscriptionHandler) PauseMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.PauseSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	sub, err := h.subscriptionService.PauseSubscription(c.Request().Context(), c.Param("id"), req.Until, domain, userID, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// ResumeMySubscription restarts a paused subscription
+func (h *SubscriptionHandler) ResumeMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	sub, err := h.subscriptionService.ResumeSubscription(c.Request().Context(), c.Param("id"), domain, userID, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// SkipMySubscription skips the next delivery
+func (h *SubscriptionHandler) SkipMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	sub, err := h.subscriptionService.SkipNextDelivery(c.Request().Context(), c.Param("id"), domain, userID, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// CancelMySubscription cancels one of the logged-in customer's subscriptions
+func (h *SubscriptionHandler) CancelMySubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	sub, err := h.subscriptionService.CancelSubscription(c.Request().Context(), c.Param("id"), domain, userID, userID, "customer")
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// CreateSubscriptionPlan offers a product variant as a subscription (admin only)
+func (h *SubscriptionHandler) CreateSubscriptionPlan(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateSubscriptionPlanRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	plan, err := h.subscriptionService.CreatePlan(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, plan)
+}
+
+// ListSubscriptionPlans lists the domain's plans, including inactive ones
+// (?product_id=) (admin only)
+func (h *SubscriptionHandler) ListSubscriptionPlans(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	plans, err := h.subscriptionService.ListPlans(c.Request().Context(), domain, c.QueryParam("product_id"), false)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"plans": plans,
+		"count": len(plans),
+	})
+}
+
+// GetSubscriptionPlan retrieves a plan (admin only)
+func (h *SubscriptionHandler) GetSubscriptionPlan(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	plan, err := h.subscriptionService.GetPlan(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// UpdateSubscriptionPlan changes or (de)activates a plan (admin only)
+func (h *SubscriptionHandler) UpdateSubscriptionPlan(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateSubscriptionPlanRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	plan, err := h.subscriptionService.UpdatePlan(c.Request().Context(), c.Param("id"), &req, domain)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// ListSubscriptions lists the domain's subscriptions, newest first
+// (?status=, ?limit=, default 100) (admin only)
+func (h *SubscriptionHandler) ListSubscriptions(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	limit := int64(100)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid limit",
+			})
+		}
+		limit = parsed
+	}
+
+	subs, err := h.subscriptionService.ListSubscriptions(c.Request().Context(), domain, "", c.QueryParam("status"), limit)
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// GetSubscription retrieves any subscription in the domain (admin only)
+func (h *SubscriptionHandler) GetSubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	sub, err := h.subscriptionService.GetSubscription(c.Request().Context(), c.Param("id"), domain, "")
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+// CancelSubscription cancels any subscription in the domain (admin only)
+func (h *SubscriptionHandler) CancelSubscription(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	sub, err := h.subscriptionService.CancelSubscription(c.Request().Context(), c.Param("id"), domain, "", userID, "merchant")
+	if err != nil {
+		return subscriptionError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, sub)
+}
+
+func subscriptionError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrOutOfStock):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidSubscription),
+		errors.Is(err, services.ErrProductNotFound),
+		errors.Is(err, services.ErrAddressNotFound),
+		errors.Is(err, services.ErrInvalidAddress):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
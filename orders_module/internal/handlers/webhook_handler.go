@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/sparque/orders_module/internal/services"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// CreateWebhookEndpoint registers an endpoint for order events. The signing
+// secret is only returned here (admin only)
+func (h *WebhookHandler) CreateWebhookEndpoint(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	var req models.CreateWebhookEndpointRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	endpoint, err := h.webhookService.CreateEndpoint(c.Request().Context(), &req, domain, userID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"endpoint": endpoint,
+		"secret":   endpoint.Secret,
+	})
+}
+
+// ListWebhookEndpoints lists the domain's endpoints (admin only)
+func (h *WebhookHandler) ListWebhookEndpoints(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	endpoints, err := h.webhookService.ListEndpoints(c.Request().Context(), domain)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"endpoints": endpoints,
+		"count":     len(endpoints),
+	})
+}
+
+// GetWebhookEndpoint retrieves an endpoint (admin only)
+func (h *WebhookHandler) GetWebhookEndpoint(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	endpoint, err := h.webhookService.GetEndpoint(c.Request().Context(), c.Param("id"), domain)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, endpoint)
+}
+
+// UpdateWebhookEndpoint changes an endpoint or (de)activates it (admin only)
+func (h *WebhookHandler) UpdateWebhookEndpoint(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	var req models.UpdateWebhookEndpointRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	endpoint, err := h.webhookService.UpdateEndpoint(c.Request().Context(), c.Param("id"), &req, domain)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhookEndpoint removes an endpoint (admin only)
+func (h *WebhookHandler) DeleteWebhookEndpoint(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	if err := h.webhookService.DeleteEndpoint(c.Request().Context(), c.Param("id"), domain); err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Webhook endpoint deleted",
+	})
+}
+
+// ListWebhookDeliveries returns an endpoint's delivery log, optionally
+// filtered by ?status= (admin only)
+func (h *WebhookHandler) ListWebhookDeliveries(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Request().Context(), c.Param("id"), domain, c.QueryParam("status"), 100)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// RedeliverWebhook sends a logged delivery again (admin only)
+func (h *WebhookHandler) RedeliverWebhook(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+
+	delivery, err := h.webhookService.Redeliver(c.Request().Context(), c.Param("id"), c.Param("deliveryId"), domain)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// webhookError maps webhook service errors to HTTP responses
+func webhookError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWebhook):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
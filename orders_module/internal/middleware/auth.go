@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// UserClaims represents the claims in a user JWT issued by auth_module
+type UserClaims struct {
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Domain      string   `json:"domain"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuth validates the user JWT and rejects requests without one
+func JWTAuth(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Missing authorization header",
+				})
+			}
+
+			tokenString := extractToken(authHeader)
+			if tokenString == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid authorization header format",
+				})
+			}
+
+			claims, err := validateJWT(tokenString, secret)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid or expired token",
+				})
+			}
+
+			setUserContext(c, claims)
+			return next(c)
+		}
+	}
+}
+
+// OptionalJWTAuth sets user info when a valid JWT is present but lets guests through
+func OptionalJWTAuth(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenString := extractToken(c.Request().Header.Get("Authorization"))
+			if tokenString == "" {
+				return next(c)
+			}
+
+			claims, err := validateJWT(tokenString, secret)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid or expired token",
+				})
+			}
+
+			setUserContext(c, claims)
+			return next(c)
+		}
+	}
+}
+
+// RequireRole creates middleware that requires specific role
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, ok := c.Get("role").(string)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Unauthorized",
+				})
+			}
+
+			for _, r := range roles {
+				if role == r {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "Insufficient permissions",
+			})
+		}
+	}
+}
+
+// RequirePermission creates middleware that requires specific permission
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			permissions, ok := c.Get("permissions").([]string)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Unauthorized",
+				})
+			}
+
+			for _, p := range permissions {
+				if p == permission {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": fmt.Sprintf("Missing required permission: %s", permission),
+			})
+		}
+	}
+}
+
+// RequireUserPermission requires a permission from logged-in users and lets
+// guests through, for routes that also serve anonymous shoppers
+func RequireUserPermission(permission string) echo.MiddlewareFunc {
+	requirePermission := RequirePermission(permission)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withPermission := requirePermission(next)
+		return func(c echo.Context) error {
+			if userID, _ := c.Get("user_id").(string); userID == "" {
+				return next(c)
+			}
+			return withPermission(c)
+		}
+	}
+}
+
+// setUserContext stores the claims on the echo context
+func setUserContext(c echo.Context, claims *UserClaims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("domain", claims.Domain)
+	c.Set("role", claims.Role)
+	c.Set("permissions", claims.Permissions)
+}
+
+// validateJWT validates a user JWT and returns the claims
+func validateJWT(tokenString, secret string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+// extractToken extracts the token from Authorization header
+func extractToken(authHeader string) string {
+	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		return authHeader[7:]
+	}
+	return ""
+}
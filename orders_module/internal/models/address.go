@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SavedAddress is an entry in a customer's address book
+type SavedAddress struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+	UserID string             `bson:"user_id" json:"user_id"` // From auth_module
+
+	Label   string  `bson:"label,omitempty" json:"label,omitempty"` // "Home", "Work", etc.
+	Address Address `bson:"address" json:"address"`
+
+	// Defaults (at most one of each per user per domain)
+	IsDefaultShipping bool `bson:"is_default_shipping" json:"is_default_shipping"`
+	IsDefaultBilling  bool `bson:"is_default_billing" json:"is_default_billing"`
+
+	// Timestamps
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// CreateAddressRequest is the request body for saving an address
+type CreateAddressRequest struct {
+	Label             string  `json:"label,omitempty"`
+	Address           Address `json:"address"`
+	IsDefaultShipping bool    `json:"is_default_shipping"`
+	IsDefaultBilling  bool    `json:"is_default_billing"`
+}
+
+// UpdateAddressRequest is the request body for updating a saved address
+type UpdateAddressRequest struct {
+	Label             *string  `json:"label,omitempty"`
+	Address           *Address `json:"address,omitempty"`
+	IsDefaultShipping *bool    `json:"is_default_shipping,omitempty"`
+	IsDefaultBilling  *bool    `json:"is_default_billing,omitempty"`
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Affiliate commission rules
+const (
+	AffiliateRuleFirstOrder = "first_order" // Only a referred customer's first paid order
+	AffiliateRuleLifetime   = "lifetime"    // Every paid order of a referred customer
+)
+
+// Affiliate statuses
+const (
+	AffiliateActive   = "active"
+	AffiliateDisabled = "disabled"
+)
+
+// Affiliate commission ledger entry types
+const (
+	AffiliateAccrual  = "accrual"  // Attributed order paid
+	AffiliateReversal = "reversal" // Order cancelled or (partly) refunded
+)
+
+// AffiliateSettings are a domain's affiliate program rules
+type AffiliateSettings struct {
+	Domain            string  `bson:"_id" json:"domain"`
+	Enabled           bool    `bson:"enabled" json:"enabled"`
+	Rule              string  `bson:"rule" json:"rule"`                             // first_order, lifetime
+	CommissionPercent float64 `bson:"commission_percent" json:"commission_percent"` // Default for affiliates without their own rate
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DefaultAffiliateSettings returns the rules used when a domain hasn't set
+// any. The program is off until a domain enables it.
+func DefaultAffiliateSettings(domain string) *AffiliateSettings {
+	return &AffiliateSettings{
+		Domain:            domain,
+		Rule:              AffiliateRuleFirstOrder,
+		CommissionPercent: 10,
+	}
+}
+
+// UpdateAffiliateSettingsRequest changes a domain's affiliate rules (nil fields are left alone)
+type UpdateAffiliateSettingsRequest struct {
+	Enabled           *bool    `json:"enabled,omitempty"`
+	Rule              *string  `json:"rule,omitempty"`
+	CommissionPercent *float64 `json:"commission_percent,omitempty"`
+}
+
+// Affiliate is a sales rep or partner who refers customers. Its code is the
+// ref of the auth_module invitations it hands out.
+type Affiliate struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain            string             `bson:"domain" json:"domain"`
+	Code              string             `bson:"code" json:"code"` // Matches the invitation ref, unique per domain
+	Name              string             `bson:"name" json:"name"`
+	Email             string             `bson:"email,omitempty" json:"email,omitempty"`
+	UserID            string             `bson:"user_id,omitempty" json:"user_id,omitempty"`                       // Lets the affiliate see their own commissions
+	CommissionPercent *float64           `bson:"commission_percent,omitempty" json:"commission_percent,omitempty"` // Overrides the domain default
+	Status            string             `bson:"status" json:"status"`                                             // active, disabled
+	Notes             string             `bson:"notes,omitempty" json:"notes,omitempty"`
+	CreatedBy         string             `bson:"created_by" json:"created_by"`
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// AffiliateCommission is an entry in the commission ledger. Reversals are
+// negative. Entries are unpaid until a payout includes them.
+type AffiliateCommission struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain         string             `bson:"domain" json:"domain"`
+	AffiliateID    string             `bson:"affiliate_id" json:"affiliate_id"`
+	AffiliateCode  string             `bson:"affiliate_code" json:"affiliate_code"`
+	Type           string             `bson:"type" json:"type"` // accrual, reversal
+	OrderID        string             `bson:"order_id" json:"order_id"`
+	OrderNumber    string             `bson:"order_number" json:"order_number"`
+	CustomerUserID string             `bson:"customer_user_id" json:"customer_user_id"`
+	Base           float64            `bson:"base" json:"base"`       // Commissionable order amount (or refunded amount)
+	Percent        float64            `bson:"percent" json:"percent"` // Rate applied
+	Amount         float64            `bson:"amount" json:"amount"`   // Negative for reversals
+	Reason         string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	PayoutID       string             `bson:"payout_id,omitempty" json:"payout_id,omitempty"`
+	CreatedBy      string             `bson:"created_by" json:"created_by"` // system | user_id
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// AffiliatePayout records commissions paid out to an affiliate
+type AffiliatePayout struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain        string             `bson:"domain" json:"domain"`
+	AffiliateID   string             `bson:"affiliate_id" json:"affiliate_id"`
+	AffiliateCode string             `bson:"affiliate_code" json:"affiliate_code"`
+	Through       time.Time          `bson:"through" json:"through"` // Unpaid entries up to this time are included
+	Amount        float64            `bson:"amount" json:"amount"`
+	Entries       int                `bson:"entries" json:"entries"`
+	Reference     string             `bson:"reference,omitempty" json:"reference,omitempty"` // Bank transfer / invoice reference
+	CreatedBy     string             `bson:"created_by" json:"created_by"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CreateAffiliateRequest is the request body for adding an affiliate
+type CreateAffiliateRequest struct {
+	Code              string   `json:"code"`
+	Name              string   `json:"name"`
+	Email             string   `json:"email,omitempty"`
+	UserID            string   `json:"user_id,omitempty"`
+	CommissionPercent *float64 `json:"commission_percent,omitempty"`
+	Notes             string   `json:"notes,omitempty"`
+}
+
+// UpdateAffiliateRequest changes an affiliate (nil fields are left alone).
+// The code can't change, invitations already carry it.
+type UpdateAffiliateRequest struct {
+	Name              *string  `json:"name,omitempty"`
+	Email             *string  `json:"email,omitempty"`
+	UserID            *string  `json:"user_id,omitempty"`
+	CommissionPercent *float64 `json:"commission_percent,omitempty"` // Negative clears the override
+	Status            *string  `json:"status,omitempty"`
+	Notes             *string  `json:"notes,omitempty"`
+}
+
+// CreateAffiliatePayoutRequest pays out an affiliate's unpaid commissions
+type CreateAffiliatePayoutRequest struct {
+	Through   *time.Time `json:"through,omitempty"` // Default: now
+	Reference string     `json:"reference,omitempty"`
+}
+
+// AffiliateReportLine is one affiliate's commissions in a reporting period
+type AffiliateReportLine struct {
+	AffiliateID   string  `bson:"_id" json:"affiliate_id"`
+	AffiliateCode string  `bson:"affiliate_code" json:"affiliate_code"`
+	Orders        int     `bson:"orders" json:"orders"` // Accruals in the period
+	Accrued       float64 `bson:"accrued" json:"accrued"`
+	Reversed      float64 `bson:"reversed" json:"reversed"` // Negative
+	Net           float64 `bson:"net" json:"net"`
+	Paid          float64 `bson:"paid" json:"paid"`
+	Owed          float64 `bson:"owed" json:"owed"` // Net not paid out yet
+}
+
+// AffiliateReport sums commissions per affiliate for a period
+type AffiliateReport struct {
+	From       *time.Time            `json:"from,omitempty"`
+	To         *time.Time            `json:"to,omitempty"`
+	Affiliates []AffiliateReportLine `json:"affiliates"`
+	TotalOwed  float64               `json:"total_owed"`
+}
+
+// AffiliateSummary is what an affiliate sees about their own account
+type AffiliateSummary struct {
+	Affiliate   *Affiliate            `json:"affiliate"`
+	Owed        float64               `json:"owed"`
+	Paid        float64               `json:"paid"`
+	Commissions []AffiliateCommission `json:"commissions"` // Most recent first
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cart is a shopper's server-side cart. Logged-in customers have one cart
+// per domain; anonymous shoppers are identified by the token in their cart
+// cookie until they log in and the cart is merged into theirs. Only product
+// and variant IDs are stored: prices and stock are read from the catalog
+// every time the cart is shown.
+type Cart struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+	UserID string             `bson:"user_id,omitempty" json:"user_id,omitempty"` // Logged-in customer
+	Token  string             `bson:"token,omitempty" json:"-"`                   // Anonymous cart cookie
+	Items  []CartItem         `bson:"items" json:"items"`
+
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `bson:"updated_at" json:"updated_at"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Anonymous carts only (TTL index)
+}
+
+// CartItem is a cart line. Adding the same variant again adds to its
+// quantity, except for gift cards which each have their own recipient.
+type CartItem struct {
+	ID        string             `bson:"id" json:"id"`
+	ProductID string             `bson:"product_id" json:"product_id"`
+	VariantID string             `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+	GiftCard  *GiftCardRecipient `bson:"gift_card,omitempty" json:"gift_card,omitempty"`
+	AddedAt   time.Time          `bson:"added_at" json:"added_at"`
+}
+
+// CartLine is a cart item priced from the catalog. Problem explains why the
+// line can't be ordered as it is (product gone, not enough stock, ...).
+type CartLine struct {
+	ID string `json:"id"`
+	OrderItem
+	Problem string `json:"problem,omitempty"`
+}
+
+// CartView is a cart with live prices and stock. Lines with a problem are
+// left out of the subtotal, and the cart can only be checked out when
+// there are none.
+type CartView struct {
+	ID        string     `json:"id,omitempty"`
+	Domain    string     `json:"domain"`
+	Items     []CartLine `json:"items"`
+	ItemCount int        `json:"item_count"` // Units
+	Subtotal  float64    `json:"subtotal"`
+	Currency  string     `json:"currency"`
+	Valid     bool       `json:"valid"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// AddCartItemRequest is the request body for adding a product to the cart
+type AddCartItemRequest struct {
+	ProductID string             `json:"product_id"`
+	VariantID string             `json:"variant_id,omitempty"`
+	Quantity  int                `json:"quantity"`
+	GiftCard  *GiftCardRecipient `json:"gift_card,omitempty"`
+}
+
+// UpdateCartItemRequest changes a cart line's quantity (0 removes it)
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// CheckoutCartRequest turns the cart into an order. It takes everything a
+// CreateOrderRequest does except the items, which come from the cart.
+type CheckoutCartRequest struct {
+	Customer          Customer `json:"customer"`
+	ShippingAddress   Address  `json:"shipping_address"`
+	BillingAddress    Address  `json:"billing_address"`
+	Notes             string   `json:"notes,omitempty"`
+	ShippingAddressID string   `json:"shipping_address_id,omitempty"`
+	BillingAddressID  string   `json:"billing_address_id,omitempty"`
+	CouponCode        string   `json:"coupon_code,omitempty"`
+	RedeemPoints      int      `json:"redeem_points,omitempty"`
+	GiftCardCodes     []string `json:"gift_card_codes,omitempty"`
+}
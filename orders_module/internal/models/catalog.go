@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CatalogProduct is the read side of a products_module product
+type CatalogProduct struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain     string             `bson:"domain" json:"domain"`
+	Name       string             `bson:"name" json:"name"`
+	Type       string             `bson:"type,omitempty" json:"type,omitempty"` // physical (default) or gift_card
+	BasePrice  float64            `bson:"base_price" json:"base_price"`
+	Images     []string           `bson:"images,omitempty" json:"images,omitempty"`
+	Attributes map[string]string  `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	Variants   []CatalogVariant   `bson:"variants,omitempty" json:"variants,omitempty"`
+	Discount   *CatalogDiscount   `bson:"discount,omitempty" json:"discount,omitempty"`
+	Active     bool               `bson:"active" json:"active"`
+}
+
+// CatalogVariant is the read side of a products_module variant
+type CatalogVariant struct {
+	ID         string            `bson:"id" json:"id"`
+	Attributes map[string]string `bson:"attributes" json:"attributes"`
+	Price      float64           `bson:"price" json:"price"`
+	Stock      int               `bson:"stock" json:"stock"`
+	SKU        string            `bson:"sku,omitempty" json:"sku,omitempty"`
+	ImageIndex int               `bson:"image_index,omitempty" json:"image_index,omitempty"`
+
+	InventoryPolicy string     `bson:"inventory_policy,omitempty" json:"inventory_policy,omitempty"` // deny (default), backorder, preorder
+	ExpectedAt      *time.Time `bson:"expected_at,omitempty" json:"expected_at,omitempty"`           // Restock / release date
+	PreorderLimit   int        `bson:"preorder_limit,omitempty" json:"preorder_limit,omitempty"`     // Max units on pre-order (0 = no cap)
+}
+
+// Product types (same values as products_module). Gift card variants are
+// denominations and aren't stocked.
+const (
+	ProductTypePhysical = "physical"
+	ProductTypeGiftCard = "gift_card"
+)
+
+// Inventory policies for out-of-stock variants (same values as products_module)
+const (
+	InventoryPolicyDeny      = "deny"
+	InventoryPolicyBackorder = "backorder"
+	InventoryPolicyPreorder  = "preorder"
+)
+
+// CatalogDiscount mirrors products_module's ProductDiscount
+type CatalogDiscount struct {
+	Active    bool      `bson:"active" json:"active"`
+	Type      string    `bson:"type" json:"type"` // "percentage" or "fixed"
+	Value     float64   `bson:"value" json:"value"`
+	StartDate time.Time `bson:"start_date,omitempty" json:"start_date,omitempty"`
+	EndDate   time.Time `bson:"end_date,omitempty" json:"end_date,omitempty"`
+}
+
+// FindVariant returns the variant with the given ID, or nil
+func (p *CatalogProduct) FindVariant(variantID string) *CatalogVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == variantID {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// UnitPrice returns the price a customer pays for one unit of the variant,
+// with the product discount applied (same rules as products_module)
+func (p *CatalogProduct) UnitPrice(variant *CatalogVariant) float64 {
+	price := p.BasePrice
+	if variant != nil && variant.Price > 0 {
+		price = variant.Price
+	}
+
+	if !p.Discount.IsActive() {
+		return price
+	}
+
+	switch p.Discount.Type {
+	case "percentage":
+		return price - price*(p.Discount.Value/100.0)
+	case "fixed":
+		if price-p.Discount.Value < 0 {
+			return 0
+		}
+		return price - p.Discount.Value
+	default:
+		return price
+	}
+}
+
+// IsActive checks if the discount is currently active and valid
+func (d *CatalogDiscount) IsActive() bool {
+	if d == nil || !d.Active {
+		return false
+	}
+
+	now := time.Now()
+	if !d.StartDate.IsZero() && now.Before(d.StartDate) {
+		return false
+	}
+	if !d.EndDate.IsZero() && now.After(d.EndDate) {
+		return false
+	}
+
+	return true
+}
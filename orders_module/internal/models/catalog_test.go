@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnitPrice(t *testing.T) {
+	now := time.Now()
+	variant := &CatalogVariant{ID: "v1", Price: 50}
+	noPrice := &CatalogVariant{ID: "v2"}
+
+	tests := []struct {
+		name     string
+		discount *CatalogDiscount
+		variant  *CatalogVariant
+		want     float64
+	}{
+		{"variant price", nil, variant, 50},
+		{"base price when the variant has none", nil, noPrice, 40},
+		{"base price without a variant", nil, nil, 40},
+		{"percentage", &CatalogDiscount{Active: true, Type: "percentage", Value: 20}, variant, 40},
+		{"fixed", &CatalogDiscount{Active: true, Type: "fixed", Value: 15}, variant, 35},
+		{"fixed above the price", &CatalogDiscount{Active: true, Type: "fixed", Value: 60}, variant, 0},
+		{"unknown type", &CatalogDiscount{Active: true, Type: "bogo", Value: 10}, variant, 50},
+		{"inactive", &CatalogDiscount{Type: "percentage", Value: 20}, variant, 50},
+		{"not started", &CatalogDiscount{Active: true, Type: "percentage", Value: 20, StartDate: now.Add(time.Hour)}, variant, 50},
+		{"ended", &CatalogDiscount{Active: true, Type: "percentage", Value: 20, EndDate: now.Add(-time.Hour)}, variant, 50},
+		{"within its dates", &CatalogDiscount{Active: true, Type: "fixed", Value: 5, StartDate: now.Add(-time.Hour), EndDate: now.Add(time.Hour)}, variant, 45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := &CatalogProduct{BasePrice: 40, Discount: tt.discount}
+			if got := product.UnitPrice(tt.variant); got != tt.want {
+				t.Errorf("UnitPrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindVariant(t *testing.T) {
+	product := &CatalogProduct{Variants: []CatalogVariant{{ID: "v1"}, {ID: "v2"}}}
+
+	if v := product.FindVariant("v2"); v == nil || v != &product.Variants[1] {
+		t.Errorf("FindVariant(v2) = %v, want the second variant", v)
+	}
+	if v := product.FindVariant("v3"); v != nil {
+		t.Errorf("FindVariant(v3) = %v, want nil", v)
+	}
+}
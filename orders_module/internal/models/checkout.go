@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// How customers pay for their orders
+const (
+	CheckoutModePaymentIntent   = "payment_intent"   // The storefront confirms the payment intent with Stripe Elements (client_secret)
+	CheckoutModeCheckoutSession = "checkout_session" // The customer is sent to a Stripe-hosted Checkout page (checkout_url)
+)
+
+// CheckoutSettings is how a domain's customers pay. In checkout_session mode
+// the success and cancel URLs are where Stripe sends the customer back to;
+// {domain} and {order_id} are filled in, and Stripe fills in its own
+// {CHECKOUT_SESSION_ID}.
+type CheckoutSettings struct {
+	Domain     string `bson:"_id" json:"domain"`
+	Mode       string `bson:"mode" json:"mode"` // payment_intent | checkout_session
+	SuccessURL string `bson:"success_url,omitempty" json:"success_url,omitempty"`
+	CancelURL  string `bson:"cancel_url,omitempty" json:"cancel_url,omitempty"`
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DefaultCheckoutSettings returns the settings used when a domain hasn't
+// set any: payment intents confirmed by the storefront
+func DefaultCheckoutSettings(domain string) *CheckoutSettings {
+	return &CheckoutSettings{
+		Domain: domain,
+		Mode:   CheckoutModePaymentIntent,
+	}
+}
+
+// UpdateCheckoutSettingsRequest changes a domain's checkout settings (nil fields are left alone)
+type UpdateCheckoutSettingsRequest struct {
+	Mode       *string `json:"mode,omitempty"`
+	SuccessURL *string `json:"success_url,omitempty"`
+	CancelURL  *string `json:"cancel_url,omitempty"`
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon types
+const (
+	CouponPercentage   = "percentage"    // Value percent off the eligible items
+	CouponFixed        = "fixed"         // Value dollars off the eligible items
+	CouponFreeShipping = "free_shipping" // Shipping is free
+)
+
+// Coupon is a discount code customers enter at checkout
+type Coupon struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain      string             `bson:"domain" json:"domain"`
+	Code        string             `bson:"code" json:"code"` // Uppercase, unique per domain
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Type        string             `bson:"type" json:"type"` // percentage, fixed, free_shipping
+	Value       float64            `bson:"value" json:"value"`
+
+	// Conditions
+	MinSubtotal float64           `bson:"min_subtotal,omitempty" json:"min_subtotal,omitempty"`
+	ProductIDs  []string          `bson:"product_ids,omitempty" json:"product_ids,omitempty"` // Only these products get the discount
+	Attributes  map[string]string `bson:"attributes,omitempty" json:"attributes,omitempty"`   // Only products with all of these attributes
+	StartsAt    *time.Time        `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt      *time.Time        `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+
+	// Usage limits (0 = unlimited). Uses counts orders that weren't cancelled.
+	MaxUses            int `bson:"max_uses,omitempty" json:"max_uses,omitempty"`
+	MaxUsesPerCustomer int `bson:"max_uses_per_customer,omitempty" json:"max_uses_per_customer,omitempty"`
+	Uses               int `bson:"uses" json:"uses"`
+
+	Active    bool      `bson:"active" json:"active"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// CouponRedemption is a coupon used on an order. Cancelling or refunding the
+// order releases it, so the use no longer counts against the limits.
+type CouponRedemption struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain      string             `bson:"domain" json:"domain"`
+	CouponID    string             `bson:"coupon_id" json:"coupon_id"`
+	Code        string             `bson:"code" json:"code"`
+	OrderID     string             `bson:"order_id" json:"order_id"`
+	CustomerKey string             `bson:"customer_key" json:"customer_key"` // user:<id> or email:<address>
+	Discount    float64            `bson:"discount" json:"discount"`
+	Status      string             `bson:"status" json:"status"` // active, released
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ReleasedAt  *time.Time         `bson:"released_at,omitempty" json:"released_at,omitempty"`
+}
+
+// CreateCouponRequest is the request body for creating a coupon
+type CreateCouponRequest struct {
+	Code               string            `json:"code"`
+	Description        string            `json:"description,omitempty"`
+	Type               string            `json:"type"`
+	Value              float64           `json:"value"`
+	MinSubtotal        float64           `json:"min_subtotal,omitempty"`
+	ProductIDs         []string          `json:"product_ids,omitempty"`
+	Attributes         map[string]string `json:"attributes,omitempty"`
+	StartsAt           *time.Time        `json:"starts_at,omitempty"`
+	EndsAt             *time.Time        `json:"ends_at,omitempty"`
+	MaxUses            int               `json:"max_uses,omitempty"`
+	MaxUsesPerCustomer int               `json:"max_uses_per_customer,omitempty"`
+}
+
+// UpdateCouponRequest is the request body for changing a coupon (nil fields
+// are left alone). The code and type can't change once created.
+type UpdateCouponRequest struct {
+	Description        *string            `json:"description,omitempty"`
+	Value              *float64           `json:"value,omitempty"`
+	MinSubtotal        *float64           `json:"min_subtotal,omitempty"`
+	ProductIDs         *[]string          `json:"product_ids,omitempty"`
+	Attributes         *map[string]string `json:"attributes,omitempty"`
+	StartsAt           *time.Time         `json:"starts_at,omitempty"`
+	EndsAt             *time.Time         `json:"ends_at,omitempty"`
+	MaxUses            *int               `json:"max_uses,omitempty"`
+	MaxUsesPerCustomer *int               `json:"max_uses_per_customer,omitempty"`
+	Active             *bool              `json:"active,omitempty"`
+}
+
+// ValidateCouponRequest checks a code against a cart before checkout
+type ValidateCouponRequest struct {
+	Code     string      `json:"code"`
+	Items    []OrderItem `json:"items"`
+	Customer Customer    `json:"customer"`
+}
+
+// CouponQuote is the discount a coupon gives an order
+type CouponQuote struct {
+	Code             string  `json:"code"`
+	Type             string  `json:"type"`
+	Description      string  `json:"description,omitempty"`
+	EligibleSubtotal float64 `json:"eligible_subtotal"`
+	Discount         float64 `json:"discount"`
+	FreeShipping     bool    `json:"free_shipping,omitempty"`
+}
+
+// CouponCustomerUses counts a customer's uses of a coupon that weren't
+// released, so the per-customer limit can be checked atomically
+type CouponCustomerUses struct {
+	Domain      string `bson:"domain" json:"domain"`
+	CouponID    string `bson:"coupon_id" json:"coupon_id"`
+	CustomerKey string `bson:"customer_key" json:"customer_key"`
+	Uses        int    `bson:"uses" json:"uses"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Customer profile sort orders
+const (
+	CustomerSortSpend   = "spend"   // Lifetime spend, highest first
+	CustomerSortOrders  = "orders"  // Paid orders, most first
+	CustomerSortAverage = "average" // Average order value, highest first
+	CustomerSortRecent  = "recent"  // Last order, newest first
+)
+
+// CustomerProfile sums up a customer's paid orders on a domain. Logged-in
+// customers are tracked by user ID, guests by email.
+type CustomerProfile struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+	Key    string             `bson:"key" json:"key"` // user:<id> or email:<address>, unique per domain
+	UserID string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email  string             `bson:"email" json:"email"` // From the latest order
+	Name   string             `bson:"name" json:"name"`
+
+	Orders            int       `bson:"orders" json:"orders"`                           // Paid orders, including ones refunded since
+	TotalPaid         float64   `bson:"total_paid" json:"total_paid"`                   // Everything charged, edits included
+	Refunded          float64   `bson:"refunded" json:"refunded"`                       // Everything refunded
+	LifetimeSpend     float64   `bson:"lifetime_spend" json:"lifetime_spend"`           // TotalPaid - Refunded
+	AverageOrderValue float64   `bson:"average_order_value" json:"average_order_value"` // TotalPaid / Orders
+	RefundedOrders    int       `bson:"refunded_orders" json:"refunded_orders"`         // Refunded or cancelled after payment
+	FirstOrderAt      time.Time `bson:"first_order_at" json:"first_order_at"`
+	LastOrderAt       time.Time `bson:"last_order_at" json:"last_order_at"`
+
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
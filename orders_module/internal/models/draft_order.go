@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DraftOrder is an order built by an admin (phone, Instagram DM, etc.) that
+// becomes a regular pending order when the customer opens its payment link
+type DraftOrder struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+
+	// Customer
+	Customer Customer `bson:"customer" json:"customer"`
+
+	// Items (catalog-priced or custom line items)
+	Items []OrderItem `bson:"items" json:"items"`
+
+	// Pricing
+	Currency       string          `bson:"currency" json:"currency"`
+	Subtotal       float64         `bson:"subtotal" json:"subtotal"`
+	ManualDiscount *ManualDiscount `bson:"manual_discount,omitempty" json:"manual_discount,omitempty"`
+	Discount       float64         `bson:"discount" json:"discount"`
+	Total          float64         `bson:"total" json:"total"`
+
+	// Addresses
+	ShippingAddress Address `bson:"shipping_address" json:"shipping_address"`
+	BillingAddress  Address `bson:"billing_address" json:"billing_address"`
+
+	// Status
+	Status       string     `bson:"status" json:"status"`             // open, sent, converting, completed, cancelled
+	ConvertingAt *time.Time `bson:"converting_at,omitempty" json:"-"` // When the payment link conversion claimed the draft
+
+	// Payment link
+	PaymentToken      string     `bson:"payment_token,omitempty" json:"-"`
+	PaymentLinkURL    string     `bson:"payment_link_url,omitempty" json:"payment_link_url,omitempty"`
+	PaymentLinkSentAt *time.Time `bson:"payment_link_sent_at,omitempty" json:"payment_link_sent_at,omitempty"`
+	PaymentLinkExpiry *time.Time `bson:"payment_link_expiry,omitempty" json:"payment_link_expiry,omitempty"`
+
+	// Resulting order
+	OrderID     string     `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderNumber string     `bson:"order_number,omitempty" json:"order_number,omitempty"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+
+	// Metadata
+	Notes      string    `bson:"notes,omitempty" json:"notes,omitempty"`
+	AdminNotes string    `bson:"admin_notes,omitempty" json:"admin_notes,omitempty"`
+	CreatedBy  string    `bson:"created_by" json:"created_by"` // Admin user_id
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// PaymentLink is what the customer sees when opening a draft order's payment
+// link, before paying
+type PaymentLink struct {
+	Status    string      `json:"status"` // open, expired, completed
+	Items     []OrderItem `json:"items"`
+	Currency  string      `json:"currency"`
+	Subtotal  float64     `json:"subtotal"`
+	Discount  float64     `json:"discount"`
+	Total     float64     `json:"total"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	Order     *Order      `json:"order,omitempty"` // Set once the link was used
+}
+
+// ManualDiscount is a discount an admin applies by hand
+type ManualDiscount struct {
+	Type   string  `bson:"type" json:"type"` // "percentage" or "fixed"
+	Value  float64 `bson:"value" json:"value"`
+	Reason string  `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// CreateDraftOrderRequest is the request body for creating a draft order.
+// Catalog items only need product_id, variant_id and quantity; custom line
+// items set custom=true with product_name and unit_price.
+type CreateDraftOrderRequest struct {
+	Customer        Customer        `json:"customer"`
+	Items           []OrderItem     `json:"items"`
+	ManualDiscount  *ManualDiscount `json:"manual_discount,omitempty"`
+	ShippingAddress Address         `json:"shipping_address"`
+	BillingAddress  Address         `json:"billing_address"`
+	Notes           string          `json:"notes,omitempty"`
+	AdminNotes      string          `json:"admin_notes,omitempty"`
+}
+
+// UpdateDraftOrderRequest is the request body for editing a draft order
+type UpdateDraftOrderRequest struct {
+	Customer        *Customer       `json:"customer,omitempty"`
+	Items           *[]OrderItem    `json:"items,omitempty"`
+	ManualDiscount  *ManualDiscount `json:"manual_discount,omitempty"`
+	ShippingAddress *Address        `json:"shipping_address,omitempty"`
+	BillingAddress  *Address        `json:"billing_address,omitempty"`
+	Notes           *string         `json:"notes,omitempty"`
+	AdminNotes      *string         `json:"admin_notes,omitempty"`
+}
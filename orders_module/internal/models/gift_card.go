@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Gift card statuses
+const (
+	GiftCardActive   = "active"
+	GiftCardDisabled = "disabled"
+)
+
+// Gift card ledger transaction types
+const (
+	GiftCardIssue  = "issue"  // Bought in an order or issued by an admin
+	GiftCardRedeem = "redeem" // Spent on an order
+	GiftCardRefund = "refund" // Given back (order cancelled/refunded or couldn't be placed)
+	GiftCardAdjust = "adjust" // Manual balance correction
+	GiftCardVoid   = "void"   // Remaining balance removed (card disabled, order refunded)
+)
+
+// Gift card email delivery statuses
+const (
+	GiftCardDeliveryPending = "pending"
+	GiftCardDeliverySent    = "sent"
+	GiftCardDeliveryFailed  = "failed"
+)
+
+// GiftCard is a code with a balance that pays for orders
+type GiftCard struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain         string             `bson:"domain" json:"domain"`
+	Code           string             `bson:"code" json:"code"`   // XXXX-XXXX-XXXX-XXXX, admin only
+	Last4          string             `bson:"last4" json:"last4"` // Shown to customers
+	InitialBalance float64            `bson:"initial_balance" json:"initial_balance"`
+	Balance        float64            `bson:"balance" json:"balance"`
+	Currency       string             `bson:"currency" json:"currency"`
+	Status         string             `bson:"status" json:"status"` // active, disabled
+	ExpiresAt      *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+
+	// Where the card came from: an order line (one card per unit) or an admin
+	OrderID     string `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderNumber string `bson:"order_number,omitempty" json:"order_number,omitempty"`
+	Source      string `bson:"source,omitempty" json:"-"` // order_id:item:unit, unique so a paid order issues its cards once
+
+	// Email delivery to the recipient
+	PurchaserEmail   string     `bson:"purchaser_email,omitempty" json:"purchaser_email,omitempty"`
+	RecipientEmail   string     `bson:"recipient_email,omitempty" json:"recipient_email,omitempty"`
+	RecipientName    string     `bson:"recipient_name,omitempty" json:"recipient_name,omitempty"`
+	SenderName       string     `bson:"sender_name,omitempty" json:"sender_name,omitempty"`
+	Message          string     `bson:"message,omitempty" json:"message,omitempty"`
+	DeliveryStatus   string     `bson:"delivery_status,omitempty" json:"delivery_status,omitempty"` // pending, sent, failed
+	DeliverAt        *time.Time `bson:"deliver_at,omitempty" json:"deliver_at,omitempty"`           // Next (or scheduled) send
+	DeliveryAttempts int        `bson:"delivery_attempts,omitempty" json:"delivery_attempts,omitempty"`
+	DeliveryError    string     `bson:"delivery_error,omitempty" json:"delivery_error,omitempty"`
+	DeliveredAt      *time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+
+	Note      string    `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy string    `bson:"created_by" json:"created_by"` // system | user_id
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// GiftCardTransaction is an entry in a gift card's ledger
+type GiftCardTransaction struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain       string             `bson:"domain" json:"domain"`
+	GiftCardID   string             `bson:"gift_card_id" json:"gift_card_id"`
+	Type         string             `bson:"type" json:"type"`     // issue, redeem, refund, adjust, void
+	Amount       float64            `bson:"amount" json:"amount"` // Negative for redeem and void
+	BalanceAfter float64            `bson:"balance_after" json:"balance_after"`
+
+	OrderID     string `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderNumber string `bson:"order_number,omitempty" json:"order_number,omitempty"`
+
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedBy string    `bson:"created_by" json:"created_by"` // system | user_id
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// GiftCardPayment is a gift card balance applied to an order
+type GiftCardPayment struct {
+	GiftCardID string  `bson:"gift_card_id" json:"gift_card_id"`
+	Last4      string  `bson:"last4" json:"last4"`
+	Amount     float64 `bson:"amount" json:"amount"`
+}
+
+// GiftCardRecipient is who a gift card order line is for. Without a
+// recipient email the code is sent to the buyer.
+type GiftCardRecipient struct {
+	Email     string     `bson:"email,omitempty" json:"email,omitempty"`
+	Name      string     `bson:"name,omitempty" json:"name,omitempty"`
+	Sender    string     `bson:"sender,omitempty" json:"sender,omitempty"` // Defaults to the buyer's name
+	Message   string     `bson:"message,omitempty" json:"message,omitempty"`
+	DeliverAt *time.Time `bson:"deliver_at,omitempty" json:"deliver_at,omitempty"` // Scheduled delivery (default: once paid)
+}
+
+// GiftCardBalance is what a customer sees when checking a code
+type GiftCardBalance struct {
+	Last4     string     `json:"last4"`
+	Balance   float64    `json:"balance"`
+	Currency  string     `json:"currency"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateGiftCardRequest issues a gift card without an order (admin only)
+type CreateGiftCardRequest struct {
+	Amount         float64    `json:"amount"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RecipientEmail string     `json:"recipient_email,omitempty"` // Emailed when set
+	RecipientName  string     `json:"recipient_name,omitempty"`
+	SenderName     string     `json:"sender_name,omitempty"`
+	Message        string     `json:"message,omitempty"`
+	DeliverAt      *time.Time `json:"deliver_at,omitempty"`
+	Note           string     `json:"note,omitempty"`
+}
+
+// UpdateGiftCardRequest disables / re-enables a card, changes its expiry or
+// corrects its balance (admin only, nil fields are left alone)
+type UpdateGiftCardRequest struct {
+	Status        *string    `json:"status,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	BalanceChange *float64   `json:"balance_change,omitempty"` // Added to the balance (negative to deduct)
+	Reason        string     `json:"reason,omitempty"`
+}
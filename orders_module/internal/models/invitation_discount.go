@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InvitationClaim is an accepted invitation, read from auth_module's
+// invitation_logs collection
+type InvitationClaim struct {
+	InvitationID    primitive.ObjectID `bson:"invitation_id"`
+	Domain          string             `bson:"domain"`
+	PromoCode       string             `bson:"promo_code,omitempty"`
+	Source          string             `bson:"source,omitempty"`
+	Ref             string             `bson:"ref,omitempty"`
+	DiscountPercent float64            `bson:"discount_percent,omitempty"`
+	DiscountOrders  int                `bson:"discount_orders,omitempty"`
+	ClaimedBy       string             `bson:"claimed_by"` // User ID
+	ClaimedAt       time.Time          `bson:"claimed_at"`
+}
+
+// InvitationDiscount tracks how many of a user's orders got the discount of
+// the promotional invitation they signed up with
+type InvitationDiscount struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain          string             `bson:"domain" json:"domain"`
+	UserID          string             `bson:"user_id" json:"user_id"`
+	InvitationID    string             `bson:"invitation_id" json:"invitation_id"`
+	PromoCode       string             `bson:"promo_code,omitempty" json:"promo_code,omitempty"`
+	DiscountPercent float64            `bson:"discount_percent" json:"discount_percent"`
+	MaxOrders       int                `bson:"max_orders" json:"max_orders"`
+	OrderIDs        []string           `bson:"order_ids" json:"order_ids"` // Orders using the discount that weren't cancelled or refunded
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
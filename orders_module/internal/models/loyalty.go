@@ -0,0 +1,119 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Loyalty ledger transaction types
+const (
+	LoyaltyEarn     = "earn"     // Paid order
+	LoyaltyBonus    = "bonus"    // Review, referral or manual bonus
+	LoyaltyRedeem   = "redeem"   // Spent as an order discount
+	LoyaltyRestore  = "restore"  // Redeemed points given back (order cancelled/refunded)
+	LoyaltyReversal = "reversal" // Earned points taken back (order refunded)
+	LoyaltyExpiry   = "expiry"   // Unspent points past their expiry date
+)
+
+// LoyaltySettings are a domain's loyalty program rules
+type LoyaltySettings struct {
+	Domain  string `bson:"_id" json:"domain"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+
+	// Earning
+	PointsPerDollar float64 `bson:"points_per_dollar" json:"points_per_dollar"` // Points per dollar of the paid total
+	ExpiryDays      int     `bson:"expiry_days" json:"expiry_days"`             // 0 = points never expire
+	ReviewBonus     int     `bson:"review_bonus" json:"review_bonus"`
+	ReferralBonus   int     `bson:"referral_bonus" json:"referral_bonus"`
+
+	// Redemption
+	PointValue       float64 `bson:"point_value" json:"point_value"`               // Dollars per point
+	MinRedeemPoints  int     `bson:"min_redeem_points" json:"min_redeem_points"`   // Smallest redemption
+	MaxRedeemPercent float64 `bson:"max_redeem_percent" json:"max_redeem_percent"` // Max share of the subtotal paid with points
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DefaultLoyaltySettings returns the rules used when a domain hasn't set
+// any. The program is off until a domain enables it.
+func DefaultLoyaltySettings(domain string) *LoyaltySettings {
+	return &LoyaltySettings{
+		Domain:           domain,
+		PointsPerDollar:  1,
+		ExpiryDays:       365,
+		ReviewBonus:      50,
+		ReferralBonus:    200,
+		PointValue:       0.01,
+		MinRedeemPoints:  100,
+		MaxRedeemPercent: 50,
+	}
+}
+
+// UpdateLoyaltySettingsRequest is the request body for changing a domain's
+// loyalty rules (nil fields are left alone)
+type UpdateLoyaltySettingsRequest struct {
+	Enabled          *bool    `json:"enabled,omitempty"`
+	PointsPerDollar  *float64 `json:"points_per_dollar,omitempty"`
+	ExpiryDays       *int     `json:"expiry_days,omitempty"`
+	ReviewBonus      *int     `json:"review_bonus,omitempty"`
+	ReferralBonus    *int     `json:"referral_bonus,omitempty"`
+	PointValue       *float64 `json:"point_value,omitempty"`
+	MinRedeemPoints  *int     `json:"min_redeem_points,omitempty"`
+	MaxRedeemPercent *float64 `json:"max_redeem_percent,omitempty"`
+}
+
+// LoyaltyAccount holds a customer's current points balance
+type LoyaltyAccount struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Domain    string             `bson:"domain" json:"domain"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Points    int                `bson:"points" json:"points"` // Can go negative when points from a refunded order were already spent
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LoyaltyTransaction is an entry in the points ledger. Earned and bonus
+// points (and restored ones) are lots that are spent oldest-expiring first.
+type LoyaltyTransaction struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+	UserID string             `bson:"user_id" json:"user_id"`
+	Type   string             `bson:"type" json:"type"`     // earn, bonus, redeem, restore, reversal, expiry
+	Points int                `bson:"points" json:"points"` // Negative for redeem, reversal and expiry
+
+	// Lots only: points not yet spent or expired
+	Remaining int        `bson:"remaining,omitempty" json:"remaining,omitempty"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+
+	// Reference
+	OrderID     string  `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderNumber string  `bson:"order_number,omitempty" json:"order_number,omitempty"`
+	Amount      float64 `bson:"amount,omitempty" json:"amount,omitempty"`       // Earn: paid total; redeem: discount
+	Reference   string  `bson:"reference,omitempty" json:"reference,omitempty"` // Bonus: review or referral ID
+
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedBy string    `bson:"created_by" json:"created_by"` // system | user_id
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// LoyaltyBalance is what a customer sees of their points
+type LoyaltyBalance struct {
+	Points       int                  `json:"points"`
+	Value        float64              `json:"value"` // Dollar value of the points
+	PointValue   float64              `json:"point_value"`
+	MinRedeem    int                  `json:"min_redeem_points"`
+	NextExpiry   *time.Time           `json:"next_expiry,omitempty"`
+	Expiring     int                  `json:"expiring_points,omitempty"` // Points expiring at next_expiry
+	Transactions []LoyaltyTransaction `json:"transactions"`
+}
+
+// LoyaltyBonusRequest awards bonus points for a review or referral. The
+// reference makes it idempotent: the same review is only rewarded once.
+type LoyaltyBonusRequest struct {
+	UserID    string `json:"user_id"`
+	Type      string `json:"type"`      // review, referral, manual
+	Reference string `json:"reference"` // Review / referral ID (required except for manual)
+	Points    int    `json:"points"`    // Manual bonuses only; review/referral use the domain's settings
+	Reason    string `json:"reason"`
+}
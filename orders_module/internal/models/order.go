@@ -19,21 +19,29 @@ type Order struct {
 	Items []OrderItem `bson:"items" json:"items"`
 
 	// Pricing (MVP: USD only)
-	Currency string  `bson:"currency" json:"currency"`
-	Subtotal float64 `bson:"subtotal" json:"subtotal"`
-	Tax      float64 `bson:"tax" json:"tax"`
-	Shipping float64 `bson:"shipping" json:"shipping"`
-	Total    float64 `bson:"total" json:"total"`
+	Currency  string          `bson:"currency" json:"currency"`
+	Subtotal  float64         `bson:"subtotal" json:"subtotal"`
+	Discount  float64         `bson:"discount,omitempty" json:"discount,omitempty"`   // Sum of Discounts
+	Discounts []OrderDiscount `bson:"discounts,omitempty" json:"discounts,omitempty"` // Itemized discounts
+	Tax       float64         `bson:"tax" json:"tax"`
+	Shipping  float64         `bson:"shipping" json:"shipping"`
+	Total     float64         `bson:"total" json:"total"`
 
 	// Payment
-	Payment Payment `bson:"payment" json:"payment"`
+	Payment            Payment             `bson:"payment" json:"payment"`
+	PaymentAdjustments []PaymentAdjustment `bson:"payment_adjustments,omitempty" json:"payment_adjustments,omitempty"` // Charges/refunds from order edits
+	GiftCardPayments   []GiftCardPayment   `bson:"gift_card_payments,omitempty" json:"gift_card_payments,omitempty"`   // Gift card balances applied before charging the rest
 
 	// Addresses
 	ShippingAddress Address `bson:"shipping_address" json:"shipping_address"`
 	BillingAddress  Address `bson:"billing_address" json:"billing_address"`
 
 	// Status
-	Status string `bson:"status" json:"status"` // pending, paid, processing, shipped, delivered, cancelled, refunded
+	Status string `bson:"status" json:"status"` // pending, paid, processing, partially_shipped, shipped, delivered, cancelled, refunded
+
+	// Shipments and the customer-facing ETA for items on backorder / pre-order
+	Fulfillments   []Fulfillment `bson:"fulfillments,omitempty" json:"fulfillments,omitempty"`
+	ExpectedShipAt *time.Time    `bson:"expected_ship_at,omitempty" json:"expected_ship_at,omitempty"`
 
 	// Timestamps
 	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
@@ -41,8 +49,67 @@ type Order struct {
 	PaidAt    *time.Time `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
 
 	// Metadata
-	Notes      string `bson:"notes,omitempty" json:"notes,omitempty"`
-	AdminNotes string `bson:"admin_notes,omitempty" json:"admin_notes,omitempty"`
+	Notes          string `bson:"notes,omitempty" json:"notes,omitempty"`
+	AdminNotes     string `bson:"admin_notes,omitempty" json:"admin_notes,omitempty"`
+	DraftOrderID   string `bson:"draft_order_id,omitempty" json:"draft_order_id,omitempty"`   // Set when created from a draft
+	SubscriptionID string `bson:"subscription_id,omitempty" json:"subscription_id,omitempty"` // Set for subscription renewals
+
+	// Loyalty points spent on and earned by this order
+	LoyaltyPointsRedeemed int `bson:"loyalty_points_redeemed,omitempty" json:"loyalty_points_redeemed,omitempty"`
+	LoyaltyPointsEarned   int `bson:"loyalty_points_earned,omitempty" json:"loyalty_points_earned,omitempty"`
+
+	// Invitation the customer signed up with, for promo/referral reporting
+	Attribution *OrderAttribution `bson:"attribution,omitempty" json:"attribution,omitempty"`
+
+	// History of changes made after the order was placed
+	History []OrderEvent `bson:"history,omitempty" json:"history,omitempty"`
+
+	// Fraud/velocity check outcome (admin only, stripped from customer responses)
+	Risk *RiskAssessment `bson:"risk,omitempty" json:"risk,omitempty"`
+
+	// Stripe fees and net amount, from the imported payouts
+	Settlement *OrderSettlement `bson:"settlement,omitempty" json:"settlement,omitempty"`
+
+	// Set once customer details were scrubbed (retention policy or customer request)
+	AnonymizedAt *time.Time `bson:"anonymized_at,omitempty" json:"anonymized_at,omitempty"`
+}
+
+// OrderEvent is an entry in an order's history
+type OrderEvent struct {
+	Type      string                 `bson:"type" json:"type"` // status_changed, items_edited, ...
+	Message   string                 `bson:"message" json:"message"`
+	Actor     string                 `bson:"actor" json:"actor"` // system | user_id
+	Data      map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// PaymentAdjustment is an extra charge or a refund after the order was paid
+type PaymentAdjustment struct {
+	ID              string    `bson:"id,omitempty" json:"id,omitempty"`
+	Type            string    `bson:"type" json:"type"` // charge, refund
+	Amount          int64     `bson:"amount" json:"amount"` // Cents
+	PaymentIntentID string    `bson:"payment_intent_id,omitempty" json:"payment_intent_id,omitempty"` // For charges
+	ClientSecret    string    `bson:"client_secret,omitempty" json:"client_secret,omitempty"`         // For charges
+	RefundID        string    `bson:"refund_id,omitempty" json:"refund_id,omitempty"`                 // For refunds
+	Status          string    `bson:"status" json:"status"` // reserved (saved, not sent to Stripe yet), pending, succeeded, failed
+	Reason          string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+// OrderDiscount is one discount applied to an order
+type OrderDiscount struct {
+	Type        string  `bson:"type" json:"type"` // manual, subscription, loyalty, coupon, invitation
+	Code        string  `bson:"code,omitempty" json:"code,omitempty"`
+	Description string  `bson:"description,omitempty" json:"description,omitempty"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// OrderAttribution links an order to the invitation its customer accepted
+type OrderAttribution struct {
+	InvitationID string `bson:"invitation_id" json:"invitation_id"`
+	PromoCode    string `bson:"promo_code,omitempty" json:"promo_code,omitempty"`
+	Source       string `bson:"source,omitempty" json:"source,omitempty"` // booth, instagram, ...
+	Ref          string `bson:"ref,omitempty" json:"ref,omitempty"`       // Referrer (sales rep, affiliate)
 }
 
 // Customer information
@@ -63,16 +130,59 @@ type OrderItem struct {
 	Quantity          int                    `bson:"quantity" json:"quantity"`
 	UnitPrice         float64                `bson:"unit_price" json:"unit_price"`
 	Total             float64                `bson:"total" json:"total"`
+	Custom            bool                   `bson:"custom,omitempty" json:"custom,omitempty"` // Custom line item (not in catalog)
+
+	// Gift card lines: the product type snapshot and who the cards are for
+	ProductType string             `bson:"product_type,omitempty" json:"product_type,omitempty"` // gift_card (empty for physical products)
+	GiftCard    *GiftCardRecipient `bson:"gift_card,omitempty" json:"gift_card,omitempty"`
+
+	// Stock availability when the order was placed / paid
+	Availability        string     `bson:"availability,omitempty" json:"availability,omitempty"`                 // in_stock, backorder, preorder
+	BackorderedQuantity int        `bson:"backordered_quantity,omitempty" json:"backordered_quantity,omitempty"` // Units still waiting for stock
+	ExpectedAt          *time.Time `bson:"expected_at,omitempty" json:"expected_at,omitempty"`                   // When the waiting units should arrive
+	ShippedQuantity     int        `bson:"shipped_quantity,omitempty" json:"shipped_quantity,omitempty"`
+}
+
+// Fulfillment is a shipment of some or all of an order's items
+type Fulfillment struct {
+	ID             string            `bson:"id" json:"id"`
+	Items          []FulfillmentItem `bson:"items" json:"items"`
+	Carrier        string            `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	TrackingNumber string            `bson:"tracking_number,omitempty" json:"tracking_number,omitempty"`
+	CreatedBy      string            `bson:"created_by" json:"created_by"`
+	CreatedAt      time.Time         `bson:"created_at" json:"created_at"`
+}
+
+// FulfillmentItem is the quantity of one order item in a shipment
+type FulfillmentItem struct {
+	ProductID string `bson:"product_id" json:"product_id"`
+	VariantID string `bson:"variant_id" json:"variant_id"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+}
+
+// CreateFulfillmentRequest ships items that are in stock. Without items,
+// everything that can ship is shipped.
+type CreateFulfillmentRequest struct {
+	Items          []FulfillmentItem `json:"items"`
+	Carrier        string            `json:"carrier"`
+	TrackingNumber string            `json:"tracking_number"`
 }
 
 // Payment information
 type Payment struct {
-	Provider        string  `bson:"provider" json:"provider"`                   // stripe
+	Provider        string  `bson:"provider" json:"provider"`                   // stripe, gift_card / none (nothing left to charge)
 	PaymentIntentID string  `bson:"payment_intent_id" json:"payment_intent_id"` // Stripe payment intent ID
-	Status          string  `bson:"status" json:"status"`                       // pending, succeeded, failed, refunded
+	Status          string  `bson:"status" json:"status"`                       // pending, authorized, succeeded, failed, refunded
 	Amount          int64   `bson:"amount" json:"amount"`                       // Stripe uses cents
 	Currency        string  `bson:"currency" json:"currency"`
 	ClientSecret    string  `bson:"client_secret,omitempty" json:"client_secret,omitempty"` // For frontend
+	CustomerID      string  `bson:"customer_id,omitempty" json:"customer_id,omitempty"`     // Stripe Customer (logged-in customers)
+	PaymentMethodID string  `bson:"payment_method_id,omitempty" json:"payment_method_id,omitempty"` // Saved card charged off-session (renewals)
+
+	// Stripe-hosted Checkout (checkout_session mode). The payment intent ID is
+	// only known once the customer completes the session.
+	CheckoutSessionID string `bson:"checkout_session_id,omitempty" json:"checkout_session_id,omitempty"`
+	CheckoutURL       string `bson:"checkout_url,omitempty" json:"checkout_url,omitempty"` // Where to send the customer to pay
 }
 
 // Address for shipping/billing
@@ -101,6 +211,37 @@ type CreateOrderRequest struct {
 	ShippingAddress Address     `json:"shipping_address"`
 	BillingAddress  Address     `json:"billing_address"`
 	Notes           string      `json:"notes,omitempty"`
+
+	// Saved addresses (logged-in customers only, override the inline addresses)
+	ShippingAddressID string `json:"shipping_address_id,omitempty"`
+	BillingAddressID  string `json:"billing_address_id,omitempty"`
+
+	// Discount code entered at checkout
+	CouponCode string `json:"coupon_code,omitempty"`
+
+	// Loyalty points to spend as a discount (logged-in customers only)
+	RedeemPoints int `json:"redeem_points,omitempty"`
+
+	// Gift card codes paying for the order before the rest is charged
+	GiftCardCodes []string `json:"gift_card_codes,omitempty"`
+
+	// Set by the handler, used by the risk checks
+	ClientIP string `json:"-"`
+}
+
+// EditOrderItemsRequest is the request body for changing line items after
+// an order was placed. Each change sets the quantity of a product variant:
+// 0 removes the line, a new product/variant adds a catalog-priced line.
+type EditOrderItemsRequest struct {
+	Items  []OrderItemChange `json:"items"`
+	Reason string            `json:"reason,omitempty"`
+}
+
+// OrderItemChange sets the quantity of one line item
+type OrderItemChange struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
 }
 
 // UpdateOrderDetailsRequest is the request body for updating order details
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// OrderNumberFormat is a domain's template for order numbers, e.g.
+// ORD-2026-00042 (yearly reset) or OYH-000042-K7Q (never reset, random suffix)
+type OrderNumberFormat struct {
+	Domain             string    `bson:"_id" json:"domain"`
+	Prefix             string    `bson:"prefix" json:"prefix"`                             // "ORD", may be empty
+	Padding            int       `bson:"padding" json:"padding"`                           // Zero-padded sequence width
+	Reset              string    `bson:"reset" json:"reset"`                               // yearly (year in the number) | never
+	RandomSuffixLength int       `bson:"random_suffix_length" json:"random_suffix_length"` // 0 for no suffix
+	UpdatedBy          string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt          time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DefaultOrderNumberFormat returns the format used when a domain hasn't set
+// one: ORD-{year}-{sequence:05d}
+func DefaultOrderNumberFormat(domain string) *OrderNumberFormat {
+	return &OrderNumberFormat{
+		Domain:  domain,
+		Prefix:  "ORD",
+		Padding: 5,
+		Reset:   "yearly",
+	}
+}
+
+// UpdateOrderNumberFormatRequest is the request body for changing a domain's
+// order number format
+type UpdateOrderNumberFormatRequest struct {
+	Prefix             *string `json:"prefix,omitempty"`
+	Padding            *int    `json:"padding,omitempty"`
+	Reset              *string `json:"reset,omitempty"`
+	RandomSuffixLength *int    `json:"random_suffix_length,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// Packing document formats
+const (
+	PackingFormatHTML = "html"
+	PackingFormatPDF  = "pdf"
+)
+
+// PackingSlip is the printable list of what goes in an order's parcel
+type PackingSlip struct {
+	OrderID         string            `json:"order_id"`
+	OrderNumber     string            `json:"order_number"`
+	Domain          string            `json:"domain"`
+	Customer        Customer          `json:"customer"`
+	ShippingAddress Address           `json:"shipping_address"`
+	Notes           string            `json:"notes,omitempty"`
+	OrderedAt       time.Time         `json:"ordered_at"`
+	Items           []PackingSlipItem `json:"items"`               // Units to pack now
+	ToFollow        []PackingSlipItem `json:"to_follow,omitempty"` // Backordered units shipped later
+}
+
+// PackingSlipItem is one line of a packing slip
+type PackingSlipItem struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	VariantID   string `json:"variant_id"`
+	VariantSKU  string `json:"variant_sku"`
+	Options     string `json:"options,omitempty"` // Variant attributes, e.g. "color: red, size: M"
+	Quantity    int    `json:"quantity"`
+}
+
+// PickList sums the units to pick for several orders per variant
+type PickList struct {
+	Domain      string         `json:"domain"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Orders      []string       `json:"orders"` // Order numbers included
+	Lines       []PickListLine `json:"lines"`  // Sorted by SKU
+	TotalUnits  int            `json:"total_units"`
+}
+
+// PickListLine is one variant to pick and the orders it goes to
+type PickListLine struct {
+	ProductID   string          `json:"product_id"`
+	ProductName string          `json:"product_name"`
+	VariantID   string          `json:"variant_id"`
+	VariantSKU  string          `json:"variant_sku"`
+	Options     string          `json:"options,omitempty"`
+	Quantity    int             `json:"quantity"`
+	Orders      []PickListOrder `json:"orders"`
+}
+
+// PickListOrder is the quantity of a pick list line that goes to one order
+type PickListOrder struct {
+	OrderID     string `json:"order_id"`
+	OrderNumber string `json:"order_number"`
+	Quantity    int    `json:"quantity"`
+}
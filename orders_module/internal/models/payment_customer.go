@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentCustomer links an auth_module user to their Stripe Customer on a
+// domain, so saved payment methods can be reused at checkout
+type PaymentCustomer struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain           string             `bson:"domain" json:"domain"`
+	UserID           string             `bson:"user_id" json:"user_id"`
+	Email            string             `bson:"email,omitempty" json:"email,omitempty"`
+	StripeCustomerID string             `bson:"stripe_customer_id" json:"stripe_customer_id"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// SavedPaymentMethod is a card saved on a customer's Stripe Customer
+type SavedPaymentMethod struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // card
+	Brand    string `json:"brand,omitempty"`
+	Last4    string `json:"last4,omitempty"`
+	ExpMonth int64  `json:"exp_month,omitempty"`
+	ExpYear  int64  `json:"exp_year,omitempty"`
+	Wallet   string `json:"wallet,omitempty"` // apple_pay, google_pay, ...
+}
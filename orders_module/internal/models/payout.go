@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+)
+
+// How an imported balance transaction matched the orders
+const (
+	SettlementMatched    = "matched"    // Tied to an order and the amounts agree
+	SettlementMismatched = "mismatched" // Tied to an order, but the amount, currency or order status disagrees
+	SettlementUnmatched  = "unmatched"  // No order has the payment intent
+)
+
+// StripePayout is a transfer from the Stripe balance to the bank, with the
+// totals of the balance transactions it pays out
+type StripePayout struct {
+	ID          string    `bson:"_id" json:"id"` // po_...
+	Amount      float64   `bson:"amount" json:"amount"`
+	Currency    string    `bson:"currency" json:"currency"`
+	Status      string    `bson:"status" json:"status"` // paid, pending, in_transit, canceled, failed
+	ArrivalDate time.Time `bson:"arrival_date" json:"arrival_date"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+
+	Transactions int     `bson:"transactions" json:"transactions"`
+	Gross        float64 `bson:"gross" json:"gross"`
+	Fees         float64 `bson:"fees" json:"fees"`
+	Net          float64 `bson:"net" json:"net"`
+	Difference   float64 `bson:"difference" json:"difference"` // Amount - Net, should be 0
+	Matched      int     `bson:"matched" json:"matched"`
+	Mismatched   int     `bson:"mismatched" json:"mismatched"`
+	Unmatched    int     `bson:"unmatched" json:"unmatched"`
+
+	ImportedAt time.Time `bson:"imported_at" json:"imported_at"`
+}
+
+// BalanceTransaction is a Stripe balance transaction paid out by a payout
+// and the order it was matched to. Amounts are negative for money going
+// out (refunds); the fee is what Stripe kept and Net = Amount - Fee.
+type BalanceTransaction struct {
+	ID                string    `bson:"_id" json:"id"` // txn_...
+	PayoutID          string    `bson:"payout_id" json:"payout_id"`
+	Type              string    `bson:"type" json:"type"` // charge, payment, refund, payment_refund, adjustment, stripe_fee, ...
+	ReportingCategory string    `bson:"reporting_category,omitempty" json:"reporting_category,omitempty"`
+	SourceID          string    `bson:"source_id,omitempty" json:"source_id,omitempty"` // ch_..., re_..., ...
+	PaymentIntentID   string    `bson:"payment_intent_id,omitempty" json:"payment_intent_id,omitempty"`
+	Amount            float64   `bson:"amount" json:"amount"`
+	Fee               float64   `bson:"fee" json:"fee"`
+	Net               float64   `bson:"net" json:"net"`
+	Currency          string    `bson:"currency" json:"currency"`
+	Description       string    `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt         time.Time `bson:"created_at" json:"created_at"` // On Stripe
+
+	// Matching
+	Status      string `bson:"status" json:"status"` // matched, mismatched, unmatched
+	Problem     string `bson:"problem,omitempty" json:"problem,omitempty"`
+	Domain      string `bson:"domain,omitempty" json:"domain,omitempty"`
+	OrderID     string `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	OrderNumber string `bson:"order_number,omitempty" json:"order_number,omitempty"`
+
+	ImportedAt time.Time `bson:"imported_at" json:"imported_at"`
+}
+
+// OrderSettlement sums the Stripe balance transactions of an order: what
+// was collected after refunds, the processing fees and what reached the bank
+type OrderSettlement struct {
+	Gross     float64   `bson:"gross" json:"gross"`
+	Fees      float64   `bson:"fees" json:"fees"`
+	Net       float64   `bson:"net" json:"net"`
+	Currency  string    `bson:"currency" json:"currency"`
+	PayoutIDs []string  `bson:"payout_ids" json:"payout_ids"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// PayoutReport reconciles the payouts that arrived in a period with the
+// orders: their totals and every transaction that didn't match cleanly
+type PayoutReport struct {
+	From       *time.Time           `json:"from,omitempty"`
+	To         *time.Time           `json:"to,omitempty"`
+	Payouts    []StripePayout       `json:"payouts"`
+	Amount     float64              `json:"amount"` // Paid out
+	Gross      float64              `json:"gross"`
+	Fees       float64              `json:"fees"`
+	Net        float64              `json:"net"`
+	Matched    int                  `json:"matched"`
+	Mismatched int                  `json:"mismatched"`
+	Unmatched  int                  `json:"unmatched"`
+	Problems   []BalanceTransaction `json:"problems"` // Mismatched and unmatched transactions
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What started an anonymization
+const (
+	AnonymizationRetention = "retention" // Orders older than the domain's retention period
+	AnonymizationRequest   = "request"   // A customer asked to be forgotten
+)
+
+// RetentionSettings is how long a domain keeps customer details on orders
+type RetentionSettings struct {
+	Domain              string `bson:"_id" json:"domain"`
+	Enabled             bool   `bson:"enabled" json:"enabled"`
+	AnonymizeAfterYears int    `bson:"anonymize_after_years" json:"anonymize_after_years"` // Orders placed longer ago are anonymized
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DefaultRetentionSettings returns the policy used when a domain hasn't set
+// one. Nothing is anonymized until a domain enables it.
+func DefaultRetentionSettings(domain string) *RetentionSettings {
+	return &RetentionSettings{
+		Domain:              domain,
+		AnonymizeAfterYears: 7,
+	}
+}
+
+// UpdateRetentionSettingsRequest changes a domain's retention policy (nil fields are left alone)
+type UpdateRetentionSettingsRequest struct {
+	Enabled             *bool `json:"enabled,omitempty"`
+	AnonymizeAfterYears *int  `json:"anonymize_after_years,omitempty"`
+}
+
+// AnonymizeCustomerRequest scrubs a customer's details from all their orders
+type AnonymizeCustomerRequest struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason,omitempty"` // e.g. a support ticket reference
+}
+
+// AnonymizationAudit records what an anonymization scrubbed. The customer's
+// email is only kept as a hash, so a later request can be matched to it.
+type AnonymizationAudit struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain       string             `bson:"domain" json:"domain"`
+	Trigger      string             `bson:"trigger" json:"trigger"`                           // retention, request
+	EmailHash    string             `bson:"email_hash,omitempty" json:"email_hash,omitempty"` // SHA-256 of the lowercased email (requests)
+	Cutoff       *time.Time         `bson:"cutoff,omitempty" json:"cutoff,omitempty"`         // Orders placed before this (retention)
+	Reason       string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Orders       int                `bson:"orders" json:"orders"`
+	OrderNumbers []string           `bson:"order_numbers" json:"order_numbers"`
+	Fields       []string           `bson:"fields" json:"fields"`                           // Order fields scrubbed
+	Profiles     int                `bson:"profiles" json:"profiles"`                       // Customer profiles recomputed or removed
+	Addresses    int                `bson:"addresses" json:"addresses"`                     // Saved addresses removed (requests)
+	Untouched    []string           `bson:"untouched,omitempty" json:"untouched,omitempty"` // Collections that may still hold the customer's details (requests)
+	CreatedBy    string             `bson:"created_by" json:"created_by"`                   // Admin user ID, cli or system
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
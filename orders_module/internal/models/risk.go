@@ -0,0 +1,120 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Risk check actions and decisions, from least to most severe
+const (
+	RiskActionAllow  = "allow"
+	RiskActionReview = "review" // Order is placed, payment is only authorized until an admin approves it
+	RiskActionReject = "reject" // Order is not placed
+)
+
+// RiskSettings are a domain's fraud and velocity rules
+type RiskSettings struct {
+	Domain string `bson:"_id" json:"domain"`
+
+	// Orders above this total (0 = no limit)
+	MaxOrderTotal       float64 `bson:"max_order_total" json:"max_order_total"`
+	MaxOrderTotalAction string  `bson:"max_order_total_action" json:"max_order_total_action"` // review | reject
+
+	// Billing country differs from shipping country ("" or allow = off)
+	CountryMismatchAction string `bson:"country_mismatch_action" json:"country_mismatch_action"`
+
+	// Email, IP, card fingerprint or shipping country on the blocklist
+	BlocklistAction string `bson:"blocklist_action" json:"blocklist_action"` // review | reject
+
+	Velocity []VelocityRule `bson:"velocity" json:"velocity"`
+
+	UpdatedBy string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// VelocityRule limits how many orders one email, IP or card may place in a window
+type VelocityRule struct {
+	Key           string `bson:"key" json:"key"`               // email | ip | card
+	MaxOrders     int    `bson:"max_orders" json:"max_orders"` // Orders allowed within the window
+	WindowMinutes int    `bson:"window_minutes" json:"window_minutes"`
+	Action        string `bson:"action" json:"action"` // review | reject
+}
+
+// DefaultRiskSettings returns the rules used when a domain hasn't set any:
+// only the blocklist is enforced
+func DefaultRiskSettings(domain string) *RiskSettings {
+	return &RiskSettings{
+		Domain:              domain,
+		MaxOrderTotalAction: RiskActionReview,
+		BlocklistAction:     RiskActionReject,
+		Velocity:            []VelocityRule{},
+	}
+}
+
+// UpdateRiskSettingsRequest is the request body for changing a domain's risk
+// rules (nil fields are left alone, velocity replaces all rules)
+type UpdateRiskSettingsRequest struct {
+	MaxOrderTotal         *float64       `json:"max_order_total,omitempty"`
+	MaxOrderTotalAction   *string        `json:"max_order_total_action,omitempty"`
+	CountryMismatchAction *string        `json:"country_mismatch_action,omitempty"`
+	BlocklistAction       *string        `json:"blocklist_action,omitempty"`
+	Velocity              []VelocityRule `json:"velocity,omitempty"`
+}
+
+// RiskAssessment is the outcome of the risk checks for an order
+type RiskAssessment struct {
+	Decision        string            `bson:"decision" json:"decision"` // allow, review, reject
+	Checks          []RiskCheckResult `bson:"checks,omitempty" json:"checks,omitempty"`
+	Email           string            `bson:"email,omitempty" json:"email,omitempty"` // Lowercased and trimmed, for the velocity limits
+	IP              string            `bson:"ip,omitempty" json:"ip,omitempty"`
+	CardFingerprint string            `bson:"card_fingerprint,omitempty" json:"card_fingerprint,omitempty"` // Of the card Stripe authorized
+	CardCheck       string            `bson:"card_check,omitempty" json:"card_check,omitempty"`             // pending until the authorized card is screened, then done
+	AssessedAt      time.Time         `bson:"assessed_at" json:"assessed_at"`
+
+	// Manual review (decision review only)
+	ReviewStatus string     `bson:"review_status,omitempty" json:"review_status,omitempty"` // pending, approved, rejected
+	ReviewedBy   string     `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	ReviewNote   string     `bson:"review_note,omitempty" json:"review_note,omitempty"`
+}
+
+// RiskCheckResult is a check that flagged the order
+type RiskCheckResult struct {
+	Check  string `bson:"check" json:"check"`   // blocklist, max_order_total, country_mismatch, velocity
+	Action string `bson:"action" json:"action"` // review, reject
+	Reason string `bson:"reason" json:"reason"`
+}
+
+// RiskRejection records an order attempt that was rejected by the risk checks
+type RiskRejection struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain     string             `bson:"domain" json:"domain"`
+	Email      string             `bson:"email" json:"email"`
+	Total      float64            `bson:"total" json:"total"`
+	Assessment RiskAssessment     `bson:"assessment" json:"assessment"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// BlocklistEntry blocks an email, IP, card fingerprint or shipping country
+type BlocklistEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain    string             `bson:"domain" json:"domain"`
+	Type      string             `bson:"type" json:"type"` // email, ip, card, country
+	Value     string             `bson:"value" json:"value"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedBy string             `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CreateBlocklistEntryRequest is the request body for blocking a value
+type CreateBlocklistEntryRequest struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// RiskReviewRequest is the request body for approving or rejecting a flagged order
+type RiskReviewRequest struct {
+	Note string `json:"note"`
+}
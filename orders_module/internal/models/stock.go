@@ -31,3 +31,63 @@ type StockTransaction struct {
 	Reason    string    `bson:"reason" json:"reason"`
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 }
+
+// StockAdjustmentRequest records a manual stock change for a variant
+type StockAdjustmentRequest struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id"`
+	Type      string `json:"type"`     // restock, adjustment, return
+	Quantity  int    `json:"quantity"` // Positive for restock/return, either sign for adjustment
+	Reason    string `json:"reason"`
+	OrderID   string `json:"order_id,omitempty"` // Returns: the order the items came back from
+}
+
+// StockLedger is the stock history of a product (or one of its variants)
+type StockLedger struct {
+	Domain    string             `json:"domain"`
+	ProductID string             `json:"product_id"`
+	VariantID string             `json:"variant_id,omitempty"`
+	Entries   []StockLedgerEntry `json:"entries"`
+
+	// Per-variant stock replayed from the ledger before the first entry and after the last
+	OpeningBalances map[string]int `json:"opening_balances"`
+	ClosingBalances map[string]int `json:"closing_balances"`
+}
+
+// StockLedgerEntry is a stock transaction with the variant's running balance
+type StockLedgerEntry struct {
+	StockTransaction
+	Balance int `json:"balance"` // Variant stock after this entry, replayed from the ledger
+}
+
+// StockReconciliation is the result of comparing the stock_transactions
+// ledger with catalog stock for one domain
+type StockReconciliation struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+
+	VariantsChecked   int                `bson:"variants_checked" json:"variants_checked"`
+	UntrackedVariants int                `bson:"untracked_variants" json:"untracked_variants"` // No ledger entries yet, nothing to compare
+	Discrepancies     []StockDiscrepancy `bson:"discrepancies" json:"discrepancies"`
+	Fix               bool               `bson:"fix" json:"fix"` // Corrective adjustments were requested
+
+	CreatedBy  string    `bson:"created_by" json:"created_by"` // system (scheduled job) | cli | user_id
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time `bson:"finished_at" json:"finished_at"`
+}
+
+// StockDiscrepancy is a variant whose catalog stock differs from the stock
+// its ledger adds up to
+type StockDiscrepancy struct {
+	ProductID   string `bson:"product_id" json:"product_id"`
+	ProductName string `bson:"product_name" json:"product_name"`
+	VariantID   string `bson:"variant_id" json:"variant_id"`
+	SKU         string `bson:"sku,omitempty" json:"sku,omitempty"`
+
+	LedgerStock  int `bson:"ledger_stock" json:"ledger_stock"`   // First stock_before plus all ledger quantities
+	CatalogStock int `bson:"catalog_stock" json:"catalog_stock"` // ProductVariant.Stock in products_module
+	Difference   int `bson:"difference" json:"difference"`       // CatalogStock - LedgerStock
+
+	// Set when a corrective adjustment was written
+	TransactionID string `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SubscriptionPlan offers a product variant as a recurring delivery, e.g.
+// "every 4, 6 or 8 weeks, 10% off"
+type SubscriptionPlan struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain    string             `bson:"domain" json:"domain"`
+	ProductID string             `bson:"product_id" json:"product_id"`
+	VariantID string             `bson:"variant_id" json:"variant_id"`
+	Name      string             `bson:"name" json:"name"`
+
+	// Delivery intervals customers can choose from
+	IntervalUnit   string `bson:"interval_unit" json:"interval_unit"`     // day, week, month
+	IntervalCounts []int  `bson:"interval_counts" json:"interval_counts"` // e.g. [4, 6, 8]
+
+	// Subscribe & save discount on the catalog price of every delivery
+	DiscountPercent float64 `bson:"discount_percent" json:"discount_percent"`
+
+	Active    bool      `bson:"active" json:"active"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Subscription is a customer's recurring delivery of one plan
+type Subscription struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain string             `bson:"domain" json:"domain"`
+	PlanID string             `bson:"plan_id" json:"plan_id"`
+
+	// Customer (logged-in users only, renewals are charged off-session)
+	Customer        Customer `bson:"customer" json:"customer"`
+	PaymentMethodID string   `bson:"payment_method_id" json:"payment_method_id"` // Saved card on the user's Stripe Customer
+
+	// What and how often
+	ProductID     string `bson:"product_id" json:"product_id"`
+	VariantID     string `bson:"variant_id" json:"variant_id"`
+	Quantity      int    `bson:"quantity" json:"quantity"`
+	IntervalUnit  string `bson:"interval_unit" json:"interval_unit"`
+	IntervalCount int    `bson:"interval_count" json:"interval_count"`
+
+	// Addresses
+	ShippingAddress Address `bson:"shipping_address" json:"shipping_address"`
+	BillingAddress  Address `bson:"billing_address" json:"billing_address"`
+
+	// Status
+	Status      string     `bson:"status" json:"status"` // active, paused, past_due, cancelled
+	NextRunAt   time.Time  `bson:"next_run_at" json:"next_run_at"`
+	PausedUntil *time.Time `bson:"paused_until,omitempty" json:"paused_until,omitempty"` // Resumes automatically (nil = until resumed)
+
+	// Renewals
+	RenewalCount   int    `bson:"renewal_count" json:"renewal_count"`
+	LastOrderID    string `bson:"last_order_id,omitempty" json:"last_order_id,omitempty"`
+	PendingOrderID string `bson:"pending_order_id,omitempty" json:"pending_order_id,omitempty"` // Renewal whose payment failed, retried by dunning
+
+	// Dunning
+	FailedAttempts    int        `bson:"failed_attempts" json:"failed_attempts"`
+	LastFailureReason string     `bson:"last_failure_reason,omitempty" json:"last_failure_reason,omitempty"`
+	NextRetryAt       *time.Time `bson:"next_retry_at,omitempty" json:"next_retry_at,omitempty"`
+
+	// Scheduler claim, so only one instance renews a subscription at a time
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"-"`
+
+	History []OrderEvent `bson:"history,omitempty" json:"history,omitempty"`
+
+	CreatedAt    time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `bson:"updated_at" json:"updated_at"`
+	CancelledAt  *time.Time `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	CancelReason string     `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"` // customer, admin, payment_failed, plan_unavailable
+}
+
+// CreateSubscriptionPlanRequest is the request body for creating a plan
+type CreateSubscriptionPlanRequest struct {
+	ProductID       string  `json:"product_id"`
+	VariantID       string  `json:"variant_id"`
+	Name            string  `json:"name"`
+	IntervalUnit    string  `json:"interval_unit"`
+	IntervalCounts  []int   `json:"interval_counts"`
+	DiscountPercent float64 `json:"discount_percent"`
+}
+
+// UpdateSubscriptionPlanRequest changes a plan (nil fields are left alone).
+// Existing subscriptions keep their interval.
+type UpdateSubscriptionPlanRequest struct {
+	Name            *string  `json:"name,omitempty"`
+	IntervalCounts  []int    `json:"interval_counts,omitempty"`
+	DiscountPercent *float64 `json:"discount_percent,omitempty"`
+	Active          *bool    `json:"active,omitempty"`
+}
+
+// CreateSubscriptionRequest is the request body for subscribing to a plan
+type CreateSubscriptionRequest struct {
+	PlanID          string `json:"plan_id"`
+	Quantity        int    `json:"quantity"`
+	IntervalCount   int    `json:"interval_count"`
+	PaymentMethodID string `json:"payment_method_id"`
+
+	// Inline addresses or saved address book entries (defaults are used when both are empty)
+	ShippingAddress   Address `json:"shipping_address"`
+	BillingAddress    Address `json:"billing_address"`
+	ShippingAddressID string  `json:"shipping_address_id,omitempty"`
+	BillingAddressID  string  `json:"billing_address_id,omitempty"`
+
+	// First delivery; now when empty
+	StartAt *time.Time `json:"start_at,omitempty"`
+}
+
+// UpdateSubscriptionRequest changes a subscription (nil fields are left alone)
+type UpdateSubscriptionRequest struct {
+	Quantity        *int       `json:"quantity,omitempty"`
+	IntervalCount   *int       `json:"interval_count,omitempty"`
+	PaymentMethodID *string    `json:"payment_method_id,omitempty"`
+	ShippingAddress *Address   `json:"shipping_address,omitempty"`
+	BillingAddress  *Address   `json:"billing_address,omitempty"`
+	NextRunAt       *time.Time `json:"next_run_at,omitempty"`
+}
+
+// PauseSubscriptionRequest pauses deliveries, until a date or until resumed
+type PauseSubscriptionRequest struct {
+	Until *time.Time `json:"until,omitempty"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Order events that can be delivered to merchant webhook endpoints
+const (
+	WebhookEventOrderCreated   = "order.created"
+	WebhookEventOrderPaid      = "order.paid"
+	WebhookEventOrderShipped   = "order.shipped"
+	WebhookEventOrderCancelled = "order.cancelled"
+	WebhookEventOrderRefunded  = "order.refunded"
+)
+
+// WebhookEvents lists every event an endpoint can subscribe to
+var WebhookEvents = []string{
+	WebhookEventOrderCreated,
+	WebhookEventOrderPaid,
+	WebhookEventOrderShipped,
+	WebhookEventOrderCancelled,
+	WebhookEventOrderRefunded,
+}
+
+// WebhookEndpoint is a merchant URL that receives order events for a domain
+type WebhookEndpoint struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain      string             `bson:"domain" json:"domain"`
+	URL         string             `bson:"url" json:"url"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Events      []string           `bson:"events" json:"events"`
+	Active      bool               `bson:"active" json:"active"`
+
+	// Signing secret, only returned when the endpoint is created
+	Secret string `bson:"secret" json:"-"`
+
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// WebhookDelivery is one event sent (or to be sent) to one endpoint
+type WebhookDelivery struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain     string             `bson:"domain" json:"domain"`
+	EndpointID primitive.ObjectID `bson:"endpoint_id" json:"endpoint_id"`
+	EventID    string             `bson:"event_id" json:"event_id"` // Same for redeliveries, so receivers can dedupe
+	Event      string             `bson:"event" json:"event"`
+	OrderID    string             `bson:"order_id" json:"order_id"`
+	Payload    string             `bson:"payload" json:"payload"` // Exact JSON body that is signed and sent
+
+	// Delivery state
+	Status        string     `bson:"status" json:"status"` // pending, delivering, succeeded, failed
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at" json:"next_attempt_at"`
+	LastAttemptAt *time.Time `bson:"last_attempt_at,omitempty" json:"last_attempt_at,omitempty"`
+
+	// Result of the last attempt
+	ResponseStatus int    `bson:"response_status,omitempty" json:"response_status,omitempty"`
+	ResponseBody   string `bson:"response_body,omitempty" json:"response_body,omitempty"` // Truncated
+	Error          string `bson:"error,omitempty" json:"error,omitempty"`
+
+	RedeliveryOf string    `bson:"redelivery_of,omitempty" json:"redelivery_of,omitempty"` // Original delivery ID
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// WebhookPayload is the JSON body of a delivery
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Domain    string          `json:"domain"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"` // {"order": {...}}
+}
+
+// CreateWebhookEndpointRequest registers a webhook endpoint
+type CreateWebhookEndpointRequest struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+}
+
+// UpdateWebhookEndpointRequest changes an endpoint (nil fields are left alone)
+type UpdateWebhookEndpointRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
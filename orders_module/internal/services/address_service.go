@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAddressNotFound is returned when a saved address doesn't exist for the user
+var ErrAddressNotFound = errors.New("address not found")
+
+// AddressService manages customer address books
+type AddressService struct {
+	db *database.MongoDB
+}
+
+func NewAddressService(db *database.MongoDB) *AddressService {
+	return &AddressService{db: db}
+}
+
+// ListAddresses lists a user's saved addresses, defaults first
+func (s *AddressService) ListAddresses(ctx context.Context, userID, domain string) ([]*models.SavedAddress, error) {
+	collection := s.db.GetCollection("addresses")
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "is_default_shipping", Value: -1},
+		{Key: "is_default_billing", Value: -1},
+		{Key: "created_at", Value: -1},
+	})
+
+	cursor, err := collection.Find(ctx, bson.M{"domain": domain, "user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	addresses := []*models.SavedAddress{}
+	if err := cursor.All(ctx, &addresses); err != nil {
+		return nil, fmt.Errorf("failed to decode addresses: %w", err)
+	}
+
+	return addresses, nil
+}
+
+// GetAddress retrieves a saved address owned by the user
+func (s *AddressService) GetAddress(ctx context.Context, addressID, userID, domain string) (*models.SavedAddress, error) {
+	collection := s.db.GetCollection("addresses")
+
+	objectID, err := primitive.ObjectIDFromHex(addressID)
+	if err != nil {
+		return nil, ErrAddressNotFound
+	}
+
+	var address models.SavedAddress
+	err = collection.FindOne(ctx, bson.M{
+		"_id":     objectID,
+		"domain":  domain,
+		"user_id": userID,
+	}).Decode(&address)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address: %w", err)
+	}
+
+	return &address, nil
+}
+
+// CreateAddress validates and saves a new address. The user's first address
+// becomes their default shipping and billing address.
+func (s *AddressService) CreateAddress(ctx context.Context, req *models.CreateAddressRequest, userID, domain string) (*models.SavedAddress, error) {
+	collection := s.db.GetCollection("addresses")
+
+	NormalizeAddress(&req.Address)
+	if err := ValidateAddress(req.Address); err != nil {
+		return nil, err
+	}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"domain": domain, "user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count addresses: %w", err)
+	}
+
+	now := time.Now()
+	address := &models.SavedAddress{
+		ID:                primitive.NewObjectID(),
+		Domain:            domain,
+		UserID:            userID,
+		Label:             req.Label,
+		Address:           req.Address,
+		IsDefaultShipping: req.IsDefaultShipping || count == 0,
+		IsDefaultBilling:  req.IsDefaultBilling || count == 0,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	if err := s.clearDefaults(ctx, userID, domain, address.IsDefaultShipping, address.IsDefaultBilling); err != nil {
+		return nil, err
+	}
+
+	if _, err := collection.InsertOne(ctx, address); err != nil {
+		return nil, fmt.Errorf("failed to insert address: %w", err)
+	}
+
+	return address, nil
+}
+
+// UpdateAddress updates a saved address and its default flags
+func (s *AddressService) UpdateAddress(ctx context.Context, addressID string, req *models.UpdateAddressRequest, userID, domain string) (*models.SavedAddress, error) {
+	collection := s.db.GetCollection("addresses")
+
+	existing, err := s.GetAddress(ctx, addressID, userID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	setFields := bson.M{
+		"updated_at": time.Now(),
+	}
+
+	if req.Label != nil {
+		setFields["label"] = *req.Label
+	}
+	if req.Address != nil {
+		NormalizeAddress(req.Address)
+		if err := ValidateAddress(*req.Address); err != nil {
+			return nil, err
+		}
+		setFields["address"] = req.Address
+	}
+
+	makeShipping := req.IsDefaultShipping != nil && *req.IsDefaultShipping
+	makeBilling := req.IsDefaultBilling != nil && *req.IsDefaultBilling
+	if err := s.clearDefaults(ctx, userID, domain, makeShipping, makeBilling); err != nil {
+		return nil, err
+	}
+	if req.IsDefaultShipping != nil {
+		setFields["is_default_shipping"] = *req.IsDefaultShipping
+	}
+	if req.IsDefaultBilling != nil {
+		setFields["is_default_billing"] = *req.IsDefaultBilling
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": setFields})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update address: %w", err)
+	}
+
+	return s.GetAddress(ctx, addressID, userID, domain)
+}
+
+// DeleteAddress removes a saved address. Orders keep their own address
+// snapshot, so nothing else needs to change.
+func (s *AddressService) DeleteAddress(ctx context.Context, addressID, userID, domain string) error {
+	collection := s.db.GetCollection("addresses")
+
+	objectID, err := primitive.ObjectIDFromHex(addressID)
+	if err != nil {
+		return ErrAddressNotFound
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.M{
+		"_id":     objectID,
+		"domain":  domain,
+		"user_id": userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete address: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrAddressNotFound
+	}
+
+	return nil
+}
+
+// GetDefaultAddress returns the user's default shipping or billing address,
+// or nil when none is set
+func (s *AddressService) GetDefaultAddress(ctx context.Context, userID, domain, kind string) (*models.SavedAddress, error) {
+	collection := s.db.GetCollection("addresses")
+
+	field := "is_default_shipping"
+	if kind == "billing" {
+		field = "is_default_billing"
+	}
+
+	var address models.SavedAddress
+	err := collection.FindOne(ctx, bson.M{
+		"domain":  domain,
+		"user_id": userID,
+		field:     true,
+	}).Decode(&address)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default address: %w", err)
+	}
+
+	return &address, nil
+}
+
+// ResolveAddress fills target from a saved address. With an address ID the
+// saved address is used; otherwise an empty target gets the user's default
+// address of that kind (shipping or billing), if they have one.
+func (s *AddressService) ResolveAddress(ctx context.Context, userID, domain, addressID, kind string, target *models.Address) error {
+	if addressID != "" {
+		saved, err := s.GetAddress(ctx, addressID, userID, domain)
+		if err != nil {
+			return fmt.Errorf("%s address: %w", kind, err)
+		}
+		*target = saved.Address
+		return nil
+	}
+
+	if !IsEmptyAddress(*target) {
+		return nil
+	}
+
+	saved, err := s.GetDefaultAddress(ctx, userID, domain, kind)
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		*target = saved.Address
+	}
+	return nil
+}
+
+// clearDefaults unsets the default flags on all of a user's addresses
+func (s *AddressService) clearDefaults(ctx context.Context, userID, domain string, shipping, billing bool) error {
+	collection := s.db.GetCollection("addresses")
+	filter := bson.M{"domain": domain, "user_id": userID}
+
+	if shipping {
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"is_default_shipping": false}}); err != nil {
+			return fmt.Errorf("failed to clear default shipping address: %w", err)
+		}
+	}
+	if billing {
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"is_default_billing": false}}); err != nil {
+			return fmt.Errorf("failed to clear default billing address: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sparque/orders_module/internal/models"
+)
+
+// ErrInvalidAddress is returned when an address fails validation
+var ErrInvalidAddress = errors.New("invalid address")
+
+// countryRule describes address requirements for a country
+type countryRule struct {
+	Aliases       []string       // Accepted spellings, normalized to the ISO code
+	StateRequired bool           // State/province/county must be present
+	StateUpper    bool           // State is a short code (NY, ON, NSW)
+	PostalPattern *regexp.Regexp // nil means postal code is optional and unchecked
+	PostalExample string         // Shown in validation errors
+}
+
+// countryRules maps ISO 3166-1 alpha-2 codes to their address rules
+var countryRules = map[string]countryRule{
+	"US": {
+		Aliases:       []string{"USA", "UNITED STATES", "UNITED STATES OF AMERICA"},
+		StateRequired: true,
+		StateUpper:    true,
+		PostalPattern: regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+		PostalExample: "12345 or 12345-6789",
+	},
+	"CA": {
+		Aliases:       []string{"CAN", "CANADA"},
+		StateRequired: true,
+		StateUpper:    true,
+		PostalPattern: regexp.MustCompile(`^[A-Z]\d[A-Z] \d[A-Z]\d$`),
+		PostalExample: "K1A 0B1",
+	},
+	"GB": {
+		Aliases:       []string{"UK", "GBR", "UNITED KINGDOM", "GREAT BRITAIN"},
+		PostalPattern: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`),
+		PostalExample: "SW1A 1AA",
+	},
+	"AU": {
+		Aliases:       []string{"AUS", "AUSTRALIA"},
+		StateRequired: true,
+		StateUpper:    true,
+		PostalPattern: regexp.MustCompile(`^\d{4}$`),
+		PostalExample: "2000",
+	},
+	"DE": {
+		Aliases:       []string{"DEU", "GERMANY", "DEUTSCHLAND"},
+		PostalPattern: regexp.MustCompile(`^\d{5}$`),
+		PostalExample: "10115",
+	},
+	"FR": {
+		Aliases:       []string{"FRA", "FRANCE"},
+		PostalPattern: regexp.MustCompile(`^\d{5}$`),
+		PostalExample: "75001",
+	},
+	"NL": {
+		Aliases:       []string{"NLD", "NETHERLANDS", "THE NETHERLANDS"},
+		PostalPattern: regexp.MustCompile(`^\d{4} [A-Z]{2}$`),
+		PostalExample: "1012 AB",
+	},
+	"IN": {
+		Aliases:       []string{"IND", "INDIA"},
+		StateRequired: true,
+		PostalPattern: regexp.MustCompile(`^\d{6}$`),
+		PostalExample: "110001",
+	},
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// NormalizeAddress trims fields, converts the country to its ISO code and
+// formats postal codes the way the country writes them
+func NormalizeAddress(addr *models.Address) {
+	addr.Name = collapseSpaces(addr.Name)
+	addr.AddressLine1 = collapseSpaces(addr.AddressLine1)
+	addr.AddressLine2 = collapseSpaces(addr.AddressLine2)
+	addr.City = collapseSpaces(addr.City)
+	addr.State = collapseSpaces(addr.State)
+	addr.Phone = strings.TrimSpace(addr.Phone)
+	addr.Country = NormalizeCountry(addr.Country)
+
+	postal := strings.ToUpper(collapseSpaces(addr.PostalCode))
+	switch addr.Country {
+	case "US":
+		digits := strings.ReplaceAll(postal, "-", "")
+		if len(digits) == 9 {
+			postal = digits[:5] + "-" + digits[5:]
+		}
+	case "CA", "GB", "NL":
+		// Inward code is always the last 3 (CA, GB) or 2 letters (NL)
+		compact := strings.ReplaceAll(postal, " ", "")
+		split := 3
+		if addr.Country == "NL" {
+			split = 2
+		}
+		if len(compact) > split {
+			postal = compact[:len(compact)-split] + " " + compact[len(compact)-split:]
+		}
+	}
+	addr.PostalCode = postal
+
+	if rule, ok := countryRules[addr.Country]; ok && rule.StateUpper {
+		addr.State = strings.ToUpper(addr.State)
+	}
+}
+
+// NormalizeCountry maps common country spellings to ISO 3166-1 alpha-2 codes
+func NormalizeCountry(country string) string {
+	country = strings.ToUpper(collapseSpaces(country))
+	if _, ok := countryRules[country]; ok {
+		return country
+	}
+	for code, rule := range countryRules {
+		for _, alias := range rule.Aliases {
+			if country == alias {
+				return code
+			}
+		}
+	}
+	return country
+}
+
+// ValidateAddress checks required fields and postal code format for the
+// address country, reporting every problem at once
+func ValidateAddress(addr models.Address) error {
+	var problems []string
+
+	if addr.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if addr.AddressLine1 == "" {
+		problems = append(problems, "address_line1 is required")
+	}
+	if addr.City == "" {
+		problems = append(problems, "city is required")
+	}
+	if addr.Country == "" {
+		problems = append(problems, "country is required")
+	} else if len(addr.Country) != 2 {
+		problems = append(problems, fmt.Sprintf("country %q is not a 2-letter ISO code", addr.Country))
+	}
+
+	if rule, ok := countryRules[addr.Country]; ok {
+		if rule.StateRequired && addr.State == "" {
+			problems = append(problems, "state is required")
+		}
+		if addr.PostalCode == "" {
+			problems = append(problems, "postal_code is required")
+		} else if !rule.PostalPattern.MatchString(addr.PostalCode) {
+			problems = append(problems, fmt.Sprintf("postal_code %q is not valid for %s (expected %s)", addr.PostalCode, addr.Country, rule.PostalExample))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// IsEmptyAddress reports whether no address fields were provided
+func IsEmptyAddress(addr models.Address) bool {
+	return addr == models.Address{}
+}
+
+func collapseSpaces(s string) string {
+	return whitespace.ReplaceAllString(strings.TrimSpace(s), " ")
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sparque/orders_module/internal/models"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"US", "US"},
+		{" us ", "US"},
+		{"United  States", "US"},
+		{"usa", "US"},
+		{"UK", "GB"},
+		{"Great Britain", "GB"},
+		{"Deutschland", "DE"},
+		{"the netherlands", "NL"},
+		{"canada", "CA"},
+		{"se", "SE"},
+		{"Narnia", "NARNIA"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeCountry(tt.in); got != tt.want {
+				t.Errorf("NormalizeCountry(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   models.Address
+		want models.Address
+	}{
+		{"US zip+4 without dash",
+			models.Address{Name: "  Jane   Doe ", City: " New  York", State: "ny", PostalCode: "100011234", Country: "usa"},
+			models.Address{Name: "Jane Doe", City: "New York", State: "NY", PostalCode: "10001-1234", Country: "US"}},
+		{"US 5-digit zip kept",
+			models.Address{State: "ca", PostalCode: " 94105 ", Country: "US"},
+			models.Address{State: "CA", PostalCode: "94105", Country: "US"}},
+		{"CA postal code spaced and upper-cased",
+			models.Address{State: "on", PostalCode: "k1a0b1", Country: "Canada"},
+			models.Address{State: "ON", PostalCode: "K1A 0B1", Country: "CA"}},
+		{"GB postcode spaced",
+			models.Address{PostalCode: "sw1a1aa", Country: "UK"},
+			models.Address{PostalCode: "SW1A 1AA", Country: "GB"}},
+		{"GB short postcode",
+			models.Address{PostalCode: "m1  1ae", Country: "GB"},
+			models.Address{PostalCode: "M1 1AE", Country: "GB"}},
+		{"NL postcode spaced",
+			models.Address{PostalCode: "1012ab", Country: "Netherlands"},
+			models.Address{PostalCode: "1012 AB", Country: "NL"}},
+		{"AU state upper-cased",
+			models.Address{State: "nsw", PostalCode: "2000", Country: "Australia"},
+			models.Address{State: "NSW", PostalCode: "2000", Country: "AU"}},
+		{"IN state kept as written",
+			models.Address{State: "Maharashtra", PostalCode: "400001", Country: "india"},
+			models.Address{State: "Maharashtra", PostalCode: "400001", Country: "IN"}},
+		{"unknown country left alone",
+			models.Address{State: "stockholm", PostalCode: "114 55", Country: "se"},
+			models.Address{State: "stockholm", PostalCode: "114 55", Country: "SE"}},
+		{"phone trimmed",
+			models.Address{Phone: " +1 555 0100 ", Country: "US"},
+			models.Address{Phone: "+1 555 0100", Country: "US"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in
+			NormalizeAddress(&got)
+			if got != tt.want {
+				t.Errorf("NormalizeAddress() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	address := func(country, state, postal string) models.Address {
+		return models.Address{Name: "Jane Doe", AddressLine1: "1 Main St", City: "Springfield",
+			State: state, PostalCode: postal, Country: country}
+	}
+
+	tests := []struct {
+		name     string
+		addr     models.Address
+		problems []string // Substrings of the error; none means valid
+	}{
+		{"US", address("US", "NY", "10001"), nil},
+		{"US zip+4", address("US", "NY", "10001-1234"), nil},
+		{"US bad zip", address("US", "NY", "1001"), []string{`postal_code "1001" is not valid for US`}},
+		{"US without state", address("US", "", "10001"), []string{"state is required"}},
+		{"CA", address("CA", "ON", "K1A 0B1"), nil},
+		{"CA bad postal code", address("CA", "ON", "K1A0B1"), []string{"expected K1A 0B1"}},
+		{"GB without county", address("GB", "", "SW1A 1AA"), nil},
+		{"GB bad postcode", address("GB", "", "12345"), []string{"not valid for GB"}},
+		{"AU", address("AU", "NSW", "2000"), nil},
+		{"AU without state", address("AU", "", "2000"), []string{"state is required"}},
+		{"DE", address("DE", "", "10115"), nil},
+		{"FR bad postal code", address("FR", "", "7500"), []string{"not valid for FR"}},
+		{"NL", address("NL", "", "1012 AB"), nil},
+		{"IN without state", address("IN", "", "110001"), []string{"state is required"}},
+		{"postal code required where checked", address("DE", "", ""), []string{"postal_code is required"}},
+		{"postal code optional elsewhere", address("SE", "", ""), nil},
+		{"country not an ISO code", address("NARNIA", "", ""), []string{`country "NARNIA" is not a 2-letter ISO code`}},
+		{"every problem reported", models.Address{Country: "US"}, []string{
+			"name is required", "address_line1 is required", "city is required", "state is required", "postal_code is required",
+		}},
+		{"country required", models.Address{Name: "Jane Doe", AddressLine1: "1 Main St", City: "Springfield"}, []string{"country is required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAddress(tt.addr)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Errorf("ValidateAddress() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidAddress) {
+				t.Fatalf("ValidateAddress() error = %v, want ErrInvalidAddress", err)
+			}
+			for _, problem := range tt.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("ValidateAddress() error = %v, want it to mention %q", err, problem)
+				}
+			}
+		})
+	}
+}
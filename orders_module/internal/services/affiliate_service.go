@@ -0,0 +1,615 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAffiliateNotFound is returned when an affiliate doesn't exist for the domain
+var ErrAffiliateNotFound = errors.New("affiliate not found")
+
+// ErrInvalidAffiliate is returned when an affiliate, the program settings or a payout are rejected
+var ErrInvalidAffiliate = errors.New("invalid affiliate")
+
+// AffiliateService runs the affiliate program: commissions accrue when an
+// order attributed to an affiliate's invitation (its ref) is paid, are
+// reversed when the order is cancelled or refunded, and are paid out per
+// period
+type AffiliateService struct {
+	db *database.MongoDB
+}
+
+func NewAffiliateService(db *database.MongoDB) *AffiliateService {
+	return &AffiliateService{db: db}
+}
+
+// CommissionFilter narrows a commission listing
+type CommissionFilter struct {
+	AffiliateID string
+	Paid        *bool
+	From        time.Time
+	To          time.Time
+}
+
+// GetSettings returns a domain's affiliate rules, or the defaults (disabled)
+func (s *AffiliateService) GetSettings(ctx context.Context, domain string) (*models.AffiliateSettings, error) {
+	var settings models.AffiliateSettings
+	err := s.db.GetCollection("affiliate_settings").FindOne(ctx, bson.M{"_id": domain}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultAffiliateSettings(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get affiliate settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings validates and saves a domain's affiliate rules
+func (s *AffiliateService) UpdateSettings(ctx context.Context, req *models.UpdateAffiliateSettingsRequest, domain, updatedBy string) (*models.AffiliateSettings, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.Rule != nil {
+		settings.Rule = *req.Rule
+	}
+	if req.CommissionPercent != nil {
+		settings.CommissionPercent = *req.CommissionPercent
+	}
+
+	var problems []string
+	if settings.Rule != models.AffiliateRuleFirstOrder && settings.Rule != models.AffiliateRuleLifetime {
+		problems = append(problems, "rule must be first_order or lifetime")
+	}
+	if settings.CommissionPercent < 0 || settings.CommissionPercent > 100 {
+		problems = append(problems, "commission_percent must be between 0 and 100")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAffiliate, strings.Join(problems, "; "))
+	}
+
+	settings.UpdatedBy = updatedBy
+	settings.UpdatedAt = time.Now()
+
+	_, err = s.db.GetCollection("affiliate_settings").ReplaceOne(ctx, bson.M{"_id": domain}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save affiliate settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// CreateAffiliate adds a referrer account
+func (s *AffiliateService) CreateAffiliate(ctx context.Context, req *models.CreateAffiliateRequest, domain, createdBy string) (*models.Affiliate, error) {
+	now := time.Now()
+	affiliate := &models.Affiliate{
+		ID:                primitive.NewObjectID(),
+		Domain:            domain,
+		Code:              strings.TrimSpace(req.Code),
+		Name:              strings.TrimSpace(req.Name),
+		Email:             strings.ToLower(strings.TrimSpace(req.Email)),
+		UserID:            req.UserID,
+		CommissionPercent: req.CommissionPercent,
+		Status:            models.AffiliateActive,
+		Notes:             req.Notes,
+		CreatedBy:         createdBy,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := validateAffiliate(affiliate); err != nil {
+		return nil, err
+	}
+
+	_, err := s.db.GetCollection("affiliates").InsertOne(ctx, affiliate)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: code %s already exists", ErrInvalidAffiliate, affiliate.Code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create affiliate: %w", err)
+	}
+
+	return affiliate, nil
+}
+
+// GetAffiliate retrieves an affiliate by ID
+func (s *AffiliateService) GetAffiliate(ctx context.Context, affiliateID, domain string) (*models.Affiliate, error) {
+	objectID, err := primitive.ObjectIDFromHex(affiliateID)
+	if err != nil {
+		return nil, ErrAffiliateNotFound
+	}
+
+	return s.findAffiliate(ctx, bson.M{"_id": objectID, "domain": domain})
+}
+
+// ListAffiliates lists a domain's affiliates by code (?status= narrows it)
+func (s *AffiliateService) ListAffiliates(ctx context.Context, domain, status string, limit int64) ([]models.Affiliate, error) {
+	filter := bson.M{"domain": domain}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.M{"code": 1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("affiliates").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list affiliates: %w", err)
+	}
+
+	affiliates := []models.Affiliate{}
+	if err := cursor.All(ctx, &affiliates); err != nil {
+		return nil, fmt.Errorf("failed to decode affiliates: %w", err)
+	}
+
+	return affiliates, nil
+}
+
+// UpdateAffiliate changes an affiliate's details, rate or status
+func (s *AffiliateService) UpdateAffiliate(ctx context.Context, affiliateID string, req *models.UpdateAffiliateRequest, domain string) (*models.Affiliate, error) {
+	affiliate, err := s.GetAffiliate(ctx, affiliateID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		affiliate.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Email != nil {
+		affiliate.Email = strings.ToLower(strings.TrimSpace(*req.Email))
+	}
+	if req.UserID != nil {
+		affiliate.UserID = *req.UserID
+	}
+	if req.CommissionPercent != nil {
+		affiliate.CommissionPercent = req.CommissionPercent
+		if *req.CommissionPercent < 0 {
+			affiliate.CommissionPercent = nil
+		}
+	}
+	if req.Status != nil {
+		affiliate.Status = *req.Status
+	}
+	if req.Notes != nil {
+		affiliate.Notes = *req.Notes
+	}
+	if err := validateAffiliate(affiliate); err != nil {
+		return nil, err
+	}
+
+	affiliate.UpdatedAt = time.Now()
+	if _, err := s.db.GetCollection("affiliates").ReplaceOne(ctx, bson.M{"_id": affiliate.ID}, affiliate); err != nil {
+		return nil, fmt.Errorf("failed to update affiliate: %w", err)
+	}
+
+	return affiliate, nil
+}
+
+// AccrueForOrder records the commission for a paid order that is attributed
+// to an active affiliate. Orders only accrue once; with the first_order rule
+// only the customer's first attributed order does.
+func (s *AffiliateService) AccrueForOrder(ctx context.Context, order *models.Order) error {
+	if order.Attribution == nil || order.Attribution.Ref == "" || order.Customer.UserID == "" {
+		return nil
+	}
+
+	settings, err := s.GetSettings(ctx, order.Domain)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	affiliate, err := s.findAffiliate(ctx, bson.M{
+		"domain": order.Domain,
+		"code":   order.Attribution.Ref,
+		"status": models.AffiliateActive,
+	})
+	if errors.Is(err, ErrAffiliateNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	collection := s.db.GetCollection("affiliate_commissions")
+	if settings.Rule == models.AffiliateRuleFirstOrder {
+		count, err := collection.CountDocuments(ctx, bson.M{
+			"domain":           order.Domain,
+			"customer_user_id": order.Customer.UserID,
+			"type":             models.AffiliateAccrual,
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return fmt.Errorf("failed to check earlier commissions: %w", err)
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	percent := settings.CommissionPercent
+	if affiliate.CommissionPercent != nil {
+		percent = *affiliate.CommissionPercent
+	}
+	base := commissionBase(order)
+	amount := roundCents(base * percent / 100)
+	if amount <= 0 {
+		return nil
+	}
+
+	_, err = collection.InsertOne(ctx, &models.AffiliateCommission{
+		ID:             primitive.NewObjectID(),
+		Domain:         order.Domain,
+		AffiliateID:    affiliate.ID.Hex(),
+		AffiliateCode:  affiliate.Code,
+		Type:           models.AffiliateAccrual,
+		OrderID:        order.ID.Hex(),
+		OrderNumber:    order.OrderNumber,
+		CustomerUserID: order.Customer.UserID,
+		Base:           base,
+		Percent:        percent,
+		Amount:         amount,
+		CreatedBy:      "system",
+		CreatedAt:      time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record commission: %w", err)
+	}
+
+	return nil
+}
+
+// ReverseOrder takes back what is left of an order's commission when the
+// order is cancelled or refunded
+func (s *AffiliateService) ReverseOrder(ctx context.Context, order *models.Order, actor string) error {
+	return s.reverse(ctx, order, 0, true, "Order cancelled or refunded", actor)
+}
+
+// ReverseRefund takes back the commission on the refunded part of an order,
+// in proportion to the refunded amount
+func (s *AffiliateService) ReverseRefund(ctx context.Context, order *models.Order, refunded float64, actor string) error {
+	return s.reverse(ctx, order, refunded, false, "Order partially refunded", actor)
+}
+
+// ListCommissions returns ledger entries, newest first
+func (s *AffiliateService) ListCommissions(ctx context.Context, domain string, filter CommissionFilter, limit int64) ([]models.AffiliateCommission, error) {
+	query := commissionQuery(domain, filter)
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := s.db.GetCollection("affiliate_commissions").Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commissions: %w", err)
+	}
+
+	commissions := []models.AffiliateCommission{}
+	if err := cursor.All(ctx, &commissions); err != nil {
+		return nil, fmt.Errorf("failed to decode commissions: %w", err)
+	}
+
+	return commissions, nil
+}
+
+// Report sums each affiliate's commissions recorded in a period (zero times
+// leave it open): accrued, reversed, paid out and still owed
+func (s *AffiliateService) Report(ctx context.Context, domain string, from, to time.Time) (*models.AffiliateReport, error) {
+	isPaid := bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$payout_id", ""}}, ""}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: commissionQuery(domain, CommissionFilter{From: from, To: to})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":            "$affiliate_id",
+			"affiliate_code": bson.M{"$first": "$affiliate_code"},
+			"orders":         bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.AffiliateAccrual}}, 1, 0}}},
+			"accrued":        bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.AffiliateAccrual}}, "$amount", 0}}},
+			"reversed":       bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.AffiliateReversal}}, "$amount", 0}}},
+			"net":            bson.M{"$sum": "$amount"},
+			"paid":           bson.M{"$sum": bson.M{"$cond": bson.A{isPaid, "$amount", 0}}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"affiliate_code": 1}}},
+	}
+
+	cursor, err := s.db.GetCollection("affiliate_commissions").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build affiliate report: %w", err)
+	}
+
+	lines := []models.AffiliateReportLine{}
+	if err := cursor.All(ctx, &lines); err != nil {
+		return nil, fmt.Errorf("failed to decode affiliate report: %w", err)
+	}
+
+	report := &models.AffiliateReport{Affiliates: lines}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	for i := range report.Affiliates {
+		line := &report.Affiliates[i]
+		line.Accrued = roundCents(line.Accrued)
+		line.Reversed = roundCents(line.Reversed)
+		line.Net = roundCents(line.Net)
+		line.Paid = roundCents(line.Paid)
+		line.Owed = roundCents(line.Net - line.Paid)
+		report.TotalOwed += line.Owed
+	}
+	report.TotalOwed = roundCents(report.TotalOwed)
+
+	return report, nil
+}
+
+// CreatePayout marks an affiliate's unpaid commissions up to a date as paid
+// and records the payout. Reversals net against the accruals, so there has
+// to be a positive amount owed.
+func (s *AffiliateService) CreatePayout(ctx context.Context, affiliateID string, req *models.CreateAffiliatePayoutRequest, domain, createdBy string) (*models.AffiliatePayout, error) {
+	affiliate, err := s.GetAffiliate(ctx, affiliateID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	through := now
+	if req.Through != nil && req.Through.Before(now) {
+		through = *req.Through
+	}
+
+	payout := &models.AffiliatePayout{
+		ID:            primitive.NewObjectID(),
+		Domain:        domain,
+		AffiliateID:   affiliate.ID.Hex(),
+		AffiliateCode: affiliate.Code,
+		Through:       through,
+		Reference:     req.Reference,
+		CreatedBy:     createdBy,
+		CreatedAt:     now,
+	}
+
+	// Claim the entries first so a concurrent payout can't include them too
+	collection := s.db.GetCollection("affiliate_commissions")
+	_, err = collection.UpdateMany(ctx, bson.M{
+		"domain":       domain,
+		"affiliate_id": payout.AffiliateID,
+		"payout_id":    bson.M{"$exists": false},
+		"created_at":   bson.M{"$lte": through},
+	}, bson.M{"$set": bson.M{"payout_id": payout.ID.Hex()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim commissions: %w", err)
+	}
+
+	payout.Amount, payout.Entries, err = s.sumCommissions(ctx, bson.M{"domain": domain, "payout_id": payout.ID.Hex()})
+	if err == nil && payout.Amount <= 0 {
+		err = fmt.Errorf("%w: nothing owed to %s (balance %.2f)", ErrInvalidAffiliate, affiliate.Code, payout.Amount)
+	}
+	if err == nil {
+		_, err = s.db.GetCollection("affiliate_payouts").InsertOne(ctx, payout)
+	}
+	if err != nil {
+		collection.UpdateMany(ctx, bson.M{"domain": domain, "payout_id": payout.ID.Hex()}, bson.M{"$unset": bson.M{"payout_id": ""}})
+		return nil, err
+	}
+
+	return payout, nil
+}
+
+// ListPayouts lists payouts, newest first (affiliateID narrows it)
+func (s *AffiliateService) ListPayouts(ctx context.Context, domain, affiliateID string, limit int64) ([]models.AffiliatePayout, error) {
+	filter := bson.M{"domain": domain}
+	if affiliateID != "" {
+		filter["affiliate_id"] = affiliateID
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("affiliate_payouts").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payouts: %w", err)
+	}
+
+	payouts := []models.AffiliatePayout{}
+	if err := cursor.All(ctx, &payouts); err != nil {
+		return nil, fmt.Errorf("failed to decode payouts: %w", err)
+	}
+
+	return payouts, nil
+}
+
+// GetSummary returns the account of the affiliate linked to a user: what
+// they are owed, what was paid and their recent commissions
+func (s *AffiliateService) GetSummary(ctx context.Context, domain, userID string) (*models.AffiliateSummary, error) {
+	affiliate, err := s.findAffiliate(ctx, bson.M{"domain": domain, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.AffiliateSummary{Affiliate: affiliate}
+	summary.Owed, _, err = s.sumCommissions(ctx, bson.M{"domain": domain, "affiliate_id": affiliate.ID.Hex(), "payout_id": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	summary.Paid, _, err = s.sumCommissions(ctx, bson.M{"domain": domain, "affiliate_id": affiliate.ID.Hex(), "payout_id": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	summary.Commissions, err = s.ListCommissions(ctx, domain, CommissionFilter{AffiliateID: affiliate.ID.Hex()}, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// reverse records a reversal for an order's commission: everything left for
+// a full reversal, otherwise the refunded share
+func (s *AffiliateService) reverse(ctx context.Context, order *models.Order, refunded float64, full bool, reason, actor string) error {
+	collection := s.db.GetCollection("affiliate_commissions")
+	cursor, err := collection.Find(ctx, bson.M{"domain": order.Domain, "order_id": order.ID.Hex()})
+	if err != nil {
+		return fmt.Errorf("failed to get order commissions: %w", err)
+	}
+
+	var entries []models.AffiliateCommission
+	if err := cursor.All(ctx, &entries); err != nil {
+		return fmt.Errorf("failed to decode order commissions: %w", err)
+	}
+
+	var accrual *models.AffiliateCommission
+	remaining := 0.0
+	for i := range entries {
+		if entries[i].Type == models.AffiliateAccrual {
+			accrual = &entries[i]
+		}
+		remaining += entries[i].Amount
+	}
+	if accrual == nil {
+		return nil
+	}
+
+	remaining = roundCents(remaining)
+	amount, base := remaining, accrual.Base
+	if !full && accrual.Base > 0 {
+		amount = min(remaining, roundCents(accrual.Amount*refunded/accrual.Base))
+		base = min(refunded, accrual.Base)
+	}
+	if amount <= 0 {
+		return nil
+	}
+
+	_, err = collection.InsertOne(ctx, &models.AffiliateCommission{
+		ID:             primitive.NewObjectID(),
+		Domain:         order.Domain,
+		AffiliateID:    accrual.AffiliateID,
+		AffiliateCode:  accrual.AffiliateCode,
+		Type:           models.AffiliateReversal,
+		OrderID:        accrual.OrderID,
+		OrderNumber:    accrual.OrderNumber,
+		CustomerUserID: accrual.CustomerUserID,
+		Base:           base,
+		Percent:        accrual.Percent,
+		Amount:         -amount,
+		Reason:         reason,
+		CreatedBy:      actor,
+		CreatedAt:      time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record commission reversal: %w", err)
+	}
+
+	return nil
+}
+
+// sumCommissions adds up the amounts of the matching ledger entries
+func (s *AffiliateService) sumCommissions(ctx context.Context, filter bson.M) (float64, int, error) {
+	cursor, err := s.db.GetCollection("affiliate_commissions").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "amount": bson.M{"$sum": "$amount"}, "entries": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to sum commissions: %w", err)
+	}
+
+	var totals []struct {
+		Amount  float64 `bson:"amount"`
+		Entries int     `bson:"entries"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode commission totals: %w", err)
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil
+	}
+
+	return roundCents(totals[0].Amount), totals[0].Entries, nil
+}
+
+func (s *AffiliateService) findAffiliate(ctx context.Context, filter bson.M) (*models.Affiliate, error) {
+	var affiliate models.Affiliate
+	err := s.db.GetCollection("affiliates").FindOne(ctx, filter).Decode(&affiliate)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAffiliateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get affiliate: %w", err)
+	}
+
+	return &affiliate, nil
+}
+
+// commissionQuery builds the ledger filter for a listing or report
+func commissionQuery(domain string, filter CommissionFilter) bson.M {
+	query := bson.M{"domain": domain}
+	if filter.AffiliateID != "" {
+		query["affiliate_id"] = filter.AffiliateID
+	}
+	if filter.Paid != nil {
+		query["payout_id"] = bson.M{"$exists": *filter.Paid}
+	}
+
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	return query
+}
+
+// commissionBase is the part of an order commissions are paid on: the
+// merchandise after discounts, without gift cards (those are money, not sales)
+func commissionBase(order *models.Order) float64 {
+	var base float64
+	for _, item := range order.Items {
+		if item.ProductType != models.ProductTypeGiftCard {
+			base += item.Total
+		}
+	}
+	return roundCents(max(base-order.Discount, 0))
+}
+
+// validateAffiliate checks an affiliate account
+func validateAffiliate(affiliate *models.Affiliate) error {
+	var problems []string
+
+	if affiliate.Code == "" || len(affiliate.Code) > 64 {
+		problems = append(problems, "code is required (up to 64 characters)")
+	}
+	if affiliate.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if affiliate.Email != "" && !strings.Contains(affiliate.Email, "@") {
+		problems = append(problems, "invalid email")
+	}
+	if affiliate.CommissionPercent != nil && (*affiliate.CommissionPercent < 0 || *affiliate.CommissionPercent > 100) {
+		problems = append(problems, "commission_percent must be between 0 and 100")
+	}
+	if affiliate.Status != models.AffiliateActive && affiliate.Status != models.AffiliateDisabled {
+		problems = append(problems, "status must be active or disabled")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidAffiliate, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCart is returned when a cart change or checkout is rejected
+var ErrInvalidCart = errors.New("invalid cart")
+
+// ErrCartItemNotFound is returned when a cart line doesn't exist
+var ErrCartItemNotFound = errors.New("cart item not found")
+
+// CartTTL is how long an anonymous cart is kept after its last change
+const CartTTL = 30 * 24 * time.Hour
+
+// Cart limits
+const (
+	maxCartItems        = 100 // Lines per cart
+	maxCartItemQuantity = 99  // Units per line
+)
+
+// CartService manages server-side carts: anonymous carts identified by a
+// cookie token, logged-in customers' carts by user ID. Lines are priced and
+// checked against stock from the catalog whenever the cart is read, and a
+// cart is turned into an order through the usual order flow.
+type CartService struct {
+	db      *database.MongoDB
+	catalog *CatalogService
+	orders  *OrderService
+}
+
+func NewCartService(db *database.MongoDB, orders *OrderService) *CartService {
+	return &CartService{
+		db:      db,
+		catalog: NewCatalogService(db),
+		orders:  orders,
+	}
+}
+
+// NewCartToken creates an unguessable token for an anonymous cart
+func NewCartToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate cart token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCart returns the cart priced from the catalog. A shopper without a
+// cart gets an empty one.
+func (s *CartService) GetCart(ctx context.Context, domain, userID, token string) (*models.CartView, error) {
+	cart, err := s.findCart(ctx, domain, userID, token)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		cart = &models.Cart{Domain: domain}
+	}
+
+	return s.price(ctx, cart)
+}
+
+// AddItem adds a product to the cart, creating the cart if needed. The
+// product must be for sale and the new quantity in stock (or orderable on
+// backorder / pre-order).
+func (s *CartService) AddItem(ctx context.Context, req *models.AddCartItemRequest, domain, userID, token string) (*models.CartView, error) {
+	if req.ProductID == "" {
+		return nil, fmt.Errorf("%w: product_id is required", ErrInvalidCart)
+	}
+	if req.Quantity <= 0 {
+		req.Quantity = 1
+	}
+
+	cart, err := s.loadOrCreate(ctx, domain, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same variant is one line, gift cards are one line per recipient
+	var line *models.CartItem
+	if req.GiftCard == nil {
+		for i := range cart.Items {
+			item := &cart.Items[i]
+			if item.ProductID == req.ProductID && item.VariantID == req.VariantID && item.GiftCard == nil {
+				line = item
+				break
+			}
+		}
+	}
+
+	quantity := req.Quantity
+	if line != nil {
+		quantity += line.Quantity
+	}
+	if quantity > maxCartItemQuantity {
+		return nil, fmt.Errorf("%w: at most %d of an item per order", ErrInvalidCart, maxCartItemQuantity)
+	}
+	if line == nil && len(cart.Items) >= maxCartItems {
+		return nil, fmt.Errorf("%w: a cart holds at most %d items", ErrInvalidCart, maxCartItems)
+	}
+
+	item := models.OrderItem{
+		ProductID: req.ProductID,
+		VariantID: req.VariantID,
+		Quantity:  quantity,
+		GiftCard:  req.GiftCard,
+	}
+	if err := s.checkItem(ctx, &item, domain); err != nil {
+		return nil, err
+	}
+
+	if line != nil {
+		line.Quantity = quantity
+	} else {
+		cart.Items = append(cart.Items, models.CartItem{
+			ID:        primitive.NewObjectID().Hex(),
+			ProductID: req.ProductID,
+			VariantID: req.VariantID,
+			Quantity:  quantity,
+			GiftCard:  item.GiftCard,
+			AddedAt:   time.Now(),
+		})
+	}
+
+	if err := s.save(ctx, cart); err != nil {
+		return nil, err
+	}
+	return s.price(ctx, cart)
+}
+
+// UpdateItem changes a line's quantity; 0 removes the line
+func (s *CartService) UpdateItem(ctx context.Context, itemID string, quantity int, domain, userID, token string) (*models.CartView, error) {
+	if quantity < 0 || quantity > maxCartItemQuantity {
+		return nil, fmt.Errorf("%w: quantity must be between 0 and %d", ErrInvalidCart, maxCartItemQuantity)
+	}
+
+	cart, err := s.findCart(ctx, domain, userID, token)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, ErrCartItemNotFound
+	}
+
+	index := -1
+	for i := range cart.Items {
+		if cart.Items[i].ID == itemID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrCartItemNotFound
+	}
+
+	if quantity == 0 {
+		cart.Items = append(cart.Items[:index], cart.Items[index+1:]...)
+	} else {
+		line := &cart.Items[index]
+		item := models.OrderItem{
+			ProductID: line.ProductID,
+			VariantID: line.VariantID,
+			Quantity:  quantity,
+			GiftCard:  line.GiftCard,
+		}
+		if err := s.checkItem(ctx, &item, domain); err != nil {
+			return nil, err
+		}
+		line.Quantity = quantity
+	}
+
+	if err := s.save(ctx, cart); err != nil {
+		return nil, err
+	}
+	return s.price(ctx, cart)
+}
+
+// Clear empties the cart
+func (s *CartService) Clear(ctx context.Context, domain, userID, token string) error {
+	filter, ok := cartFilter(domain, userID, token)
+	if !ok {
+		return nil
+	}
+
+	if _, err := s.db.GetCollection("carts").DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+	return nil
+}
+
+// Merge moves an anonymous cart into the cart of the customer who just
+// logged in. Quantities of the same variant are added up.
+func (s *CartService) Merge(ctx context.Context, domain, userID, token string) error {
+	if userID == "" || token == "" {
+		return nil
+	}
+
+	guest, err := s.findCart(ctx, domain, "", token)
+	if err != nil || guest == nil {
+		return err
+	}
+
+	if len(guest.Items) > 0 {
+		cart, err := s.loadOrCreate(ctx, domain, userID, "")
+		if err != nil {
+			return err
+		}
+		cart.Items = mergeCartItems(cart.Items, guest.Items)
+		if err := s.save(ctx, cart); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.GetCollection("carts").DeleteOne(ctx, bson.M{"_id": guest.ID}); err != nil {
+		return fmt.Errorf("failed to delete merged cart: %w", err)
+	}
+	return nil
+}
+
+// Checkout turns the cart into an order at the current catalog prices and
+// empties it. The order goes through the same checks, discounts and payment
+// as POST /orders. req.Customer.UserID must be set by the caller for
+// logged-in customers.
+func (s *CartService) Checkout(ctx context.Context, req *models.CheckoutCartRequest, domain, token, clientIP string) (*models.Order, error) {
+	cart, err := s.findCart(ctx, domain, req.Customer.UserID, token)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return nil, fmt.Errorf("%w: cart is empty", ErrInvalidCart)
+	}
+
+	view, err := s.price(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]models.OrderItem, 0, len(view.Items))
+	for _, line := range view.Items {
+		if line.Problem != "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCart, line.Problem)
+		}
+		items = append(items, line.OrderItem)
+	}
+
+	order, err := s.orders.CreateOrder(ctx, &models.CreateOrderRequest{
+		Customer:          req.Customer,
+		Items:             items,
+		ShippingAddress:   req.ShippingAddress,
+		BillingAddress:    req.BillingAddress,
+		Notes:             req.Notes,
+		ShippingAddressID: req.ShippingAddressID,
+		BillingAddressID:  req.BillingAddressID,
+		CouponCode:        req.CouponCode,
+		RedeemPoints:      req.RedeemPoints,
+		GiftCardCodes:     req.GiftCardCodes,
+		ClientIP:          clientIP,
+	}, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.GetCollection("carts").DeleteOne(ctx, bson.M{"_id": cart.ID}); err != nil {
+		log.Printf("ERROR: Failed to empty cart %s after order %s: %v", cart.ID.Hex(), order.OrderNumber, err)
+	}
+
+	return order, nil
+}
+
+// price fills in the cart's lines from the catalog. Lines that can't be
+// ordered get a problem instead of failing the whole cart.
+func (s *CartService) price(ctx context.Context, cart *models.Cart) (*models.CartView, error) {
+	view := &models.CartView{
+		Domain:   cart.Domain,
+		Items:    make([]models.CartLine, 0, len(cart.Items)),
+		Currency: "USD",
+	}
+	if !cart.ID.IsZero() {
+		view.ID = cart.ID.Hex()
+		view.UpdatedAt = &cart.UpdatedAt
+	}
+
+	for _, item := range cart.Items {
+		line := models.CartLine{
+			ID: item.ID,
+			OrderItem: models.OrderItem{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+				GiftCard:  item.GiftCard,
+			},
+		}
+		if err := s.checkItem(ctx, &line.OrderItem, cart.Domain); err != nil {
+			if !isCartItemProblem(err) {
+				return nil, err
+			}
+			line.Problem = err.Error()
+		}
+		line.Total = roundCents(line.UnitPrice * float64(line.Quantity))
+
+		view.Items = append(view.Items, line)
+		view.ItemCount += line.Quantity
+		if line.Problem == "" {
+			view.Subtotal += line.Total
+		}
+	}
+	view.Subtotal = roundCents(view.Subtotal)
+	view.Valid = len(view.Items) > 0
+	for _, line := range view.Items {
+		if line.Problem != "" {
+			view.Valid = false
+		}
+	}
+
+	return view, nil
+}
+
+// checkItem prices an item from the catalog and checks its stock
+func (s *CartService) checkItem(ctx context.Context, item *models.OrderItem, domain string) error {
+	if err := s.catalog.PriceItem(ctx, item, domain); err != nil {
+		return err
+	}
+	return s.catalog.CheckAvailability(ctx, item, domain)
+}
+
+// isCartItemProblem reports whether a pricing error is about the item
+// itself rather than the catalog being unreachable
+func isCartItemProblem(err error) bool {
+	return errors.Is(err, ErrProductNotFound) || errors.Is(err, ErrOutOfStock) || errors.Is(err, ErrInvalidGiftCard)
+}
+
+// findCart loads the shopper's cart, or returns nil when there is none
+func (s *CartService) findCart(ctx context.Context, domain, userID, token string) (*models.Cart, error) {
+	filter, ok := cartFilter(domain, userID, token)
+	if !ok {
+		return nil, nil
+	}
+
+	var cart models.Cart
+	err := s.db.GetCollection("carts").FindOne(ctx, filter).Decode(&cart)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	return &cart, nil
+}
+
+// loadOrCreate loads the shopper's cart, creating an empty one atomically
+// so concurrent first requests share a cart
+func (s *CartService) loadOrCreate(ctx context.Context, domain, userID, token string) (*models.Cart, error) {
+	filter, ok := cartFilter(domain, userID, token)
+	if !ok {
+		return nil, fmt.Errorf("%w: no cart token", ErrInvalidCart)
+	}
+
+	now := time.Now()
+	onInsert := bson.M{
+		"items":      []models.CartItem{},
+		"created_at": now,
+		"updated_at": now,
+	}
+	if userID == "" {
+		onInsert["expires_at"] = now.Add(CartTTL)
+	}
+
+	var cart models.Cart
+	err := s.db.GetCollection("carts").FindOneAndUpdate(ctx, filter,
+		bson.M{"$setOnInsert": onInsert},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&cart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	return &cart, nil
+}
+
+// save writes the cart's lines. Anonymous carts expire CartTTL after their
+// last change.
+func (s *CartService) save(ctx context.Context, cart *models.Cart) error {
+	now := time.Now()
+	set := bson.M{
+		"items":      cart.Items,
+		"updated_at": now,
+	}
+	if cart.UserID == "" {
+		expiresAt := now.Add(CartTTL)
+		set["expires_at"] = expiresAt
+		cart.ExpiresAt = &expiresAt
+	}
+
+	_, err := s.db.GetCollection("carts").UpdateOne(ctx, bson.M{"_id": cart.ID}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to save cart: %w", err)
+	}
+
+	cart.UpdatedAt = now
+	return nil
+}
+
+// cartFilter selects a logged-in customer's cart by user ID, an anonymous
+// one by token. ok is false for a shopper without either.
+func cartFilter(domain, userID, token string) (bson.M, bool) {
+	switch {
+	case userID != "":
+		return bson.M{"domain": domain, "user_id": userID}, true
+	case token != "":
+		return bson.M{"domain": domain, "token": token}, true
+	default:
+		return nil, false
+	}
+}
+
+// mergeCartItems adds an anonymous cart's lines to a customer's cart. The
+// same variant's quantities are added up (capped at maxCartItemQuantity),
+// other lines are appended while there is room.
+func mergeCartItems(items, guest []models.CartItem) []models.CartItem {
+	for _, g := range guest {
+		merged := false
+		if g.GiftCard == nil {
+			for i := range items {
+				if items[i].ProductID == g.ProductID && items[i].VariantID == g.VariantID && items[i].GiftCard == nil {
+					items[i].Quantity = min(items[i].Quantity+g.Quantity, maxCartItemQuantity)
+					merged = true
+					break
+				}
+			}
+		}
+		if !merged && len(items) < maxCartItems {
+			items = append(items, g)
+		}
+	}
+	return items
+}
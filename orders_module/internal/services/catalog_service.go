@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrProductNotFound is returned when a product or variant isn't in the catalog
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrOutOfStock is returned when a variant doesn't have enough stock and
+// can't be backordered or pre-ordered
+var ErrOutOfStock = errors.New("out of stock")
+
+// CatalogService reads products and variants from the products_module database
+type CatalogService struct {
+	db *database.MongoDB
+}
+
+func NewCatalogService(db *database.MongoDB) *CatalogService {
+	return &CatalogService{db: db}
+}
+
+// GetProduct retrieves a catalog product by ID
+func (s *CatalogService) GetProduct(ctx context.Context, productID, domain string) (*models.CatalogProduct, error) {
+	collection := s.db.GetProductsCollection("products")
+
+	objectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, productID)
+	}
+
+	var product models.CatalogProduct
+	err = collection.FindOne(ctx, bson.M{
+		"_id":    objectID,
+		"domain": domain,
+	}).Decode(&product)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, productID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return &product, nil
+}
+
+// PriceItem fills an order item's snapshot fields and unit price from the
+// catalog. Products without variants are priced from the base price.
+func (s *CatalogService) PriceItem(ctx context.Context, item *models.OrderItem, domain string) error {
+	product, err := s.GetProduct(ctx, item.ProductID, domain)
+	if err != nil {
+		return err
+	}
+	if !product.Active {
+		return fmt.Errorf("%w: %s is no longer available", ErrProductNotFound, product.Name)
+	}
+
+	var variant *models.CatalogVariant
+	if item.VariantID != "" || len(product.Variants) > 0 {
+		variant = product.FindVariant(item.VariantID)
+		if variant == nil {
+			return fmt.Errorf("%w: variant %s of %s", ErrProductNotFound, item.VariantID, product.Name)
+		}
+	}
+
+	item.ProductName = product.Name
+	item.UnitPrice = product.UnitPrice(variant)
+	if len(product.Images) > 0 {
+		item.ProductImage = product.Images[0]
+	}
+
+	if variant != nil {
+		item.VariantSKU = variant.SKU
+		item.VariantAttributes = make(map[string]interface{}, len(variant.Attributes))
+		for k, v := range variant.Attributes {
+			item.VariantAttributes[k] = v
+		}
+		if variant.ImageIndex > 0 && variant.ImageIndex < len(product.Images) {
+			item.ProductImage = product.Images[variant.ImageIndex]
+		}
+	}
+
+	return nil
+}
+
+// CheckAvailability flags an order item as in stock, on backorder or on
+// pre-order from the variant's current stock and inventory policy. Units on
+// backorder / pre-order take variant stock below zero once paid, so a
+// negative stock is the number of units already waiting. Gift cards aren't
+// stocked; their lines are marked and the recipient is checked instead.
+func (s *CatalogService) CheckAvailability(ctx context.Context, item *models.OrderItem, domain string) error {
+	item.Availability = ""
+	item.BackorderedQuantity = 0
+	item.ExpectedAt = nil
+	item.ProductType = ""
+
+	// Custom line items and products without variants aren't stocked
+	if item.Custom || item.VariantID == "" {
+		item.GiftCard = nil
+		return nil
+	}
+
+	product, err := s.GetProduct(ctx, item.ProductID, domain)
+	if err != nil {
+		return err
+	}
+	variant := product.FindVariant(item.VariantID)
+	if variant == nil {
+		return fmt.Errorf("%w: variant %s of %s", ErrProductNotFound, item.VariantID, product.Name)
+	}
+
+	if product.Type == models.ProductTypeGiftCard {
+		item.ProductType = models.ProductTypeGiftCard
+		return ValidateGiftCardRecipient(item.GiftCard)
+	}
+	item.GiftCard = nil
+
+	available := max(variant.Stock, 0)
+	if item.Quantity <= available {
+		item.Availability = "in_stock"
+		return nil
+	}
+
+	short := item.Quantity - available
+	switch variant.InventoryPolicy {
+	case models.InventoryPolicyBackorder:
+	case models.InventoryPolicyPreorder:
+		if variant.PreorderLimit > 0 {
+			// Stock only goes negative once an order is paid, so units
+			// pre-ordered by orders still waiting for payment count too
+			reserved, err := s.reservedPreorders(ctx, domain, item.ProductID, item.VariantID)
+			if err != nil {
+				return err
+			}
+			waiting := max(-variant.Stock, 0) + reserved
+			if waiting+short > variant.PreorderLimit {
+				return fmt.Errorf("%w: only %d of %s left to pre-order", ErrOutOfStock, max(variant.PreorderLimit-waiting, 0)+available, product.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: only %d of %s left", ErrOutOfStock, available, product.Name)
+	}
+
+	item.Availability = variant.InventoryPolicy
+	item.BackorderedQuantity = short
+	item.ExpectedAt = variant.ExpectedAt
+	return nil
+}
+
+// reservedPreorders sums the pre-ordered units of a variant in the domain's
+// pending orders
+func (s *CatalogService) reservedPreorders(ctx context.Context, domain, productID, variantID string) (int, error) {
+	line := bson.M{"product_id": productID, "variant_id": variantID, "availability": models.InventoryPolicyPreorder}
+
+	cursor, err := s.db.GetCollection("orders").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"domain": domain, "status": "pending", "items": bson.M{"$elemMatch": line}}}},
+		{{Key: "$unwind", Value: "$items"}},
+		{{Key: "$match", Value: bson.M{"items.product_id": productID, "items.variant_id": variantID, "items.availability": models.InventoryPolicyPreorder}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$items.backordered_quantity"}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum pending pre-orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Total int `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return 0, fmt.Errorf("failed to decode pending pre-orders: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Total, nil
+}
+
+// expectedShipAt returns the latest expected date of the items still
+// waiting for stock, or nil when everything can ship
+func expectedShipAt(items []models.OrderItem) *time.Time {
+	var latest *time.Time
+	for _, item := range items {
+		if item.BackorderedQuantity > 0 && item.ExpectedAt != nil && (latest == nil || item.ExpectedAt.After(*latest)) {
+			latest = item.ExpectedAt
+		}
+	}
+	return latest
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sparque/orders_module/internal/models"
+)
+
+func TestExpectedShipAt(t *testing.T) {
+	soon := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	later := soon.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name  string
+		items []models.OrderItem
+		want  *time.Time
+	}{
+		{"in stock", []models.OrderItem{{Quantity: 2}}, nil},
+		{"backordered without a date", []models.OrderItem{{Quantity: 2, BackorderedQuantity: 1}}, nil},
+		{"latest date", []models.OrderItem{
+			{Quantity: 1, BackorderedQuantity: 1, ExpectedAt: &later},
+			{Quantity: 1, BackorderedQuantity: 1, ExpectedAt: &soon},
+		}, &later},
+		{"allocated items ignored", []models.OrderItem{
+			{Quantity: 1, ExpectedAt: &later},
+			{Quantity: 1, BackorderedQuantity: 1, ExpectedAt: &soon},
+		}, &soon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expectedShipAt(tt.items)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("expectedShipAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
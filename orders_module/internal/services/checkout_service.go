@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCheckoutSettings is returned when checkout settings are rejected
+var ErrInvalidCheckoutSettings = errors.New("invalid checkout settings")
+
+// ErrCheckoutIncomplete is returned when an order's hosted Checkout Session
+// hasn't been completed by the customer yet
+var ErrCheckoutIncomplete = errors.New("checkout not completed")
+
+// CheckoutService manages how each domain's customers pay: payment intents
+// confirmed by the storefront or Stripe-hosted Checkout Sessions
+type CheckoutService struct {
+	db *database.MongoDB
+}
+
+func NewCheckoutService(db *database.MongoDB) *CheckoutService {
+	return &CheckoutService{db: db}
+}
+
+// GetSettings returns a domain's checkout settings, or the default (payment intents)
+func (s *CheckoutService) GetSettings(ctx context.Context, domain string) (*models.CheckoutSettings, error) {
+	var settings models.CheckoutSettings
+	err := s.db.GetCollection("checkout_settings").FindOne(ctx, bson.M{"_id": domain}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultCheckoutSettings(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkout settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings validates and saves a domain's checkout settings. Checkout
+// Sessions need both redirect URLs.
+func (s *CheckoutService) UpdateSettings(ctx context.Context, req *models.UpdateCheckoutSettingsRequest, domain, updatedBy string) (*models.CheckoutSettings, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Mode != nil {
+		settings.Mode = *req.Mode
+	}
+	if req.SuccessURL != nil {
+		settings.SuccessURL = strings.TrimSpace(*req.SuccessURL)
+	}
+	if req.CancelURL != nil {
+		settings.CancelURL = strings.TrimSpace(*req.CancelURL)
+	}
+
+	if settings.Mode != models.CheckoutModePaymentIntent && settings.Mode != models.CheckoutModeCheckoutSession {
+		return nil, fmt.Errorf("%w: mode must be payment_intent or checkout_session", ErrInvalidCheckoutSettings)
+	}
+	for name, value := range map[string]string{"success_url": settings.SuccessURL, "cancel_url": settings.CancelURL} {
+		if value == "" {
+			if settings.Mode == models.CheckoutModeCheckoutSession {
+				return nil, fmt.Errorf("%w: %s is required for checkout_session mode", ErrInvalidCheckoutSettings, name)
+			}
+			continue
+		}
+		if err := validateRedirectURL(value); err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidCheckoutSettings, name, err)
+		}
+	}
+
+	settings.UpdatedBy = updatedBy
+	settings.UpdatedAt = time.Now()
+
+	_, err = s.db.GetCollection("checkout_settings").ReplaceOne(ctx, bson.M{"_id": domain}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checkout settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// validateRedirectURL checks that a redirect URL template is an absolute
+// http(s) URL once its placeholders are filled in
+func validateRedirectURL(template string) error {
+	u, err := url.Parse(checkoutRedirectURL(template, "example.com", "000000000000000000000000"))
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// checkoutRedirectURL fills in a redirect URL template. Stripe's own
+// {CHECKOUT_SESSION_ID} is left for Stripe.
+func checkoutRedirectURL(template, domain, orderID string) string {
+	return strings.NewReplacer(
+		"{domain}", domain,
+		"{order_id}", orderID,
+	).Replace(template)
+}
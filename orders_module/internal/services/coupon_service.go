@@ -0,0 +1,537 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCouponNotFound is returned when a coupon doesn't exist for the domain
+var ErrCouponNotFound = errors.New("coupon not found")
+
+// ErrInvalidCoupon is returned when a coupon definition is rejected
+var ErrInvalidCoupon = errors.New("invalid coupon")
+
+// ErrCouponNotApplicable is returned when a code can't be used on an order
+var ErrCouponNotApplicable = errors.New("coupon can't be used")
+
+// couponCodePattern is what merchants can use as a code (stored uppercase)
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// CouponService manages discount codes and applies them at checkout: it
+// checks the conditions, works out the discount on the eligible items and
+// enforces the usage limits
+type CouponService struct {
+	db      *database.MongoDB
+	catalog *CatalogService
+}
+
+func NewCouponService(db *database.MongoDB) *CouponService {
+	return &CouponService{
+		db:      db,
+		catalog: NewCatalogService(db),
+	}
+}
+
+// CreateCoupon validates and saves a new coupon
+func (s *CouponService) CreateCoupon(ctx context.Context, req *models.CreateCouponRequest, domain, createdBy string) (*models.Coupon, error) {
+	now := time.Now()
+	coupon := &models.Coupon{
+		ID:                 primitive.NewObjectID(),
+		Domain:             domain,
+		Code:               normalizeCouponCode(req.Code),
+		Description:        req.Description,
+		Type:               req.Type,
+		Value:              req.Value,
+		MinSubtotal:        req.MinSubtotal,
+		ProductIDs:         req.ProductIDs,
+		Attributes:         req.Attributes,
+		StartsAt:           req.StartsAt,
+		EndsAt:             req.EndsAt,
+		MaxUses:            req.MaxUses,
+		MaxUsesPerCustomer: req.MaxUsesPerCustomer,
+		Active:             true,
+		CreatedBy:          createdBy,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	_, err := s.db.GetCollection("coupons").InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: code %s already exists", ErrInvalidCoupon, coupon.Code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coupon: %w", err)
+	}
+
+	return coupon, nil
+}
+
+// GetCoupon retrieves a coupon by ID
+func (s *CouponService) GetCoupon(ctx context.Context, couponID, domain string) (*models.Coupon, error) {
+	objectID, err := primitive.ObjectIDFromHex(couponID)
+	if err != nil {
+		return nil, ErrCouponNotFound
+	}
+
+	var coupon models.Coupon
+	err = s.db.GetCollection("coupons").FindOne(ctx, bson.M{"_id": objectID, "domain": domain}).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	return &coupon, nil
+}
+
+// ListCoupons lists a domain's coupons, newest first
+func (s *CouponService) ListCoupons(ctx context.Context, domain string, activeOnly bool, limit int64) ([]models.Coupon, error) {
+	filter := bson.M{"domain": domain}
+	if activeOnly {
+		filter["active"] = true
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("coupons").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coupons: %w", err)
+	}
+
+	coupons := []models.Coupon{}
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, fmt.Errorf("failed to decode coupons: %w", err)
+	}
+
+	return coupons, nil
+}
+
+// UpdateCoupon changes a coupon's conditions, limits or active flag. Only
+// the changed fields are written so concurrent redemptions keep their count.
+func (s *CouponService) UpdateCoupon(ctx context.Context, couponID string, req *models.UpdateCouponRequest, domain string) (*models.Coupon, error) {
+	coupon, err := s.GetCoupon(ctx, couponID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	if req.Description != nil {
+		coupon.Description = *req.Description
+		set["description"] = coupon.Description
+	}
+	if req.Value != nil {
+		coupon.Value = *req.Value
+		set["value"] = coupon.Value
+	}
+	if req.MinSubtotal != nil {
+		coupon.MinSubtotal = *req.MinSubtotal
+		set["min_subtotal"] = coupon.MinSubtotal
+	}
+	if req.ProductIDs != nil {
+		coupon.ProductIDs = *req.ProductIDs
+		set["product_ids"] = coupon.ProductIDs
+	}
+	if req.Attributes != nil {
+		coupon.Attributes = *req.Attributes
+		set["attributes"] = coupon.Attributes
+	}
+	if req.StartsAt != nil {
+		coupon.StartsAt = req.StartsAt
+		set["starts_at"] = coupon.StartsAt
+	}
+	if req.EndsAt != nil {
+		coupon.EndsAt = req.EndsAt
+		set["ends_at"] = coupon.EndsAt
+	}
+	if req.MaxUses != nil {
+		coupon.MaxUses = *req.MaxUses
+		set["max_uses"] = coupon.MaxUses
+	}
+	if req.MaxUsesPerCustomer != nil {
+		coupon.MaxUsesPerCustomer = *req.MaxUsesPerCustomer
+		set["max_uses_per_customer"] = coupon.MaxUsesPerCustomer
+	}
+	if req.Active != nil {
+		coupon.Active = *req.Active
+		set["active"] = coupon.Active
+	}
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+
+	set["updated_at"] = time.Now()
+	if _, err := s.db.GetCollection("coupons").UpdateOne(ctx, bson.M{"_id": coupon.ID}, bson.M{"$set": set}); err != nil {
+		return nil, fmt.Errorf("failed to update coupon: %w", err)
+	}
+
+	return s.GetCoupon(ctx, couponID, domain)
+}
+
+// ListRedemptions lists the orders a coupon was used on, newest first
+func (s *CouponService) ListRedemptions(ctx context.Context, couponID, domain string, limit int64) ([]models.CouponRedemption, error) {
+	if _, err := s.GetCoupon(ctx, couponID, domain); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("coupon_redemptions").Find(ctx, bson.M{"domain": domain, "coupon_id": couponID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coupon redemptions: %w", err)
+	}
+
+	redemptions := []models.CouponRedemption{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		return nil, fmt.Errorf("failed to decode coupon redemptions: %w", err)
+	}
+
+	return redemptions, nil
+}
+
+// Quote checks that a code can be used on a cart and works out its
+// discount. Percentage and fixed discounts only apply to the eligible items
+// (all catalog items without product or attribute conditions; never gift
+// cards), the minimum subtotal is checked against the whole cart.
+func (s *CouponService) Quote(ctx context.Context, domain, code string, items []models.OrderItem, customer models.Customer) (*models.Coupon, *models.CouponQuote, error) {
+	var coupon models.Coupon
+	err := s.db.GetCollection("coupons").FindOne(ctx, bson.M{"domain": domain, "code": normalizeCouponCode(code)}).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case !coupon.Active:
+		return nil, nil, fmt.Errorf("%w: %s is no longer valid", ErrCouponNotApplicable, coupon.Code)
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return nil, nil, fmt.Errorf("%w: %s isn't valid yet", ErrCouponNotApplicable, coupon.Code)
+	case coupon.EndsAt != nil && now.After(*coupon.EndsAt):
+		return nil, nil, fmt.Errorf("%w: %s has expired", ErrCouponNotApplicable, coupon.Code)
+	case coupon.MaxUses > 0 && coupon.Uses >= coupon.MaxUses:
+		return nil, nil, fmt.Errorf("%w: %s has been used up", ErrCouponNotApplicable, coupon.Code)
+	}
+
+	if coupon.MaxUsesPerCustomer > 0 {
+		key := couponCustomerKey(customer)
+		if key == "" {
+			return nil, nil, fmt.Errorf("%w: enter your email to use %s", ErrCouponNotApplicable, coupon.Code)
+		}
+		used, err := s.customerUses(ctx, &coupon, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if used >= int64(coupon.MaxUsesPerCustomer) {
+			return nil, nil, fmt.Errorf("%w: you've already used %s", ErrCouponNotApplicable, coupon.Code)
+		}
+	}
+
+	var subtotal, eligible float64
+	products := make(map[string]*models.CatalogProduct)
+	for _, item := range items {
+		total := roundCents(item.UnitPrice * float64(item.Quantity))
+		subtotal += total
+		if item.Custom {
+			continue
+		}
+
+		product, ok := products[item.ProductID]
+		if !ok {
+			// Items that aren't in the catalog just don't get the discount
+			product, _ = s.catalog.GetProduct(ctx, item.ProductID, domain)
+			products[item.ProductID] = product
+		}
+		if product != nil && couponAppliesTo(&coupon, product) {
+			eligible += total
+		}
+	}
+	subtotal = roundCents(subtotal)
+	eligible = roundCents(eligible)
+
+	if subtotal < coupon.MinSubtotal {
+		return nil, nil, fmt.Errorf("%w: %s needs a subtotal of at least %.2f", ErrCouponNotApplicable, coupon.Code, coupon.MinSubtotal)
+	}
+
+	quote := &models.CouponQuote{
+		Code:             coupon.Code,
+		Type:             coupon.Type,
+		Description:      coupon.Description,
+		EligibleSubtotal: eligible,
+	}
+	switch coupon.Type {
+	case models.CouponPercentage:
+		quote.Discount = roundCents(eligible * coupon.Value / 100)
+	case models.CouponFixed:
+		quote.Discount = min(coupon.Value, eligible)
+	case models.CouponFreeShipping:
+		quote.FreeShipping = true
+	}
+	if coupon.Type != models.CouponFreeShipping && quote.Discount <= 0 {
+		return nil, nil, fmt.Errorf("%w: %s doesn't apply to any item in the cart", ErrCouponNotApplicable, coupon.Code)
+	}
+
+	return &coupon, quote, nil
+}
+
+// Redeem records a coupon use for an order. The order's ID must already be
+// set. Both usage limits are checked again atomically, so two checkouts
+// can't take the last use.
+func (s *CouponService) Redeem(ctx context.Context, order *models.Order, coupon *models.Coupon, discount float64) error {
+	customerKey := couponCustomerKey(order.Customer)
+	if coupon.MaxUsesPerCustomer > 0 {
+		if err := s.takeCustomerUse(ctx, coupon, customerKey); err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"_id": coupon.ID, "active": true}
+	if coupon.MaxUses > 0 {
+		filter["uses"] = bson.M{"$lt": coupon.MaxUses}
+	}
+
+	collection := s.db.GetCollection("coupons")
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err == nil && result.MatchedCount == 0 {
+		err = fmt.Errorf("%w: %s has been used up", ErrCouponNotApplicable, coupon.Code)
+	} else if err != nil {
+		err = fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if err != nil {
+		s.giveBackCustomerUse(ctx, coupon.ID.Hex(), customerKey)
+		return err
+	}
+
+	redemption := &models.CouponRedemption{
+		ID:          primitive.NewObjectID(),
+		Domain:      order.Domain,
+		CouponID:    coupon.ID.Hex(),
+		Code:        coupon.Code,
+		OrderID:     order.ID.Hex(),
+		CustomerKey: customerKey,
+		Discount:    discount,
+		Status:      "active",
+		CreatedAt:   time.Now(),
+	}
+	if _, err := s.db.GetCollection("coupon_redemptions").InsertOne(ctx, redemption); err != nil {
+		if _, rollbackErr := collection.UpdateOne(ctx, bson.M{"_id": coupon.ID}, bson.M{"$inc": bson.M{"uses": -1}}); rollbackErr != nil {
+			log.Printf("ERROR: Failed to give back use of coupon %s: %v", coupon.Code, rollbackErr)
+		}
+		s.giveBackCustomerUse(ctx, coupon.ID.Hex(), customerKey)
+		return fmt.Errorf("failed to record coupon redemption: %w", err)
+	}
+
+	return nil
+}
+
+// takeCustomerUse counts a use against the customer's limit. The counter is
+// seeded from the customer's redemptions the first time, then only
+// incremented while it is under the limit, so concurrent checkouts can't go
+// over it.
+func (s *CouponService) takeCustomerUse(ctx context.Context, coupon *models.Coupon, customerKey string) error {
+	if customerKey == "" {
+		return fmt.Errorf("%w: enter your email to use %s", ErrCouponNotApplicable, coupon.Code)
+	}
+
+	collection := s.db.GetCollection("coupon_customer_uses")
+	filter := bson.M{"coupon_id": coupon.ID.Hex(), "customer_key": customerKey}
+	if err := collection.FindOne(ctx, filter).Err(); err == mongo.ErrNoDocuments {
+		used, err := s.customerUses(ctx, coupon, customerKey)
+		if err != nil {
+			return err
+		}
+		_, err = collection.InsertOne(ctx, &models.CouponCustomerUses{
+			Domain:      coupon.Domain,
+			CouponID:    coupon.ID.Hex(),
+			CustomerKey: customerKey,
+			Uses:        int(used),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to redeem coupon: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+
+	filter["uses"] = bson.M{"$lt": coupon.MaxUsesPerCustomer}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: you've already used %s", ErrCouponNotApplicable, coupon.Code)
+	}
+	return nil
+}
+
+// giveBackCustomerUse takes a use off the customer's counter, if the coupon
+// has one for them
+func (s *CouponService) giveBackCustomerUse(ctx context.Context, couponID, customerKey string) {
+	if customerKey == "" {
+		return
+	}
+	_, err := s.db.GetCollection("coupon_customer_uses").UpdateOne(ctx,
+		bson.M{"coupon_id": couponID, "customer_key": customerKey, "uses": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"uses": -1}},
+	)
+	if err != nil {
+		log.Printf("ERROR: Failed to give back coupon use of %s: %v", customerKey, err)
+	}
+}
+
+// Release gives back the coupon use of an order that was cancelled,
+// refunded or couldn't be placed. Safe to call again.
+func (s *CouponService) Release(ctx context.Context, order *models.Order) error {
+	now := time.Now()
+	var redemption models.CouponRedemption
+	err := s.db.GetCollection("coupon_redemptions").FindOneAndUpdate(ctx,
+		bson.M{"domain": order.Domain, "order_id": order.ID.Hex(), "status": "active"},
+		bson.M{"$set": bson.M{"status": "released", "released_at": now}},
+	).Decode(&redemption)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release coupon: %w", err)
+	}
+
+	s.giveBackCustomerUse(ctx, redemption.CouponID, redemption.CustomerKey)
+
+	couponID, err := primitive.ObjectIDFromHex(redemption.CouponID)
+	if err != nil {
+		return nil
+	}
+	_, err = s.db.GetCollection("coupons").UpdateOne(ctx, bson.M{"_id": couponID}, bson.M{"$inc": bson.M{"uses": -1}})
+	if err != nil {
+		return fmt.Errorf("failed to release coupon: %w", err)
+	}
+
+	return nil
+}
+
+// customerUses counts a customer's orders with the coupon that weren't released
+func (s *CouponService) customerUses(ctx context.Context, coupon *models.Coupon, customerKey string) (int64, error) {
+	count, err := s.db.GetCollection("coupon_redemptions").CountDocuments(ctx, bson.M{
+		"domain":       coupon.Domain,
+		"coupon_id":    coupon.ID.Hex(),
+		"customer_key": customerKey,
+		"status":       "active",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count coupon uses: %w", err)
+	}
+	return count, nil
+}
+
+// couponAppliesTo checks a product against a coupon's product and attribute
+// conditions. Gift cards can't be bought with a discount.
+func couponAppliesTo(coupon *models.Coupon, product *models.CatalogProduct) bool {
+	if product.Type == models.ProductTypeGiftCard {
+		return false
+	}
+
+	if len(coupon.ProductIDs) > 0 {
+		found := false
+		for _, id := range coupon.ProductIDs {
+			if id == product.ID.Hex() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range coupon.Attributes {
+		if !strings.EqualFold(product.Attributes[key], value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasCoupon reports whether a coupon was used on an order
+func hasCoupon(order *models.Order) bool {
+	for _, discount := range order.Discounts {
+		if discount.Type == "coupon" {
+			return true
+		}
+	}
+	return false
+}
+
+// couponCustomerKey identifies a customer for per-customer limits: logged-in
+// customers by user ID, guests by email
+func couponCustomerKey(customer models.Customer) string {
+	if customer.UserID != "" {
+		return "user:" + customer.UserID
+	}
+	if email := strings.ToLower(strings.TrimSpace(customer.Email)); email != "" {
+		return "email:" + email
+	}
+	return ""
+}
+
+// normalizeCouponCode makes codes case-insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validateCoupon checks a coupon definition
+func validateCoupon(coupon *models.Coupon) error {
+	var problems []string
+
+	if !couponCodePattern.MatchString(coupon.Code) {
+		problems = append(problems, "code must be 3-32 letters, digits, - or _")
+	}
+	switch coupon.Type {
+	case models.CouponPercentage:
+		if coupon.Value <= 0 || coupon.Value > 100 {
+			problems = append(problems, "percentage value must be between 0 and 100")
+		}
+	case models.CouponFixed:
+		if coupon.Value <= 0 {
+			problems = append(problems, "fixed value must be positive")
+		}
+	case models.CouponFreeShipping:
+		coupon.Value = 0
+	default:
+		problems = append(problems, "type must be percentage, fixed or free_shipping")
+	}
+	if coupon.MinSubtotal < 0 {
+		problems = append(problems, "min_subtotal can't be negative")
+	}
+	if coupon.MaxUses < 0 || coupon.MaxUsesPerCustomer < 0 {
+		problems = append(problems, "usage limits can't be negative")
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		problems = append(problems, "ends_at must be after starts_at")
+	}
+	for _, id := range coupon.ProductIDs {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid product ID %q", id))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidCoupon, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCustomerNotFound is returned when a customer has no paid orders on the domain
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// ErrInvalidCustomerSort is returned for an unknown profile sort order
+var ErrInvalidCustomerSort = errors.New("invalid sort")
+
+// paidOrderStatuses are the statuses an order can only reach once paid.
+// Orders marked paid by the payment webhook also carry paid_at.
+var paidOrderStatuses = []string{"paid", "processing", "partially_shipped", "shipped", "delivered", "refunded"}
+
+var customerSortKeys = map[string]string{
+	models.CustomerSortSpend:   "lifetime_spend",
+	models.CustomerSortOrders:  "orders",
+	models.CustomerSortAverage: "average_order_value",
+	models.CustomerSortRecent:  "last_order_at",
+}
+
+// CustomerProfileService keeps a profile per customer with their order
+// count, spend and refunds. A customer's profile is refreshed from their
+// orders whenever one of them is paid, edited, refunded or cancelled, so a
+// replayed webhook can't count an order twice.
+type CustomerProfileService struct {
+	db *database.MongoDB
+}
+
+func NewCustomerProfileService(db *database.MongoDB) *CustomerProfileService {
+	return &CustomerProfileService{db: db}
+}
+
+// RecordOrder refreshes the profile of an order's customer. Unpaid orders
+// don't count, so they leave the profile alone.
+func (s *CustomerProfileService) RecordOrder(ctx context.Context, order *models.Order) error {
+	if !isPaidOrder(order) {
+		return nil
+	}
+
+	key := couponCustomerKey(order.Customer)
+	if key == "" {
+		return nil
+	}
+
+	return s.refresh(ctx, order.Domain, key)
+}
+
+// Rebuild recomputes every profile of a domain from its orders, e.g. to
+// backfill orders placed before profiles existed. Returns the number of
+// customers.
+func (s *CustomerProfileService) Rebuild(ctx context.Context, domain string) (int, error) {
+	opts := options.Find().SetProjection(bson.M{"customer": 1})
+	cursor, err := s.db.GetCollection("orders").Find(ctx, paidOrdersQuery(domain), opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	seen := map[string]bool{}
+	keys := []string{}
+	for cursor.Next(ctx) {
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			return 0, fmt.Errorf("failed to decode order: %w", err)
+		}
+		if key := couponCustomerKey(order.Customer); key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	for _, key := range keys {
+		if err := s.refresh(ctx, domain, key); err != nil {
+			return 0, err
+		}
+	}
+
+	// Customers whose orders are gone
+	_, err = s.db.GetCollection("customer_profiles").DeleteMany(ctx, bson.M{
+		"domain": domain,
+		"key":    bson.M{"$nin": keys},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove stale customer profiles: %w", err)
+	}
+
+	return len(keys), nil
+}
+
+// ListProfiles lists a domain's customers, by lifetime spend unless another sort is given
+func (s *CustomerProfileService) ListProfiles(ctx context.Context, domain, sort string, limit int64) ([]models.CustomerProfile, error) {
+	if sort == "" {
+		sort = models.CustomerSortSpend
+	}
+	field, ok := customerSortKeys[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, use spend, orders, average or recent", ErrInvalidCustomerSort, sort)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: -1}, {Key: "key", Value: 1}}).
+		SetLimit(limit)
+	cursor, err := s.db.GetCollection("customer_profiles").Find(ctx, bson.M{"domain": domain}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+
+	profiles := []models.CustomerProfile{}
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode customers: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// GetProfile finds a customer by profile key (user:<id> or email:<address>).
+// A bare email or user ID works too.
+func (s *CustomerProfileService) GetProfile(ctx context.Context, domain, key string) (*models.CustomerProfile, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, "user:") && !strings.HasPrefix(key, "email:") {
+		if strings.Contains(key, "@") {
+			key = "email:" + key
+		} else {
+			key = "user:" + key
+		}
+	}
+	if strings.HasPrefix(key, "email:") {
+		key = strings.ToLower(key)
+	}
+
+	var profile models.CustomerProfile
+	err := s.db.GetCollection("customer_profiles").FindOne(ctx, bson.M{
+		"domain": domain,
+		"key":    key,
+	}).Decode(&profile)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// ListOrders returns a customer's orders, newest first, paid or not
+func (s *CustomerProfileService) ListOrders(ctx context.Context, profile *models.CustomerProfile, limit int64) ([]*models.Order, error) {
+	filter := customerOrdersQuery(profile.Domain, profile.Key)
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("orders").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	orders := []*models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// refresh recomputes one customer's profile from their paid orders
+func (s *CustomerProfileService) refresh(ctx context.Context, domain, key string) error {
+	filter := bson.M{"$and": bson.A{customerOrdersQuery(domain, key), paidOrdersQuery(domain)}}
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1}).SetProjection(bson.M{
+		"customer":            1,
+		"status":              1,
+		"payment":             1,
+		"payment_adjustments": 1,
+		"gift_card_payments":  1,
+		"created_at":          1,
+	})
+	cursor, err := s.db.GetCollection("orders").Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("failed to list customer orders: %w", err)
+	}
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return fmt.Errorf("failed to decode customer orders: %w", err)
+	}
+
+	collection := s.db.GetCollection("customer_profiles")
+	if len(orders) == 0 {
+		_, err := collection.DeleteOne(ctx, bson.M{"domain": domain, "key": key})
+		if err != nil {
+			return fmt.Errorf("failed to remove customer profile: %w", err)
+		}
+		return nil
+	}
+
+	profile := models.CustomerProfile{
+		Domain:       domain,
+		Key:          key,
+		FirstOrderAt: orders[0].CreatedAt,
+		UpdatedAt:    time.Now(),
+	}
+	for _, order := range orders {
+		paid, refunded := orderPayments(&order)
+		profile.Orders++
+		profile.TotalPaid += paid
+		profile.Refunded += refunded
+		if order.Status == "refunded" || order.Status == "cancelled" {
+			profile.RefundedOrders++
+		}
+
+		// Contact details from the latest order
+		profile.UserID = order.Customer.UserID
+		profile.Email = order.Customer.Email
+		profile.Name = order.Customer.Name
+		profile.LastOrderAt = order.CreatedAt
+	}
+	profile.TotalPaid = roundCents(profile.TotalPaid)
+	profile.Refunded = roundCents(profile.Refunded)
+	profile.LifetimeSpend = roundCents(profile.TotalPaid - profile.Refunded)
+	profile.AverageOrderValue = roundCents(profile.TotalPaid / float64(profile.Orders))
+
+	_, err = collection.ReplaceOne(ctx, bson.M{"domain": domain, "key": key}, profile, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save customer profile: %w", err)
+	}
+
+	return nil
+}
+
+// orderPayments returns what was charged for an order (card, gift cards and
+// edit charges) and how much of it was refunded. Refunded and cancelled
+// orders were refunded in full.
+func orderPayments(order *models.Order) (paid, refunded float64) {
+	paid = float64(order.Payment.Amount) / 100
+	for _, payment := range order.GiftCardPayments {
+		paid += payment.Amount
+	}
+
+	var refunds int64
+	for _, adjustment := range order.PaymentAdjustments {
+		switch {
+		case adjustment.Type == "charge" && adjustment.Status == "succeeded":
+			paid += float64(adjustment.Amount) / 100
+		case adjustment.Type == "refund" && adjustment.Status != "failed":
+			refunds += adjustment.Amount
+		}
+	}
+
+	refunded = float64(refunds) / 100
+	if order.Status == "refunded" || order.Status == "cancelled" || refunded > paid {
+		refunded = paid
+	}
+	return paid, refunded
+}
+
+// isPaidOrder reports whether an order was paid (and maybe refunded since)
+func isPaidOrder(order *models.Order) bool {
+	if order.PaidAt != nil {
+		return true
+	}
+	for _, status := range paidOrderStatuses {
+		if order.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// paidOrdersQuery matches a domain's orders that were paid
+func paidOrdersQuery(domain string) bson.M {
+	return bson.M{
+		"domain": domain,
+		"$or": bson.A{
+			bson.M{"paid_at": bson.M{"$ne": nil}},
+			bson.M{"status": bson.M{"$in": paidOrderStatuses}},
+		},
+	}
+}
+
+// customerOrdersQuery matches the orders of the customer with a profile key.
+// Guest orders match by email whatever its case.
+func customerOrdersQuery(domain, key string) bson.M {
+	if userID, ok := strings.CutPrefix(key, "user:"); ok {
+		return bson.M{"domain": domain, "customer.user_id": userID}
+	}
+
+	email := strings.TrimPrefix(key, "email:")
+	return bson.M{
+		"domain":           domain,
+		"customer.user_id": bson.M{"$in": bson.A{nil, ""}},
+		"customer.email":   primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"},
+	}
+}
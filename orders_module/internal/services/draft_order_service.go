@@ -0,0 +1,518 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrDraftNotFound is returned when a draft order or payment link doesn't exist
+	ErrDraftNotFound = errors.New("draft order not found")
+
+	// ErrInvalidDraft is returned when a draft order can't be priced or changed
+	ErrInvalidDraft = errors.New("invalid draft order")
+)
+
+// PaymentLinkSettings controls the payment links sent for draft orders
+type PaymentLinkSettings struct {
+	URL         string // Link template, {domain} and {token} are replaced
+	ExpiryHours int
+}
+
+// DraftOrderService manages admin-created draft orders
+type DraftOrderService struct {
+	db       *database.MongoDB
+	orders   *OrderService
+	catalog  *CatalogService
+	email    *EmailService
+	settings PaymentLinkSettings
+}
+
+func NewDraftOrderService(db *database.MongoDB, orders *OrderService, email *EmailService, settings PaymentLinkSettings) *DraftOrderService {
+	return &DraftOrderService{
+		db:       db,
+		orders:   orders,
+		catalog:  NewCatalogService(db),
+		email:    email,
+		settings: settings,
+	}
+}
+
+// CreateDraft prices and saves a new draft order
+func (s *DraftOrderService) CreateDraft(ctx context.Context, req *models.CreateDraftOrderRequest, domain, createdBy string) (*models.DraftOrder, error) {
+	now := time.Now()
+	draft := &models.DraftOrder{
+		ID:              primitive.NewObjectID(),
+		Domain:          domain,
+		Customer:        req.Customer,
+		Items:           req.Items,
+		Currency:        "USD",
+		ManualDiscount:  req.ManualDiscount,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		Status:          "open",
+		Notes:           req.Notes,
+		AdminNotes:      req.AdminNotes,
+		CreatedBy:       createdBy,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	NormalizeAddress(&draft.ShippingAddress)
+	NormalizeAddress(&draft.BillingAddress)
+
+	if err := s.priceDraft(ctx, draft); err != nil {
+		return nil, err
+	}
+
+	collection := s.db.GetCollection("draft_orders")
+	if _, err := collection.InsertOne(ctx, draft); err != nil {
+		return nil, fmt.Errorf("failed to insert draft order: %w", err)
+	}
+
+	return draft, nil
+}
+
+// GetDraft retrieves a draft order by ID
+func (s *DraftOrderService) GetDraft(ctx context.Context, draftID, domain string) (*models.DraftOrder, error) {
+	collection := s.db.GetCollection("draft_orders")
+
+	objectID, err := primitive.ObjectIDFromHex(draftID)
+	if err != nil {
+		return nil, ErrDraftNotFound
+	}
+
+	var draft models.DraftOrder
+	err = collection.FindOne(ctx, bson.M{
+		"_id":    objectID,
+		"domain": domain,
+	}).Decode(&draft)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get draft order: %w", err)
+	}
+
+	return &draft, nil
+}
+
+// ListDrafts lists draft orders for a domain, optionally filtered by status
+func (s *DraftOrderService) ListDrafts(ctx context.Context, domain, status string, limit int) ([]*models.DraftOrder, error) {
+	collection := s.db.GetCollection("draft_orders")
+
+	filter := bson.M{"domain": domain}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list draft orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	drafts := []*models.DraftOrder{}
+	if err := cursor.All(ctx, &drafts); err != nil {
+		return nil, fmt.Errorf("failed to decode draft orders: %w", err)
+	}
+
+	return drafts, nil
+}
+
+// UpdateDraft edits an open or sent draft and re-prices it
+func (s *DraftOrderService) UpdateDraft(ctx context.Context, draftID string, req *models.UpdateDraftOrderRequest, domain string) (*models.DraftOrder, error) {
+	draft, err := s.GetDraft(ctx, draftID, domain)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != "open" && draft.Status != "sent" {
+		return nil, fmt.Errorf("%w: draft is %s", ErrInvalidDraft, draft.Status)
+	}
+
+	if req.Customer != nil {
+		draft.Customer = *req.Customer
+	}
+	if req.Items != nil {
+		draft.Items = *req.Items
+	}
+	if req.ManualDiscount != nil {
+		// A zero value removes the discount
+		draft.ManualDiscount = req.ManualDiscount
+		if req.ManualDiscount.Value == 0 {
+			draft.ManualDiscount = nil
+		}
+	}
+	if req.ShippingAddress != nil {
+		draft.ShippingAddress = *req.ShippingAddress
+		NormalizeAddress(&draft.ShippingAddress)
+	}
+	if req.BillingAddress != nil {
+		draft.BillingAddress = *req.BillingAddress
+		NormalizeAddress(&draft.BillingAddress)
+	}
+	if req.Notes != nil {
+		draft.Notes = *req.Notes
+	}
+	if req.AdminNotes != nil {
+		draft.AdminNotes = *req.AdminNotes
+	}
+
+	if err := s.priceDraft(ctx, draft); err != nil {
+		return nil, err
+	}
+	draft.UpdatedAt = time.Now()
+
+	collection := s.db.GetCollection("draft_orders")
+	result, err := collection.ReplaceOne(ctx, bson.M{
+		"_id":    draft.ID,
+		"status": bson.M{"$in": []string{"open", "sent"}},
+	}, draft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update draft order: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: draft was completed while editing", ErrInvalidDraft)
+	}
+
+	return draft, nil
+}
+
+// CancelDraft cancels a draft that hasn't been paid yet
+func (s *DraftOrderService) CancelDraft(ctx context.Context, draftID, domain string) error {
+	collection := s.db.GetCollection("draft_orders")
+
+	objectID, err := primitive.ObjectIDFromHex(draftID)
+	if err != nil {
+		return ErrDraftNotFound
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{
+		"_id":    objectID,
+		"domain": domain,
+		"status": bson.M{"$in": []string{"open", "sent"}},
+	}, bson.M{
+		"$set": bson.M{
+			"status":     "cancelled",
+			"updated_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel draft order: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: draft not found or already completed", ErrInvalidDraft)
+	}
+
+	return nil
+}
+
+// SendPaymentLink issues a payment link token and emails it to the customer.
+// Sending again issues a fresh link and invalidates the previous one.
+func (s *DraftOrderService) SendPaymentLink(ctx context.Context, draftID, domain string) (*models.DraftOrder, error) {
+	draft, err := s.GetDraft(ctx, draftID, domain)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != "open" && draft.Status != "sent" {
+		return nil, fmt.Errorf("%w: draft is %s", ErrInvalidDraft, draft.Status)
+	}
+	if draft.Customer.Email == "" {
+		return nil, fmt.Errorf("%w: customer email is required to send a payment link", ErrInvalidDraft)
+	}
+	if len(draft.Items) == 0 {
+		return nil, fmt.Errorf("%w: draft has no items", ErrInvalidDraft)
+	}
+
+	token, err := generatePaymentToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(time.Duration(s.settings.ExpiryHours) * time.Hour)
+	link := strings.NewReplacer("{domain}", domain, "{token}", token).Replace(s.settings.URL)
+
+	collection := s.db.GetCollection("draft_orders")
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": draft.ID}, bson.M{
+		"$set": bson.M{
+			"status":               "sent",
+			"payment_token":        token,
+			"payment_link_url":     link,
+			"payment_link_sent_at": now,
+			"payment_link_expiry":  expiry,
+			"updated_at":           now,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save payment link: %w", err)
+	}
+
+	draft.Status = "sent"
+	draft.PaymentToken = token
+	draft.PaymentLinkURL = link
+	draft.PaymentLinkSentAt = &now
+	draft.PaymentLinkExpiry = &expiry
+
+	err = s.email.SendPaymentLink(draft.Customer.Email, PaymentLinkEmail{
+		Domain:    domain,
+		Name:      draft.Customer.Name,
+		Items:     draft.Items,
+		Discount:  draft.Discount,
+		Total:     draft.Total,
+		Link:      link,
+		ExpiresAt: expiry.Format("January 2, 2006 at 3:04 PM"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+// conversionTimeout is how long a payment link conversion may hold the
+// draft before another request can take over (e.g. after a crash)
+const conversionTimeout = 2 * time.Minute
+
+// GetPaymentLink shows the draft behind a payment link without converting
+// it, so link previews and mail scanners don't create a payment. Once the
+// link was used, the resulting order is included.
+func (s *DraftOrderService) GetPaymentLink(ctx context.Context, token string) (*models.PaymentLink, error) {
+	draft, err := s.draftByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.PaymentLink{
+		Status:    "open",
+		Items:     draft.Items,
+		Currency:  draft.Currency,
+		Subtotal:  draft.Subtotal,
+		Discount:  draft.Discount,
+		Total:     draft.Total,
+		ExpiresAt: draft.PaymentLinkExpiry,
+	}
+
+	switch draft.Status {
+	case "completed":
+		order, err := s.orders.GetOrder(ctx, draft.OrderID, draft.Domain)
+		if err != nil {
+			return nil, err
+		}
+		link.Status = "completed"
+		link.Order = order
+	case "sent", "converting":
+		if draft.PaymentLinkExpiry != nil && time.Now().After(*draft.PaymentLinkExpiry) {
+			link.Status = "expired"
+		}
+	default:
+		return nil, fmt.Errorf("%w: draft is %s", ErrInvalidDraft, draft.Status)
+	}
+
+	return link, nil
+}
+
+// OpenPaymentLink converts the draft behind a payment link into a pending
+// order with a payment intent. Opening the link again returns the same order
+// and payment intent.
+func (s *DraftOrderService) OpenPaymentLink(ctx context.Context, token string) (*models.Order, error) {
+	collection := s.db.GetCollection("draft_orders")
+
+	draft, err := s.draftByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if draft.Status == "completed" {
+		return s.orders.GetOrder(ctx, draft.OrderID, draft.Domain)
+	}
+	if draft.Status != "sent" && draft.Status != "converting" {
+		return nil, fmt.Errorf("%w: draft is %s", ErrInvalidDraft, draft.Status)
+	}
+	if draft.PaymentLinkExpiry != nil && time.Now().After(*draft.PaymentLinkExpiry) {
+		return nil, fmt.Errorf("%w: payment link has expired", ErrInvalidDraft)
+	}
+
+	// Claim the draft so a double click can't create two orders. A claim
+	// left behind by a conversion that never finished can be taken over.
+	now := time.Now()
+	claim, err := collection.UpdateOne(ctx, bson.M{
+		"_id": draft.ID,
+		"$or": bson.A{
+			bson.M{"status": "sent"},
+			bson.M{"status": "converting", "converting_at": bson.M{"$lt": now.Add(-conversionTimeout)}},
+		},
+	}, bson.M{
+		"$set": bson.M{"status": "converting", "converting_at": now, "updated_at": now},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim draft order: %w", err)
+	}
+	if claim.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: payment link is already being processed", ErrInvalidDraft)
+	}
+
+	// An earlier conversion may have placed the order and stopped before
+	// completing the draft: reuse that order and its payment intent
+	var order models.Order
+	err = s.db.GetCollection("orders").FindOne(ctx, bson.M{"domain": draft.Domain, "draft_order_id": draft.ID.Hex()}).Decode(&order)
+	if err != nil && err != mongo.ErrNoDocuments {
+		s.releaseClaim(ctx, draft)
+		return nil, fmt.Errorf("failed to check for an existing order: %w", err)
+	}
+	if err == mongo.ErrNoDocuments {
+		order = models.Order{
+			Domain:          draft.Domain,
+			Customer:        draft.Customer,
+			Items:           draft.Items,
+			Subtotal:        draft.Subtotal,
+			Discount:        draft.Discount,
+			ShippingAddress: draft.ShippingAddress,
+			BillingAddress:  draft.BillingAddress,
+			Notes:           draft.Notes,
+			AdminNotes:      draft.AdminNotes,
+			DraftOrderID:    draft.ID.Hex(),
+		}
+		if draft.Discount > 0 {
+			order.Discounts = []models.OrderDiscount{{
+				Type:        "manual",
+				Description: draft.ManualDiscount.Reason,
+				Amount:      draft.Discount,
+			}}
+		}
+
+		if err := s.orders.placeOrder(ctx, &order); err != nil {
+			// Release the claim so the customer can retry
+			s.releaseClaim(ctx, draft)
+			return nil, err
+		}
+	}
+
+	now = time.Now()
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": draft.ID}, bson.M{
+		"$set": bson.M{
+			"status":       "completed",
+			"order_id":     order.ID.Hex(),
+			"order_number": order.OrderNumber,
+			"completed_at": now,
+			"updated_at":   now,
+		},
+		"$unset": bson.M{"converting_at": ""},
+	})
+	if err != nil {
+		// The order is placed; the next visit completes the draft with it
+		log.Printf("ERROR: Failed to complete draft order %s: %v", draft.ID.Hex(), err)
+	}
+
+	return &order, nil
+}
+
+// draftByToken finds the draft behind a payment link
+func (s *DraftOrderService) draftByToken(ctx context.Context, token string) (*models.DraftOrder, error) {
+	var draft models.DraftOrder
+	err := s.db.GetCollection("draft_orders").FindOne(ctx, bson.M{"payment_token": token}).Decode(&draft)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get draft order: %w", err)
+	}
+	return &draft, nil
+}
+
+// releaseClaim puts a draft whose conversion failed back to sent
+func (s *DraftOrderService) releaseClaim(ctx context.Context, draft *models.DraftOrder) {
+	_, err := s.db.GetCollection("draft_orders").UpdateOne(ctx,
+		bson.M{"_id": draft.ID, "status": "converting"},
+		bson.M{
+			"$set":   bson.M{"status": "sent", "updated_at": time.Now()},
+			"$unset": bson.M{"converting_at": ""},
+		},
+	)
+	if err != nil {
+		log.Printf("ERROR: Failed to release draft order %s, it can be retried in %s: %v", draft.ID.Hex(), conversionTimeout, err)
+	}
+}
+
+// priceDraft prices catalog items from products_module, validates custom
+// line items and applies the manual discount
+func (s *DraftOrderService) priceDraft(ctx context.Context, draft *models.DraftOrder) error {
+	var subtotal float64
+	for i := range draft.Items {
+		item := &draft.Items[i]
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidDraft, i+1)
+		}
+
+		if item.Custom {
+			if item.ProductName == "" || item.UnitPrice <= 0 {
+				return fmt.Errorf("%w: custom item %d needs product_name and a positive unit_price", ErrInvalidDraft, i+1)
+			}
+			item.ProductID = ""
+			item.VariantID = ""
+		} else if err := s.catalog.PriceItem(ctx, item, draft.Domain); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDraft, err)
+		}
+
+		item.Total = roundCents(item.UnitPrice * float64(item.Quantity))
+		subtotal += item.Total
+	}
+
+	discount := 0.0
+	if d := draft.ManualDiscount; d != nil {
+		switch d.Type {
+		case "percentage":
+			if d.Value < 0 || d.Value > 100 {
+				return fmt.Errorf("%w: percentage discount must be between 0 and 100", ErrInvalidDraft)
+			}
+			discount = subtotal * d.Value / 100
+		case "fixed":
+			if d.Value < 0 {
+				return fmt.Errorf("%w: fixed discount can't be negative", ErrInvalidDraft)
+			}
+			discount = d.Value
+		default:
+			return fmt.Errorf("%w: discount type must be percentage or fixed", ErrInvalidDraft)
+		}
+	}
+
+	draft.Subtotal = roundCents(subtotal)
+	draft.Discount = roundCents(math.Min(discount, draft.Subtotal))
+	draft.Total = roundCents(draft.Subtotal - draft.Discount)
+
+	return nil
+}
+
+// generatePaymentToken creates an unguessable payment link token
+func generatePaymentToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate payment token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// roundCents rounds an amount to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
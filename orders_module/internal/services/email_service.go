@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/smtp"
+
+	"github.com/sparque/orders_module/internal/models"
+)
+
+// EmailSettings holds SMTP settings for outgoing customer emails
+type EmailSettings struct {
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	FromAddress string
+}
+
+// EmailService handles sending customer emails
+type EmailService struct {
+	settings EmailSettings
+}
+
+func NewEmailService(settings EmailSettings) *EmailService {
+	return &EmailService{settings: settings}
+}
+
+var paymentLinkTemplate = template.Must(template.New("payment_link").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.button { display: inline-block; padding: 12px 24px; background-color: #007bff; color: white; text-decoration: none; border-radius: 4px; }
+		table { width: 100%; border-collapse: collapse; margin: 20px 0; }
+		td { padding: 6px 0; border-bottom: 1px solid #eee; }
+		.amount { text-align: right; }
+		.footer { margin-top: 30px; font-size: 12px; color: #666; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<h2>Your order from {{.Domain}}</h2>
+		<p>Hi {{.Name}}, we've prepared your order. Review it and pay securely using the link below.</p>
+		<table>
+			{{range .Items}}
+			<tr><td>{{.ProductName}} &times; {{.Quantity}}</td><td class="amount">${{printf "%.2f" .Total}}</td></tr>
+			{{end}}
+			{{if .Discount}}
+			<tr><td>Discount</td><td class="amount">-${{printf "%.2f" .Discount}}</td></tr>
+			{{end}}
+			<tr><td><strong>Total</strong></td><td class="amount"><strong>${{printf "%.2f" .Total}}</strong></td></tr>
+		</table>
+		<p><a href="{{.Link}}" class="button">Pay Now</a></p>
+		<p>Or copy and paste this link into your browser:</p>
+		<p><a href="{{.Link}}">{{.Link}}</a></p>
+		<p class="footer">This link expires on {{.ExpiresAt}}.</p>
+	</div>
+</body>
+</html>
+`))
+
+// PaymentLinkEmail is the data rendered into a payment link email
+type PaymentLinkEmail struct {
+	Domain    string
+	Name      string
+	Items     []models.OrderItem
+	Discount  float64
+	Total     float64
+	Link      string
+	ExpiresAt string
+}
+
+// SendPaymentLink sends a draft order payment link to the customer
+func (s *EmailService) SendPaymentLink(to string, data PaymentLinkEmail) error {
+	var body bytes.Buffer
+	if err := paymentLinkTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	subject := fmt.Sprintf("Complete your order from %s", data.Domain)
+	return s.sendEmail(to, subject, body.String())
+}
+
+var subscriptionPaymentFailedTemplate = template.Must(template.New("subscription_payment_failed").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.footer { margin-top: 30px; font-size: 12px; color: #666; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<h2>We couldn't charge your subscription</h2>
+		<p>Hi {{.Name}}, the payment of ${{printf "%.2f" .Amount}} for your {{.ProductName}} delivery from {{.Domain}} didn't go through{{if .Reason}} ({{.Reason}}){{end}}.</p>
+		{{if .Cancelled}}
+		<p>We tried several times, so your subscription has been cancelled. You can subscribe again at any time.</p>
+		{{else}}
+		<p>We'll try again on {{.NextRetryAt}}. To avoid missing your delivery, update the card on your subscription before then.</p>
+		{{end}}
+		<p class="footer">You're receiving this email because you have a subscription with {{.Domain}}.</p>
+	</div>
+</body>
+</html>
+`))
+
+// SubscriptionPaymentFailedEmail is the data rendered into a dunning email
+type SubscriptionPaymentFailedEmail struct {
+	Domain      string
+	Name        string
+	ProductName string
+	Amount      float64
+	Reason      string
+	NextRetryAt string
+	Cancelled   bool // Last attempt failed, the subscription was cancelled
+}
+
+// SendSubscriptionPaymentFailed tells a subscriber a renewal charge failed
+func (s *EmailService) SendSubscriptionPaymentFailed(to string, data SubscriptionPaymentFailedEmail) error {
+	var body bytes.Buffer
+	if err := subscriptionPaymentFailedTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	subject := fmt.Sprintf("Payment failed for your %s subscription", data.Domain)
+	if data.Cancelled {
+		subject = fmt.Sprintf("Your %s subscription was cancelled", data.Domain)
+	}
+	return s.sendEmail(to, subject, body.String())
+}
+
+var giftCardTemplate = template.Must(template.New("gift_card").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.code { font-size: 24px; font-weight: bold; letter-spacing: 2px; padding: 12px; background: #f5f5f5; text-align: center; }
+		.message { font-style: italic; border-left: 3px solid #ccc; padding-left: 12px; }
+		.footer { margin-top: 30px; font-size: 12px; color: #666; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<h2>You've received a ${{printf "%.2f" .Amount}} gift card</h2>
+		<p>Hi{{if .RecipientName}} {{.RecipientName}}{{end}}, {{if .SenderName}}{{.SenderName}} sent you{{else}}here is{{end}} a gift card for {{.Domain}}.</p>
+		{{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+		<p class="code">{{.Code}}</p>
+		<p>Enter the code at checkout to pay with it. Whatever you don't spend stays on the card for next time.</p>
+		{{if .ExpiresAt}}<p class="footer">This gift card expires on {{.ExpiresAt}}.</p>{{end}}
+	</div>
+</body>
+</html>
+`))
+
+// GiftCardEmail is the data rendered into a gift card email
+type GiftCardEmail struct {
+	Domain        string
+	RecipientName string
+	SenderName    string
+	Message       string
+	Amount        float64
+	Code          string
+	ExpiresAt     string
+}
+
+// SendGiftCard sends a gift card code to its recipient
+func (s *EmailService) SendGiftCard(to string, data GiftCardEmail) error {
+	var body bytes.Buffer
+	if err := giftCardTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	subject := fmt.Sprintf("Your gift card for %s", data.Domain)
+	if data.SenderName != "" {
+		subject = fmt.Sprintf("%s sent you a gift card for %s", data.SenderName, data.Domain)
+	}
+	return s.sendEmail(to, subject, body.String())
+}
+
+// sendEmail sends an email using SMTP. Without an SMTP host (local
+// development) the email is logged instead.
+func (s *EmailService) sendEmail(to, subject, body string) error {
+	if s.settings.Host == "" {
+		log.Printf("📧 Email not sent (SMTP not configured) - to: %s, subject: %s", to, subject)
+		return nil
+	}
+
+	from := s.settings.FromAddress
+
+	// Setup email headers
+	msg := []byte(fmt.Sprintf("From: %s\r\n"+
+		"To: %s\r\n"+
+		"Subject: %s\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/html; charset=UTF-8\r\n"+
+		"\r\n"+
+		"%s\r\n", from, to, subject, body))
+
+	auth := smtp.PlainAuth("", s.settings.User, s.settings.Password, s.settings.Host)
+
+	addr := fmt.Sprintf("%s:%d", s.settings.Host, s.settings.Port)
+	if err := smtp.SendMail(addr, auth, from, []string{to}, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
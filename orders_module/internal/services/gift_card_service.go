@@ -0,0 +1,935 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrGiftCardNotFound is returned when a gift card doesn't exist for the domain
+var ErrGiftCardNotFound = errors.New("gift card not found")
+
+// ErrInvalidGiftCard is returned when a gift card can't be issued, changed or spent
+var ErrInvalidGiftCard = errors.New("invalid gift card")
+
+const (
+	// giftCardCodeAlphabet leaves out 0/O and 1/I so codes can be read out
+	giftCardCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// giftCardMaxCodes bounds how many gift cards one order can use
+	giftCardMaxCodes = 5
+	// giftCardMaxAttempts is how often a gift card email is tried before it's marked failed
+	giftCardMaxAttempts = 5
+	// giftCardRetryBase is the wait after the first failed email; it doubles
+	// with every attempt
+	giftCardRetryBase = 5 * time.Minute
+	// giftCardDeliveryLease is how long a claimed email is reserved for the
+	// worker sending it
+	giftCardDeliveryLease = 5 * time.Minute
+	// minCardCharge is the smallest amount Stripe charges. Gift cards that
+	// would leave less than this to pay cover a little less instead.
+	minCardCharge = 0.50
+)
+
+// GiftCardService issues gift cards when they're bought, emails the codes to
+// their recipients and keeps each card's balance and ledger as it is spent
+// on orders
+type GiftCardService struct {
+	db      *database.MongoDB
+	catalog *CatalogService
+	email   *EmailService // Only needed by the delivery worker
+}
+
+func NewGiftCardService(db *database.MongoDB, email *EmailService) *GiftCardService {
+	return &GiftCardService{
+		db:      db,
+		catalog: NewCatalogService(db),
+		email:   email,
+	}
+}
+
+// CreateGiftCard issues a gift card without an order, e.g. as a goodwill
+// gesture. With a recipient email the code is emailed to them.
+func (s *GiftCardService) CreateGiftCard(ctx context.Context, req *models.CreateGiftCardRequest, domain, createdBy string) (*models.GiftCard, error) {
+	amount := roundCents(req.Amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidGiftCard)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidGiftCard)
+	}
+
+	recipient := &models.GiftCardRecipient{
+		Email:     req.RecipientEmail,
+		Name:      req.RecipientName,
+		Sender:    req.SenderName,
+		Message:   req.Message,
+		DeliverAt: req.DeliverAt,
+	}
+	if err := ValidateGiftCardRecipient(recipient); err != nil {
+		return nil, err
+	}
+
+	card := &models.GiftCard{
+		Domain:         domain,
+		InitialBalance: amount,
+		Balance:        amount,
+		ExpiresAt:      req.ExpiresAt,
+		Note:           req.Note,
+		CreatedBy:      createdBy,
+	}
+	if recipient.Email != "" {
+		setGiftCardRecipient(card, recipient, time.Now())
+	}
+
+	if err := s.issue(ctx, card, "Issued by admin"); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// IssueForOrder issues one gift card per unit of the paid order's gift card
+// lines, worth the variant's denomination in the catalog (never the price on
+// the order line). Cards already issued for the order are skipped, so it is
+// safe to call again.
+func (s *GiftCardService) IssueForOrder(ctx context.Context, order *models.Order) error {
+	issued, err := s.orderSources(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var failed []string
+	count := 0
+	for i, item := range order.Items {
+		if item.ProductType != models.ProductTypeGiftCard {
+			continue
+		}
+
+		recipient := models.GiftCardRecipient{}
+		if item.GiftCard != nil {
+			recipient = *item.GiftCard
+		}
+		if recipient.Email == "" {
+			recipient.Email = order.Customer.Email
+		}
+		if recipient.Sender == "" && recipient.Email != order.Customer.Email {
+			recipient.Sender = order.Customer.Name
+		}
+
+		amount := 0.0
+		for unit := 0; unit < item.Quantity; unit++ {
+			source := fmt.Sprintf("%s:%d:%d", order.ID.Hex(), i, unit)
+			if issued[source] {
+				continue
+			}
+			if amount == 0 {
+				if amount, err = s.denomination(ctx, order.Domain, &item); err != nil {
+					failed = append(failed, fmt.Sprintf("%s: %v", item.ProductName, err))
+					break
+				}
+			}
+
+			card := &models.GiftCard{
+				Domain:         order.Domain,
+				InitialBalance: amount,
+				Balance:        amount,
+				OrderID:        order.ID.Hex(),
+				OrderNumber:    order.OrderNumber,
+				Source:         source,
+				PurchaserEmail: order.Customer.Email,
+				CreatedBy:      "system",
+			}
+			setGiftCardRecipient(card, &recipient, now)
+
+			// Keep going so one failure doesn't hold back the other cards
+			if err := s.issue(ctx, card, fmt.Sprintf("Bought in order %s", order.OrderNumber)); err != nil {
+				failed = append(failed, fmt.Sprintf("%s #%d: %v", item.ProductName, unit+1, err))
+				continue
+			}
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Printf("🎁 Issued %d gift card(s) for order %s", count, order.OrderNumber)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d gift card(s) failed: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// denomination returns the balance a gift card line's cards are issued with
+func (s *GiftCardService) denomination(ctx context.Context, domain string, item *models.OrderItem) (float64, error) {
+	product, err := s.catalog.GetProduct(ctx, item.ProductID, domain)
+	if err != nil {
+		return 0, err
+	}
+	return giftCardDenomination(product, item.VariantID)
+}
+
+// giftCardDenomination returns the variant's price, or the product's base
+// price when the variant has none
+func giftCardDenomination(product *models.CatalogProduct, variantID string) (float64, error) {
+	if product.Type != models.ProductTypeGiftCard {
+		return 0, fmt.Errorf("%w: %s is not a gift card", ErrInvalidGiftCard, product.Name)
+	}
+	variant := product.FindVariant(variantID)
+	if variant == nil {
+		return 0, fmt.Errorf("%w: variant %s of %s", ErrProductNotFound, variantID, product.Name)
+	}
+
+	amount := product.BasePrice
+	if variant.Price > 0 {
+		amount = variant.Price
+	}
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return 0, fmt.Errorf("%w: %s has no denomination", ErrInvalidGiftCard, product.Name)
+	}
+	return amount, nil
+}
+
+// Apply spends gift card balances on an order, in the order the codes were
+// given, until amountDue is covered. The order ID must already be set. Each
+// card is debited atomically; if one fails the others are given back.
+func (s *GiftCardService) Apply(ctx context.Context, order *models.Order, codes []string, amountDue float64) error {
+	if amountDue <= 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var cards []*models.GiftCard
+	for _, code := range codes {
+		code = normalizeGiftCardCode(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		if len(seen) > giftCardMaxCodes {
+			return fmt.Errorf("%w: at most %d gift cards per order", ErrInvalidGiftCard, giftCardMaxCodes)
+		}
+
+		card, err := s.getByCode(ctx, order.Domain, code)
+		if err != nil {
+			return err
+		}
+		if err := checkGiftCardUsable(card); err != nil {
+			return err
+		}
+		cards = append(cards, card)
+	}
+
+	amounts := planGiftCardAmounts(cards, amountDue)
+	order.GiftCardPayments = nil
+	for i, card := range cards {
+		if amounts[i] <= 0 {
+			continue
+		}
+		if err := s.debit(ctx, card, amounts[i], order); err != nil {
+			if refundErr := s.RestoreRedemptions(ctx, order, "system"); refundErr != nil {
+				log.Printf("ERROR: Failed to give back gift card balances for order %s: %v", order.ID.Hex(), refundErr)
+			}
+			order.GiftCardPayments = nil
+			return err
+		}
+		order.GiftCardPayments = append(order.GiftCardPayments, models.GiftCardPayment{
+			GiftCardID: card.ID.Hex(),
+			Last4:      card.Last4,
+			Amount:     amounts[i],
+		})
+	}
+
+	return nil
+}
+
+// ReverseOrder gives back the balances spent on a cancelled or refunded
+// order and voids the gift cards it bought
+func (s *GiftCardService) ReverseOrder(ctx context.Context, order *models.Order, actor string) error {
+	if err := s.RestoreRedemptions(ctx, order, actor); err != nil {
+		return err
+	}
+	return s.voidOrderCards(ctx, order, actor)
+}
+
+// RestoreRedemptions credits back what the order spent of each gift card.
+// Only the part not already given back is credited, so it is safe to call
+// again.
+func (s *GiftCardService) RestoreRedemptions(ctx context.Context, order *models.Order, actor string) error {
+	cursor, err := s.db.GetCollection("gift_card_transactions").Find(ctx, bson.M{
+		"domain":   order.Domain,
+		"order_id": order.ID.Hex(),
+		"type":     bson.M{"$in": []string{models.GiftCardRedeem, models.GiftCardRefund}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list gift card transactions: %w", err)
+	}
+
+	var txs []models.GiftCardTransaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return fmt.Errorf("failed to decode gift card transactions: %w", err)
+	}
+
+	cardIDs, spent := netGiftCardSpend(txs)
+
+	reason := "Order couldn't be placed"
+	if order.Status != "" {
+		reason = fmt.Sprintf("Order %s", order.Status)
+	}
+	for _, cardID := range cardIDs {
+		amount := roundCents(spent[cardID])
+		if amount <= 0 {
+			continue
+		}
+		objectID, err := primitive.ObjectIDFromHex(cardID)
+		if err != nil {
+			continue
+		}
+		balance, err := s.addBalance(ctx, bson.M{"_id": objectID}, amount)
+		if err != nil {
+			return err
+		}
+		if err := s.record(ctx, &models.GiftCardTransaction{
+			Domain:       order.Domain,
+			GiftCardID:   cardID,
+			Type:         models.GiftCardRefund,
+			Amount:       amount,
+			BalanceAfter: balance,
+			OrderID:      order.ID.Hex(),
+			OrderNumber:  order.OrderNumber,
+			Reason:       reason,
+			CreatedBy:    actor,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckBalance looks up a code for a customer. Only the last 4 characters
+// of the code are returned.
+func (s *GiftCardService) CheckBalance(ctx context.Context, domain, code string) (*models.GiftCardBalance, error) {
+	card, err := s.getByCode(ctx, domain, normalizeGiftCardCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	status := card.Status
+	if card.ExpiresAt != nil && card.ExpiresAt.Before(time.Now()) {
+		status = "expired"
+	}
+	return &models.GiftCardBalance{
+		Last4:     card.Last4,
+		Balance:   card.Balance,
+		Currency:  card.Currency,
+		Status:    status,
+		ExpiresAt: card.ExpiresAt,
+	}, nil
+}
+
+// GetGiftCard retrieves a gift card by ID
+func (s *GiftCardService) GetGiftCard(ctx context.Context, cardID, domain string) (*models.GiftCard, error) {
+	objectID, err := primitive.ObjectIDFromHex(cardID)
+	if err != nil {
+		return nil, ErrGiftCardNotFound
+	}
+
+	var card models.GiftCard
+	err = s.db.GetCollection("gift_cards").FindOne(ctx, bson.M{"_id": objectID, "domain": domain}).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gift card: %w", err)
+	}
+
+	return &card, nil
+}
+
+// ListGiftCards lists a domain's gift cards, newest first. A code, its last
+// 4 characters or an order number narrows the list down.
+func (s *GiftCardService) ListGiftCards(ctx context.Context, domain, status, query string, limit int64) ([]models.GiftCard, error) {
+	filter := bson.M{"domain": domain}
+	if status != "" {
+		filter["status"] = status
+	}
+	if query != "" {
+		code := normalizeGiftCardCode(query)
+		filter["$or"] = bson.A{
+			bson.M{"code": code},
+			bson.M{"last4": strings.ToUpper(query)},
+			bson.M{"order_number": query},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("gift_cards").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gift cards: %w", err)
+	}
+
+	cards := []models.GiftCard{}
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, fmt.Errorf("failed to decode gift cards: %w", err)
+	}
+
+	return cards, nil
+}
+
+// ListTransactions returns a gift card's ledger, newest first
+func (s *GiftCardService) ListTransactions(ctx context.Context, cardID, domain string) ([]models.GiftCardTransaction, error) {
+	if _, err := s.GetGiftCard(ctx, cardID, domain); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := s.db.GetCollection("gift_card_transactions").Find(ctx, bson.M{"domain": domain, "gift_card_id": cardID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gift card transactions: %w", err)
+	}
+
+	txs := []models.GiftCardTransaction{}
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode gift card transactions: %w", err)
+	}
+
+	return txs, nil
+}
+
+// UpdateGiftCard disables or re-enables a card, changes its expiry or
+// corrects its balance. Balance corrections are recorded in the ledger.
+func (s *GiftCardService) UpdateGiftCard(ctx context.Context, cardID string, req *models.UpdateGiftCardRequest, domain, actor string) (*models.GiftCard, error) {
+	card, err := s.GetGiftCard(ctx, cardID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Status != nil {
+		if *req.Status != models.GiftCardActive && *req.Status != models.GiftCardDisabled {
+			return nil, fmt.Errorf("%w: status must be active or disabled", ErrInvalidGiftCard)
+		}
+		set["status"] = *req.Status
+	}
+	if req.ExpiresAt != nil {
+		set["expires_at"] = req.ExpiresAt
+	}
+	if _, err := s.db.GetCollection("gift_cards").UpdateOne(ctx, bson.M{"_id": card.ID}, bson.M{"$set": set}); err != nil {
+		return nil, fmt.Errorf("failed to update gift card: %w", err)
+	}
+
+	if req.BalanceChange != nil {
+		change := roundCents(*req.BalanceChange)
+		if change == 0 {
+			return nil, fmt.Errorf("%w: balance_change can't be 0", ErrInvalidGiftCard)
+		}
+
+		// Deductions can't take the balance below zero
+		filter := bson.M{"_id": card.ID}
+		if change < 0 {
+			filter["balance"] = bson.M{"$gte": -change}
+		}
+		balance, err := s.addBalance(ctx, filter, change)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: the balance is only %.2f", ErrInvalidGiftCard, card.Balance)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.record(ctx, &models.GiftCardTransaction{
+			Domain:       domain,
+			GiftCardID:   card.ID.Hex(),
+			Type:         models.GiftCardAdjust,
+			Amount:       change,
+			BalanceAfter: balance,
+			Reason:       req.Reason,
+			CreatedBy:    actor,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetGiftCard(ctx, cardID, domain)
+}
+
+// ResendGiftCard emails the code to the recipient again, optionally to a
+// corrected address
+func (s *GiftCardService) ResendGiftCard(ctx context.Context, cardID, recipientEmail, domain string) (*models.GiftCard, error) {
+	card, err := s.GetGiftCard(ctx, cardID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipientEmail == "" {
+		recipientEmail = card.RecipientEmail
+	}
+	if recipientEmail == "" {
+		return nil, fmt.Errorf("%w: the gift card has no recipient email", ErrInvalidGiftCard)
+	}
+	if err := ValidateGiftCardRecipient(&models.GiftCardRecipient{Email: recipientEmail}); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = s.db.GetCollection("gift_cards").UpdateOne(ctx, bson.M{"_id": card.ID}, bson.M{
+		"$set": bson.M{
+			"recipient_email":   recipientEmail,
+			"delivery_status":   models.GiftCardDeliveryPending,
+			"deliver_at":        now,
+			"delivery_attempts": 0,
+			"delivery_error":    "",
+			"updated_at":        now,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update gift card: %w", err)
+	}
+
+	return s.GetGiftCard(ctx, cardID, domain)
+}
+
+// RunDeliveryWorker emails gift cards that are due every interval until ctx
+// is cancelled
+func (s *GiftCardService) RunDeliveryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deliverDue(ctx)
+		}
+	}
+}
+
+// deliverDue emails every gift card whose delivery is due
+func (s *GiftCardService) deliverDue(ctx context.Context) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(100)
+	cursor, err := s.db.GetCollection("gift_cards").Find(ctx, bson.M{
+		"delivery_status": models.GiftCardDeliveryPending,
+		"deliver_at":      bson.M{"$lte": time.Now()},
+	}, opts)
+	if err != nil {
+		log.Printf("ERROR: Failed to list due gift card emails: %v", err)
+		return
+	}
+
+	var due []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &due); err != nil {
+		log.Printf("ERROR: Failed to decode due gift card emails: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		s.deliver(ctx, d.ID)
+	}
+}
+
+// deliver claims a due gift card email, sends it and records the outcome.
+// Claiming moves deliver_at forward by the lease so two workers never send
+// the same email.
+func (s *GiftCardService) deliver(ctx context.Context, cardID primitive.ObjectID) {
+	collection := s.db.GetCollection("gift_cards")
+	now := time.Now()
+
+	var card models.GiftCard
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":             cardID,
+			"delivery_status": models.GiftCardDeliveryPending,
+			"deliver_at":      bson.M{"$lte": now},
+		},
+		bson.M{
+			"$set": bson.M{"deliver_at": now.Add(giftCardDeliveryLease)},
+			"$inc": bson.M{"delivery_attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return // Not due, or another worker has it
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to claim gift card email %s: %v", cardID.Hex(), err)
+		return
+	}
+
+	data := GiftCardEmail{
+		Domain:        card.Domain,
+		RecipientName: card.RecipientName,
+		SenderName:    card.SenderName,
+		Message:       card.Message,
+		Amount:        card.Balance,
+		Code:          card.Code,
+	}
+	if card.ExpiresAt != nil {
+		data.ExpiresAt = card.ExpiresAt.Format("January 2, 2006")
+	}
+	sendErr := s.email.SendGiftCard(card.RecipientEmail, data)
+
+	set := bson.M{"updated_at": time.Now()}
+	switch {
+	case sendErr == nil:
+		set["delivery_status"] = models.GiftCardDeliverySent
+		set["delivered_at"] = time.Now()
+		set["delivery_error"] = ""
+	case card.DeliveryAttempts >= giftCardMaxAttempts:
+		set["delivery_status"] = models.GiftCardDeliveryFailed
+		set["delivery_error"] = sendErr.Error()
+		log.Printf("⚠️  Gift card email to %s failed after %d attempts: %v", card.RecipientEmail, card.DeliveryAttempts, sendErr)
+	default:
+		set["delivery_error"] = sendErr.Error()
+		set["deliver_at"] = now.Add(giftCardRetryBase << (card.DeliveryAttempts - 1))
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": card.ID}, bson.M{"$set": set}); err != nil {
+		log.Printf("ERROR: Failed to record gift card email %s: %v", card.ID.Hex(), err)
+	}
+}
+
+// ValidateGiftCardRecipient checks the recipient details of a gift card
+func ValidateGiftCardRecipient(recipient *models.GiftCardRecipient) error {
+	if recipient == nil {
+		return nil
+	}
+
+	recipient.Email = strings.TrimSpace(recipient.Email)
+	if recipient.Email != "" {
+		if _, err := mail.ParseAddress(recipient.Email); err != nil || !strings.Contains(recipient.Email, "@") {
+			return fmt.Errorf("%w: invalid recipient email %q", ErrInvalidGiftCard, recipient.Email)
+		}
+	}
+	// Names end up in the email subject
+	for _, value := range []string{recipient.Email, recipient.Name, recipient.Sender} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: names can't contain line breaks", ErrInvalidGiftCard)
+		}
+	}
+	if len(recipient.Message) > 1000 {
+		return fmt.Errorf("%w: message is limited to 1000 characters", ErrInvalidGiftCard)
+	}
+
+	return nil
+}
+
+// issue generates a unique code for the card, saves it and records the
+// issue in the ledger
+func (s *GiftCardService) issue(ctx context.Context, card *models.GiftCard, reason string) error {
+	now := time.Now()
+	card.ID = primitive.NewObjectID()
+	card.Currency = "USD"
+	card.Status = models.GiftCardActive
+	card.CreatedAt = now
+	card.UpdatedAt = now
+
+	// {domain, code} is unique; retry the rare collision with a new code
+	collection := s.db.GetCollection("gift_cards")
+	for attempt := 1; ; attempt++ {
+		code, err := generateGiftCardCode()
+		if err != nil {
+			return err
+		}
+		card.Code = code
+		card.Last4 = code[len(code)-4:]
+
+		_, err = collection.InsertOne(ctx, card)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == 5 {
+			return fmt.Errorf("failed to insert gift card: %w", err)
+		}
+	}
+
+	return s.record(ctx, &models.GiftCardTransaction{
+		Domain:       card.Domain,
+		GiftCardID:   card.ID.Hex(),
+		Type:         models.GiftCardIssue,
+		Amount:       card.InitialBalance,
+		BalanceAfter: card.Balance,
+		OrderID:      card.OrderID,
+		OrderNumber:  card.OrderNumber,
+		Reason:       reason,
+		CreatedBy:    card.CreatedBy,
+	})
+}
+
+// debit takes amount off an active card that still has it and records the
+// redemption
+func (s *GiftCardService) debit(ctx context.Context, card *models.GiftCard, amount float64, order *models.Order) error {
+	balance, err := s.addBalance(ctx, bson.M{
+		"_id":     card.ID,
+		"status":  models.GiftCardActive,
+		"balance": bson.M{"$gte": amount},
+	}, -amount)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("%w: gift card ending %s no longer has %.2f", ErrInvalidGiftCard, card.Last4, amount)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.record(ctx, &models.GiftCardTransaction{
+		Domain:       order.Domain,
+		GiftCardID:   card.ID.Hex(),
+		Type:         models.GiftCardRedeem,
+		Amount:       -amount,
+		BalanceAfter: balance,
+		OrderID:      order.ID.Hex(),
+		OrderNumber:  order.OrderNumber,
+		CreatedBy:    order.Customer.UserID,
+	})
+}
+
+// voidOrderCards disables the cards an order bought and removes what is left
+// on them
+func (s *GiftCardService) voidOrderCards(ctx context.Context, order *models.Order, actor string) error {
+	cursor, err := s.db.GetCollection("gift_cards").Find(ctx, bson.M{
+		"domain":   order.Domain,
+		"order_id": order.ID.Hex(),
+		"status":   models.GiftCardActive,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list order gift cards: %w", err)
+	}
+
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		return fmt.Errorf("failed to decode order gift cards: %w", err)
+	}
+
+	collection := s.db.GetCollection("gift_cards")
+	reason := fmt.Sprintf("Order %s", order.Status)
+	for _, card := range cards {
+		// The document before the update holds the balance being voided
+		var voided models.GiftCard
+		err := collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": card.ID, "status": models.GiftCardActive},
+			bson.M{"$set": bson.M{
+				"status":     models.GiftCardDisabled,
+				"balance":    0.0,
+				"updated_at": time.Now(),
+			}},
+		).Decode(&voided)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to void gift card: %w", err)
+		}
+
+		// Don't email codes that no longer work
+		_, err = collection.UpdateOne(ctx,
+			bson.M{"_id": card.ID, "delivery_status": models.GiftCardDeliveryPending},
+			bson.M{"$set": bson.M{"delivery_status": models.GiftCardDeliveryFailed, "delivery_error": reason}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to cancel gift card email: %w", err)
+		}
+
+		if voided.Balance > 0 {
+			if err := s.record(ctx, &models.GiftCardTransaction{
+				Domain:      order.Domain,
+				GiftCardID:  card.ID.Hex(),
+				Type:        models.GiftCardVoid,
+				Amount:      -voided.Balance,
+				OrderID:     order.ID.Hex(),
+				OrderNumber: order.OrderNumber,
+				Reason:      reason,
+				CreatedBy:   actor,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// orderSources returns the sources of the cards already issued for an order
+func (s *GiftCardService) orderSources(ctx context.Context, order *models.Order) (map[string]bool, error) {
+	opts := options.Find().SetProjection(bson.M{"source": 1})
+	cursor, err := s.db.GetCollection("gift_cards").Find(ctx, bson.M{
+		"domain":   order.Domain,
+		"order_id": order.ID.Hex(),
+		"source":   bson.M{"$exists": true},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issued gift cards: %w", err)
+	}
+
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, fmt.Errorf("failed to decode issued gift cards: %w", err)
+	}
+
+	sources := make(map[string]bool, len(cards))
+	for _, card := range cards {
+		sources[card.Source] = true
+	}
+	return sources, nil
+}
+
+// getByCode finds a gift card by its (normalized) code
+func (s *GiftCardService) getByCode(ctx context.Context, domain, code string) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.db.GetCollection("gift_cards").FindOne(ctx, bson.M{"domain": domain, "code": code}).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gift card: %w", err)
+	}
+
+	return &card, nil
+}
+
+// addBalance adds amount to the balance of the card matching filter, rounded
+// to cents, and returns the new balance. It returns mongo.ErrNoDocuments when
+// no card matches.
+func (s *GiftCardService) addBalance(ctx context.Context, filter bson.M, amount float64) (float64, error) {
+	var card models.GiftCard
+	err := s.db.GetCollection("gift_cards").FindOneAndUpdate(ctx, filter,
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"balance":    bson.M{"$round": bson.A{bson.M{"$add": bson.A{"$balance", amount}}, 2}},
+				"updated_at": time.Now(),
+			}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update gift card balance: %w", err)
+	}
+
+	return card.Balance, nil
+}
+
+// record appends a transaction to the gift card ledger
+func (s *GiftCardService) record(ctx context.Context, tx *models.GiftCardTransaction) error {
+	tx.ID = primitive.NewObjectID()
+	tx.CreatedAt = time.Now()
+
+	if _, err := s.db.GetCollection("gift_card_transactions").InsertOne(ctx, tx); err != nil {
+		return fmt.Errorf("failed to record gift card transaction: %w", err)
+	}
+	return nil
+}
+
+// setGiftCardRecipient schedules the email of a card to its recipient
+func setGiftCardRecipient(card *models.GiftCard, recipient *models.GiftCardRecipient, now time.Time) {
+	card.RecipientEmail = recipient.Email
+	card.RecipientName = recipient.Name
+	card.SenderName = recipient.Sender
+	card.Message = recipient.Message
+	card.DeliveryStatus = models.GiftCardDeliveryPending
+	card.DeliverAt = &now
+	if recipient.DeliverAt != nil && recipient.DeliverAt.After(now) {
+		card.DeliverAt = recipient.DeliverAt
+	}
+}
+
+// checkGiftCardUsable checks a card can pay for an order
+func checkGiftCardUsable(card *models.GiftCard) error {
+	switch {
+	case card.Status != models.GiftCardActive:
+		return fmt.Errorf("%w: gift card ending %s is disabled", ErrInvalidGiftCard, card.Last4)
+	case card.ExpiresAt != nil && card.ExpiresAt.Before(time.Now()):
+		return fmt.Errorf("%w: gift card ending %s has expired", ErrInvalidGiftCard, card.Last4)
+	case card.Balance <= 0:
+		return fmt.Errorf("%w: gift card ending %s has no balance left", ErrInvalidGiftCard, card.Last4)
+	}
+	return nil
+}
+
+// planGiftCardAmounts works out how much each card pays towards amountDue,
+// in order, leaving at least Stripe's minimum charge if the cards don't
+// cover everything
+func planGiftCardAmounts(cards []*models.GiftCard, amountDue float64) []float64 {
+	amounts := make([]float64, len(cards))
+	remaining := roundCents(amountDue)
+	for i, card := range cards {
+		amounts[i] = min(card.Balance, remaining)
+		remaining = roundCents(remaining - amounts[i])
+	}
+	if remaining > 0 && remaining < minCardCharge {
+		short := roundCents(minCardCharge - remaining)
+		for i := len(amounts) - 1; i >= 0 && short > 0; i-- {
+			take := min(amounts[i], short)
+			amounts[i] = roundCents(amounts[i] - take)
+			short = roundCents(short - take)
+		}
+	}
+	return amounts
+}
+
+// netGiftCardSpend returns what an order's redemptions and refunds leave
+// spent per card (redemptions are negative), with the card IDs in the order
+// they were first used
+func netGiftCardSpend(txs []models.GiftCardTransaction) ([]string, map[string]float64) {
+	spent := make(map[string]float64)
+	var cardIDs []string
+	for _, tx := range txs {
+		if _, ok := spent[tx.GiftCardID]; !ok {
+			cardIDs = append(cardIDs, tx.GiftCardID)
+		}
+		spent[tx.GiftCardID] -= tx.Amount
+	}
+	return cardIDs, spent
+}
+
+// giftCardTotal returns how much of an order gift cards pay
+func giftCardTotal(payments []models.GiftCardPayment) float64 {
+	var total float64
+	for _, p := range payments {
+		total += p.Amount
+	}
+	return roundCents(total)
+}
+
+// generateGiftCardCode returns a random XXXX-XXXX-XXXX-XXXX code
+func generateGiftCardCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate gift card code: %w", err)
+	}
+
+	var code strings.Builder
+	for i, v := range b {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		// 256 is a multiple of the 32-letter alphabet, so this isn't biased
+		code.WriteByte(giftCardCodeAlphabet[int(v)%len(giftCardCodeAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// normalizeGiftCardCode uppercases a code typed by a customer and puts the
+// dashes back where they belong
+func normalizeGiftCardCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
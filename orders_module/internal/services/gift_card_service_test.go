@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGiftCardDenomination(t *testing.T) {
+	giftCard := func(basePrice float64, variants ...models.CatalogVariant) *models.CatalogProduct {
+		return &models.CatalogProduct{Name: "Gift card", Type: models.ProductTypeGiftCard, BasePrice: basePrice, Variants: variants}
+	}
+
+	tests := []struct {
+		name      string
+		product   *models.CatalogProduct
+		variantID string
+		want      float64
+		wantErr   error
+	}{
+		{"variant price", giftCard(10, models.CatalogVariant{ID: "25", Price: 25}), "25", 25, nil},
+		{"base price when the variant has none", giftCard(10, models.CatalogVariant{ID: "base"}), "base", 10, nil},
+		{"rounded to cents", giftCard(0, models.CatalogVariant{ID: "odd", Price: 12.345678}), "odd", 12.35, nil},
+		{"discount ignored", &models.CatalogProduct{
+			Type: models.ProductTypeGiftCard, BasePrice: 50,
+			Discount: &models.CatalogDiscount{Active: true, Type: "percentage", Value: 50},
+			Variants: []models.CatalogVariant{{ID: "50"}},
+		}, "50", 50, nil},
+		{"not a gift card", &models.CatalogProduct{Name: "Mug", Type: models.ProductTypePhysical, BasePrice: 10,
+			Variants: []models.CatalogVariant{{ID: "v1"}}}, "v1", 0, ErrInvalidGiftCard},
+		{"unknown variant", giftCard(10, models.CatalogVariant{ID: "25", Price: 25}), "100", 0, ErrProductNotFound},
+		{"no denomination", giftCard(0, models.CatalogVariant{ID: "free"}), "free", 0, ErrInvalidGiftCard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := giftCardDenomination(tt.product, tt.variantID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("giftCardDenomination() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("giftCardDenomination() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanGiftCardAmounts(t *testing.T) {
+	cards := func(balances ...float64) []*models.GiftCard {
+		out := make([]*models.GiftCard, len(balances))
+		for i, b := range balances {
+			out[i] = &models.GiftCard{Balance: b}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		cards     []*models.GiftCard
+		amountDue float64
+		want      []float64
+	}{
+		{"one card covers it", cards(100), 40, []float64{40}},
+		{"cards used in order", cards(25, 25, 25), 60, []float64{25, 25, 10}},
+		{"exact balance", cards(30, 20), 50, []float64{30, 20}},
+		{"cards don't cover it", cards(10, 5), 40, []float64{10, 5}},
+		{"leaves the minimum charge", cards(39.8), 40, []float64{39.5}},
+		{"minimum taken from the last cards first", cards(30, 0.2), 30.4, []float64{29.9, 0}},
+		{"amount due rounded", cards(100), 19.999, []float64{20}},
+		{"no cards", cards(), 40, []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planGiftCardAmounts(tt.cards, tt.amountDue); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planGiftCardAmounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetGiftCardSpend(t *testing.T) {
+	redeem := func(cardID string, amount float64) models.GiftCardTransaction {
+		return models.GiftCardTransaction{GiftCardID: cardID, Type: models.GiftCardRedeem, Amount: -amount}
+	}
+	refund := func(cardID string, amount float64) models.GiftCardTransaction {
+		return models.GiftCardTransaction{GiftCardID: cardID, Type: models.GiftCardRefund, Amount: amount}
+	}
+
+	tests := []struct {
+		name      string
+		txs       []models.GiftCardTransaction
+		wantCards []string
+		wantSpent map[string]float64
+	}{
+		{"nothing spent", nil, nil, map[string]float64{}},
+		{"redemptions", []models.GiftCardTransaction{redeem("a", 20), redeem("b", 5)},
+			[]string{"a", "b"}, map[string]float64{"a": 20, "b": 5}},
+		{"partly given back", []models.GiftCardTransaction{redeem("a", 20), refund("a", 8)},
+			[]string{"a"}, map[string]float64{"a": 12}},
+		{"already given back", []models.GiftCardTransaction{redeem("a", 20), refund("a", 20), redeem("b", 5)},
+			[]string{"a", "b"}, map[string]float64{"a": 0, "b": 5}},
+		{"first use order kept", []models.GiftCardTransaction{redeem("b", 5), redeem("a", 20), refund("b", 5)},
+			[]string{"b", "a"}, map[string]float64{"a": 20, "b": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cardIDs, spent := netGiftCardSpend(tt.txs)
+			if !reflect.DeepEqual(cardIDs, tt.wantCards) {
+				t.Errorf("netGiftCardSpend() cards = %v, want %v", cardIDs, tt.wantCards)
+			}
+			if !reflect.DeepEqual(spent, tt.wantSpent) {
+				t.Errorf("netGiftCardSpend() spent = %v, want %v", spent, tt.wantSpent)
+			}
+		})
+	}
+}
+
+func TestGiftCardTotal(t *testing.T) {
+	tests := []struct {
+		name     string
+		payments []models.GiftCardPayment
+		want     float64
+	}{
+		{"none", nil, 0},
+		{"one", []models.GiftCardPayment{{Amount: 12.5}}, 12.5},
+		{"rounded to cents", []models.GiftCardPayment{{Amount: 0.1}, {Amount: 0.2}}, 0.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := giftCardTotal(tt.payments); got != tt.want {
+				t.Errorf("giftCardTotal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGiftCardReverseOrder(t *testing.T) {
+	db := testMongoDB(t)
+	ctx := context.Background()
+	s := NewGiftCardService(db, nil)
+
+	card := &models.GiftCard{Domain: testDomain, InitialBalance: 50, Balance: 50, CreatedBy: "admin"}
+	if err := s.issue(ctx, card, "Test card"); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	giftCardID := insertTestProduct(t, db, models.CatalogProduct{
+		Name: "Gift card", Type: models.ProductTypeGiftCard,
+		Variants: []models.CatalogVariant{{ID: "20", Price: 20}},
+	})
+	order := insertTestOrder(t, db, models.OrderItem{ProductID: giftCardID, ProductName: "Gift card", VariantID: "20",
+		Quantity: 2, UnitPrice: 20, Total: 40, ProductType: models.ProductTypeGiftCard})
+
+	if err := s.Apply(ctx, order, []string{card.Code}, 40); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := giftCardTotal(order.GiftCardPayments); got != 40 {
+		t.Fatalf("gift cards pay %v, want 40", got)
+	}
+
+	// Issuing twice gives one card per unit
+	for i := 0; i < 2; i++ {
+		if err := s.IssueForOrder(ctx, order); err != nil {
+			t.Fatalf("IssueForOrder() error = %v", err)
+		}
+	}
+	bought, err := db.GetCollection("gift_cards").CountDocuments(ctx, bson.M{"order_id": order.ID.Hex()})
+	if err != nil {
+		t.Fatalf("count issued cards: %v", err)
+	}
+	if bought != 2 {
+		t.Fatalf("issued %d cards, want 2", bought)
+	}
+
+	// Reversing twice gives the balance back once and voids the bought cards
+	order.Status = "cancelled"
+	for i := 0; i < 2; i++ {
+		if err := s.ReverseOrder(ctx, order, "admin"); err != nil {
+			t.Fatalf("ReverseOrder() error = %v", err)
+		}
+	}
+
+	restored, err := s.GetGiftCard(ctx, card.ID.Hex(), testDomain)
+	if err != nil {
+		t.Fatalf("get card: %v", err)
+	}
+	if restored.Balance != 50 {
+		t.Errorf("balance = %v, want 50", restored.Balance)
+	}
+
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   int64
+	}{
+		{"refunds", bson.M{"gift_card_id": card.ID.Hex(), "type": models.GiftCardRefund}, 1},
+		{"voids", bson.M{"order_id": order.ID.Hex(), "type": models.GiftCardVoid}, 2},
+	}
+	for _, tt := range tests {
+		got, err := db.GetCollection("gift_card_transactions").CountDocuments(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("count %s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	active, err := db.GetCollection("gift_cards").CountDocuments(ctx, bson.M{"order_id": order.ID.Hex(), "status": models.GiftCardActive})
+	if err != nil {
+		t.Fatalf("count active cards: %v", err)
+	}
+	if active != 0 {
+		t.Errorf("%d bought cards still active, want 0", active)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InvitationDiscountService applies the discount of the promotional
+// invitation a customer signed up with (auth_module invitation metadata) to
+// their first orders, and attributes their orders to the invitation
+type InvitationDiscountService struct {
+	db      *database.MongoDB
+	catalog *CatalogService
+}
+
+func NewInvitationDiscountService(db *database.MongoDB) *InvitationDiscountService {
+	return &InvitationDiscountService{
+		db:      db,
+		catalog: NewCatalogService(db),
+	}
+}
+
+// GetClaim returns the latest promotional invitation a user accepted on the
+// domain, nil when they didn't sign up with one
+func (s *InvitationDiscountService) GetClaim(ctx context.Context, domain, userID string) (*models.InvitationClaim, error) {
+	filter := bson.M{
+		"domain":     domain,
+		"claimed_by": userID,
+		"$or": bson.A{
+			bson.M{"promo_code": bson.M{"$nin": bson.A{nil, ""}}},
+			bson.M{"source": bson.M{"$nin": bson.A{nil, ""}}},
+			bson.M{"ref": bson.M{"$nin": bson.A{nil, ""}}},
+			bson.M{"discount_percent": bson.M{"$gt": 0}},
+		},
+	}
+	opts := options.FindOne().SetSort(bson.M{"claimed_at": -1})
+
+	var claim models.InvitationClaim
+	err := s.db.GetAuthCollection("invitation_logs").FindOne(ctx, filter, opts).Decode(&claim)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation claim: %w", err)
+	}
+
+	return &claim, nil
+}
+
+// Quote works out the invitation discount for a cart: the invitation's
+// percentage off the catalog items (gift cards and custom items excluded).
+// It is 0 when the invitation has no discount or it was used up.
+func (s *InvitationDiscountService) Quote(ctx context.Context, claim *models.InvitationClaim, items []models.OrderItem) (float64, error) {
+	if claim.DiscountPercent <= 0 {
+		return 0, nil
+	}
+
+	var used int
+	var discount models.InvitationDiscount
+	err := s.db.GetCollection("invitation_discounts").FindOne(ctx, invitationDiscountFilter(claim)).Decode(&discount)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("failed to get invitation discount: %w", err)
+	}
+	if err == nil {
+		used = len(discount.OrderIDs)
+	}
+	if used >= max(claim.DiscountOrders, 1) {
+		return 0, nil
+	}
+
+	var eligible float64
+	products := make(map[string]*models.CatalogProduct)
+	for _, item := range items {
+		if item.Custom {
+			continue
+		}
+		product, ok := products[item.ProductID]
+		if !ok {
+			product, _ = s.catalog.GetProduct(ctx, item.ProductID, claim.Domain)
+			products[item.ProductID] = product
+		}
+		if product != nil && product.Type != models.ProductTypeGiftCard {
+			eligible += roundCents(item.UnitPrice * float64(item.Quantity))
+		}
+	}
+
+	return roundCents(eligible * min(claim.DiscountPercent, 100) / 100), nil
+}
+
+// Redeem counts an order against the invitation's number of discounted
+// orders. It returns false when the last one was taken in the meantime.
+func (s *InvitationDiscountService) Redeem(ctx context.Context, order *models.Order, claim *models.InvitationClaim) (bool, error) {
+	collection := s.db.GetCollection("invitation_discounts")
+	filter := invitationDiscountFilter(claim)
+	now := time.Now()
+
+	_, err := collection.UpdateOne(ctx, filter, bson.M{
+		"$setOnInsert": bson.M{
+			"promo_code":       claim.PromoCode,
+			"discount_percent": claim.DiscountPercent,
+			"max_orders":       max(claim.DiscountOrders, 1),
+			"order_ids":        bson.A{},
+			"created_at":       now,
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return false, fmt.Errorf("failed to redeem invitation discount: %w", err)
+	}
+
+	// The array has fewer than max_orders entries while its last slot is free
+	filter[fmt.Sprintf("order_ids.%d", max(claim.DiscountOrders, 1)-1)] = bson.M{"$exists": false}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{
+		"$push": bson.M{"order_ids": order.ID.Hex()},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem invitation discount: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// Release gives back the discounted order of an order that was cancelled,
+// refunded or couldn't be placed. Safe to call again.
+func (s *InvitationDiscountService) Release(ctx context.Context, order *models.Order) error {
+	_, err := s.db.GetCollection("invitation_discounts").UpdateOne(ctx,
+		bson.M{"domain": order.Domain, "order_ids": order.ID.Hex()},
+		bson.M{
+			"$pull": bson.M{"order_ids": order.ID.Hex()},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release invitation discount: %w", err)
+	}
+	return nil
+}
+
+// invitationDiscountFilter selects the discount counter of a user's invitation
+func invitationDiscountFilter(claim *models.InvitationClaim) bson.M {
+	return bson.M{
+		"domain":        claim.Domain,
+		"user_id":       claim.ClaimedBy,
+		"invitation_id": claim.InvitationID.Hex(),
+	}
+}
+
+// hasInvitationDiscount reports whether an order got an invitation discount
+func hasInvitationDiscount(order *models.Order) bool {
+	for _, discount := range order.Discounts {
+		if discount.Type == "invitation" {
+			return true
+		}
+	}
+	return false
+}
+
+// invitationAttribution is what an order records about the customer's invitation
+func invitationAttribution(claim *models.InvitationClaim) *models.OrderAttribution {
+	return &models.OrderAttribution{
+		InvitationID: claim.InvitationID.Hex(),
+		PromoCode:    claim.PromoCode,
+		Source:       claim.Source,
+		Ref:          claim.Ref,
+	}
+}
@@ -0,0 +1,663 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidLoyaltySettings is returned when loyalty settings or a bonus are rejected
+var ErrInvalidLoyaltySettings = errors.New("invalid loyalty settings")
+
+// ErrInvalidRedemption is returned when points can't be spent on an order
+var ErrInvalidRedemption = errors.New("invalid points redemption")
+
+// ErrLoyaltyBonusExists is returned when a review or referral was already rewarded
+var ErrLoyaltyBonusExists = errors.New("bonus already awarded")
+
+// LoyaltyService keeps each customer's points balance and the points ledger:
+// points are earned on paid orders and bonuses, spent as order discounts,
+// and reversed when orders are refunded
+type LoyaltyService struct {
+	db *database.MongoDB
+}
+
+func NewLoyaltyService(db *database.MongoDB) *LoyaltyService {
+	return &LoyaltyService{db: db}
+}
+
+// GetSettings returns a domain's loyalty rules, or the defaults (disabled)
+func (s *LoyaltyService) GetSettings(ctx context.Context, domain string) (*models.LoyaltySettings, error) {
+	var settings models.LoyaltySettings
+	err := s.db.GetCollection("loyalty_settings").FindOne(ctx, bson.M{"_id": domain}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultLoyaltySettings(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loyalty settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings validates and saves a domain's loyalty rules
+func (s *LoyaltyService) UpdateSettings(ctx context.Context, req *models.UpdateLoyaltySettingsRequest, domain, updatedBy string) (*models.LoyaltySettings, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.PointsPerDollar != nil {
+		settings.PointsPerDollar = *req.PointsPerDollar
+	}
+	if req.ExpiryDays != nil {
+		settings.ExpiryDays = *req.ExpiryDays
+	}
+	if req.ReviewBonus != nil {
+		settings.ReviewBonus = *req.ReviewBonus
+	}
+	if req.ReferralBonus != nil {
+		settings.ReferralBonus = *req.ReferralBonus
+	}
+	if req.PointValue != nil {
+		settings.PointValue = *req.PointValue
+	}
+	if req.MinRedeemPoints != nil {
+		settings.MinRedeemPoints = *req.MinRedeemPoints
+	}
+	if req.MaxRedeemPercent != nil {
+		settings.MaxRedeemPercent = *req.MaxRedeemPercent
+	}
+
+	var problems []string
+	if settings.PointsPerDollar < 0 {
+		problems = append(problems, "points_per_dollar can't be negative")
+	}
+	if settings.ExpiryDays < 0 {
+		problems = append(problems, "expiry_days can't be negative")
+	}
+	if settings.ReviewBonus < 0 || settings.ReferralBonus < 0 {
+		problems = append(problems, "bonuses can't be negative")
+	}
+	if settings.PointValue <= 0 {
+		problems = append(problems, "point_value must be positive")
+	}
+	if settings.MinRedeemPoints < 1 {
+		problems = append(problems, "min_redeem_points must be at least 1")
+	}
+	if settings.MaxRedeemPercent <= 0 || settings.MaxRedeemPercent > 100 {
+		problems = append(problems, "max_redeem_percent must be between 0 and 100")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidLoyaltySettings, strings.Join(problems, "; "))
+	}
+
+	settings.UpdatedBy = updatedBy
+	settings.UpdatedAt = time.Now()
+
+	_, err = s.db.GetCollection("loyalty_settings").ReplaceOne(ctx, bson.M{"_id": domain}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save loyalty settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// GetBalance returns a customer's points, their value and recent ledger entries
+func (s *LoyaltyService) GetBalance(ctx context.Context, domain, userID string) (*models.LoyaltyBalance, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	s.expire(ctx, domain, userID)
+
+	points, err := s.points(ctx, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &models.LoyaltyBalance{
+		Points:     points,
+		Value:      roundCents(float64(max(points, 0)) * settings.PointValue),
+		PointValue: settings.PointValue,
+		MinRedeem:  settings.MinRedeemPoints,
+	}
+
+	lots, err := s.openLots(ctx, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, lot := range lots {
+		if lot.ExpiresAt == nil {
+			continue
+		}
+		if balance.NextExpiry == nil {
+			balance.NextExpiry = lot.ExpiresAt
+		}
+		if lot.ExpiresAt.Equal(*balance.NextExpiry) {
+			balance.Expiring += lot.Remaining
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(50)
+	cursor, err := s.db.GetCollection("loyalty_transactions").Find(ctx, bson.M{"domain": domain, "user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loyalty transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	balance.Transactions = []models.LoyaltyTransaction{}
+	if err := cursor.All(ctx, &balance.Transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode loyalty transactions: %w", err)
+	}
+
+	return balance, nil
+}
+
+// Quote checks that a customer can spend points on an order with the given
+// subtotal and returns the discount they're worth
+func (s *LoyaltyService) Quote(ctx context.Context, domain, userID string, points int, subtotal float64) (float64, error) {
+	if userID == "" {
+		return 0, fmt.Errorf("%w: log in to use loyalty points", ErrInvalidRedemption)
+	}
+
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+	if !settings.Enabled {
+		return 0, fmt.Errorf("%w: this store has no loyalty program", ErrInvalidRedemption)
+	}
+	if points < settings.MinRedeemPoints {
+		return 0, fmt.Errorf("%w: redeem at least %d points", ErrInvalidRedemption, settings.MinRedeemPoints)
+	}
+
+	maxDiscount := subtotal * settings.MaxRedeemPercent / 100
+	if maxPoints := int(math.Floor(maxDiscount / settings.PointValue)); points > maxPoints {
+		return 0, fmt.Errorf("%w: at most %d points can be used on this order", ErrInvalidRedemption, maxPoints)
+	}
+
+	s.expire(ctx, domain, userID)
+	balance, err := s.points(ctx, domain, userID)
+	if err != nil {
+		return 0, err
+	}
+	if points > balance {
+		return 0, fmt.Errorf("%w: only %d points available", ErrInvalidRedemption, max(balance, 0))
+	}
+
+	return roundCents(float64(points) * settings.PointValue), nil
+}
+
+// Redeem spends points on an order. The order's ID must already be set. The
+// balance is checked again atomically, so two checkouts can't spend the same
+// points.
+func (s *LoyaltyService) Redeem(ctx context.Context, order *models.Order, points int, discount float64) error {
+	userID := order.Customer.UserID
+
+	result, err := s.db.GetCollection("loyalty_accounts").UpdateOne(ctx,
+		bson.M{"domain": order.Domain, "user_id": userID, "points": bson.M{"$gte": points}},
+		bson.M{
+			"$inc": bson.M{"points": -points},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to redeem points: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: not enough points", ErrInvalidRedemption)
+	}
+
+	s.consumeLots(ctx, order.Domain, userID, points)
+
+	tx := &models.LoyaltyTransaction{
+		Domain:      order.Domain,
+		UserID:      userID,
+		Type:        models.LoyaltyRedeem,
+		Points:      -points,
+		OrderID:     order.ID.Hex(),
+		OrderNumber: order.OrderNumber,
+		Amount:      discount,
+		CreatedBy:   userID,
+	}
+	return s.insert(ctx, tx)
+}
+
+// EarnForOrder credits points for a paid order. Orders are only rewarded
+// once (the ledger's unique earn index settles concurrent calls), and guest
+// orders earn nothing.
+func (s *LoyaltyService) EarnForOrder(ctx context.Context, order *models.Order) error {
+	if order.Customer.UserID == "" {
+		return nil
+	}
+
+	settings, err := s.GetSettings(ctx, order.Domain)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	points := int(math.Floor(order.Total * settings.PointsPerDollar))
+	if points <= 0 {
+		return nil
+	}
+
+	existing, err := s.orderTransactions(ctx, order, models.LoyaltyEarn)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	tx := &models.LoyaltyTransaction{
+		Domain:      order.Domain,
+		UserID:      order.Customer.UserID,
+		Type:        models.LoyaltyEarn,
+		Points:      points,
+		OrderID:     order.ID.Hex(),
+		OrderNumber: order.OrderNumber,
+		Amount:      order.Total,
+		CreatedBy:   "system",
+	}
+	if err := s.credit(ctx, tx, settings); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+		"$set": bson.M{"loyalty_points_earned": points},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	order.LoyaltyPointsEarned = points
+	return nil
+}
+
+// ReverseOrder undoes an order's points when it is cancelled or refunded:
+// redeemed points are given back and earned points are taken back
+func (s *LoyaltyService) ReverseOrder(ctx context.Context, order *models.Order, actor string) error {
+	if order.Customer.UserID == "" {
+		return nil
+	}
+	if err := s.RestoreRedemption(ctx, order, actor); err != nil {
+		return err
+	}
+	return s.ReverseEarned(ctx, order, math.Inf(1), actor)
+}
+
+// RestoreRedemption gives back the points spent on an order, once
+func (s *LoyaltyService) RestoreRedemption(ctx context.Context, order *models.Order, actor string) error {
+	redeemed, err := s.orderTransactions(ctx, order, models.LoyaltyRedeem, models.LoyaltyRestore)
+	if err != nil {
+		return err
+	}
+
+	points := 0
+	for _, tx := range redeemed {
+		points -= tx.Points
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	settings, err := s.GetSettings(ctx, order.Domain)
+	if err != nil {
+		return err
+	}
+
+	return s.credit(ctx, &models.LoyaltyTransaction{
+		Domain:      order.Domain,
+		UserID:      order.Customer.UserID,
+		Type:        models.LoyaltyRestore,
+		Points:      points,
+		OrderID:     order.ID.Hex(),
+		OrderNumber: order.OrderNumber,
+		Reason:      fmt.Sprintf("Order %s", order.Status),
+		CreatedBy:   actor,
+	}, settings)
+}
+
+// ReverseEarned takes back the points earned by the refunded part of an
+// order, in proportion to the refunded amount. Points the customer already
+// spent are still taken back, so the balance can go negative.
+func (s *LoyaltyService) ReverseEarned(ctx context.Context, order *models.Order, refunded float64, actor string) error {
+	txs, err := s.orderTransactions(ctx, order, models.LoyaltyEarn, models.LoyaltyReversal)
+	if err != nil {
+		return err
+	}
+
+	var earn *models.LoyaltyTransaction
+	reversed := 0
+	for i := range txs {
+		switch txs[i].Type {
+		case models.LoyaltyEarn:
+			earn = &txs[i]
+		case models.LoyaltyReversal:
+			reversed -= txs[i].Points
+		}
+	}
+	if earn == nil || earn.Amount <= 0 {
+		return nil
+	}
+
+	points := earn.Points - reversed
+	if refunded < earn.Amount {
+		points = min(points, int(math.Round(float64(earn.Points)*refunded/earn.Amount)))
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	// Take the points out of the order's own lot first so they don't expire twice
+	fromLot := min(points, earn.Remaining)
+	if fromLot > 0 {
+		_, err := s.db.GetCollection("loyalty_transactions").UpdateOne(ctx,
+			bson.M{"_id": earn.ID, "remaining": bson.M{"$gte": fromLot}},
+			bson.M{"$inc": bson.M{"remaining": -fromLot}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update loyalty lot: %w", err)
+		}
+	}
+	if points > fromLot {
+		s.consumeLots(ctx, order.Domain, order.Customer.UserID, points-fromLot)
+	}
+
+	if err := s.addPoints(ctx, order.Domain, order.Customer.UserID, -points); err != nil {
+		return err
+	}
+	return s.insert(ctx, &models.LoyaltyTransaction{
+		Domain:      order.Domain,
+		UserID:      order.Customer.UserID,
+		Type:        models.LoyaltyReversal,
+		Points:      -points,
+		OrderID:     order.ID.Hex(),
+		OrderNumber: order.OrderNumber,
+		Amount:      math.Min(refunded, earn.Amount),
+		Reason:      "Order refunded",
+		CreatedBy:   actor,
+	})
+}
+
+// AwardBonus credits bonus points for a review, a referral or a manual
+// goodwill gesture. Reviews and referrals are rewarded once per reference.
+func (s *LoyaltyService) AwardBonus(ctx context.Context, req *models.LoyaltyBonusRequest, domain, actor string) (*models.LoyaltyTransaction, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, fmt.Errorf("%w: the loyalty program is disabled", ErrInvalidLoyaltySettings)
+	}
+	if req.UserID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidLoyaltySettings)
+	}
+
+	tx := &models.LoyaltyTransaction{
+		Domain:    domain,
+		UserID:    req.UserID,
+		Type:      models.LoyaltyBonus,
+		Reason:    req.Reason,
+		CreatedBy: actor,
+	}
+
+	switch req.Type {
+	case "review", "referral":
+		if req.Reference == "" {
+			return nil, fmt.Errorf("%w: reference is required for %s bonuses", ErrInvalidLoyaltySettings, req.Type)
+		}
+		tx.Points = settings.ReviewBonus
+		if req.Type == "referral" {
+			tx.Points = settings.ReferralBonus
+		}
+		tx.Reference = req.Type + ":" + req.Reference
+		if tx.Reason == "" {
+			tx.Reason = strings.ToUpper(req.Type[:1]) + req.Type[1:] + " bonus"
+		}
+	case "manual":
+		if req.Points <= 0 {
+			return nil, fmt.Errorf("%w: points must be positive", ErrInvalidLoyaltySettings)
+		}
+		if req.Reason == "" {
+			return nil, fmt.Errorf("%w: manual bonuses need a reason", ErrInvalidLoyaltySettings)
+		}
+		tx.Points = req.Points
+	default:
+		return nil, fmt.Errorf("%w: type must be review, referral or manual", ErrInvalidLoyaltySettings)
+	}
+	if tx.Points <= 0 {
+		return nil, fmt.Errorf("%w: %s bonuses are set to 0 points", ErrInvalidLoyaltySettings, req.Type)
+	}
+
+	if tx.Reference != "" {
+		err := s.db.GetCollection("loyalty_transactions").FindOne(ctx, bson.M{
+			"domain":    domain,
+			"reference": tx.Reference,
+		}).Err()
+		if err == nil {
+			return nil, ErrLoyaltyBonusExists
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to check loyalty bonus: %w", err)
+		}
+	}
+
+	if err := s.credit(ctx, tx, settings); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrLoyaltyBonusExists
+		}
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// credit records a lot of points that can be spent and expire, and adds them
+// to the balance
+func (s *LoyaltyService) credit(ctx context.Context, tx *models.LoyaltyTransaction, settings *models.LoyaltySettings) error {
+	tx.Remaining = tx.Points
+	if settings.ExpiryDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, settings.ExpiryDays)
+		tx.ExpiresAt = &expiresAt
+	}
+
+	// Ledger first: for bonuses the unique reference index rejects duplicates
+	if err := s.insert(ctx, tx); err != nil {
+		return err
+	}
+	return s.addPoints(ctx, tx.Domain, tx.UserID, tx.Points)
+}
+
+// expire writes off lots past their expiry date. Expiry runs whenever a
+// balance is read or points are spent, so no scheduled job is needed.
+func (s *LoyaltyService) expire(ctx context.Context, domain, userID string) {
+	collection := s.db.GetCollection("loyalty_transactions")
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"domain":     domain,
+		"user_id":    userID,
+		"remaining":  bson.M{"$gt": 0},
+		"expires_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to find expired loyalty points for %s: %v", userID, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var lots []models.LoyaltyTransaction
+	if err := cursor.All(ctx, &lots); err != nil {
+		log.Printf("ERROR: Failed to decode expired loyalty points for %s: %v", userID, err)
+		return
+	}
+
+	for _, lot := range lots {
+		// Only the request that zeroes the lot writes it off
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": lot.ID, "remaining": lot.Remaining},
+			bson.M{"$set": bson.M{"remaining": 0}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+
+		if err := s.addPoints(ctx, domain, userID, -lot.Remaining); err != nil {
+			log.Printf("ERROR: Failed to expire loyalty points for %s: %v", userID, err)
+			continue
+		}
+		err = s.insert(ctx, &models.LoyaltyTransaction{
+			Domain:    domain,
+			UserID:    userID,
+			Type:      models.LoyaltyExpiry,
+			Points:    -lot.Remaining,
+			Reason:    fmt.Sprintf("Points from %s expired", lot.CreatedAt.Format("2006-01-02")),
+			CreatedBy: "system",
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to record loyalty expiry for %s: %v", userID, err)
+		}
+	}
+}
+
+// consumeLots marks spent points as used, oldest-expiring lots first.
+// Points that never expire are spent last.
+func (s *LoyaltyService) consumeLots(ctx context.Context, domain, userID string, points int) {
+	lots, err := s.openLots(ctx, domain, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load loyalty lots for %s: %v", userID, err)
+		return
+	}
+
+	collection := s.db.GetCollection("loyalty_transactions")
+	for _, lot := range lots {
+		if points <= 0 {
+			return
+		}
+		n := min(points, lot.Remaining)
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": lot.ID, "remaining": bson.M{"$gte": n}},
+			bson.M{"$inc": bson.M{"remaining": -n}},
+		)
+		if err != nil {
+			log.Printf("ERROR: Failed to update loyalty lot %s: %v", lot.ID.Hex(), err)
+			continue
+		}
+		if result.ModifiedCount > 0 {
+			points -= n
+		}
+	}
+}
+
+// openLots returns a customer's lots with unspent points, oldest-expiring first
+func (s *LoyaltyService) openLots(ctx context.Context, domain, userID string) ([]models.LoyaltyTransaction, error) {
+	cursor, err := s.db.GetCollection("loyalty_transactions").Find(ctx, bson.M{
+		"domain":    domain,
+		"user_id":   userID,
+		"remaining": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loyalty lots: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var lots []models.LoyaltyTransaction
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, fmt.Errorf("failed to decode loyalty lots: %w", err)
+	}
+
+	sort.SliceStable(lots, func(i, j int) bool {
+		a, b := lots[i].ExpiresAt, lots[j].ExpiresAt
+		switch {
+		case a == nil && b == nil:
+			return lots[i].CreatedAt.Before(lots[j].CreatedAt)
+		case a == nil || b == nil:
+			return b == nil
+		default:
+			return a.Before(*b)
+		}
+	})
+	return lots, nil
+}
+
+// orderTransactions returns an order's ledger entries of the given types
+func (s *LoyaltyService) orderTransactions(ctx context.Context, order *models.Order, types ...string) ([]models.LoyaltyTransaction, error) {
+	cursor, err := s.db.GetCollection("loyalty_transactions").Find(ctx, bson.M{
+		"domain":   order.Domain,
+		"order_id": order.ID.Hex(),
+		"type":     bson.M{"$in": types},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loyalty transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []models.LoyaltyTransaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode loyalty transactions: %w", err)
+	}
+	return txs, nil
+}
+
+// points returns a customer's balance (0 without an account)
+func (s *LoyaltyService) points(ctx context.Context, domain, userID string) (int, error) {
+	var account models.LoyaltyAccount
+	err := s.db.GetCollection("loyalty_accounts").FindOne(ctx, bson.M{"domain": domain, "user_id": userID}).Decode(&account)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get loyalty account: %w", err)
+	}
+	return account.Points, nil
+}
+
+// addPoints changes a customer's balance, creating the account if needed
+func (s *LoyaltyService) addPoints(ctx context.Context, domain, userID string, points int) error {
+	_, err := s.db.GetCollection("loyalty_accounts").UpdateOne(ctx,
+		bson.M{"domain": domain, "user_id": userID},
+		bson.M{
+			"$inc": bson.M{"points": points},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update loyalty account: %w", err)
+	}
+	return nil
+}
+
+// insert saves a ledger entry
+func (s *LoyaltyService) insert(ctx context.Context, tx *models.LoyaltyTransaction) error {
+	tx.ID = primitive.NewObjectID()
+	tx.CreatedAt = time.Now()
+
+	if _, err := s.db.GetCollection("loyalty_transactions").InsertOne(ctx, tx); err != nil {
+		return fmt.Errorf("failed to record loyalty transaction: %w", err)
+	}
+	return nil
+}
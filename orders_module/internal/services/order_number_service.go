@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidOrderNumberFormat is returned when a format update is rejected
+var ErrInvalidOrderNumberFormat = errors.New("invalid order number format")
+
+var orderNumberPrefixPattern = regexp.MustCompile(`^[A-Z0-9]{0,10}$`)
+
+// suffixAlphabet leaves out characters that are easy to misread (0/O, 1/I)
+const suffixAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// OrderNumberService generates order numbers from per-domain formats
+type OrderNumberService struct {
+	db *database.MongoDB
+}
+
+func NewOrderNumberService(db *database.MongoDB) *OrderNumberService {
+	return &OrderNumberService{db: db}
+}
+
+// GetFormat returns the domain's order number format, or the default
+func (s *OrderNumberService) GetFormat(ctx context.Context, domain string) (*models.OrderNumberFormat, error) {
+	collection := s.db.GetCollection("order_number_formats")
+
+	var format models.OrderNumberFormat
+	err := collection.FindOne(ctx, bson.M{"_id": domain}).Decode(&format)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultOrderNumberFormat(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order number format: %w", err)
+	}
+
+	return &format, nil
+}
+
+// UpdateFormat validates and saves a domain's order number format. The
+// sequence carries on from the current counter.
+func (s *OrderNumberService) UpdateFormat(ctx context.Context, req *models.UpdateOrderNumberFormatRequest, domain, updatedBy string) (*models.OrderNumberFormat, error) {
+	format, err := s.GetFormat(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Prefix != nil {
+		format.Prefix = strings.ToUpper(strings.TrimSpace(*req.Prefix))
+	}
+	if req.Padding != nil {
+		format.Padding = *req.Padding
+	}
+	if req.Reset != nil {
+		format.Reset = *req.Reset
+	}
+	if req.RandomSuffixLength != nil {
+		format.RandomSuffixLength = *req.RandomSuffixLength
+	}
+
+	var problems []string
+	if !orderNumberPrefixPattern.MatchString(format.Prefix) {
+		problems = append(problems, "prefix must be up to 10 letters or digits")
+	}
+	if format.Padding < 1 || format.Padding > 10 {
+		problems = append(problems, "padding must be between 1 and 10")
+	}
+	if format.Reset != "yearly" && format.Reset != "never" {
+		problems = append(problems, "reset must be yearly or never")
+	}
+	if format.RandomSuffixLength < 0 || format.RandomSuffixLength > 8 {
+		problems = append(problems, "random_suffix_length must be between 0 and 8")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOrderNumberFormat, strings.Join(problems, "; "))
+	}
+
+	format.UpdatedBy = updatedBy
+	format.UpdatedAt = time.Now()
+
+	collection := s.db.GetCollection("order_number_formats")
+	_, err = collection.ReplaceOne(ctx, bson.M{"_id": domain}, format, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save order number format: %w", err)
+	}
+
+	return format, nil
+}
+
+// Next generates the next order number for a domain.
+//
+// The counter is incremented with a single pipeline update, so the yearly
+// reset happens in the same atomic operation as the increment: two orders
+// racing at the start of a new year can't both get sequence 1.
+func (s *OrderNumberService) Next(ctx context.Context, domain string) (string, error) {
+	format, err := s.GetFormat(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	currentYear := time.Now().Year()
+	next := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$sequence", 0}}, 1}}
+	sequence := interface{}(next)
+	if format.Reset == "yearly" {
+		sequence = bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$year", currentYear}}, next, 1}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"sequence": sequence,
+			"year":     currentYear,
+		}}},
+	}
+
+	var counter models.OrderCounter
+	err = s.db.GetCollection("order_counters").FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": domain},
+		pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", fmt.Errorf("failed to increment order counter: %w", err)
+	}
+
+	suffix, err := randomSuffix(format.RandomSuffixLength)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatOrderNumber(format, counter.Year, counter.Sequence, suffix), nil
+}
+
+// FormatOrderNumber renders an order number from its parts
+func FormatOrderNumber(format *models.OrderNumberFormat, year, sequence int, suffix string) string {
+	var parts []string
+	if format.Prefix != "" {
+		parts = append(parts, format.Prefix)
+	}
+	if format.Reset == "yearly" {
+		parts = append(parts, fmt.Sprintf("%d", year))
+	}
+	parts = append(parts, fmt.Sprintf("%0*d", format.Padding, sequence))
+	if suffix != "" {
+		parts = append(parts, suffix)
+	}
+	return strings.Join(parts, "-")
+}
+
+// randomSuffix returns n random characters from suffixAlphabet
+func randomSuffix(n int) (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(suffixAlphabet)))
+	for i := 0; i < n; i++ {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate order number suffix: %w", err)
+		}
+		b.WriteByte(suffixAlphabet[idx.Int64()])
+	}
+	return b.String(), nil
+}
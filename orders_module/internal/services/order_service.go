@@ -2,23 +2,61 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/sparque/orders_module/internal/database"
 	"github.com/sparque/orders_module/internal/models"
 	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
 	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/stripe/stripe-go/v81/refund"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrOrderNotFound is returned when an order doesn't exist for the domain
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrInvalidOrderEdit is returned when an order's items can't be changed
+var ErrInvalidOrderEdit = errors.New("invalid order edit")
+
+// ErrInvalidFulfillment is returned when items can't be shipped
+var ErrInvalidFulfillment = errors.New("invalid fulfillment")
+
+// ErrInvalidOrderStatus is returned when an order's status doesn't allow a change
+var ErrInvalidOrderStatus = errors.New("invalid order status")
+
+// ErrInvalidOrder is returned when an order's items can't be ordered as sent
+var ErrInvalidOrder = errors.New("invalid order")
+
+// maxOrderNumberAttempts bounds retries when an order number is already taken
+const maxOrderNumberAttempts = 5
+
 type OrderService struct {
 	db         *database.MongoDB
 	stripeKey  string
+	addresses  *AddressService
+	catalog    *CatalogService
+	stock      *StockService
+	numbers    *OrderNumberService
+	webhooks   *WebhookService
+	risk       *RiskService
+	customers  *PaymentCustomerService
+	loyalty    *LoyaltyService
+	giftCards  *GiftCardService
+	coupons    *CouponService
+	invites    *InvitationDiscountService
+	affiliates *AffiliateService
+	profiles   *CustomerProfileService
+	checkout   *CheckoutService
+	payments   *StripeService
 }
 
 func NewOrderService(db *database.MongoDB, stripeKey string) *OrderService {
@@ -26,89 +64,440 @@ func NewOrderService(db *database.MongoDB, stripeKey string) *OrderService {
 	stripe.Key = stripeKey
 
 	return &OrderService{
-		db:        db,
-		stripeKey: stripeKey,
+		db:         db,
+		stripeKey:  stripeKey,
+		addresses:  NewAddressService(db),
+		catalog:    NewCatalogService(db),
+		stock:      NewStockService(db),
+		numbers:    NewOrderNumberService(db),
+		webhooks:   NewWebhookService(db),
+		risk:       NewRiskService(db),
+		customers:  NewPaymentCustomerService(db),
+		loyalty:    NewLoyaltyService(db),
+		giftCards:  NewGiftCardService(db, nil),
+		coupons:    NewCouponService(db),
+		invites:    NewInvitationDiscountService(db),
+		affiliates: NewAffiliateService(db),
+		profiles:   NewCustomerProfileService(db),
+		checkout:   NewCheckoutService(db),
+		payments:   NewStripeService(db, ""),
 	}
 }
 
 // CreateOrder creates a new order and Stripe payment intent
 func (s *OrderService) CreateOrder(ctx context.Context, req *models.CreateOrderRequest, domain string) (*models.Order, error) {
-	// Calculate totals
+	// Fill in saved addresses for logged-in customers
+	if err := s.resolveSavedAddresses(ctx, req, domain); err != nil {
+		return nil, err
+	}
+	for _, addr := range []*models.Address{&req.ShippingAddress, &req.BillingAddress} {
+		if IsEmptyAddress(*addr) {
+			continue
+		}
+		NormalizeAddress(addr)
+		if err := ValidateAddress(*addr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Lines are priced from the catalog; names and prices sent by the client
+	// are ignored. Custom lines only come from draft orders.
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrInvalidOrder)
+	}
 	var subtotal float64
 	for i := range req.Items {
-		req.Items[i].Total = req.Items[i].UnitPrice * float64(req.Items[i].Quantity)
-		subtotal += req.Items[i].Total
+		item := &req.Items[i]
+		if item.Custom {
+			return nil, fmt.Errorf("%w: custom line items can't be ordered", ErrInvalidOrder)
+		}
+		if item.Quantity < 1 {
+			return nil, fmt.Errorf("%w: quantity must be at least 1", ErrInvalidOrder)
+		}
+		if err := s.catalog.PriceItem(ctx, item, domain); err != nil {
+			return nil, err
+		}
+		item.Total = roundCents(item.UnitPrice * float64(item.Quantity))
+		subtotal += item.Total
 	}
+	subtotal = roundCents(subtotal)
 
-	// MVP: Simple pricing (no tax, no shipping)
-	tax := 0.0
-	shipping := 0.0
-	total := subtotal + tax + shipping
+	order := &models.Order{
+		Domain:          domain,
+		Customer:        req.Customer,
+		Items:           req.Items,
+		Subtotal:        subtotal,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		Notes:           req.Notes,
+	}
 
-	// Generate order number
-	orderNumber, err := s.generateOrderNumber(ctx, domain)
+	// Fraud/velocity checks run before any payment intent exists
+	order.Total = order.Subtotal
+	risk, err := s.risk.Assess(ctx, order, req.ClientIP)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate order number: %w", err)
+		return nil, err
+	}
+	if risk.Decision == models.RiskActionReject {
+		return nil, ErrOrderRejected
+	}
+	order.Risk = risk
+
+	// The coupon discount comes first, points and gift cards pay what's left.
+	// Its use is counted now and given back if placing the order fails.
+	if req.CouponCode != "" {
+		coupon, quote, err := s.coupons.Quote(ctx, domain, req.CouponCode, order.Items, order.Customer)
+		if err != nil {
+			return nil, err
+		}
+		order.ID = primitive.NewObjectID()
+		if quote.FreeShipping {
+			order.Shipping = 0
+		}
+		order.Discount += quote.Discount
+		order.Discounts = append(order.Discounts, models.OrderDiscount{
+			Type:        "coupon",
+			Code:        quote.Code,
+			Description: quote.Description,
+			Amount:      quote.Discount,
+		})
+		if err := s.coupons.Redeem(ctx, order, coupon, quote.Discount); err != nil {
+			return nil, err
+		}
+	}
+
+	// Customers who signed up with a promotional invitation get its discount
+	// on their first orders (unless they use a coupon), and their orders are
+	// attributed to it
+	if req.Customer.UserID != "" {
+		if err := s.applyInvitationDiscount(ctx, order, req.CouponCode == ""); err != nil {
+			log.Printf("ERROR: Failed to apply invitation discount for user %s: %v", req.Customer.UserID, err)
+		}
+	}
+
+	// Loyalty points are taken before the order is placed and given back if
+	// placing it fails
+	if req.RedeemPoints > 0 {
+		discount, err := s.loyalty.Quote(ctx, domain, req.Customer.UserID, req.RedeemPoints, roundCents(subtotal-order.Discount))
+		if err != nil {
+			s.releaseRedemptions(ctx, order)
+			return nil, err
+		}
+		if order.ID.IsZero() {
+			order.ID = primitive.NewObjectID()
+		}
+		order.Discount += discount
+		order.Discounts = append(order.Discounts, models.OrderDiscount{
+			Type:        "loyalty",
+			Description: fmt.Sprintf("%d loyalty points", req.RedeemPoints),
+			Amount:      discount,
+		})
+		order.LoyaltyPointsRedeemed = req.RedeemPoints
+		if err := s.loyalty.Redeem(ctx, order, req.RedeemPoints, discount); err != nil {
+			order.LoyaltyPointsRedeemed = 0
+			s.releaseRedemptions(ctx, order)
+			return nil, err
+		}
+	}
+
+	// Gift card balances pay what's left after discounts, the same way
+	if len(req.GiftCardCodes) > 0 {
+		if order.ID.IsZero() {
+			order.ID = primitive.NewObjectID()
+		}
+		if err := s.giftCards.Apply(ctx, order, req.GiftCardCodes, roundCents(order.Subtotal-order.Discount)); err != nil {
+			s.releaseRedemptions(ctx, order)
+			return nil, err
+		}
+	}
+
+	if err := s.placeOrder(ctx, order); err != nil {
+		s.releaseRedemptions(ctx, order)
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// applyInvitationDiscount attributes an order to the invitation its customer
+// accepted and, when allowed, takes the invitation's discount off it. A
+// failure leaves the order without the discount rather than failing checkout.
+func (s *OrderService) applyInvitationDiscount(ctx context.Context, order *models.Order, withDiscount bool) error {
+	claim, err := s.invites.GetClaim(ctx, order.Domain, order.Customer.UserID)
+	if err != nil || claim == nil {
+		return err
+	}
+	order.Attribution = invitationAttribution(claim)
+	if !withDiscount {
+		return nil
+	}
+
+	discount, err := s.invites.Quote(ctx, claim, order.Items)
+	if err != nil || discount <= 0 {
+		return err
+	}
+	if order.ID.IsZero() {
+		order.ID = primitive.NewObjectID()
+	}
+	ok, err := s.invites.Redeem(ctx, order, claim)
+	if err != nil || !ok {
+		return err
+	}
+
+	order.Discount += discount
+	order.Discounts = append(order.Discounts, models.OrderDiscount{
+		Type:        "invitation",
+		Code:        claim.PromoCode,
+		Description: fmt.Sprintf("%g%% welcome discount", claim.DiscountPercent),
+		Amount:      discount,
+	})
+	return nil
+}
+
+// releaseRedemptions gives back the coupon use, invitation discount, loyalty
+// points and gift card balances taken for an order that couldn't be placed
+func (s *OrderService) releaseRedemptions(ctx context.Context, order *models.Order) {
+	if hasCoupon(order) {
+		if err := s.coupons.Release(ctx, order); err != nil {
+			log.Printf("ERROR: Failed to release coupon for order %s: %v", order.ID.Hex(), err)
+		}
+	}
+	if hasInvitationDiscount(order) {
+		if err := s.invites.Release(ctx, order); err != nil {
+			log.Printf("ERROR: Failed to release invitation discount for order %s: %v", order.ID.Hex(), err)
+		}
 	}
+	if order.LoyaltyPointsRedeemed > 0 {
+		if err := s.loyalty.RestoreRedemption(ctx, order, "system"); err != nil {
+			log.Printf("ERROR: Failed to restore loyalty points for user %s: %v", order.Customer.UserID, err)
+		}
+	}
+	if len(order.GiftCardPayments) > 0 {
+		if err := s.giftCards.RestoreRedemptions(ctx, order, "system"); err != nil {
+			log.Printf("ERROR: Failed to restore gift card balances for order %s: %v", order.ID.Hex(), err)
+		}
+	}
+}
+
+// placeOrder assigns an order number, creates the Stripe payment intent (or
+// the hosted Checkout Session, if the domain uses them) and saves a priced
+// order as pending. Subtotal and discounts must already be set.
+// Gift card payments are taken off the amount charged; when they cover the
+// whole order no payment intent is created and the order is paid right away
+// (or once approved, if it is held for risk review).
+func (s *OrderService) placeOrder(ctx context.Context, order *models.Order) error {
+	// MVP: Simple pricing (no tax). Shipping isn't charged yet, so it stays
+	// 0 unless set before (and a free_shipping coupon sets it to 0).
+	order.Tax = 0.0
+	order.Total = order.Subtotal - order.Discount + order.Tax + order.Shipping
 
-	// Create Stripe Payment Intent
-	amountCents := int64(total * 100) // Convert to cents
-	pi, err := s.createPaymentIntent(amountCents, "usd", orderNumber)
+	// Refuse out-of-stock items, flag backorders / pre-orders with their ETA
+	for i := range order.Items {
+		if err := s.catalog.CheckAvailability(ctx, &order.Items[i], order.Domain); err != nil {
+			return err
+		}
+	}
+	order.ExpectedShipAt = expectedShipAt(order.Items)
+
+	// Generate order number
+	orderNumber, err := s.generateOrderNumber(ctx, order.Domain)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+		return fmt.Errorf("failed to generate order number: %w", err)
+	}
+
+	// Create Stripe Payment Intent for what gift cards don't cover
+	amountCents := int64(math.Round((order.Total - giftCardTotal(order.GiftCardPayments)) * 100)) // Convert to cents
+	// Logged-in customers pay through their Stripe Customer so the card is
+	// saved for next time. Checkout still works without one.
+	var customerID string
+	var pi *stripe.PaymentIntent
+	var cs *stripe.CheckoutSession
+	if amountCents > 0 {
+		if order.Customer.UserID != "" {
+			customerID, err = s.customers.GetOrCreate(ctx, order.Domain, order.Customer.UserID, order.Customer.Email, order.Customer.Name)
+			if err != nil {
+				log.Printf("ERROR: Failed to get Stripe customer for user %s: %v", order.Customer.UserID, err)
+			}
+		}
+
+		// Domains using hosted Checkout send the customer to Stripe to pay.
+		// Saved cards charged off-session (renewals) always use a payment intent.
+		checkout := models.DefaultCheckoutSettings(order.Domain)
+		if order.Payment.PaymentMethodID == "" {
+			if checkout, err = s.checkout.GetSettings(ctx, order.Domain); err != nil {
+				return err
+			}
+		}
+
+		if checkout.Mode == models.CheckoutModeCheckoutSession {
+			if order.ID.IsZero() {
+				order.ID = primitive.NewObjectID()
+			}
+			cs, err = s.createCheckoutSession(order, checkout, amountCents, orderNumber, customerID)
+			if err != nil {
+				return fmt.Errorf("failed to create checkout session: %w", err)
+			}
+		} else {
+			pi, err = s.createPaymentIntent(order, amountCents, orderNumber, customerID)
+			if err != nil {
+				return fmt.Errorf("failed to create payment intent: %w", err)
+			}
+		}
 	}
 
-	// Create order
 	now := time.Now()
-	order := &models.Order{
-		OrderNumber: orderNumber,
-		Domain:      domain,
-		Customer:    req.Customer,
-		Items:       req.Items,
-		Currency:    "USD",
-		Subtotal:    subtotal,
-		Tax:         tax,
-		Shipping:    shipping,
-		Total:       total,
-		Payment: models.Payment{
+	order.OrderNumber = orderNumber
+	order.Currency = "USD"
+	switch {
+	case pi != nil:
+		order.Payment = models.Payment{
 			Provider:        "stripe",
 			PaymentIntentID: pi.ID,
+			PaymentMethodID: order.Payment.PaymentMethodID,
 			Status:          "pending",
 			Amount:          amountCents,
 			Currency:        "usd",
 			ClientSecret:    pi.ClientSecret,
-		},
-		ShippingAddress: req.ShippingAddress,
-		BillingAddress:  req.BillingAddress,
-		Status:          "pending",
-		CreatedAt:       now,
-		UpdatedAt:       now,
-		Notes:           req.Notes,
+			CustomerID:      customerID,
+		}
+	case cs != nil:
+		// The payment intent is linked when the session is completed
+		order.Payment = models.Payment{
+			Provider:          "stripe",
+			Status:            "pending",
+			Amount:            amountCents,
+			Currency:          "usd",
+			CustomerID:        customerID,
+			CheckoutSessionID: cs.ID,
+			CheckoutURL:       cs.URL,
+		}
+	default:
+		// Nothing to charge: the gift card balances are already held
+		order.Payment = models.Payment{
+			Provider: "none",
+			Status:   "authorized",
+			Currency: "usd",
+		}
+		if order.Risk != nil {
+			// No card to screen
+			order.Risk.CardCheck = ""
+		}
+		if len(order.GiftCardPayments) > 0 {
+			order.Payment.Provider = "gift_card"
+		}
 	}
+	order.Status = "pending"
+	order.CreatedAt = now
+	order.UpdatedAt = now
 
-	// Save to database
+	// Save to database. {domain, order_number} is unique, so on the rare
+	// collision (random suffix, numbers issued by an older format) take the
+	// next number and point the payment intent at it.
 	collection := s.db.GetCollection("orders")
-	result, err := collection.InsertOne(ctx, order)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert order: %w", err)
+	for attempt := 1; ; attempt++ {
+		result, err := collection.InsertOne(ctx, order)
+		if err == nil {
+			order.ID = result.InsertedID.(primitive.ObjectID)
+			s.webhooks.Dispatch(ctx, models.WebhookEventOrderCreated, order)
+			if pi == nil && cs == nil && (order.Risk == nil || order.Risk.Decision != models.RiskActionReview) {
+				if err := s.payments.MarkOrderPaid(ctx, order); err != nil {
+					log.Printf("ERROR: Failed to complete gift card payment for order %s: %v", order.OrderNumber, err)
+				}
+			}
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == maxOrderNumberAttempts {
+			return fmt.Errorf("failed to insert order: %w", err)
+		}
+
+		log.Printf("Order number %s already taken for %s, retrying", order.OrderNumber, order.Domain)
+		if order.OrderNumber, err = s.generateOrderNumber(ctx, order.Domain); err != nil {
+			return fmt.Errorf("failed to generate order number: %w", err)
+		}
+		switch {
+		case pi != nil:
+			if err := s.updatePaymentIntentOrderNumber(pi.ID, order.OrderNumber); err != nil {
+				return err
+			}
+		case cs != nil:
+			if err := s.updateCheckoutSessionOrderNumber(cs.ID, order.OrderNumber); err != nil {
+				return err
+			}
+		}
 	}
+}
 
-	order.ID = result.InsertedID.(primitive.ObjectID)
+// updatePaymentIntentOrderNumber points a payment intent at a new order number
+func (s *OrderService) updatePaymentIntentOrderNumber(paymentIntentID, orderNumber string) error {
+	params := &stripe.PaymentIntentParams{}
+	params.AddMetadata("order_number", orderNumber)
 
-	return order, nil
+	if _, err := paymentintent.Update(paymentIntentID, params); err != nil {
+		return fmt.Errorf("failed to update payment intent: %w", err)
+	}
+	return nil
+}
+
+// updateCheckoutSessionOrderNumber points a checkout session at a new order
+// number. Its payment intent is matched to the order by ID, which doesn't change.
+func (s *OrderService) updateCheckoutSessionOrderNumber(sessionID, orderNumber string) error {
+	params := &stripe.CheckoutSessionParams{}
+	params.AddMetadata("order_number", orderNumber)
+
+	if _, err := session.Update(sessionID, params); err != nil {
+		return fmt.Errorf("failed to update checkout session: %w", err)
+	}
+	return nil
+}
+
+// resolveSavedAddresses replaces the inline addresses with the referenced
+// address book entries, falling back to the customer's defaults when no
+// address was sent at all
+func (s *OrderService) resolveSavedAddresses(ctx context.Context, req *models.CreateOrderRequest, domain string) error {
+	userID := req.Customer.UserID
+	if userID == "" {
+		if req.ShippingAddressID != "" || req.BillingAddressID != "" {
+			return fmt.Errorf("%w: saved addresses require a logged-in customer", ErrInvalidAddress)
+		}
+		return nil
+	}
+
+	if err := s.addresses.ResolveAddress(ctx, userID, domain, req.ShippingAddressID, "shipping", &req.ShippingAddress); err != nil {
+		return err
+	}
+	return s.addresses.ResolveAddress(ctx, userID, domain, req.BillingAddressID, "billing", &req.BillingAddress)
 }
 
-// createPaymentIntent creates a Stripe payment intent
-func (s *OrderService) createPaymentIntent(amount int64, currency, orderNumber string) (*stripe.PaymentIntent, error) {
+// createPaymentIntent creates a Stripe payment intent for a new order.
+// Checkout payment intents are confirmed by the customer's browser. When
+// order.Payment.PaymentMethodID is set (subscription renewals), the saved
+// card is attached instead and the caller confirms it off-session once the
+// order is saved.
+func (s *OrderService) createPaymentIntent(order *models.Order, amount int64, orderNumber, customerID string) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{
 		Amount:   stripe.Int64(amount),
-		Currency: stripe.String(currency),
+		Currency: stripe.String("usd"),
 		Metadata: map[string]string{
 			"order_number": orderNumber,
 		},
-		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+	}
+	if order.Payment.PaymentMethodID != "" {
+		params.PaymentMethod = stripe.String(order.Payment.PaymentMethodID)
+		params.PaymentMethodTypes = stripe.StringSlice([]string{"card"})
+	} else {
+		params.AutomaticPaymentMethods = &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
-		},
+		}
+	}
+	if customerID != "" {
+		params.Customer = stripe.String(customerID)
+		// Saved cards charged off-session are already set up for it
+		if order.Payment.PaymentMethodID == "" {
+			params.SetupFutureUsage = stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession))
+		}
+	}
+	if holdsPayment(order.Risk) {
+		params.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
 	}
 
 	pi, err := paymentintent.New(params)
@@ -119,53 +508,98 @@ func (s *OrderService) createPaymentIntent(amount int64, currency, orderNumber s
 	return pi, nil
 }
 
-// generateOrderNumber generates a sequential order number
-func (s *OrderService) generateOrderNumber(ctx context.Context, domain string) (string, error) {
-	collection := s.db.GetCollection("order_counters")
-
-	currentYear := time.Now().Year()
+// createCheckoutSession creates a Stripe-hosted Checkout Session for a new
+// order. The order ID must already be set: it is the session's client
+// reference, goes into the redirect URLs and lets the webhooks find the
+// order before the payment intent is linked to it.
+func (s *OrderService) createCheckoutSession(order *models.Order, settings *models.CheckoutSettings, amount int64, orderNumber, customerID string) (*stripe.CheckoutSession, error) {
+	orderID := order.ID.Hex()
+	params := &stripe.CheckoutSessionParams{
+		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems:         checkoutLineItems(order, amount),
+		SuccessURL:        stripe.String(checkoutRedirectURL(settings.SuccessURL, order.Domain, orderID)),
+		CancelURL:         stripe.String(checkoutRedirectURL(settings.CancelURL, order.Domain, orderID)),
+		ClientReferenceID: stripe.String(orderID),
+		Metadata: map[string]string{
+			"order_number": orderNumber,
+			"order_id":     orderID,
+		},
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+			Metadata: map[string]string{
+				"order_number":     orderNumber,
+				"order_id":         orderID,
+				"checkout_session": "true",
+			},
+		},
+	}
+	if customerID != "" {
+		params.Customer = stripe.String(customerID)
+		params.PaymentIntentData.SetupFutureUsage = stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession))
+	} else if order.Customer.Email != "" {
+		params.CustomerEmail = stripe.String(order.Customer.Email)
+	}
+	if holdsPayment(order.Risk) {
+		params.PaymentIntentData.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
 
-	// Find and update counter atomically
-	filter := bson.M{"_id": domain}
-	update := bson.M{
-		"$inc": bson.M{"sequence": 1},
-		"$setOnInsert": bson.M{"year": currentYear},
+	cs, err := session.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
 	}
 
-	var counter models.OrderCounter
-	err := collection.FindOneAndUpdate(
-		ctx,
-		filter,
-		update,
-		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
-	).Decode(&counter)
+	return cs, nil
+}
 
-	if err != nil {
-		return "", err
-	}
-
-	// If year changed, reset counter
-	if counter.Year != currentYear {
-		_, err := collection.UpdateOne(
-			ctx,
-			filter,
-			bson.M{
-				"$set": bson.M{
-					"sequence": 1,
-					"year":     currentYear,
-				},
-			},
-		)
-		if err != nil {
-			return "", err
+// checkoutLineItems lists the order's items on the Checkout page. Checkout
+// can't show our discounts and gift card payments, so when they change the
+// amount charged the order is shown as a single line for the amount due.
+func checkoutLineItems(order *models.Order, amount int64) []*stripe.CheckoutSessionLineItemParams {
+	items := make([]*stripe.CheckoutSessionLineItemParams, 0, len(order.Items))
+	var total int64
+	for _, item := range order.Items {
+		unitAmount := int64(math.Round(item.UnitPrice * 100))
+		total += unitAmount * int64(item.Quantity)
+
+		name := item.ProductName
+		if name == "" {
+			name = item.ProductID
 		}
-		counter.Sequence = 1
-		counter.Year = currentYear
+		product := &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+			Name: stripe.String(name),
+		}
+		if strings.HasPrefix(item.ProductImage, "https://") {
+			product.Images = stripe.StringSlice([]string{item.ProductImage})
+		}
+
+		items = append(items, &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:    stripe.String("usd"),
+				ProductData: product,
+				UnitAmount:  stripe.Int64(unitAmount),
+			},
+			Quantity: stripe.Int64(int64(item.Quantity)),
+		})
 	}
+	if total == amount {
+		return items
+	}
+
+	return []*stripe.CheckoutSessionLineItemParams{{
+		PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency: stripe.String("usd"),
+			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+				Name:        stripe.String("Order total"),
+				Description: stripe.String("After discounts and gift cards"),
+			},
+			UnitAmount: stripe.Int64(amount),
+		},
+		Quantity: stripe.Int64(1),
+	}}
+}
 
-	// Format: ORD-2026-00001
-	orderNumber := fmt.Sprintf("ORD-%d-%05d", counter.Year, counter.Sequence)
-	return orderNumber, nil
+// generateOrderNumber generates the next order number in the domain's format
+func (s *OrderService) generateOrderNumber(ctx context.Context, domain string) (string, error) {
+	return s.numbers.Next(ctx, domain)
 }
 
 // GetOrder retrieves an order by ID
@@ -184,7 +618,7 @@ func (s *OrderService) GetOrder(ctx context.Context, orderID string, domain stri
 	}).Decode(&order)
 
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("order not found")
+		return nil, ErrOrderNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order: %w", err)
@@ -197,13 +631,11 @@ func (s *OrderService) GetOrder(ctx context.Context, orderID string, domain stri
 func (s *OrderService) ListOrders(ctx context.Context, userID, domain string, limit int) ([]*models.Order, error) {
 	collection := s.db.GetCollection("orders")
 
-	// For now, show all orders for the domain (TODO: Add proper user auth filtering)
 	filter := bson.M{
-		"domain": domain,
+		"domain":           domain,
+		"customer.user_id": userID,
 	}
 
-	log.Printf("ListOrders - domain: %s, filter: %+v", domain, filter)
-
 	opts := options.Find().
 		SetSort(bson.D{{Key: "created_at", Value: -1}}).
 		SetLimit(int64(limit))
@@ -222,36 +654,414 @@ func (s *OrderService) ListOrders(ctx context.Context, userID, domain string, li
 	return orders, nil
 }
 
-// UpdateOrderStatus updates an order's status
-func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, status, domain string) error {
-	collection := s.db.GetCollection("orders")
+// orderStatusFrom maps each status an order can be moved to with
+// UpdateOrderStatus to the statuses it can be moved from. Orders are only
+// marked paid by StripeService.MarkOrderPaid (from the payment webhooks or a
+// risk review approval), which takes the stock and issues what the order
+// bought, and only cancelled or refunded by CancelOrder and RefundOrder,
+// which deal with the payment and give back what the order used.
+var orderStatusFrom = map[string][]string{
+	"processing":        {"paid"},
+	"partially_shipped": {"paid", "processing"},
+	"shipped":           {"paid", "processing", "partially_shipped"},
+	"delivered":         {"partially_shipped", "shipped"},
+}
 
-	objectID, err := primitive.ObjectIDFromHex(orderID)
+// UpdateOrderStatus moves an order along its lifecycle (see orderStatusFrom)
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, status, domain, actor string) error {
+	from, ok := orderStatusFrom[status]
+	if !ok {
+		return fmt.Errorf("%w: can't set an order to %q", ErrInvalidOrderStatus, status)
+	}
+
+	order, err := s.GetOrder(ctx, orderID, domain)
 	if err != nil {
-		return fmt.Errorf("invalid order ID: %w", err)
+		return err
+	}
+	allowed := false
+	for _, f := range from {
+		allowed = allowed || f == order.Status
+	}
+	if !allowed {
+		return fmt.Errorf("%w: order is %s", ErrInvalidOrderStatus, order.Status)
 	}
 
+	_, err = s.setStatus(ctx, order, status, actor)
+	return err
+}
+
+// setStatus changes an order's status if it is still the status the order
+// was read with, so each change (and its webhook) happens once, then updates
+// the customer's profile
+func (s *OrderService) setStatus(ctx context.Context, order *models.Order, status, actor string) (*models.Order, error) {
 	update := bson.M{
 		"$set": bson.M{
 			"status":     status,
 			"updated_at": time.Now(),
 		},
+		"$push": bson.M{
+			"history": newOrderEvent("status_changed", fmt.Sprintf("Status changed to %s", status), actor, nil),
+		},
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{
-		"_id":    objectID,
-		"domain": domain,
-	}, update)
+	var updated models.Order
+	err := s.db.GetCollection("orders").FindOneAndUpdate(ctx, bson.M{
+		"_id":    order.ID,
+		"status": order.Status,
+	}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
 
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: the order changed, try again", ErrInvalidOrderStatus)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update order: %w", err)
+		return nil, fmt.Errorf("failed to update order: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("order not found")
+	if event, ok := statusWebhookEvents[status]; ok {
+		s.webhooks.Dispatch(ctx, event, &updated)
 	}
 
-	return nil
+	// Refunding or cancelling an order changes the customer's totals
+	if err := s.profiles.RecordOrder(ctx, &updated); err != nil {
+		log.Printf("ERROR: Failed to update customer profile for order %s: %v", updated.OrderNumber, err)
+	}
+
+	return &updated, nil
+}
+
+// reverseOrder gives back what a cancelled or refunded order used and
+// earned: loyalty points, gift card balances (and voids cards it bought),
+// its coupon use, invitation discount and affiliate commission
+func (s *OrderService) reverseOrder(ctx context.Context, order *models.Order, actor string) {
+	if err := s.loyalty.ReverseOrder(ctx, order, actor); err != nil {
+		log.Printf("ERROR: Failed to reverse loyalty points for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.giftCards.ReverseOrder(ctx, order, actor); err != nil {
+		log.Printf("ERROR: Failed to reverse gift cards for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.coupons.Release(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to release coupon for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.invites.Release(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to release invitation discount for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.affiliates.ReverseOrder(ctx, order, actor); err != nil {
+		log.Printf("ERROR: Failed to reverse affiliate commission for order %s: %v", order.OrderNumber, err)
+	}
+}
+
+// RefundOrder refunds everything still charged on an order through Stripe
+// and marks it refunded, which reverses points, gift cards and commissions
+func (s *OrderService) RefundOrder(ctx context.Context, orderID, domain, reason, actor string) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case "paid", "processing", "partially_shipped", "shipped", "delivered":
+	default:
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidOrderStatus, order.Status)
+	}
+
+	if err := s.refundPayments(ctx, order, reason, actor); err != nil {
+		return nil, err
+	}
+	updated, err := s.setStatus(ctx, order, "refunded", actor)
+	if err != nil {
+		return nil, err
+	}
+	s.reverseOrder(ctx, updated, actor)
+
+	return s.GetOrder(ctx, orderID, domain)
+}
+
+// CancelOrder cancels an order that hasn't shipped. An unpaid order's
+// payment intent (or Checkout Session) is cancelled, a paid order is
+// refunded in full.
+func (s *OrderService) CancelOrder(ctx context.Context, orderID, domain, reason, actor string) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case "pending":
+		// Nothing left to cancel in Stripe once the payment intent was
+		// cancelled or the Checkout Session expired
+		stripeClosed := order.Payment.Status == "cancelled" ||
+			(order.Payment.PaymentIntentID == "" && order.Payment.Status == "failed")
+		if !stripeClosed && (order.Payment.PaymentIntentID != "" || order.Payment.CheckoutSessionID != "") {
+			if order.Payment.PaymentIntentID != "" {
+				params := &stripe.PaymentIntentCancelParams{
+					CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonRequestedByCustomer)),
+				}
+				if _, err := paymentintent.Cancel(order.Payment.PaymentIntentID, params); err != nil {
+					return nil, fmt.Errorf("failed to cancel payment intent: %w", err)
+				}
+			} else if _, err := session.Expire(order.Payment.CheckoutSessionID, nil); err != nil {
+				return nil, fmt.Errorf("failed to expire checkout session: %w", err)
+			}
+			_, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+				"$set": bson.M{"payment.status": "cancelled", "updated_at": time.Now()},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to update order: %w", err)
+			}
+		}
+	case "paid", "processing":
+		if err := s.refundPayments(ctx, order, reason, actor); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidOrderStatus, order.Status)
+	}
+
+	updated, err := s.setStatus(ctx, order, "cancelled", actor)
+	if err != nil {
+		return nil, err
+	}
+	s.reverseOrder(ctx, updated, actor)
+
+	return s.GetOrder(ctx, orderID, domain)
+}
+
+// ExpirePendingOrders cancels orders that are still unpaid after maxAge, so
+// abandoned checkouts give back the coupons, invitation discounts and gift
+// card balances they hold. Subscription renewals are left to the
+// subscription retries and payments held for risk review to the reviewer.
+func (s *OrderService) ExpirePendingOrders(ctx context.Context, maxAge time.Duration) (int, error) {
+	cursor, err := s.db.GetCollection("orders").Find(ctx, bson.M{
+		"status":          "pending",
+		"payment.status":  bson.M{"$in": bson.A{"pending", "failed", "cancelled"}},
+		"subscription_id": bson.M{"$in": bson.A{nil, ""}},
+		"created_at":      bson.M{"$lt": time.Now().Add(-maxAge)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find pending orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	expired := 0
+	for cursor.Next(ctx) {
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			log.Printf("ERROR: Failed to decode pending order: %v", err)
+			continue
+		}
+		if _, err := s.CancelOrder(ctx, order.ID.Hex(), order.Domain, "payment not completed in time", "system"); err != nil {
+			log.Printf("ERROR: Failed to expire pending order %s: %v", order.OrderNumber, err)
+			continue
+		}
+		expired++
+	}
+	if err := cursor.Err(); err != nil {
+		return expired, fmt.Errorf("failed to read pending orders: %w", err)
+	}
+
+	return expired, nil
+}
+
+// RunPendingExpiry expires unpaid orders older than maxAge every interval
+// until ctx is cancelled
+func (s *OrderService) RunPendingExpiry(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.ExpirePendingOrders(ctx, maxAge)
+			if err != nil {
+				log.Printf("ERROR: Failed to expire pending orders: %v", err)
+			}
+			if expired > 0 {
+				log.Printf("✅ Expired %d unpaid orders", expired)
+			}
+		}
+	}
+}
+
+// refundPayments refunds what is left of the order payment and the extra
+// charges from item edits, minus earlier refunds. Refunds that went through
+// are recorded even when a later one fails.
+func (s *OrderService) refundPayments(ctx context.Context, order *models.Order, reason, actor string) error {
+	type charge struct {
+		paymentIntentID string
+		amount          int64
+	}
+
+	var charges []charge
+	if order.Payment.PaymentIntentID != "" && order.Payment.Status == "succeeded" {
+		charges = append(charges, charge{order.Payment.PaymentIntentID, order.Payment.Amount})
+	}
+	var refunded int64
+	for _, adjustment := range order.PaymentAdjustments {
+		switch {
+		case adjustment.Type == "charge" && adjustment.Status == "succeeded":
+			charges = append(charges, charge{adjustment.PaymentIntentID, adjustment.Amount})
+		case adjustment.Type == "refund" && adjustment.Status != "failed" && adjustment.Status != "canceled":
+			refunded += adjustment.Amount
+		}
+	}
+
+	var adjustments []models.PaymentAdjustment
+	var total int64
+	var refundErr error
+	for _, c := range charges {
+		amount := c.amount - refunded
+		refunded = max(refunded-c.amount, 0)
+		if amount <= 0 {
+			continue
+		}
+
+		r, err := s.createRefund(c.paymentIntentID, amount, order.OrderNumber, "")
+		if err != nil {
+			refundErr = err
+			break
+		}
+		adjustments = append(adjustments, models.PaymentAdjustment{
+			Type:      "refund",
+			Amount:    amount,
+			RefundID:  r.ID,
+			Status:    string(r.Status),
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		})
+		total += amount
+	}
+
+	if len(adjustments) > 0 {
+		set := bson.M{"updated_at": time.Now()}
+		if refundErr == nil {
+			set["payment.status"] = "refunded"
+		}
+		_, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+			"$set": set,
+			"$push": bson.M{
+				"payment_adjustments": bson.M{"$each": adjustments},
+				"history": newOrderEvent("refunded", fmt.Sprintf("Refunded %.2f", float64(total)/100), actor,
+					map[string]interface{}{"reason": reason, "amount": total}),
+			},
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to record refunds for order %s: %v", order.OrderNumber, err)
+		}
+	}
+
+	return refundErr
+}
+
+// CreateFulfillment ships some or all of an order's items. Units still on
+// backorder / pre-order can't ship yet; once every unit has shipped the
+// order becomes shipped, until then it is partially_shipped.
+func (s *OrderService) CreateFulfillment(ctx context.Context, orderID string, req *models.CreateFulfillmentRequest, domain, actor string) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case "paid", "processing", "partially_shipped":
+	default:
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidFulfillment, order.Status)
+	}
+
+	// Gift cards are delivered by email, not shipped
+	shipItems := req.Items
+	if len(shipItems) == 0 {
+		for _, item := range order.Items {
+			if item.ProductType == models.ProductTypeGiftCard {
+				continue
+			}
+			if n := item.Quantity - item.ShippedQuantity - item.BackorderedQuantity; n > 0 {
+				shipItems = append(shipItems, models.FulfillmentItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: n})
+			}
+		}
+		if len(shipItems) == 0 {
+			return nil, fmt.Errorf("%w: nothing can ship yet", ErrInvalidFulfillment)
+		}
+	}
+
+	for _, ship := range shipItems {
+		idx := -1
+		for i, item := range order.Items {
+			if item.ProductID == ship.ProductID && item.VariantID == ship.VariantID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 || order.Items[idx].ProductType == models.ProductTypeGiftCard {
+			return nil, fmt.Errorf("%w: %s/%s is not in the order", ErrInvalidFulfillment, ship.ProductID, ship.VariantID)
+		}
+
+		item := &order.Items[idx]
+		shippable := item.Quantity - item.ShippedQuantity - item.BackorderedQuantity
+		if ship.Quantity < 1 || ship.Quantity > shippable {
+			return nil, fmt.Errorf("%w: %d of %s can ship", ErrInvalidFulfillment, max(shippable, 0), item.ProductName)
+		}
+		item.ShippedQuantity += ship.Quantity
+	}
+
+	status := "shipped"
+	for _, item := range order.Items {
+		if item.ProductType != models.ProductTypeGiftCard && item.ShippedQuantity < item.Quantity {
+			status = "partially_shipped"
+			break
+		}
+	}
+
+	now := time.Now()
+	fulfillment := models.Fulfillment{
+		ID:             primitive.NewObjectID().Hex(),
+		Items:          shipItems,
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		CreatedBy:      actor,
+		CreatedAt:      now,
+	}
+	event := newOrderEvent("fulfilled", fmt.Sprintf("Shipment created, status %s", status), actor,
+		map[string]interface{}{"fulfillment_id": fulfillment.ID})
+
+	// Matching updated_at keeps two shipments from racing for the same units
+	var updated models.Order
+	err = s.db.GetCollection("orders").FindOneAndUpdate(ctx,
+		bson.M{"_id": order.ID, "updated_at": order.UpdatedAt},
+		bson.M{
+			"$set": bson.M{
+				"items":      order.Items,
+				"status":     status,
+				"updated_at": now,
+			},
+			"$push": bson.M{
+				"fulfillments": fulfillment,
+				"history":      event,
+			},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: the order changed, try again", ErrInvalidFulfillment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if status == "shipped" {
+		s.webhooks.Dispatch(ctx, models.WebhookEventOrderShipped, &updated)
+	}
+
+	return &updated, nil
+}
+
+// statusWebhookEvents maps admin status changes to the webhook event they trigger
+var statusWebhookEvents = map[string]string{
+	"paid":      models.WebhookEventOrderPaid,
+	"shipped":   models.WebhookEventOrderShipped,
+	"cancelled": models.WebhookEventOrderCancelled,
+	"refunded":  models.WebhookEventOrderRefunded,
 }
 
 // ListAllOrders lists all orders (admin) with optional domain filter
@@ -284,6 +1094,68 @@ func (s *OrderService) ListAllOrders(ctx context.Context, domain string, limit i
 	return orders, nil
 }
 
+// OrderFilter narrows FindOrders (zero values match everything)
+type OrderFilter struct {
+	Status string
+	From   time.Time // Created at or after
+	To     time.Time // Created at or before
+}
+
+// FindOrders lists a domain's orders matching the filter, newest first. A
+// limit of 0 returns every match.
+func (s *OrderService) FindOrders(ctx context.Context, domain string, filter OrderFilter, limit int64) ([]*models.Order, error) {
+	query := bson.M{"domain": domain}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lte"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := s.db.GetCollection("orders").Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	orders := []*models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetOrderByNumber retrieves an order by its order number
+func (s *OrderService) GetOrderByNumber(ctx context.Context, orderNumber, domain string) (*models.Order, error) {
+	var order models.Order
+	err := s.db.GetCollection("orders").FindOne(ctx, bson.M{
+		"order_number": orderNumber,
+		"domain":       domain,
+	}).Decode(&order)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return &order, nil
+}
+
 // UpdateOrderDetails updates customer and address info for an order
 func (s *OrderService) UpdateOrderDetails(ctx context.Context, orderID string, req *models.UpdateOrderDetailsRequest, domain string) error {
 	collection := s.db.GetCollection("orders")
@@ -302,9 +1174,17 @@ func (s *OrderService) UpdateOrderDetails(ctx context.Context, orderID string, r
 		setFields["customer"] = req.Customer
 	}
 	if req.ShippingAddress != nil {
+		NormalizeAddress(req.ShippingAddress)
+		if err := ValidateAddress(*req.ShippingAddress); err != nil {
+			return err
+		}
 		setFields["shipping_address"] = req.ShippingAddress
 	}
 	if req.BillingAddress != nil {
+		NormalizeAddress(req.BillingAddress)
+		if err := ValidateAddress(*req.BillingAddress); err != nil {
+			return err
+		}
 		setFields["billing_address"] = req.BillingAddress
 	}
 
@@ -327,3 +1207,376 @@ func (s *OrderService) UpdateOrderDetails(ctx context.Context, orderID string, r
 
 	return nil
 }
+
+// EditOrderItems adds, removes or re-quantifies line items on an order that
+// hasn't shipped. Paid orders get their stock adjusted and the price
+// difference charged through a new payment intent or refunded; pending orders
+// just have their payment intent amount updated.
+func (s *OrderService) EditOrderItems(ctx context.Context, orderID string, req *models.EditOrderItemsRequest, domain, actor string) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case "pending", "paid", "processing":
+	default:
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidOrderEdit, order.Status)
+	}
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: no item changes", ErrInvalidOrderEdit)
+	}
+	// Price differences are settled through Stripe only, and issued gift
+	// cards can't be taken back by an edit
+	if len(order.GiftCardPayments) > 0 {
+		return nil, fmt.Errorf("%w: orders paid with gift cards can't be edited, cancel and re-place it", ErrInvalidOrderEdit)
+	}
+	for _, item := range order.Items {
+		if item.ProductType == models.ProductTypeGiftCard {
+			return nil, fmt.Errorf("%w: orders with gift cards can't be edited, cancel and re-place it", ErrInvalidOrderEdit)
+		}
+	}
+
+	// Apply the changes to a copy of the items
+	items := make([]models.OrderItem, len(order.Items))
+	copy(items, order.Items)
+	oldQuantities := itemQuantities(order.Items)
+
+	for _, change := range req.Items {
+		if change.Quantity < 0 {
+			return nil, fmt.Errorf("%w: quantity can't be negative", ErrInvalidOrderEdit)
+		}
+
+		idx := -1
+		for i, item := range items {
+			if !item.Custom && item.ProductID == change.ProductID && item.VariantID == change.VariantID {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case idx >= 0 && change.Quantity == 0:
+			items = append(items[:idx], items[idx+1:]...)
+		case idx >= 0:
+			items[idx].Quantity = change.Quantity
+			items[idx].Total = roundCents(items[idx].UnitPrice * float64(change.Quantity))
+			items[idx].BackorderedQuantity = min(items[idx].BackorderedQuantity, change.Quantity)
+		case change.Quantity > 0:
+			item := models.OrderItem{
+				ProductID: change.ProductID,
+				VariantID: change.VariantID,
+				Quantity:  change.Quantity,
+			}
+			if err := s.catalog.PriceItem(ctx, &item, domain); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidOrderEdit, err)
+			}
+			if err := s.catalog.CheckAvailability(ctx, &item, domain); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidOrderEdit, err)
+			}
+			if item.ProductType == models.ProductTypeGiftCard {
+				return nil, fmt.Errorf("%w: gift cards can't be added to an order, place a new one", ErrInvalidOrderEdit)
+			}
+			item.Total = roundCents(item.UnitPrice * float64(item.Quantity))
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: an order needs at least one item, cancel it instead", ErrInvalidOrderEdit)
+	}
+
+	// Recalculate totals, keeping existing discounts (capped at the new subtotal)
+	var subtotal float64
+	for _, item := range items {
+		subtotal += item.Total
+	}
+	subtotal = roundCents(subtotal)
+	discount := math.Min(order.Discount, subtotal)
+	total := roundCents(subtotal - discount + order.Tax + order.Shipping)
+
+	oldCents := int64(math.Round(order.Total * 100))
+	newCents := int64(math.Round(total * 100))
+	diffCents := newCents - oldCents
+
+	now := time.Now()
+	setFields := bson.M{
+		"items":            items,
+		"subtotal":         subtotal,
+		"discount":         discount,
+		"total":            total,
+		"expected_ship_at": expectedShipAt(items),
+		"updated_at":       now,
+	}
+	push := bson.M{}
+
+	// A pending order's payment intent gets the new amount. A paid order's
+	// difference is reserved as an adjustment and charged or refunded once
+	// the edit is saved.
+	var adjustment *models.PaymentAdjustment
+	if order.Status == "pending" {
+		setFields["payment.amount"] = newCents
+	} else if diffCents != 0 {
+		adjustment = &models.PaymentAdjustment{
+			ID:        primitive.NewObjectID().Hex(),
+			Type:      "charge",
+			Amount:    diffCents,
+			Status:    "reserved",
+			Reason:    req.Reason,
+			CreatedAt: now,
+		}
+		if diffCents < 0 {
+			adjustment.Type = "refund"
+			adjustment.Amount = -diffCents
+		}
+		push["payment_adjustments"] = adjustment
+	}
+	push["history"] = newOrderEvent("items_edited",
+		fmt.Sprintf("Items edited, total %.2f → %.2f", order.Total, total), actor,
+		map[string]interface{}{
+			"reason":         req.Reason,
+			"changes":        req.Items,
+			"previous_total": order.Total,
+			"new_total":      total,
+		})
+
+	// Only apply if nobody changed the order in the meantime. The edit is
+	// saved before any money moves, so two concurrent edits can't both
+	// charge or refund.
+	result, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{
+		"_id":        order.ID,
+		"updated_at": order.UpdatedAt,
+	}, bson.M{"$set": setFields, "$push": push})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: order was modified concurrently, try again", ErrInvalidOrderEdit)
+	}
+
+	if err := s.settleEdit(ctx, order, adjustment, newCents); err != nil {
+		s.undoEdit(ctx, order, adjustment, now, actor, err)
+		return nil, err
+	}
+
+	// Stock was deducted at payment time, so only paid orders need adjusting
+	if order.Status != "pending" {
+		s.adjustStockForEdit(ctx, order, oldQuantities, itemQuantities(items), actor)
+	}
+
+	updated, err := s.GetOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if adjustment != nil && adjustment.Type == "refund" {
+		s.webhooks.Dispatch(ctx, models.WebhookEventOrderRefunded, updated)
+		if err := s.loyalty.ReverseEarned(ctx, updated, float64(adjustment.Amount)/100, actor); err != nil {
+			log.Printf("ERROR: Failed to reverse loyalty points for order %s: %v", updated.OrderNumber, err)
+		}
+		if err := s.affiliates.ReverseRefund(ctx, updated, float64(adjustment.Amount)/100, actor); err != nil {
+			log.Printf("ERROR: Failed to reverse affiliate commission for order %s: %v", updated.OrderNumber, err)
+		}
+		if err := s.profiles.RecordOrder(ctx, updated); err != nil {
+			log.Printf("ERROR: Failed to update customer profile for order %s: %v", updated.OrderNumber, err)
+		}
+	}
+
+	return updated, nil
+}
+
+// settleEdit moves the money for a saved item edit: a pending order's
+// payment intent gets the new amount, a paid order's reserved adjustment is
+// charged or refunded. Stripe requests carry the adjustment's idempotency
+// key, so a retried request can't charge or refund twice.
+func (s *OrderService) settleEdit(ctx context.Context, order *models.Order, adjustment *models.PaymentAdjustment, newCents int64) error {
+	if order.Status == "pending" {
+		return s.updatePaymentIntentAmount(order.Payment.PaymentIntentID, newCents)
+	}
+	if adjustment == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("order-%s-edit-%s", order.ID.Hex(), adjustment.ID)
+	set := bson.M{}
+	if adjustment.Type == "charge" {
+		pi, err := s.createAdjustmentPaymentIntent(adjustment.Amount, order.Payment.Currency, order.OrderNumber, key)
+		if err != nil {
+			return err
+		}
+		adjustment.PaymentIntentID = pi.ID
+		adjustment.ClientSecret = pi.ClientSecret
+		adjustment.Status = "pending"
+		set["payment_adjustments.$.payment_intent_id"] = pi.ID
+		set["payment_adjustments.$.client_secret"] = pi.ClientSecret
+	} else {
+		r, err := s.createRefund(order.Payment.PaymentIntentID, adjustment.Amount, order.OrderNumber, key)
+		if err != nil {
+			return err
+		}
+		adjustment.RefundID = r.ID
+		adjustment.Status = string(r.Status)
+		set["payment_adjustments.$.refund_id"] = r.ID
+	}
+	set["payment_adjustments.$.status"] = adjustment.Status
+
+	// The money has moved: a failure here is logged, not undone
+	_, err := s.db.GetCollection("orders").UpdateOne(ctx,
+		bson.M{"_id": order.ID, "payment_adjustments.id": adjustment.ID},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		log.Printf("ERROR: Failed to record %s %s for order %s: %v", adjustment.Type, adjustment.ID, order.OrderNumber, err)
+	}
+	return nil
+}
+
+// undoEdit puts back an order's items and totals when the money for an edit
+// couldn't be moved, unless the order changed again since the edit was saved
+func (s *OrderService) undoEdit(ctx context.Context, order *models.Order, adjustment *models.PaymentAdjustment, editedAt time.Time, actor string, cause error) {
+	update := bson.M{
+		"$set": bson.M{
+			"items":            order.Items,
+			"subtotal":         order.Subtotal,
+			"discount":         order.Discount,
+			"total":            order.Total,
+			"expected_ship_at": order.ExpectedShipAt,
+			"payment.amount":   order.Payment.Amount,
+			"updated_at":       time.Now(),
+		},
+		"$push": bson.M{
+			"history": newOrderEvent("items_edit_failed", fmt.Sprintf("Item edit undone: %v", cause), actor, nil),
+		},
+	}
+	if adjustment != nil {
+		update["$pull"] = bson.M{"payment_adjustments": bson.M{"id": adjustment.ID}}
+	}
+
+	result, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID, "updated_at": editedAt}, update)
+	if err != nil {
+		log.Printf("ERROR: Failed to undo item edit on order %s: %v", order.OrderNumber, err)
+	} else if result.MatchedCount == 0 {
+		log.Printf("ERROR: Failed to undo item edit on order %s: the order changed since", order.OrderNumber)
+	}
+}
+
+// adjustStockForEdit records the stock difference between the old and new items
+func (s *OrderService) adjustStockForEdit(ctx context.Context, order *models.Order, before, after map[[2]string]int, actor string) {
+	keys := make(map[[2]string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		delta := before[k] - after[k] // More items ordered means less stock
+		if delta == 0 {
+			continue
+		}
+
+		tx := &models.StockTransaction{
+			Domain:      order.Domain,
+			ProductID:   k[0],
+			VariantID:   k[1],
+			Type:        "adjustment",
+			Quantity:    delta,
+			OrderID:     order.ID.Hex(),
+			OrderNumber: order.OrderNumber,
+			CreatedBy:   actor,
+			Reason:      "Order items edited",
+		}
+		if err := s.stock.ApplyTransaction(ctx, tx); err != nil {
+			log.Printf("ERROR: Failed to adjust stock for order %s (%s/%s): %v", order.OrderNumber, k[0], k[1], err)
+		}
+	}
+}
+
+// updatePaymentIntentAmount changes the amount of an unpaid payment intent
+func (s *OrderService) updatePaymentIntentAmount(paymentIntentID string, amount int64) error {
+	_, err := paymentintent.Update(paymentIntentID, &stripe.PaymentIntentParams{
+		Amount: stripe.Int64(amount),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update payment intent: %w", err)
+	}
+	return nil
+}
+
+// createAdjustmentPaymentIntent creates a payment intent for an extra charge
+// after an order edit. The webhook matches it through the adjustment metadata.
+func (s *OrderService) createAdjustmentPaymentIntent(amount int64, currency, orderNumber, idempotencyKey string) (*stripe.PaymentIntent, error) {
+	params := &stripe.PaymentIntentParams{
+		Params:   stripe.Params{IdempotencyKey: stripe.String(idempotencyKey)},
+		Amount:   stripe.Int64(amount),
+		Currency: stripe.String(currency),
+		Metadata: map[string]string{
+			"order_number": orderNumber,
+			"adjustment":   "true",
+		},
+		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+			Enabled: stripe.Bool(true),
+		},
+	}
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	return pi, nil
+}
+
+// createRefund refunds part of a payment intent. An idempotency key, when
+// given, makes a repeated request return the first refund.
+func (s *OrderService) createRefund(paymentIntentID string, amount int64, orderNumber, idempotencyKey string) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Amount:        stripe.Int64(amount),
+	}
+	params.AddMetadata("order_number", orderNumber)
+	if idempotencyKey != "" {
+		params.SetIdempotencyKey(idempotencyKey)
+	}
+
+	r, err := refund.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	return r, nil
+}
+
+// itemQuantities sums quantities per product/variant, ignoring custom items
+func itemQuantities(items []models.OrderItem) map[[2]string]int {
+	quantities := make(map[[2]string]int)
+	for _, item := range items {
+		if item.Custom {
+			continue
+		}
+		quantities[[2]string{item.ProductID, item.VariantID}] += item.Quantity
+	}
+	return quantities
+}
+
+// holdsPayment reports whether an order's payment is only authorized at
+// checkout: orders flagged for review wait for an admin, and pending card
+// checks run on the card Stripe authorized before it is captured
+func holdsPayment(risk *models.RiskAssessment) bool {
+	return risk != nil && (risk.Decision == models.RiskActionReview || risk.CardCheck == "pending")
+}
+
+// newOrderEvent builds an order history entry
+func newOrderEvent(eventType, message, actor string, data map[string]interface{}) models.OrderEvent {
+	if actor == "" {
+		actor = "system"
+	}
+	return models.OrderEvent{
+		Type:      eventType,
+		Message:   message,
+		Actor:     actor,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sparque/orders_module/internal/models"
+)
+
+func TestCheckoutLineItems(t *testing.T) {
+	items := []models.OrderItem{
+		{ProductID: "p1", ProductName: "Mug", ProductImage: "https://cdn.example.com/mug.png", Quantity: 2, UnitPrice: 12.5},
+		{ProductID: "p2", ProductImage: "/uploads/tee.png", Quantity: 1, UnitPrice: 19.99},
+	}
+
+	type line struct {
+		name       string
+		unitAmount int64
+		quantity   int64
+		images     int
+	}
+	tests := []struct {
+		name   string
+		amount int64
+		want   []line
+	}{
+		{"items when nothing is taken off", 4499, []line{
+			{"Mug", 1250, 2, 1},
+			{"p2", 1999, 1, 0},
+		}},
+		{"single line after discounts or gift cards", 3000, []line{
+			{"Order total", 3000, 1, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkoutLineItems(&models.Order{Items: items}, tt.amount)
+			if len(got) != len(tt.want) {
+				t.Fatalf("checkoutLineItems() returned %d lines, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				price := got[i].PriceData
+				if name := *price.ProductData.Name; name != want.name {
+					t.Errorf("line %d name = %q, want %q", i, name, want.name)
+				}
+				if *price.UnitAmount != want.unitAmount {
+					t.Errorf("line %d unit amount = %d, want %d", i, *price.UnitAmount, want.unitAmount)
+				}
+				if *got[i].Quantity != want.quantity {
+					t.Errorf("line %d quantity = %d, want %d", i, *got[i].Quantity, want.quantity)
+				}
+				if len(price.ProductData.Images) != want.images {
+					t.Errorf("line %d has %d images, want %d", i, len(price.ProductData.Images), want.images)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderStatusFrom(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"paid", "processing", true},
+		{"paid", "shipped", true},
+		{"processing", "partially_shipped", true},
+		{"partially_shipped", "shipped", true},
+		{"shipped", "delivered", true},
+		{"pending", "paid", false},
+		{"pending", "processing", false},
+		{"pending", "shipped", false},
+		{"paid", "paid", false},
+		{"delivered", "shipped", false},
+		{"paid", "delivered", false},
+		{"cancelled", "paid", false},
+		{"paid", "cancelled", false},
+		{"paid", "refunded", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := slices.Contains(orderStatusFrom[tt.to], tt.from); got != tt.allowed {
+				t.Errorf("%s -> %s allowed = %v, want %v", tt.from, tt.to, got, tt.allowed)
+			}
+		})
+	}
+}
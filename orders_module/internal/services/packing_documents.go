@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/sparque/orders_module/internal/models"
+)
+
+// ErrInvalidDocumentFormat is returned for formats other than html and pdf
+var ErrInvalidDocumentFormat = errors.New("invalid document format, use html or pdf")
+
+// WritePackingSlips renders packing slips as one printable document, a page
+// per order
+func WritePackingSlips(w io.Writer, slips []*models.PackingSlip, format string) error {
+	switch format {
+	case models.PackingFormatHTML:
+		if err := packingSlipsTemplate.Execute(w, slips); err != nil {
+			return fmt.Errorf("failed to render packing slips: %w", err)
+		}
+		return nil
+	case models.PackingFormatPDF:
+		return writePackingSlipsPDF(w, slips)
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidDocumentFormat, format)
+}
+
+// WritePickList renders a pick list as a printable document
+func WritePickList(w io.Writer, list *models.PickList, format string) error {
+	switch format {
+	case models.PackingFormatHTML:
+		if err := pickListTemplate.Execute(w, list); err != nil {
+			return fmt.Errorf("failed to render pick list: %w", err)
+		}
+		return nil
+	case models.PackingFormatPDF:
+		return writePickListPDF(w, list)
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidDocumentFormat, format)
+}
+
+var packingTemplateFuncs = template.FuncMap{
+	"pickOrders": pickOrders,
+}
+
+var packingSlipsTemplate = template.Must(template.New("packing_slips").Funcs(packingTemplateFuncs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Packing slips</title>
+	<style>
+		body { font-family: Arial, sans-serif; font-size: 13px; color: #000; margin: 0; }
+		.slip { padding: 24px; page-break-after: always; }
+		.slip:last-child { page-break-after: auto; }
+		h1 { font-size: 20px; margin: 0 0 4px; }
+		.meta { color: #555; margin-bottom: 16px; }
+		.address { margin-bottom: 16px; }
+		table { width: 100%; border-collapse: collapse; margin-bottom: 16px; }
+		th, td { border: 1px solid #999; padding: 6px; text-align: left; vertical-align: top; }
+		th { background: #eee; }
+		.qty { text-align: right; width: 50px; }
+		.check { width: 50px; }
+		.notes { border-left: 3px solid #999; padding-left: 8px; }
+	</style>
+</head>
+<body>
+{{range .}}
+	<div class="slip">
+		<h1>Packing slip</h1>
+		<div class="meta">Order {{.OrderNumber}} &middot; {{.OrderedAt.Format "Jan 2, 2006"}} &middot; {{.Domain}}</div>
+		<div class="address">
+			<strong>Ship to</strong><br>
+			{{with .ShippingAddress}}{{.Name}}<br>
+			{{.AddressLine1}}<br>
+			{{if .AddressLine2}}{{.AddressLine2}}<br>{{end}}
+			{{.City}}{{if .State}}, {{.State}}{{end}} {{.PostalCode}}<br>
+			{{.Country}}{{if .Phone}}<br>{{.Phone}}{{end}}{{end}}
+		</div>
+		<table>
+			<tr><th>SKU</th><th>Item</th><th>Options</th><th class="qty">Qty</th><th class="check">Packed</th></tr>
+			{{range .Items}}<tr><td>{{.VariantSKU}}</td><td>{{.ProductName}}</td><td>{{.Options}}</td><td class="qty">{{.Quantity}}</td><td class="check">&#9744;</td></tr>
+			{{else}}<tr><td colspan="5">Nothing to pack yet</td></tr>
+			{{end}}
+		</table>
+		{{if .ToFollow}}
+		<strong>To follow (on backorder)</strong>
+		<table>
+			<tr><th>SKU</th><th>Item</th><th>Options</th><th class="qty">Qty</th></tr>
+			{{range .ToFollow}}<tr><td>{{.VariantSKU}}</td><td>{{.ProductName}}</td><td>{{.Options}}</td><td class="qty">{{.Quantity}}</td></tr>
+			{{end}}
+		</table>
+		{{end}}
+		{{if .Notes}}<p class="notes">{{.Notes}}</p>{{end}}
+	</div>
+{{else}}
+	<p>No orders to pack.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var pickListTemplate = template.Must(template.New("pick_list").Funcs(packingTemplateFuncs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Pick list</title>
+	<style>
+		body { font-family: Arial, sans-serif; font-size: 13px; color: #000; padding: 24px; }
+		h1 { font-size: 20px; margin: 0 0 4px; }
+		.meta { color: #555; margin-bottom: 16px; }
+		table { width: 100%; border-collapse: collapse; margin-bottom: 16px; }
+		th, td { border: 1px solid #999; padding: 6px; text-align: left; vertical-align: top; }
+		th { background: #eee; }
+		.qty { text-align: right; width: 50px; }
+		.check { width: 50px; }
+	</style>
+</head>
+<body>
+	<h1>Pick list</h1>
+	<div class="meta">{{.Domain}} &middot; {{.GeneratedAt.Format "Jan 2, 2006 15:04"}} &middot; {{len .Orders}} orders, {{.TotalUnits}} units</div>
+	<table>
+		<tr><th>SKU</th><th>Item</th><th>Options</th><th class="qty">Qty</th><th>Orders</th><th class="check">Picked</th></tr>
+		{{range .Lines}}<tr><td>{{.VariantSKU}}</td><td>{{.ProductName}}</td><td>{{.Options}}</td><td class="qty">{{.Quantity}}</td><td>{{pickOrders .Orders}}</td><td class="check">&#9744;</td></tr>
+		{{else}}<tr><td colspan="6">Nothing to pick</td></tr>
+		{{end}}
+	</table>
+	{{if .Orders}}<p>Orders: {{range $i, $number := .Orders}}{{if $i}}, {{end}}{{$number}}{{end}}</p>{{end}}
+</body>
+</html>
+`))
+
+// pickOrders lists the orders of a pick list line, e.g. "1001 (2), 1004 (1)"
+func pickOrders(orders []models.PickListOrder) string {
+	parts := make([]string, 0, len(orders))
+	for _, order := range orders {
+		parts = append(parts, fmt.Sprintf("%s (%d)", order.OrderNumber, order.Quantity))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func writePackingSlipsPDF(w io.Writer, slips []*models.PackingSlip) error {
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	widths := []float64{35, 70, 50, 20, 20}
+
+	if len(slips) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.Cell(0, 6, "No orders to pack.")
+	}
+
+	for _, slip := range slips {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 8, "Packing slip", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Order %s - %s - %s", slip.OrderNumber, slip.OrderedAt.Format("Jan 2, 2006"), slip.Domain)), "", 1, "L", false, 0, "")
+		pdf.Ln(4)
+
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(0, 5, "Ship to", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		for _, line := range addressLines(slip.ShippingAddress) {
+			pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+		}
+		pdf.Ln(4)
+
+		pdfTableRow(pdf, tr, widths, []string{"SKU", "Item", "Options", "Qty", "Packed"}, true)
+		for _, item := range slip.Items {
+			pdfTableRow(pdf, tr, widths, []string{item.VariantSKU, item.ProductName, item.Options, fmt.Sprint(item.Quantity), ""}, false)
+		}
+		if len(slip.Items) == 0 {
+			pdfTableRow(pdf, tr, []float64{195}, []string{"Nothing to pack yet"}, false)
+		}
+
+		if len(slip.ToFollow) > 0 {
+			pdf.Ln(4)
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.CellFormat(0, 5, "To follow (on backorder)", "", 1, "L", false, 0, "")
+			pdfTableRow(pdf, tr, widths[:4], []string{"SKU", "Item", "Options", "Qty"}, true)
+			for _, item := range slip.ToFollow {
+				pdfTableRow(pdf, tr, widths[:4], []string{item.VariantSKU, item.ProductName, item.Options, fmt.Sprint(item.Quantity)}, false)
+			}
+		}
+
+		if slip.Notes != "" {
+			pdf.Ln(4)
+			pdf.SetFont("Helvetica", "I", 10)
+			pdf.MultiCell(0, 5, tr(slip.Notes), "", "L", false)
+		}
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to render packing slips: %w", err)
+	}
+	return nil
+}
+
+func writePickListPDF(w io.Writer, list *models.PickList) error {
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	widths := []float64{30, 55, 40, 15, 40, 15}
+
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 8, "Pick list", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s - %s - %d orders, %d units", list.Domain, list.GeneratedAt.Format("Jan 2, 2006 15:04"), len(list.Orders), list.TotalUnits)), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdfTableRow(pdf, tr, widths, []string{"SKU", "Item", "Options", "Qty", "Orders", "Picked"}, true)
+	for _, line := range list.Lines {
+		pdfTableRow(pdf, tr, widths, []string{line.VariantSKU, line.ProductName, line.Options, fmt.Sprint(line.Quantity), pickOrders(line.Orders), ""}, false)
+	}
+	if len(list.Lines) == 0 {
+		pdfTableRow(pdf, tr, []float64{195}, []string{"Nothing to pick"}, false)
+	}
+
+	if len(list.Orders) > 0 {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(0, 5, tr("Orders: "+strings.Join(list.Orders, ", ")), "", "L", false)
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to render pick list: %w", err)
+	}
+	return nil
+}
+
+// pdfTableRow draws a row of bordered cells, wrapping long text and starting
+// a new page when the row doesn't fit
+func pdfTableRow(pdf *fpdf.Fpdf, tr func(string) string, widths []float64, cells []string, header bool) {
+	const lineHeight = 5
+
+	if header {
+		pdf.SetFont("Helvetica", "B", 9)
+	} else {
+		pdf.SetFont("Helvetica", "", 9)
+	}
+
+	lines := 1
+	for i, cell := range cells {
+		if n := len(pdf.SplitLines([]byte(tr(cell)), widths[i])); n > lines {
+			lines = n
+		}
+	}
+	height := float64(lines) * lineHeight
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+height > pageHeight-bottom {
+		pdf.AddPage()
+	}
+
+	left, _, _, _ := pdf.GetMargins()
+	x, y := left, pdf.GetY()
+	for i, cell := range cells {
+		if header {
+			pdf.SetFillColor(238, 238, 238)
+			pdf.Rect(x, y, widths[i], height, "FD")
+		} else {
+			pdf.Rect(x, y, widths[i], height, "D")
+		}
+		pdf.SetXY(x, y)
+		pdf.MultiCell(widths[i], lineHeight, tr(cell), "", "L", false)
+		x += widths[i]
+	}
+	pdf.SetXY(left, y+height)
+}
+
+// addressLines formats an address for print, one line per entry
+func addressLines(address models.Address) []string {
+	lines := []string{address.Name, address.AddressLine1}
+	if address.AddressLine2 != "" {
+		lines = append(lines, address.AddressLine2)
+	}
+	cityLine := address.City
+	if address.State != "" {
+		cityLine += ", " + address.State
+	}
+	lines = append(lines, strings.TrimSpace(cityLine+" "+address.PostalCode), address.Country)
+	if address.Phone != "" {
+		lines = append(lines, address.Phone)
+	}
+	return lines
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotPackable is returned when an order has nothing to pack (not paid,
+// already shipped or cancelled)
+var ErrNotPackable = errors.New("order can't be packed")
+
+// maxPackingOrders bounds the orders printed in one go when none are selected
+const maxPackingOrders = 200
+
+// packableStatuses are the order statuses that still have items to ship
+var packableStatuses = []string{"paid", "processing", "partially_shipped"}
+
+// PackingService builds packing slips and pick lists for the warehouse
+type PackingService struct {
+	db *database.MongoDB
+}
+
+func NewPackingService(db *database.MongoDB) *PackingService {
+	return &PackingService{db: db}
+}
+
+// PackingSlips builds a packing slip per order. Without order IDs every
+// paid order that hasn't fully shipped is included, oldest first.
+func (s *PackingService) PackingSlips(ctx context.Context, domain string, orderIDs []string) ([]*models.PackingSlip, error) {
+	orders, err := s.packableOrders(ctx, domain, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	slips := make([]*models.PackingSlip, 0, len(orders))
+	for _, order := range orders {
+		slips = append(slips, packingSlip(order))
+	}
+	return slips, nil
+}
+
+// PickList sums the units to pick across orders per variant. Without order
+// IDs every paid order that hasn't fully shipped is included.
+func (s *PackingService) PickList(ctx context.Context, domain string, orderIDs []string) (*models.PickList, error) {
+	orders, err := s.packableOrders(ctx, domain, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &models.PickList{
+		Domain:      domain,
+		GeneratedAt: time.Now(),
+		Orders:      []string{},
+		Lines:       []models.PickListLine{},
+	}
+	lines := make(map[string]*models.PickListLine)
+	var keys []string
+	for _, order := range orders {
+		list.Orders = append(list.Orders, order.OrderNumber)
+		for _, item := range order.Items {
+			n := quantityToPack(item)
+			if n <= 0 {
+				continue
+			}
+
+			key := item.ProductID + "/" + item.VariantID
+			line, ok := lines[key]
+			if !ok {
+				line = &models.PickListLine{
+					ProductID:   item.ProductID,
+					ProductName: item.ProductName,
+					VariantID:   item.VariantID,
+					VariantSKU:  item.VariantSKU,
+					Options:     variantOptions(item.VariantAttributes),
+				}
+				lines[key] = line
+				keys = append(keys, key)
+			}
+			line.Quantity += n
+			line.Orders = append(line.Orders, models.PickListOrder{
+				OrderID:     order.ID.Hex(),
+				OrderNumber: order.OrderNumber,
+				Quantity:    n,
+			})
+			list.TotalUnits += n
+		}
+	}
+
+	for _, key := range keys {
+		list.Lines = append(list.Lines, *lines[key])
+	}
+	sort.SliceStable(list.Lines, func(i, j int) bool {
+		if list.Lines[i].VariantSKU != list.Lines[j].VariantSKU {
+			return list.Lines[i].VariantSKU < list.Lines[j].VariantSKU
+		}
+		return list.Lines[i].ProductName < list.Lines[j].ProductName
+	})
+
+	return list, nil
+}
+
+// packableOrders loads the selected orders in the given order, or all
+// packable orders of the domain when none are selected
+func (s *PackingService) packableOrders(ctx context.Context, domain string, orderIDs []string) ([]*models.Order, error) {
+	collection := s.db.GetCollection("orders")
+
+	if len(orderIDs) == 0 {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "paid_at", Value: 1}, {Key: "created_at", Value: 1}}).
+			SetLimit(maxPackingOrders)
+		cursor, err := collection.Find(ctx, bson.M{
+			"domain": domain,
+			"status": bson.M{"$in": packableStatuses},
+		}, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list orders: %w", err)
+		}
+		defer cursor.Close(ctx)
+
+		orders := []*models.Order{}
+		if err := cursor.All(ctx, &orders); err != nil {
+			return nil, fmt.Errorf("failed to decode orders: %w", err)
+		}
+		return orders, nil
+	}
+
+	if len(orderIDs) > maxPackingOrders {
+		return nil, fmt.Errorf("%w: at most %d orders at a time", ErrNotPackable, maxPackingOrders)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		id, err := primitive.ObjectIDFromHex(orderID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, orderID)
+		}
+		ids = append(ids, id)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "domain": domain})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var found []*models.Order
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+	byID := make(map[primitive.ObjectID]*models.Order, len(found))
+	for _, order := range found {
+		byID[order.ID] = order
+	}
+
+	orders := make([]*models.Order, 0, len(ids))
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	for i, id := range ids {
+		order, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, orderIDs[i])
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !isPackable(order) {
+			return nil, fmt.Errorf("%w: order %s is %s", ErrNotPackable, order.OrderNumber, order.Status)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func isPackable(order *models.Order) bool {
+	for _, status := range packableStatuses {
+		if order.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// packingSlip lists the units of an order that can ship now and the ones
+// that follow once back in stock. Gift cards are emailed, not packed.
+func packingSlip(order *models.Order) *models.PackingSlip {
+	slip := &models.PackingSlip{
+		OrderID:         order.ID.Hex(),
+		OrderNumber:     order.OrderNumber,
+		Domain:          order.Domain,
+		Customer:        order.Customer,
+		ShippingAddress: order.ShippingAddress,
+		Notes:           order.Notes,
+		OrderedAt:       order.CreatedAt,
+		Items:           []models.PackingSlipItem{},
+	}
+
+	for _, item := range order.Items {
+		if item.ProductType == models.ProductTypeGiftCard {
+			continue
+		}
+		line := models.PackingSlipItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			VariantID:   item.VariantID,
+			VariantSKU:  item.VariantSKU,
+			Options:     variantOptions(item.VariantAttributes),
+		}
+		if n := quantityToPack(item); n > 0 {
+			line.Quantity = n
+			slip.Items = append(slip.Items, line)
+		}
+		if item.BackorderedQuantity > 0 {
+			line.Quantity = item.BackorderedQuantity
+			slip.ToFollow = append(slip.ToFollow, line)
+		}
+	}
+	return slip
+}
+
+// quantityToPack is what's left to ship of an item from stock on hand
+func quantityToPack(item models.OrderItem) int {
+	if item.ProductType == models.ProductTypeGiftCard {
+		return 0
+	}
+	return item.Quantity - item.ShippedQuantity - item.BackorderedQuantity
+}
+
+// variantOptions formats variant attributes for print, sorted by name
+func variantOptions(attributes map[string]interface{}) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %v", name, attributes[name]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/customer"
+	"github.com/stripe/stripe-go/v81/paymentmethod"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrPaymentMethodNotFound is returned when a payment method isn't saved on the user's customer
+var ErrPaymentMethodNotFound = errors.New("payment method not found")
+
+// PaymentCustomerService keeps one Stripe Customer per user per domain and
+// manages the payment methods saved on it
+type PaymentCustomerService struct {
+	db *database.MongoDB
+}
+
+func NewPaymentCustomerService(db *database.MongoDB) *PaymentCustomerService {
+	return &PaymentCustomerService{db: db}
+}
+
+// GetOrCreate returns the user's Stripe Customer ID for the domain, creating
+// the Stripe Customer on first use. Checkout passes the order's domain, which
+// for logged-in customers is the one in their token, like the payment method
+// routes.
+func (s *PaymentCustomerService) GetOrCreate(ctx context.Context, domain, userID, email, name string) (string, error) {
+	existing, err := s.get(ctx, domain, userID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.StripeCustomerID, nil
+	}
+
+	params := &stripe.CustomerParams{
+		Metadata: map[string]string{
+			"user_id": userID,
+			"domain":  domain,
+		},
+	}
+	if email != "" {
+		params.Email = stripe.String(email)
+	}
+	if name != "" {
+		params.Name = stripe.String(name)
+	}
+
+	c, err := customer.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Stripe customer: %w", err)
+	}
+
+	link := models.PaymentCustomer{
+		ID:               primitive.NewObjectID(),
+		Domain:           domain,
+		UserID:           userID,
+		Email:            email,
+		StripeCustomerID: c.ID,
+		CreatedAt:        time.Now(),
+	}
+
+	_, err = s.db.GetCollection("payment_customers").InsertOne(ctx, link)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another checkout created the link first, use theirs
+		if _, delErr := customer.Del(c.ID, nil); delErr != nil {
+			log.Printf("ERROR: Failed to delete duplicate Stripe customer %s: %v", c.ID, delErr)
+		}
+		existing, err := s.get(ctx, domain, userID)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return "", fmt.Errorf("payment customer for user %s disappeared", userID)
+		}
+		return existing.StripeCustomerID, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save payment customer: %w", err)
+	}
+
+	return c.ID, nil
+}
+
+// ListPaymentMethods lists the cards saved on the user's Stripe Customer
+func (s *PaymentCustomerService) ListPaymentMethods(ctx context.Context, domain, userID string) ([]models.SavedPaymentMethod, error) {
+	methods := []models.SavedPaymentMethod{}
+
+	link, err := s.get(ctx, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return methods, nil
+	}
+
+	iter := paymentmethod.List(&stripe.PaymentMethodListParams{
+		Customer: stripe.String(link.StripeCustomerID),
+		Type:     stripe.String(string(stripe.PaymentMethodTypeCard)),
+	})
+	for iter.Next() {
+		methods = append(methods, savedPaymentMethod(iter.PaymentMethod()))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list payment methods: %w", err)
+	}
+
+	return methods, nil
+}
+
+// DeletePaymentMethod detaches a saved payment method from the user's Stripe Customer
+func (s *PaymentCustomerService) DeletePaymentMethod(ctx context.Context, domain, userID, paymentMethodID string) error {
+	// Never detach a card that belongs to someone else
+	if err := s.CheckPaymentMethod(ctx, domain, userID, paymentMethodID); err != nil {
+		return err
+	}
+
+	if _, err := paymentmethod.Detach(paymentMethodID, nil); err != nil {
+		return fmt.Errorf("failed to remove payment method: %w", err)
+	}
+
+	return nil
+}
+
+// CheckPaymentMethod returns ErrPaymentMethodNotFound unless the payment
+// method is saved on the user's Stripe Customer
+func (s *PaymentCustomerService) CheckPaymentMethod(ctx context.Context, domain, userID, paymentMethodID string) error {
+	link, err := s.get(ctx, domain, userID)
+	if err != nil {
+		return err
+	}
+	if link == nil || paymentMethodID == "" {
+		return ErrPaymentMethodNotFound
+	}
+
+	pm, err := paymentmethod.Get(paymentMethodID, nil)
+	if err != nil {
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == 404 {
+			return ErrPaymentMethodNotFound
+		}
+		return fmt.Errorf("failed to get payment method: %w", err)
+	}
+
+	if pm.Customer == nil || pm.Customer.ID != link.StripeCustomerID {
+		return ErrPaymentMethodNotFound
+	}
+
+	return nil
+}
+
+// get returns the user's customer link, or nil if there is none yet
+func (s *PaymentCustomerService) get(ctx context.Context, domain, userID string) (*models.PaymentCustomer, error) {
+	var link models.PaymentCustomer
+	err := s.db.GetCollection("payment_customers").FindOne(ctx, bson.M{
+		"domain":  domain,
+		"user_id": userID,
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment customer: %w", err)
+	}
+
+	return &link, nil
+}
+
+func savedPaymentMethod(pm *stripe.PaymentMethod) models.SavedPaymentMethod {
+	saved := models.SavedPaymentMethod{
+		ID:   pm.ID,
+		Type: string(pm.Type),
+	}
+	if pm.Card != nil {
+		saved.Brand = string(pm.Card.Brand)
+		saved.Last4 = pm.Card.Last4
+		saved.ExpMonth = pm.Card.ExpMonth
+		saved.ExpYear = pm.Card.ExpYear
+		if pm.Card.Wallet != nil {
+			saved.Wallet = string(pm.Card.Wallet.Type)
+		}
+	}
+	return saved
+}
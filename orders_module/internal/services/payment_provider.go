@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/balancetransaction"
+	"github.com/stripe/stripe-go/v81/payout"
+)
+
+// PaymentProvider is what the payout reconciliation needs from the payment
+// provider. StripeProvider reads the Stripe API; FixtureProvider reads a
+// JSON file instead, for development and testing without a Stripe account.
+type PaymentProvider interface {
+	// Payouts lists the payouts that arrived between from and to (zero means unbounded)
+	Payouts(ctx context.Context, from, to time.Time) ([]ProviderPayout, error)
+	// BalanceTransactions lists the balance transactions a payout paid out
+	BalanceTransactions(ctx context.Context, payoutID string) ([]ProviderBalanceTransaction, error)
+}
+
+// ProviderPayout is a payout as the provider reports it (cents, Unix times)
+type ProviderPayout struct {
+	ID          string `json:"id"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Status      string `json:"status"`
+	ArrivalDate int64  `json:"arrival_date"`
+	Created     int64  `json:"created"`
+}
+
+// ProviderBalanceTransaction is a balance transaction as the provider
+// reports it (cents, Unix times). PaymentIntent is the payment intent of
+// the charge or refund behind it, if any.
+type ProviderBalanceTransaction struct {
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	ReportingCategory string `json:"reporting_category"`
+	Source            string `json:"source"`
+	PaymentIntent     string `json:"payment_intent"`
+	Amount            int64  `json:"amount"`
+	Fee               int64  `json:"fee"`
+	Net               int64  `json:"net"`
+	Currency          string `json:"currency"`
+	Description       string `json:"description"`
+	Created           int64  `json:"created"`
+}
+
+// StripeProvider reads payouts and balance transactions from the Stripe API
+type StripeProvider struct{}
+
+func NewStripeProvider(secretKey string) *StripeProvider {
+	stripe.Key = secretKey
+	return &StripeProvider{}
+}
+
+// Payouts lists the Stripe payouts that arrived in the period
+func (p *StripeProvider) Payouts(ctx context.Context, from, to time.Time) ([]ProviderPayout, error) {
+	params := &stripe.PayoutListParams{}
+	params.Context = ctx
+	if !from.IsZero() || !to.IsZero() {
+		params.ArrivalDateRange = &stripe.RangeQueryParams{}
+		if !from.IsZero() {
+			params.ArrivalDateRange.GreaterThanOrEqual = from.Unix()
+		}
+		if !to.IsZero() {
+			params.ArrivalDateRange.LesserThanOrEqual = to.Unix()
+		}
+	}
+
+	payouts := []ProviderPayout{}
+	i := payout.List(params)
+	for i.Next() {
+		po := i.Payout()
+		payouts = append(payouts, ProviderPayout{
+			ID:          po.ID,
+			Amount:      po.Amount,
+			Currency:    string(po.Currency),
+			Status:      string(po.Status),
+			ArrivalDate: po.ArrivalDate,
+			Created:     po.Created,
+		})
+	}
+	if err := i.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list Stripe payouts: %w", err)
+	}
+
+	return payouts, nil
+}
+
+// BalanceTransactions lists what a Stripe payout paid out, with the payment
+// intent of each charge and refund. Stripe only links automatic payouts to
+// their transactions.
+func (p *StripeProvider) BalanceTransactions(ctx context.Context, payoutID string) ([]ProviderBalanceTransaction, error) {
+	params := &stripe.BalanceTransactionListParams{Payout: stripe.String(payoutID)}
+	params.Context = ctx
+	params.AddExpand("data.source")
+
+	transactions := []ProviderBalanceTransaction{}
+	i := balancetransaction.List(params)
+	for i.Next() {
+		bt := i.BalanceTransaction()
+		txn := ProviderBalanceTransaction{
+			ID:                bt.ID,
+			Type:              string(bt.Type),
+			ReportingCategory: string(bt.ReportingCategory),
+			Amount:            bt.Amount,
+			Fee:               bt.Fee,
+			Net:               bt.Net,
+			Currency:          string(bt.Currency),
+			Description:       bt.Description,
+			Created:           bt.Created,
+		}
+		if bt.Source != nil {
+			txn.Source = bt.Source.ID
+			switch {
+			case bt.Source.Charge != nil && bt.Source.Charge.PaymentIntent != nil:
+				txn.PaymentIntent = bt.Source.Charge.PaymentIntent.ID
+			case bt.Source.Refund != nil && bt.Source.Refund.PaymentIntent != nil:
+				txn.PaymentIntent = bt.Source.Refund.PaymentIntent.ID
+			}
+		}
+		transactions = append(transactions, txn)
+	}
+	if err := i.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list Stripe balance transactions for payout %s: %w", payoutID, err)
+	}
+
+	return transactions, nil
+}
+
+// FixtureProvider serves payouts from a JSON file shaped like Stripe's
+// objects: {"payouts": [{"id": "po_...", "amount": 1000, ..., "transactions": [...]}]}
+type FixtureProvider struct {
+	payouts []fixturePayout
+}
+
+type fixturePayout struct {
+	ProviderPayout
+	Transactions []ProviderBalanceTransaction `json:"transactions"`
+}
+
+// NewFixtureProvider loads a fixture file
+func NewFixtureProvider(path string) (*FixtureProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payout fixture: %w", err)
+	}
+
+	var fixture struct {
+		Payouts []fixturePayout `json:"payouts"`
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse payout fixture %s: %w", path, err)
+	}
+
+	return &FixtureProvider{payouts: fixture.Payouts}, nil
+}
+
+// Payouts lists the fixture payouts that arrived in the period
+func (p *FixtureProvider) Payouts(ctx context.Context, from, to time.Time) ([]ProviderPayout, error) {
+	payouts := []ProviderPayout{}
+	for _, po := range p.payouts {
+		arrival := time.Unix(po.ArrivalDate, 0)
+		if (!from.IsZero() && arrival.Before(from)) || (!to.IsZero() && arrival.After(to)) {
+			continue
+		}
+		payouts = append(payouts, po.ProviderPayout)
+	}
+	return payouts, nil
+}
+
+// BalanceTransactions lists a fixture payout's transactions
+func (p *FixtureProvider) BalanceTransactions(ctx context.Context, payoutID string) ([]ProviderBalanceTransaction, error) {
+	for _, po := range p.payouts {
+		if po.ID == payoutID {
+			return po.Transactions, nil
+		}
+	}
+	return nil, fmt.Errorf("payout %s not in fixture", payoutID)
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PayoutService ties payment provider payouts back to orders: it imports
+// the balance transactions of each payout, matches them to orders by
+// payment intent, records the fees and net amount on each order and
+// reports what didn't match. Payouts are account-wide, so they span domains.
+type PayoutService struct {
+	db       *database.MongoDB
+	provider PaymentProvider
+}
+
+func NewPayoutService(db *database.MongoDB, provider PaymentProvider) *PayoutService {
+	return &PayoutService{db: db, provider: provider}
+}
+
+// Import fetches the payouts that arrived in the period and reconciles
+// their transactions. Importing a payout again updates it.
+func (s *PayoutService) Import(ctx context.Context, from, to time.Time) ([]models.StripePayout, error) {
+	payouts, err := s.provider.Payouts(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := []models.StripePayout{}
+	for _, po := range payouts {
+		payout, err := s.importPayout(ctx, po)
+		if err != nil {
+			return imported, err
+		}
+		imported = append(imported, *payout)
+	}
+
+	return imported, nil
+}
+
+// Report sums the imported payouts that arrived in the period and lists
+// their mismatched and unmatched transactions
+func (s *PayoutService) Report(ctx context.Context, from, to time.Time) (*models.PayoutReport, error) {
+	filter := bson.M{}
+	arrival := bson.M{}
+	if !from.IsZero() {
+		arrival["$gte"] = from
+	}
+	if !to.IsZero() {
+		arrival["$lte"] = to
+	}
+	if len(arrival) > 0 {
+		filter["arrival_date"] = arrival
+	}
+
+	opts := options.Find().SetSort(bson.M{"arrival_date": 1})
+	cursor, err := s.db.GetCollection("stripe_payouts").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payouts: %w", err)
+	}
+
+	report := &models.PayoutReport{Payouts: []models.StripePayout{}}
+	if err := cursor.All(ctx, &report.Payouts); err != nil {
+		return nil, fmt.Errorf("failed to decode payouts: %w", err)
+	}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+
+	payoutIDs := make([]string, 0, len(report.Payouts))
+	for _, payout := range report.Payouts {
+		payoutIDs = append(payoutIDs, payout.ID)
+		report.Amount += payout.Amount
+		report.Gross += payout.Gross
+		report.Fees += payout.Fees
+		report.Net += payout.Net
+		report.Matched += payout.Matched
+		report.Mismatched += payout.Mismatched
+		report.Unmatched += payout.Unmatched
+	}
+	report.Amount = roundCents(report.Amount)
+	report.Gross = roundCents(report.Gross)
+	report.Fees = roundCents(report.Fees)
+	report.Net = roundCents(report.Net)
+
+	cursor, err = s.db.GetCollection("balance_transactions").Find(ctx, bson.M{
+		"payout_id": bson.M{"$in": payoutIDs},
+		"status":    bson.M{"$ne": models.SettlementMatched},
+	}, options.Find().SetSort(bson.D{{Key: "payout_id", Value: 1}, {Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unmatched transactions: %w", err)
+	}
+
+	report.Problems = []models.BalanceTransaction{}
+	if err := cursor.All(ctx, &report.Problems); err != nil {
+		return nil, fmt.Errorf("failed to decode unmatched transactions: %w", err)
+	}
+
+	return report, nil
+}
+
+// importPayout saves a payout and its matched transactions, then updates
+// the settlement of every order involved
+func (s *PayoutService) importPayout(ctx context.Context, po ProviderPayout) (*models.StripePayout, error) {
+	transactions, err := s.provider.BalanceTransactions(ctx, po.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payout := &models.StripePayout{
+		ID:          po.ID,
+		Amount:      float64(po.Amount) / 100,
+		Currency:    strings.ToLower(po.Currency),
+		Status:      po.Status,
+		ArrivalDate: time.Unix(po.ArrivalDate, 0),
+		CreatedAt:   time.Unix(po.Created, 0),
+		ImportedAt:  now,
+	}
+
+	collection := s.db.GetCollection("balance_transactions")
+	orders := map[string]bool{}
+	for _, t := range transactions {
+		// The payout's own withdrawal from the balance
+		if t.Type == "payout" {
+			continue
+		}
+
+		txn := &models.BalanceTransaction{
+			ID:                t.ID,
+			PayoutID:          po.ID,
+			Type:              t.Type,
+			ReportingCategory: t.ReportingCategory,
+			SourceID:          t.Source,
+			PaymentIntentID:   t.PaymentIntent,
+			Amount:            float64(t.Amount) / 100,
+			Fee:               float64(t.Fee) / 100,
+			Net:               float64(t.Net) / 100,
+			Currency:          strings.ToLower(t.Currency),
+			Description:       t.Description,
+			CreatedAt:         time.Unix(t.Created, 0),
+			ImportedAt:        now,
+		}
+		if err := s.match(ctx, txn); err != nil {
+			return nil, err
+		}
+
+		_, err := collection.ReplaceOne(ctx, bson.M{"_id": txn.ID}, txn, options.Replace().SetUpsert(true))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save balance transaction %s: %w", txn.ID, err)
+		}
+
+		payout.Transactions++
+		payout.Gross += txn.Amount
+		payout.Fees += txn.Fee
+		payout.Net += txn.Net
+		switch txn.Status {
+		case models.SettlementMatched:
+			payout.Matched++
+		case models.SettlementMismatched:
+			payout.Mismatched++
+		default:
+			payout.Unmatched++
+		}
+		if txn.OrderID != "" {
+			orders[txn.OrderID] = true
+		}
+	}
+	payout.Gross = roundCents(payout.Gross)
+	payout.Fees = roundCents(payout.Fees)
+	payout.Net = roundCents(payout.Net)
+	payout.Difference = roundCents(payout.Amount - payout.Net)
+
+	_, err = s.db.GetCollection("stripe_payouts").ReplaceOne(ctx, bson.M{"_id": payout.ID}, payout, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save payout %s: %w", payout.ID, err)
+	}
+
+	for orderID := range orders {
+		if err := s.settle(ctx, orderID); err != nil {
+			return nil, err
+		}
+	}
+
+	return payout, nil
+}
+
+// match finds the order behind a transaction by payment intent (the
+// order's payment or an edit charge) and checks it against the order
+func (s *PayoutService) match(ctx context.Context, txn *models.BalanceTransaction) error {
+	if txn.PaymentIntentID == "" {
+		txn.Status = models.SettlementUnmatched
+		txn.Problem = fmt.Sprintf("%s has no payment intent", txn.Type)
+		return nil
+	}
+
+	var order models.Order
+	err := s.db.GetCollection("orders").FindOne(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"payment.payment_intent_id": txn.PaymentIntentID},
+			bson.M{"payment_adjustments.payment_intent_id": txn.PaymentIntentID},
+		},
+	}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		txn.Status = models.SettlementUnmatched
+		txn.Problem = fmt.Sprintf("no order for payment intent %s", txn.PaymentIntentID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find order for payment intent %s: %w", txn.PaymentIntentID, err)
+	}
+
+	txn.Domain = order.Domain
+	txn.OrderID = order.ID.Hex()
+	txn.OrderNumber = order.OrderNumber
+	txn.Status = models.SettlementMatched
+	if problem := settlementProblem(&order, txn); problem != "" {
+		txn.Status = models.SettlementMismatched
+		txn.Problem = problem
+	}
+
+	return nil
+}
+
+// settle sums an order's imported transactions onto the order
+func (s *PayoutService) settle(ctx context.Context, orderID string) error {
+	objectID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return fmt.Errorf("invalid order ID %s: %w", orderID, err)
+	}
+
+	cursor, err := s.db.GetCollection("balance_transactions").Find(ctx, bson.M{"order_id": orderID})
+	if err != nil {
+		return fmt.Errorf("failed to list balance transactions of order %s: %w", orderID, err)
+	}
+
+	var transactions []models.BalanceTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return fmt.Errorf("failed to decode balance transactions of order %s: %w", orderID, err)
+	}
+
+	settlement := models.OrderSettlement{PayoutIDs: []string{}, UpdatedAt: time.Now()}
+	payouts := map[string]bool{}
+	for _, txn := range transactions {
+		settlement.Gross += txn.Amount
+		settlement.Fees += txn.Fee
+		settlement.Net += txn.Net
+		settlement.Currency = txn.Currency
+		if !payouts[txn.PayoutID] {
+			payouts[txn.PayoutID] = true
+			settlement.PayoutIDs = append(settlement.PayoutIDs, txn.PayoutID)
+		}
+	}
+	settlement.Gross = roundCents(settlement.Gross)
+	settlement.Fees = roundCents(settlement.Fees)
+	settlement.Net = roundCents(settlement.Net)
+	sort.Strings(settlement.PayoutIDs)
+
+	_, err = s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{"settlement": settlement},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update settlement of order %s: %w", orderID, err)
+	}
+
+	return nil
+}
+
+// settlementProblem explains why a transaction doesn't agree with its
+// order, or returns "". Charges must match the payment or edit charge they
+// belong to, refunds a refund recorded on the order.
+func settlementProblem(order *models.Order, txn *models.BalanceTransaction) string {
+	if !strings.EqualFold(order.Payment.Currency, txn.Currency) {
+		return fmt.Sprintf("currency %s, order paid in %s", txn.Currency, order.Payment.Currency)
+	}
+
+	amount := int64(math.Round(txn.Amount * 100))
+	switch txn.Type {
+	case "charge", "payment":
+		if !isPaidOrder(order) {
+			return fmt.Sprintf("order is %s, not paid", order.Status)
+		}
+		expected := order.Payment.Amount
+		if txn.PaymentIntentID != order.Payment.PaymentIntentID {
+			for _, adjustment := range order.PaymentAdjustments {
+				if adjustment.PaymentIntentID == txn.PaymentIntentID {
+					expected = adjustment.Amount
+				}
+			}
+		}
+		if amount != expected {
+			return fmt.Sprintf("charged %.2f, order expects %.2f", txn.Amount, float64(expected)/100)
+		}
+
+	case "refund", "payment_refund":
+		for _, adjustment := range order.PaymentAdjustments {
+			if adjustment.Type == "refund" && adjustment.RefundID == txn.SourceID {
+				if -amount != adjustment.Amount {
+					return fmt.Sprintf("refunded %.2f, order recorded %.2f", -txn.Amount, float64(adjustment.Amount)/100)
+				}
+				return ""
+			}
+		}
+		return fmt.Sprintf("refund %s isn't recorded on the order", txn.SourceID)
+
+	default:
+		return fmt.Sprintf("unexpected %s transaction", txn.Type)
+	}
+
+	return ""
+}
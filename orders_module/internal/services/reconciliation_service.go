@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReconciliationService detects drift between the stock_transactions ledger
+// and variant stock in products_module, e.g. after stock was edited directly
+// through the products API
+type ReconciliationService struct {
+	db *database.MongoDB
+}
+
+func NewReconciliationService(db *database.MongoDB) *ReconciliationService {
+	return &ReconciliationService{db: db}
+}
+
+// ReconcileAll reconciles every domain that has products
+func (s *ReconciliationService) ReconcileAll(ctx context.Context, fix bool, createdBy string) ([]*models.StockReconciliation, error) {
+	domains, err := s.db.GetProductsCollection("products").Distinct(ctx, "domain", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	var reports []*models.StockReconciliation
+	for _, d := range domains {
+		domain, ok := d.(string)
+		if !ok || domain == "" {
+			continue
+		}
+		report, err := s.Reconcile(ctx, domain, fix, createdBy)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", domain, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// Reconcile replays the ledger of every variant in the domain and compares it
+// with catalog stock. With fix set, each discrepancy that is still there on a
+// second read gets an `adjustment` transaction that brings the ledger in line
+// with the catalog; catalog stock itself is never changed. The report is saved
+// to stock_reconciliations.
+func (s *ReconciliationService) Reconcile(ctx context.Context, domain string, fix bool, createdBy string) (*models.StockReconciliation, error) {
+	report := &models.StockReconciliation{
+		ID:            primitive.NewObjectID(),
+		Domain:        domain,
+		Discrepancies: []models.StockDiscrepancy{},
+		Fix:           fix,
+		CreatedBy:     createdBy,
+		StartedAt:     time.Now(),
+	}
+
+	ledger, err := ledgerBalances(ctx, s.db, bson.M{"domain": domain})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.db.GetProductsCollection("products").Find(ctx, bson.M{"domain": domain})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.CatalogProduct
+		if err := cursor.Decode(&product); err != nil {
+			return nil, fmt.Errorf("failed to decode product: %w", err)
+		}
+
+		for _, variant := range product.Variants {
+			report.VariantsChecked++
+
+			expected, ok := ledger[product.ID.Hex()+"/"+variant.ID]
+			if !ok {
+				report.UntrackedVariants++
+				continue
+			}
+
+			if variant.Stock == expected {
+				continue
+			}
+
+			report.Discrepancies = append(report.Discrepancies, models.StockDiscrepancy{
+				ProductID:    product.ID.Hex(),
+				ProductName:  product.Name,
+				VariantID:    variant.ID,
+				SKU:          variant.SKU,
+				LedgerStock:  expected,
+				CatalogStock: variant.Stock,
+				Difference:   variant.Stock - expected,
+			})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read products: %w", err)
+	}
+
+	if fix {
+		for i := range report.Discrepancies {
+			if err := s.correct(ctx, domain, &report.Discrepancies[i], createdBy); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	if _, err := s.db.GetCollection("stock_reconciliations").InsertOne(ctx, report); err != nil {
+		return nil, fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+
+	return report, nil
+}
+
+// ListReconciliations returns the most recent reports for a domain
+func (s *ReconciliationService) ListReconciliations(ctx context.Context, domain string, limit int64) ([]models.StockReconciliation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.db.GetCollection("stock_reconciliations").Find(ctx, bson.M{"domain": domain}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reconciliations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	reports := []models.StockReconciliation{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, fmt.Errorf("failed to decode reconciliations: %w", err)
+	}
+
+	return reports, nil
+}
+
+// RunScheduled reconciles all domains every interval until ctx is cancelled
+func (s *ReconciliationService) RunScheduled(ctx context.Context, interval time.Duration, fix bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reports, err := s.ReconcileAll(ctx, fix, "system")
+			if err != nil {
+				log.Printf("❌ Stock reconciliation failed: %v", err)
+			}
+			for _, report := range reports {
+				if len(report.Discrepancies) > 0 {
+					log.Printf("⚠️  Stock reconciliation for %s: %d of %d variants differ from the ledger", report.Domain, len(report.Discrepancies), report.VariantsChecked)
+				}
+			}
+		}
+	}
+}
+
+// correct re-checks a discrepancy and, if the ledger and catalog still
+// disagree, records an adjustment from the ledger stock to the catalog stock.
+// The re-check skips variants that only looked off because a sale landed
+// between reading the ledger and the catalog.
+func (s *ReconciliationService) correct(ctx context.Context, domain string, d *models.StockDiscrepancy, createdBy string) error {
+	productID, err := primitive.ObjectIDFromHex(d.ProductID)
+	if err != nil {
+		return fmt.Errorf("invalid product ID %s: %w", d.ProductID, err)
+	}
+
+	ledger, err := ledgerBalances(ctx, s.db, bson.M{"domain": domain, "product_id": d.ProductID, "variant_id": d.VariantID})
+	if err != nil {
+		return err
+	}
+
+	var product models.CatalogProduct
+	err = s.db.GetProductsCollection("products").FindOne(ctx, bson.M{"_id": productID, "domain": domain}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+
+	variant := product.FindVariant(d.VariantID)
+	expected, ok := ledger[d.ProductID+"/"+d.VariantID]
+	if variant == nil || !ok {
+		return nil
+	}
+
+	if variant.Stock == expected {
+		return nil
+	}
+
+	tx := models.StockTransaction{
+		ID:          primitive.NewObjectID(),
+		Domain:      domain,
+		ProductID:   d.ProductID,
+		VariantID:   d.VariantID,
+		Type:        "adjustment",
+		Quantity:    variant.Stock - expected,
+		StockBefore: expected,
+		StockAfter:  variant.Stock,
+		CreatedBy:   createdBy,
+		Reason:      "Reconciliation: catalog stock differs from ledger",
+		CreatedAt:   time.Now(),
+	}
+
+	if _, err := s.db.GetCollection("stock_transactions").InsertOne(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create stock transaction: %w", err)
+	}
+
+	d.LedgerStock = expected
+	d.CatalogStock = variant.Stock
+	d.Difference = tx.Quantity
+	d.TransactionID = tx.ID.Hex()
+	return nil
+}
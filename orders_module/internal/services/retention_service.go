@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidRetention is returned when a retention policy or anonymization request is rejected
+var ErrInvalidRetention = errors.New("invalid retention request")
+
+// anonymizedFields are the order fields anonymization scrubs, as listed in
+// the audit. Totals, items, payments and the state and country of the
+// addresses (tax reporting) are kept.
+var anonymizedFields = []string{
+	"customer",
+	"shipping_address",
+	"billing_address",
+	"notes",
+	"items.gift_card",
+	"risk.email",
+	"risk.ip",
+	"risk.card_fingerprint",
+}
+
+// anonymizeUntouched are the collections an anonymization request leaves as
+// they are, as listed in the audit: they're still needed to run the
+// customer's subscriptions, drafts, gift cards and saved cards, and are
+// removed with the customer's account
+var anonymizeUntouched = []string{
+	"subscriptions",
+	"draft_orders",
+	"gift_cards",
+	"payment_customers",
+}
+
+// anonymizeBatchSize is how many orders are scrubbed per update
+const anonymizeBatchSize = 500
+
+// RetentionService anonymizes customer details on orders: on a schedule for
+// orders older than a domain's retention period, and on demand for a
+// customer who asks to be forgotten. Every run leaves an audit record.
+type RetentionService struct {
+	db       *database.MongoDB
+	profiles *CustomerProfileService
+}
+
+func NewRetentionService(db *database.MongoDB) *RetentionService {
+	return &RetentionService{
+		db:       db,
+		profiles: NewCustomerProfileService(db),
+	}
+}
+
+// GetSettings returns a domain's retention policy, or the default (disabled)
+func (s *RetentionService) GetSettings(ctx context.Context, domain string) (*models.RetentionSettings, error) {
+	var settings models.RetentionSettings
+	err := s.db.GetCollection("retention_settings").FindOne(ctx, bson.M{"_id": domain}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultRetentionSettings(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings validates and saves a domain's retention policy
+func (s *RetentionService) UpdateSettings(ctx context.Context, req *models.UpdateRetentionSettingsRequest, domain, updatedBy string) (*models.RetentionSettings, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.AnonymizeAfterYears != nil {
+		settings.AnonymizeAfterYears = *req.AnonymizeAfterYears
+	}
+
+	if settings.AnonymizeAfterYears < 1 || settings.AnonymizeAfterYears > 100 {
+		return nil, fmt.Errorf("%w: anonymize_after_years must be between 1 and 100", ErrInvalidRetention)
+	}
+
+	settings.UpdatedBy = updatedBy
+	settings.UpdatedAt = time.Now()
+
+	_, err = s.db.GetCollection("retention_settings").ReplaceOne(ctx, bson.M{"_id": domain}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save retention settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// ApplyRetention anonymizes a domain's orders placed before its retention
+// period. The audit is only saved when orders were scrubbed.
+func (s *RetentionService) ApplyRetention(ctx context.Context, domain, actor string) (*models.AnonymizationAudit, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, fmt.Errorf("%w: no retention policy is enabled for %s", ErrInvalidRetention, domain)
+	}
+
+	cutoff := time.Now().AddDate(-settings.AnonymizeAfterYears, 0, 0)
+	audit := &models.AnonymizationAudit{
+		Domain:    domain,
+		Trigger:   models.AnonymizationRetention,
+		Cutoff:    &cutoff,
+		CreatedBy: actor,
+	}
+
+	filter := bson.M{
+		"domain":     domain,
+		"created_at": bson.M{"$lt": cutoff},
+	}
+	if err := s.anonymize(ctx, filter, audit); err != nil {
+		return nil, err
+	}
+
+	if audit.Orders > 0 {
+		if err := s.saveAudit(ctx, audit); err != nil {
+			return nil, err
+		}
+	}
+
+	return audit, nil
+}
+
+// AnonymizeCustomer scrubs a customer's details from every order placed
+// with their email (in any case), guest or logged in, and removes their
+// customer profiles and the saved addresses of the accounts that placed
+// those orders. The request is audited even when no orders matched.
+func (s *RetentionService) AnonymizeCustomer(ctx context.Context, req *models.AnonymizeCustomerRequest, domain, actor string) (*models.AnonymizationAudit, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, fmt.Errorf("%w: a valid email is required", ErrInvalidRetention)
+	}
+
+	hash := sha256.Sum256([]byte(email))
+	audit := &models.AnonymizationAudit{
+		Domain:    domain,
+		Trigger:   models.AnonymizationRequest,
+		EmailHash: hex.EncodeToString(hash[:]),
+		Reason:    strings.TrimSpace(req.Reason),
+		CreatedBy: actor,
+	}
+
+	emailPattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"}
+	filter := bson.M{
+		"domain":         domain,
+		"customer.email": emailPattern,
+	}
+
+	// The accounts are looked up first: anonymizing clears the orders' user IDs
+	userIDs, err := s.customerUserIDs(ctx, domain, emailPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.anonymize(ctx, filter, audit); err != nil {
+		return nil, err
+	}
+	if err := s.removeCustomerData(ctx, domain, email, emailPattern, userIDs, audit); err != nil {
+		return nil, err
+	}
+
+	if err := s.saveAudit(ctx, audit); err != nil {
+		return nil, err
+	}
+
+	return audit, nil
+}
+
+// RunScheduled applies every enabled retention policy every interval until ctx is cancelled
+func (s *RetentionService) RunScheduled(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.applyAll(ctx)
+		}
+	}
+}
+
+// ListAudits lists a domain's anonymization audits, newest first (trigger narrows it)
+func (s *RetentionService) ListAudits(ctx context.Context, domain, trigger string, limit int64) ([]models.AnonymizationAudit, error) {
+	filter := bson.M{"domain": domain}
+	if trigger != "" {
+		filter["trigger"] = trigger
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := s.db.GetCollection("anonymization_audits").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anonymization audits: %w", err)
+	}
+
+	audits := []models.AnonymizationAudit{}
+	if err := cursor.All(ctx, &audits); err != nil {
+		return nil, fmt.Errorf("failed to decode anonymization audits: %w", err)
+	}
+
+	return audits, nil
+}
+
+// applyAll applies the retention policy of every domain that enabled one
+func (s *RetentionService) applyAll(ctx context.Context) {
+	cursor, err := s.db.GetCollection("retention_settings").Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		log.Printf("❌ Retention: failed to list policies: %v", err)
+		return
+	}
+
+	var policies []models.RetentionSettings
+	if err := cursor.All(ctx, &policies); err != nil {
+		log.Printf("❌ Retention: failed to decode policies: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		audit, err := s.ApplyRetention(ctx, policy.Domain, "system")
+		if err != nil {
+			log.Printf("❌ Retention for %s failed: %v", policy.Domain, err)
+			continue
+		}
+		if audit.Orders > 0 {
+			log.Printf("🧹 Retention for %s: anonymized %d orders placed before %s", policy.Domain, audit.Orders, audit.Cutoff.Format("2006-01-02"))
+		}
+	}
+}
+
+// anonymize scrubs the orders matching filter that weren't anonymized yet,
+// in batches, then recomputes the profiles of the customers involved
+// (removing the ones left without orders). The audit gets the order numbers.
+func (s *RetentionService) anonymize(ctx context.Context, filter bson.M, audit *models.AnonymizationAudit) error {
+	collection := s.db.GetCollection("orders")
+	filter["anonymized_at"] = bson.M{"$exists": false}
+
+	audit.OrderNumbers = []string{}
+	audit.Fields = anonymizedFields
+	customers := map[string]bool{}
+
+	findOpts := options.Find().
+		SetProjection(bson.M{"order_number": 1, "customer": 1}).
+		SetLimit(anonymizeBatchSize)
+	updateOpts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"gift.gift_card": bson.M{"$type": "object"}}},
+	})
+
+	for {
+		cursor, err := collection.Find(ctx, filter, findOpts)
+		if err != nil {
+			return fmt.Errorf("failed to find orders to anonymize: %w", err)
+		}
+
+		var orders []models.Order
+		if err := cursor.All(ctx, &orders); err != nil {
+			return fmt.Errorf("failed to decode orders to anonymize: %w", err)
+		}
+		if len(orders) == 0 {
+			break
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+			audit.OrderNumbers = append(audit.OrderNumbers, order.OrderNumber)
+			if key := couponCustomerKey(order.Customer); key != "" {
+				customers[key] = true
+			}
+		}
+
+		_, err = collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, anonymizeUpdate(time.Now()), updateOpts)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize orders: %w", err)
+		}
+		audit.Orders += len(orders)
+
+		if len(orders) < anonymizeBatchSize {
+			break
+		}
+	}
+
+	for key := range customers {
+		if err := s.profiles.refresh(ctx, audit.Domain, key); err != nil {
+			return err
+		}
+	}
+	audit.Profiles = len(customers)
+
+	return nil
+}
+
+// customerUserIDs returns the accounts that placed orders with an email or
+// have a profile under it
+func (s *RetentionService) customerUserIDs(ctx context.Context, domain string, emailPattern primitive.Regex) ([]string, error) {
+	seen := map[string]bool{}
+
+	ids, err := s.db.GetCollection("orders").Distinct(ctx, "customer.user_id", bson.M{
+		"domain":         domain,
+		"customer.email": emailPattern,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find customer accounts: %w", err)
+	}
+	profileIDs, err := s.db.GetCollection("customer_profiles").Distinct(ctx, "user_id", bson.M{
+		"domain": domain,
+		"email":  emailPattern,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find customer accounts: %w", err)
+	}
+
+	userIDs := []string{}
+	for _, id := range append(ids, profileIDs...) {
+		if userID, ok := id.(string); ok && userID != "" && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// removeCustomerData deletes what is left of a customer after their orders
+// are anonymized: profiles under their email or accounts (refreshing them
+// only removes the ones left without orders) and the accounts' saved
+// addresses. The audit counts them and lists the collections left alone.
+func (s *RetentionService) removeCustomerData(ctx context.Context, domain, email string, emailPattern primitive.Regex, userIDs []string, audit *models.AnonymizationAudit) error {
+	result, err := s.db.GetCollection("customer_profiles").DeleteMany(ctx, bson.M{
+		"domain": domain,
+		"$or": bson.A{
+			bson.M{"key": "email:" + email},
+			bson.M{"email": emailPattern},
+			bson.M{"user_id": bson.M{"$in": userIDs}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove customer profiles: %w", err)
+	}
+	audit.Profiles += int(result.DeletedCount)
+
+	if len(userIDs) > 0 {
+		result, err = s.db.GetCollection("addresses").DeleteMany(ctx, bson.M{
+			"domain":  domain,
+			"user_id": bson.M{"$in": userIDs},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove saved addresses: %w", err)
+		}
+		audit.Addresses = int(result.DeletedCount)
+	}
+
+	audit.Untouched = anonymizeUntouched
+	return nil
+}
+
+// saveAudit records an anonymization
+func (s *RetentionService) saveAudit(ctx context.Context, audit *models.AnonymizationAudit) error {
+	audit.CreatedAt = time.Now()
+
+	result, err := s.db.GetCollection("anonymization_audits").InsertOne(ctx, audit)
+	if err != nil {
+		return fmt.Errorf("failed to save anonymization audit: %w", err)
+	}
+	audit.ID = result.InsertedID.(primitive.ObjectID)
+
+	return nil
+}
+
+// anonymizeUpdate blanks the required customer and address fields and
+// removes the optional ones. Gift card recipients are matched by the "gift"
+// array filter.
+func anonymizeUpdate(now time.Time) bson.M {
+	set := bson.M{
+		"customer.email": "",
+		"customer.name":  "",
+		"anonymized_at":  now,
+		"updated_at":     now,
+	}
+	unset := bson.M{
+		"customer.user_id":                "",
+		"notes":                           "",
+		"items.$[gift].gift_card.email":   "",
+		"items.$[gift].gift_card.name":    "",
+		"items.$[gift].gift_card.sender":  "",
+		"items.$[gift].gift_card.message": "",
+		"risk.email":                      "",
+		"risk.ip":                         "",
+		"risk.card_fingerprint":           "",
+	}
+	for _, address := range []string{"shipping_address", "billing_address"} {
+		for _, field := range []string{"name", "address_line1", "city", "postal_code"} {
+			set[address+"."+field] = ""
+		}
+		unset[address+".address_line2"] = ""
+		unset[address+".phone"] = ""
+	}
+
+	return bson.M{"$set": set, "$unset": unset}
+}
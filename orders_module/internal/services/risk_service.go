@@ -0,0 +1,828 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/stripe/stripe-go/v81/paymentmethod"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrOrderRejected is returned when the risk checks reject an order
+var ErrOrderRejected = errors.New("order rejected by risk checks")
+
+// ErrInvalidRiskSettings is returned when risk settings or a blocklist entry are rejected
+var ErrInvalidRiskSettings = errors.New("invalid risk settings")
+
+// ErrNotUnderReview is returned when approving/rejecting an order that isn't awaiting review
+var ErrNotUnderReview = errors.New("order is not awaiting risk review")
+
+// RiskInput is what a risk check sees of an order attempt
+type RiskInput struct {
+	Order           *models.Order
+	IP              string
+	CardFingerprint string // Only set for CardCheck, once Stripe has authorized the card
+	Settings        *models.RiskSettings
+}
+
+// RiskCheck is one step of the risk pipeline. It returns nil when the order
+// passes, or a result with the action to take.
+type RiskCheck interface {
+	Name() string
+	Check(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error)
+}
+
+// CardCheck is implemented by checks that also screen the card. The card is
+// only known once Stripe authorizes the payment, so ScreenCard runs these then.
+type CardCheck interface {
+	CheckCard(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error)
+}
+
+// RiskService runs the risk check pipeline before orders are placed and
+// handles manual review of flagged orders
+type RiskService struct {
+	db        *database.MongoDB
+	checks    []RiskCheck
+	webhooks  *WebhookService
+	loyalty   *LoyaltyService
+	giftCards *GiftCardService
+	coupons   *CouponService
+	invites   *InvitationDiscountService
+	payments  *StripeService
+}
+
+func NewRiskService(db *database.MongoDB) *RiskService {
+	return NewStripeService(db, "").risk
+}
+
+// newRiskService builds the pipeline; approved orders are marked paid
+// through payments
+func newRiskService(db *database.MongoDB, payments *StripeService) *RiskService {
+	return &RiskService{
+		db: db,
+		checks: []RiskCheck{
+			&blocklistCheck{db: db},
+			&orderTotalCheck{},
+			&countryMismatchCheck{},
+			&velocityCheck{db: db},
+		},
+		webhooks:  NewWebhookService(db),
+		loyalty:   NewLoyaltyService(db),
+		giftCards: NewGiftCardService(db, nil),
+		coupons:   NewCouponService(db),
+		invites:   NewInvitationDiscountService(db),
+		payments:  payments,
+	}
+}
+
+// Register adds a check to the end of the pipeline
+func (s *RiskService) Register(check RiskCheck) {
+	s.checks = append(s.checks, check)
+}
+
+// Assess runs every check against an order attempt. The decision is the most
+// severe action any check returned. A failing check is logged and skipped so
+// an outage doesn't block checkout. When the domain has card rules the card
+// checks are left pending for ScreenCard.
+func (s *RiskService) Assess(ctx context.Context, order *models.Order, ip string) (*models.RiskAssessment, error) {
+	settings, err := s.GetSettings(ctx, order.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &RiskInput{
+		Order:    order,
+		IP:       ip,
+		Settings: settings,
+	}
+
+	assessment := &models.RiskAssessment{
+		Decision:   models.RiskActionAllow,
+		Email:      normalizeBlocklistValue("email", order.Customer.Email),
+		IP:         in.IP,
+		AssessedAt: time.Now(),
+	}
+
+	for _, check := range s.checks {
+		result, err := check.Check(ctx, in)
+		if err != nil {
+			log.Printf("ERROR: Risk check %s failed for %s: %v", check.Name(), order.Domain, err)
+			continue
+		}
+		if result == nil || result.Action == models.RiskActionAllow {
+			continue
+		}
+
+		assessment.Checks = append(assessment.Checks, *result)
+		if riskSeverity(result.Action) > riskSeverity(assessment.Decision) {
+			assessment.Decision = result.Action
+		}
+	}
+
+	if assessment.Decision == models.RiskActionReview {
+		assessment.ReviewStatus = "pending"
+	}
+
+	screens, err := s.screensCards(ctx, settings, order.Domain)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up card rules for %s: %v", order.Domain, err)
+	} else if screens {
+		assessment.CardCheck = "pending"
+	}
+
+	if assessment.Decision == models.RiskActionReject {
+		rejection := models.RiskRejection{
+			Domain:     order.Domain,
+			Email:      order.Customer.Email,
+			Total:      order.Total,
+			Assessment: *assessment,
+			CreatedAt:  assessment.AssessedAt,
+		}
+		if _, err := s.db.GetCollection("risk_rejections").InsertOne(ctx, rejection); err != nil {
+			log.Printf("ERROR: Failed to record risk rejection for %s: %v", order.Domain, err)
+		}
+	}
+
+	return assessment, nil
+}
+
+// screensCards reports whether the domain has card rules: a card velocity
+// limit or a blocked card
+func (s *RiskService) screensCards(ctx context.Context, settings *models.RiskSettings, domain string) (bool, error) {
+	for _, rule := range settings.Velocity {
+		if rule.Key == "card" {
+			return true, nil
+		}
+	}
+
+	count, err := s.db.GetCollection("risk_blocklist").CountDocuments(ctx,
+		bson.M{"domain": domain, "type": "card"},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to count blocked cards: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ScreenCard runs the card checks on the card Stripe authorized for an
+// order's payment. Orders with pending card checks are paid with manual
+// capture, so the payment is captured here when the card passes, left
+// authorized for review when a check asks for one, or cancelled together
+// with the order on a reject. Only the first call for an order does anything.
+func (s *RiskService) ScreenCard(ctx context.Context, order *models.Order, pi *stripe.PaymentIntent) error {
+	if order.Risk == nil || order.Risk.CardCheck != "pending" {
+		return nil
+	}
+
+	settings, err := s.GetSettings(ctx, order.Domain)
+	if err != nil {
+		return err
+	}
+
+	in := &RiskInput{
+		Order:    order,
+		IP:       order.Risk.IP,
+		Settings: settings,
+	}
+	if pi.PaymentMethod != nil {
+		pm, err := paymentmethod.Get(pi.PaymentMethod.ID, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get payment method %s: %w", pi.PaymentMethod.ID, err)
+		}
+		if pm.Card != nil {
+			in.CardFingerprint = pm.Card.Fingerprint
+		}
+	}
+
+	decision := order.Risk.Decision
+	var flagged []models.RiskCheckResult
+	if in.CardFingerprint != "" {
+		for _, check := range s.checks {
+			cardCheck, ok := check.(CardCheck)
+			if !ok {
+				continue
+			}
+			result, err := cardCheck.CheckCard(ctx, in)
+			if err != nil {
+				log.Printf("ERROR: Card check %s failed for %s: %v", check.Name(), order.Domain, err)
+				continue
+			}
+			if result == nil || result.Action == models.RiskActionAllow {
+				continue
+			}
+
+			flagged = append(flagged, *result)
+			if riskSeverity(result.Action) > riskSeverity(decision) {
+				decision = result.Action
+			}
+		}
+	}
+
+	// A new review flag holds the payment even if an admin already approved
+	// the order's first assessment
+	set := bson.M{
+		"risk.decision":         decision,
+		"risk.card_fingerprint": in.CardFingerprint,
+		"risk.card_check":       "done",
+		"updated_at":            time.Now(),
+	}
+	reviewStatus := order.Risk.ReviewStatus
+	if decision == models.RiskActionReview && len(flagged) > 0 {
+		reviewStatus = "pending"
+		set["risk.review_status"] = reviewStatus
+	}
+	if decision == models.RiskActionReject {
+		set["status"] = "cancelled"
+		set["payment.status"] = "cancelled"
+	}
+	if flagged == nil {
+		flagged = []models.RiskCheckResult{}
+	}
+
+	var updated models.Order
+	err = s.db.GetCollection("orders").FindOneAndUpdate(ctx,
+		bson.M{"_id": order.ID, "risk.card_check": "pending", "status": "pending"},
+		bson.M{
+			"$set": set,
+			"$push": bson.M{
+				"risk.checks": bson.M{"$each": flagged},
+				"history":     newOrderEvent("risk_check", fmt.Sprintf("Card checks: %s", decision), "system", nil),
+			},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	switch {
+	case decision == models.RiskActionReject:
+		params := &stripe.PaymentIntentCancelParams{
+			CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonFraudulent)),
+		}
+		if _, err := paymentintent.Cancel(pi.ID, params); err != nil {
+			log.Printf("ERROR: Failed to cancel payment intent %s of rejected order %s: %v", pi.ID, updated.OrderNumber, err)
+		}
+		s.releaseOrder(ctx, &updated, "system")
+	case reviewStatus == "pending":
+		// Captured by ApproveReview
+	default:
+		if _, err := paymentintent.Capture(pi.ID, nil); err != nil {
+			// Leave it to an admin: ApproveReview captures the payment
+			log.Printf("ERROR: Failed to capture payment of order %s, holding it for review: %v", updated.OrderNumber, err)
+			if _, err := s.db.GetCollection("orders").UpdateOne(ctx,
+				bson.M{"_id": updated.ID},
+				bson.M{"$set": bson.M{"risk.review_status": "pending"}},
+			); err != nil {
+				return fmt.Errorf("failed to hold order for review: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetSettings returns the domain's risk settings, or the defaults
+func (s *RiskService) GetSettings(ctx context.Context, domain string) (*models.RiskSettings, error) {
+	var settings models.RiskSettings
+	err := s.db.GetCollection("risk_settings").FindOne(ctx, bson.M{"_id": domain}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.DefaultRiskSettings(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get risk settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings validates and saves a domain's risk settings
+func (s *RiskService) UpdateSettings(ctx context.Context, req *models.UpdateRiskSettingsRequest, domain, updatedBy string) (*models.RiskSettings, error) {
+	settings, err := s.GetSettings(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.MaxOrderTotal != nil {
+		settings.MaxOrderTotal = *req.MaxOrderTotal
+	}
+	if req.MaxOrderTotalAction != nil {
+		settings.MaxOrderTotalAction = *req.MaxOrderTotalAction
+	}
+	if req.CountryMismatchAction != nil {
+		settings.CountryMismatchAction = *req.CountryMismatchAction
+	}
+	if req.BlocklistAction != nil {
+		settings.BlocklistAction = *req.BlocklistAction
+	}
+	if req.Velocity != nil {
+		settings.Velocity = req.Velocity
+	}
+
+	var problems []string
+	if settings.MaxOrderTotal < 0 {
+		problems = append(problems, "max_order_total can't be negative")
+	}
+	if !isRiskAction(settings.MaxOrderTotalAction, false) {
+		problems = append(problems, "max_order_total_action must be review or reject")
+	}
+	if !isRiskAction(settings.CountryMismatchAction, true) {
+		problems = append(problems, "country_mismatch_action must be allow, review or reject")
+	}
+	if !isRiskAction(settings.BlocklistAction, false) {
+		problems = append(problems, "blocklist_action must be review or reject")
+	}
+	for i, rule := range settings.Velocity {
+		if rule.Key != "email" && rule.Key != "ip" && rule.Key != "card" {
+			problems = append(problems, fmt.Sprintf("velocity[%d].key must be email, ip or card", i))
+		}
+		if rule.MaxOrders < 1 {
+			problems = append(problems, fmt.Sprintf("velocity[%d].max_orders must be at least 1", i))
+		}
+		if rule.WindowMinutes < 1 {
+			problems = append(problems, fmt.Sprintf("velocity[%d].window_minutes must be at least 1", i))
+		}
+		if !isRiskAction(rule.Action, false) {
+			problems = append(problems, fmt.Sprintf("velocity[%d].action must be review or reject", i))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRiskSettings, strings.Join(problems, "; "))
+	}
+
+	settings.UpdatedBy = updatedBy
+	settings.UpdatedAt = time.Now()
+
+	_, err = s.db.GetCollection("risk_settings").ReplaceOne(ctx, bson.M{"_id": domain}, settings, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save risk settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// AddBlocklistEntry blocks an email, IP, card fingerprint or shipping country
+func (s *RiskService) AddBlocklistEntry(ctx context.Context, req *models.CreateBlocklistEntryRequest, domain, createdBy string) (*models.BlocklistEntry, error) {
+	value := normalizeBlocklistValue(req.Type, req.Value)
+	switch req.Type {
+	case "email", "ip", "card", "country":
+	default:
+		return nil, fmt.Errorf("%w: type must be email, ip, card or country", ErrInvalidRiskSettings)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%w: value is required", ErrInvalidRiskSettings)
+	}
+
+	entry := &models.BlocklistEntry{
+		ID:        primitive.NewObjectID(),
+		Domain:    domain,
+		Type:      req.Type,
+		Value:     value,
+		Reason:    req.Reason,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.db.GetCollection("risk_blocklist").InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: %s %s is already blocked", ErrInvalidRiskSettings, req.Type, value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blocklist entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// ListBlocklist lists a domain's blocklist, optionally for one type
+func (s *RiskService) ListBlocklist(ctx context.Context, domain, entryType string) ([]models.BlocklistEntry, error) {
+	filter := bson.M{"domain": domain}
+	if entryType != "" {
+		filter["type"] = entryType
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.db.GetCollection("risk_blocklist").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocklist: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.BlocklistEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode blocklist: %w", err)
+	}
+
+	return entries, nil
+}
+
+// DeleteBlocklistEntry unblocks a value
+func (s *RiskService) DeleteBlocklistEntry(ctx context.Context, entryID, domain string) error {
+	objectID, err := primitive.ObjectIDFromHex(entryID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid blocklist entry ID", ErrInvalidRiskSettings)
+	}
+
+	result, err := s.db.GetCollection("risk_blocklist").DeleteOne(ctx, bson.M{"_id": objectID, "domain": domain})
+	if err != nil {
+		return fmt.Errorf("failed to delete blocklist entry: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: blocklist entry not found", ErrInvalidRiskSettings)
+	}
+
+	return nil
+}
+
+// ListReviews lists orders waiting for a risk review, oldest first
+func (s *RiskService) ListReviews(ctx context.Context, domain string, limit int64) ([]*models.Order, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := s.db.GetCollection("orders").Find(ctx, bson.M{
+		"domain":             domain,
+		"risk.review_status": "pending",
+		"status":             bson.M{"$ne": "cancelled"},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list risk reviews: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	orders := []*models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// ListRejections lists recently rejected order attempts
+func (s *RiskService) ListRejections(ctx context.Context, domain string, limit int64) ([]models.RiskRejection, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.db.GetCollection("risk_rejections").Find(ctx, bson.M{"domain": domain}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list risk rejections: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	rejections := []models.RiskRejection{}
+	if err := cursor.All(ctx, &rejections); err != nil {
+		return nil, fmt.Errorf("failed to decode risk rejections: %w", err)
+	}
+
+	return rejections, nil
+}
+
+// ApproveReview releases a flagged order. An authorized payment is captured
+// now; if the customer hasn't paid yet the payment intent is switched back to
+// automatic capture, unless the card still has to be screened when it is
+// authorized. The order becomes paid through the usual webhook, or
+// right away when gift cards paid for all of it. A hosted Checkout Session
+// has to be completed by the customer before the order can be approved.
+func (s *RiskService) ApproveReview(ctx context.Context, orderID, domain, actor, note string) (*models.Order, error) {
+	order, err := s.getReviewOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Payment.PaymentIntentID == "" && order.Payment.CheckoutSessionID != "" {
+		return nil, fmt.Errorf("%w: the customer hasn't paid on the Checkout page yet", ErrCheckoutIncomplete)
+	}
+
+	// Paid entirely with gift cards: the balances were held until now
+	if order.Payment.PaymentIntentID == "" {
+		updated, err := s.finishReview(ctx, order, "approved", actor, note, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.payments.MarkOrderPaid(ctx, updated); err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+
+	pi, err := paymentintent.Get(order.Payment.PaymentIntentID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment intent: %w", err)
+	}
+
+	switch pi.Status {
+	case stripe.PaymentIntentStatusRequiresCapture:
+		if _, err := paymentintent.Capture(pi.ID, nil); err != nil {
+			return nil, fmt.Errorf("failed to capture payment: %w", err)
+		}
+	case stripe.PaymentIntentStatusRequiresPaymentMethod, stripe.PaymentIntentStatusRequiresConfirmation, stripe.PaymentIntentStatusRequiresAction:
+		if order.Risk.CardCheck == "pending" {
+			// ScreenCard captures it once the card passes
+			break
+		}
+		params := &stripe.PaymentIntentParams{
+			CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodAutomatic)),
+		}
+		if _, err := paymentintent.Update(pi.ID, params); err != nil {
+			return nil, fmt.Errorf("failed to update payment intent: %w", err)
+		}
+	}
+
+	return s.finishReview(ctx, order, "approved", actor, note, bson.M{})
+}
+
+// RejectReview cancels a flagged order and releases the authorized payment,
+// redeemed points and gift card balances
+func (s *RiskService) RejectReview(ctx context.Context, orderID, domain, actor, note string) (*models.Order, error) {
+	order, err := s.getReviewOrder(ctx, orderID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Payment.PaymentIntentID != "" {
+		params := &stripe.PaymentIntentCancelParams{
+			CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonFraudulent)),
+		}
+		if _, err := paymentintent.Cancel(order.Payment.PaymentIntentID, params); err != nil {
+			return nil, fmt.Errorf("failed to cancel payment intent: %w", err)
+		}
+	} else if order.Payment.CheckoutSessionID != "" {
+		// Not paid yet: close the Checkout page
+		if _, err := session.Expire(order.Payment.CheckoutSessionID, nil); err != nil {
+			return nil, fmt.Errorf("failed to expire checkout session: %w", err)
+		}
+	}
+
+	updated, err := s.finishReview(ctx, order, "rejected", actor, note, bson.M{
+		"status":         "cancelled",
+		"payment.status": "cancelled",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.releaseOrder(ctx, updated, actor)
+	return updated, nil
+}
+
+// releaseOrder announces a rejected order's cancellation and gives back its
+// redeemed points, gift card balances, coupon and invitation discount
+func (s *RiskService) releaseOrder(ctx context.Context, order *models.Order, actor string) {
+	s.webhooks.Dispatch(ctx, models.WebhookEventOrderCancelled, order)
+	if err := s.loyalty.RestoreRedemption(ctx, order, actor); err != nil {
+		log.Printf("ERROR: Failed to restore loyalty points for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.giftCards.RestoreRedemptions(ctx, order, actor); err != nil {
+		log.Printf("ERROR: Failed to restore gift card balances for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.coupons.Release(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to release coupon for order %s: %v", order.OrderNumber, err)
+	}
+	if err := s.invites.Release(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to release invitation discount for order %s: %v", order.OrderNumber, err)
+	}
+}
+
+// getReviewOrder loads an order that is waiting for a risk review
+func (s *RiskService) getReviewOrder(ctx context.Context, orderID, domain string) (*models.Order, error) {
+	objectID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	var order models.Order
+	err = s.db.GetCollection("orders").FindOne(ctx, bson.M{"_id": objectID, "domain": domain}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.Risk == nil || order.Risk.ReviewStatus != "pending" || order.Status == "cancelled" {
+		return nil, ErrNotUnderReview
+	}
+
+	return &order, nil
+}
+
+// finishReview records the review outcome on the order. The review_status
+// filter makes sure only one admin decision wins.
+func (s *RiskService) finishReview(ctx context.Context, order *models.Order, outcome, actor, note string, set bson.M) (*models.Order, error) {
+	now := time.Now()
+	set["risk.review_status"] = outcome
+	set["risk.reviewed_by"] = actor
+	set["risk.reviewed_at"] = now
+	set["risk.review_note"] = note
+	set["updated_at"] = now
+
+	var updated models.Order
+	err := s.db.GetCollection("orders").FindOneAndUpdate(ctx,
+		bson.M{"_id": order.ID, "risk.review_status": "pending"},
+		bson.M{
+			"$set":  set,
+			"$push": bson.M{"history": newOrderEvent("risk_review", fmt.Sprintf("Risk review %s", outcome), actor, map[string]interface{}{"note": note})},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotUnderReview
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	return &updated, nil
+}
+
+// blocklistCheck flags orders whose email, IP, shipping country or card is blocked
+type blocklistCheck struct {
+	db *database.MongoDB
+}
+
+func (c *blocklistCheck) Name() string { return "blocklist" }
+
+func (c *blocklistCheck) Check(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	candidates := bson.A{
+		bson.M{"type": "email", "value": normalizeBlocklistValue("email", in.Order.Customer.Email)},
+		bson.M{"type": "country", "value": normalizeBlocklistValue("country", in.Order.ShippingAddress.Country)},
+	}
+	if in.IP != "" {
+		candidates = append(candidates, bson.M{"type": "ip", "value": in.IP})
+	}
+
+	return c.find(ctx, in, candidates)
+}
+
+// CheckCard flags a blocked card
+func (c *blocklistCheck) CheckCard(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	return c.find(ctx, in, bson.A{bson.M{"type": "card", "value": in.CardFingerprint}})
+}
+
+// find flags the order when any of the candidate entries is blocked
+func (c *blocklistCheck) find(ctx context.Context, in *RiskInput, candidates bson.A) (*models.RiskCheckResult, error) {
+	var entry models.BlocklistEntry
+	err := c.db.GetCollection("risk_blocklist").FindOne(ctx, bson.M{
+		"domain": in.Order.Domain,
+		"$or":    candidates,
+	}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check blocklist: %w", err)
+	}
+
+	return &models.RiskCheckResult{
+		Check:  c.Name(),
+		Action: in.Settings.BlocklistAction,
+		Reason: fmt.Sprintf("%s %s is blocked", entry.Type, entry.Value),
+	}, nil
+}
+
+// orderTotalCheck flags orders above the domain's maximum order total
+type orderTotalCheck struct{}
+
+func (c *orderTotalCheck) Name() string { return "max_order_total" }
+
+func (c *orderTotalCheck) Check(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	if in.Settings.MaxOrderTotal <= 0 || in.Order.Total <= in.Settings.MaxOrderTotal {
+		return nil, nil
+	}
+
+	return &models.RiskCheckResult{
+		Check:  c.Name(),
+		Action: in.Settings.MaxOrderTotalAction,
+		Reason: fmt.Sprintf("total %.2f exceeds %.2f", in.Order.Total, in.Settings.MaxOrderTotal),
+	}, nil
+}
+
+// countryMismatchCheck flags orders billed to a different country than they ship to
+type countryMismatchCheck struct{}
+
+func (c *countryMismatchCheck) Name() string { return "country_mismatch" }
+
+func (c *countryMismatchCheck) Check(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	billing := in.Order.BillingAddress.Country
+	shipping := in.Order.ShippingAddress.Country
+	if billing == "" || shipping == "" || billing == shipping {
+		return nil, nil
+	}
+
+	return &models.RiskCheckResult{
+		Check:  c.Name(),
+		Action: in.Settings.CountryMismatchAction,
+		Reason: fmt.Sprintf("billing country %s differs from shipping country %s", billing, shipping),
+	}, nil
+}
+
+// velocityCheck flags emails, IPs and cards that placed too many orders recently
+type velocityCheck struct {
+	db *database.MongoDB
+}
+
+func (c *velocityCheck) Name() string { return "velocity" }
+
+func (c *velocityCheck) Check(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	return c.count(ctx, in, false)
+}
+
+// CheckCard applies the card limits
+func (c *velocityCheck) CheckCard(ctx context.Context, in *RiskInput) (*models.RiskCheckResult, error) {
+	return c.count(ctx, in, true)
+}
+
+// count applies the card limits, or all the others
+func (c *velocityCheck) count(ctx context.Context, in *RiskInput, card bool) (*models.RiskCheckResult, error) {
+	var flagged *models.RiskCheckResult
+
+	for _, rule := range in.Settings.Velocity {
+		if (rule.Key == "card") != card {
+			continue
+		}
+
+		field, value := "", ""
+		switch rule.Key {
+		case "email":
+			field, value = "risk.email", normalizeBlocklistValue("email", in.Order.Customer.Email)
+		case "ip":
+			field, value = "risk.ip", in.IP
+		case "card":
+			field, value = "risk.card_fingerprint", in.CardFingerprint
+		}
+		if value == "" {
+			continue
+		}
+
+		since := time.Now().Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+		count, err := c.db.GetCollection("orders").CountDocuments(ctx, bson.M{
+			"domain":     in.Order.Domain,
+			field:        value,
+			"created_at": bson.M{"$gte": since},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count orders by %s: %w", rule.Key, err)
+		}
+		if count < int64(rule.MaxOrders) {
+			continue
+		}
+
+		if flagged == nil || riskSeverity(rule.Action) > riskSeverity(flagged.Action) {
+			flagged = &models.RiskCheckResult{
+				Check:  c.Name(),
+				Action: rule.Action,
+				Reason: fmt.Sprintf("%d orders from this %s in the last %d minutes", count, rule.Key, rule.WindowMinutes),
+			}
+		}
+	}
+
+	return flagged, nil
+}
+
+// riskSeverity orders actions so the most severe one decides
+func riskSeverity(action string) int {
+	switch action {
+	case models.RiskActionReject:
+		return 2
+	case models.RiskActionReview:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isRiskAction(action string, allowOff bool) bool {
+	switch action {
+	case models.RiskActionReview, models.RiskActionReject:
+		return true
+	case "", models.RiskActionAllow:
+		return allowOff
+	default:
+		return false
+	}
+}
+
+func normalizeBlocklistValue(entryType, value string) string {
+	value = strings.TrimSpace(value)
+	switch entryType {
+	case "email":
+		return strings.ToLower(value)
+	case "country":
+		return NormalizeCountry(value)
+	default:
+		return value
+	}
+}
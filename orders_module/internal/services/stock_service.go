@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidStockAdjustment is returned when a manual stock change is rejected
+var ErrInvalidStockAdjustment = errors.New("invalid stock adjustment")
+
+// StockService changes variant stock in products_module and records every
+// change in the stock_transactions ledger
+type StockService struct {
+	db *database.MongoDB
+}
+
+func NewStockService(db *database.MongoDB) *StockService {
+	return &StockService{db: db}
+}
+
+// ApplyTransaction atomically applies tx.Quantity to the variant stock and
+// records the transaction with the resulting stock levels
+func (s *StockService) ApplyTransaction(ctx context.Context, tx *models.StockTransaction) error {
+	if tx.VariantID == "" {
+		return fmt.Errorf("%w: product %s has no variant to track stock on", ErrProductNotFound, tx.ProductID)
+	}
+
+	productID, err := primitive.ObjectIDFromHex(tx.ProductID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, tx.ProductID)
+	}
+
+	products := s.db.GetProductsCollection("products")
+
+	// Return the document from before the update to read the old stock level
+	var before models.CatalogProduct
+	err = products.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":         productID,
+			"domain":      tx.Domain,
+			"variants.id": tx.VariantID,
+		},
+		bson.M{
+			"$inc": bson.M{"variants.$.stock": tx.Quantity},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("%w: variant %s of product %s", ErrProductNotFound, tx.VariantID, tx.ProductID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update stock: %w", err)
+	}
+
+	variant := before.FindVariant(tx.VariantID)
+	tx.StockBefore = variant.Stock
+	tx.StockAfter = variant.Stock + tx.Quantity
+
+	if tx.ID.IsZero() {
+		tx.ID = primitive.NewObjectID()
+	}
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now()
+	}
+
+	_, err = s.db.GetCollection("stock_transactions").InsertOne(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create stock transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RecordAdjustment validates and applies a manual restock, adjustment or return
+func (s *StockService) RecordAdjustment(ctx context.Context, req *models.StockAdjustmentRequest, domain, createdBy string) (*models.StockTransaction, error) {
+	switch req.Type {
+	case "restock", "return":
+		if req.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %s quantity must be positive", ErrInvalidStockAdjustment, req.Type)
+		}
+	case "adjustment":
+		if req.Quantity == 0 {
+			return nil, fmt.Errorf("%w: adjustment quantity can't be zero", ErrInvalidStockAdjustment)
+		}
+		if req.Reason == "" {
+			return nil, fmt.Errorf("%w: adjustments need a reason", ErrInvalidStockAdjustment)
+		}
+	default:
+		return nil, fmt.Errorf("%w: type must be restock, adjustment or return", ErrInvalidStockAdjustment)
+	}
+	if req.ProductID == "" || req.VariantID == "" {
+		return nil, fmt.Errorf("%w: product_id and variant_id are required", ErrInvalidStockAdjustment)
+	}
+
+	tx := &models.StockTransaction{
+		Domain:    domain,
+		ProductID: req.ProductID,
+		VariantID: req.VariantID,
+		Type:      req.Type,
+		Quantity:  req.Quantity,
+		CreatedBy: createdBy,
+		Reason:    req.Reason,
+	}
+
+	if req.OrderID != "" {
+		orderID, err := primitive.ObjectIDFromHex(req.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid order ID", ErrInvalidStockAdjustment)
+		}
+
+		var order models.Order
+		err = s.db.GetCollection("orders").FindOne(ctx, bson.M{"_id": orderID, "domain": domain}).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrderNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order: %w", err)
+		}
+		tx.OrderID = order.ID.Hex()
+		tx.OrderNumber = order.OrderNumber
+	}
+
+	if err := s.ApplyTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	if tx.Quantity > 0 {
+		s.allocateBackorders(ctx, tx)
+	}
+
+	return tx, nil
+}
+
+// allocateBackorders hands units that just arrived to paid orders waiting
+// for the variant, oldest first. The stock was already taken when those
+// orders were paid, so only their backordered quantities change.
+func (s *StockService) allocateBackorders(ctx context.Context, tx *models.StockTransaction) {
+	collection := s.db.GetCollection("orders")
+	waiting := bson.M{
+		"domain": tx.Domain,
+		"status": bson.M{"$in": bson.A{"paid", "processing", "partially_shipped"}},
+		"items": bson.M{"$elemMatch": bson.M{
+			"product_id":           tx.ProductID,
+			"variant_id":           tx.VariantID,
+			"backordered_quantity": bson.M{"$gt": 0},
+		}},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "paid_at", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := collection.Find(ctx, waiting, opts)
+	if err != nil {
+		log.Printf("ERROR: Failed to find backorders for %s/%s: %v", tx.ProductID, tx.VariantID, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		log.Printf("ERROR: Failed to decode backorders for %s/%s: %v", tx.ProductID, tx.VariantID, err)
+		return
+	}
+
+	remaining := tx.Quantity
+	for _, order := range orders {
+		if remaining == 0 {
+			return
+		}
+
+		// An order edited or shipped since it was read is read again, so the
+		// units aren't handed to lines that changed in the meantime
+		for attempt := 0; attempt < 3; attempt++ {
+			allocated, err := s.allocateToOrder(ctx, &order, tx, remaining)
+			if err == nil {
+				remaining -= allocated
+				break
+			}
+			if err != mongo.ErrNoDocuments {
+				log.Printf("ERROR: Failed to allocate stock to order %s: %v", order.OrderNumber, err)
+				break
+			}
+
+			filter := bson.M{"_id": order.ID}
+			for k, v := range waiting {
+				filter[k] = v
+			}
+			err = collection.FindOne(ctx, filter).Decode(&order)
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			if err != nil {
+				log.Printf("ERROR: Failed to reload order %s: %v", order.OrderNumber, err)
+				break
+			}
+		}
+	}
+}
+
+// allocateToOrder hands up to `available` units of the transaction's variant
+// to the order's backordered lines. The update only applies while the order
+// is unchanged since it was read (mongo.ErrNoDocuments otherwise).
+func (s *StockService) allocateToOrder(ctx context.Context, order *models.Order, tx *models.StockTransaction, available int) (int, error) {
+	items := append([]models.OrderItem(nil), order.Items...)
+	allocated := 0
+	productName := tx.ProductID
+	for i := range items {
+		item := &items[i]
+		if item.Custom || item.ProductID != tx.ProductID || item.VariantID != tx.VariantID || item.BackorderedQuantity == 0 {
+			continue
+		}
+		n := min(item.BackorderedQuantity, available-allocated)
+		item.BackorderedQuantity -= n
+		allocated += n
+		productName = item.ProductName
+	}
+	if allocated == 0 {
+		return 0, nil
+	}
+
+	event := newOrderEvent("stock_allocated", fmt.Sprintf("%d x %s arrived and can ship", allocated, productName), tx.CreatedBy,
+		map[string]interface{}{"variant_id": tx.VariantID, "quantity": allocated})
+	result, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID, "updated_at": order.UpdatedAt}, bson.M{
+		"$set": bson.M{
+			"items":            items,
+			"expected_ship_at": expectedShipAt(items),
+			"updated_at":       time.Now(),
+		},
+		"$push": bson.M{"history": event},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		return 0, mongo.ErrNoDocuments
+	}
+	return allocated, nil
+}
+
+// trackedTransactions matches the ledger rows that record the stock level
+// they changed. Sales recorded before the ledger tracked stock levels have a
+// stock_before and stock_after of 0 and are left out of every balance.
+var trackedTransactions = bson.M{"$expr": bson.M{
+	"$eq": bson.A{"$stock_after", bson.M{"$add": bson.A{"$stock_before", "$quantity"}}},
+}}
+
+// ledgerBalances replays the tracked ledger per variant: the stock before its
+// oldest matching transaction plus the quantities of all of them. Keys are
+// "product_id/variant_id". The ledger API and reconciliation both use it.
+func ledgerBalances(ctx context.Context, db *database.MongoDB, filter bson.M) (map[string]int, error) {
+	match := bson.M{}
+	for k, v := range trackedTransactions {
+		match[k] = v
+	}
+	for k, v := range filter {
+		match[k] = v
+	}
+
+	cursor, err := db.GetCollection("stock_transactions").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          bson.M{"product_id": "$product_id", "variant_id": "$variant_id"},
+			"first_before": bson.M{"$first": "$stock_before"},
+			"total":        bson.M{"$sum": "$quantity"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay stock ledger: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			ProductID string `bson:"product_id"`
+			VariantID string `bson:"variant_id"`
+		} `bson:"_id"`
+		FirstBefore int `bson:"first_before"`
+		Total       int `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode stock ledger totals: %w", err)
+	}
+
+	balances := make(map[string]int, len(rows))
+	for _, row := range rows {
+		balances[row.ID.ProductID+"/"+row.ID.VariantID] = row.FirstBefore + row.Total
+	}
+	return balances, nil
+}
+
+// GetLedger returns a product's tracked stock transactions oldest first with
+// the variant's stock after each one. Transactions before `from` are replayed
+// into the opening balances, so a date range still shows correct balances.
+func (s *StockService) GetLedger(ctx context.Context, domain, productID, variantID string, from, to time.Time) (*models.StockLedger, error) {
+	collection := s.db.GetCollection("stock_transactions")
+
+	filter := bson.M{"domain": domain, "product_id": productID}
+	if variantID != "" {
+		filter["variant_id"] = variantID
+	}
+
+	ledger := &models.StockLedger{
+		Domain:          domain,
+		ProductID:       productID,
+		VariantID:       variantID,
+		Entries:         []models.StockLedgerEntry{},
+		OpeningBalances: map[string]int{},
+		ClosingBalances: map[string]int{},
+	}
+
+	if !from.IsZero() {
+		before := bson.M{"created_at": bson.M{"$lt": from}}
+		for k, v := range filter {
+			before[k] = v
+		}
+		opening, err := ledgerBalances(ctx, s.db, before)
+		if err != nil {
+			return nil, err
+		}
+		for key, balance := range opening {
+			ledger.OpeningBalances[strings.TrimPrefix(key, productID+"/")] = balance
+		}
+	}
+
+	createdAt := bson.M{}
+	if !from.IsZero() {
+		createdAt["$gte"] = from
+	}
+	if !to.IsZero() {
+		createdAt["$lte"] = to
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	for k, v := range trackedTransactions {
+		filter[k] = v
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	balances := make(map[string]int, len(ledger.OpeningBalances))
+	for k, v := range ledger.OpeningBalances {
+		balances[k] = v
+	}
+
+	for cursor.Next(ctx) {
+		var tx models.StockTransaction
+		if err := cursor.Decode(&tx); err != nil {
+			return nil, fmt.Errorf("failed to decode stock transaction: %w", err)
+		}
+		// A variant's first entry starts from the stock it recorded
+		if _, ok := balances[tx.VariantID]; !ok {
+			balances[tx.VariantID] = tx.StockBefore
+		}
+		balances[tx.VariantID] += tx.Quantity
+		ledger.Entries = append(ledger.Entries, models.StockLedgerEntry{
+			StockTransaction: tx,
+			Balance:          balances[tx.VariantID],
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stock transactions: %w", err)
+	}
+
+	ledger.ClosingBalances = balances
+	return ledger, nil
+}
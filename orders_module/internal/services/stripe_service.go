@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/sparque/orders_module/internal/database"
@@ -12,18 +13,37 @@ import (
 	"github.com/stripe/stripe-go/v81/webhook"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type StripeService struct {
 	db            *database.MongoDB
 	webhookSecret string
+	stock         *StockService
+	webhooks      *WebhookService
+	loyalty       *LoyaltyService
+	giftCards     *GiftCardService
+	affiliates    *AffiliateService
+	profiles      *CustomerProfileService
+	invites       *InvitationDiscountService
+	risk          *RiskService
 }
 
 func NewStripeService(db *database.MongoDB, webhookSecret string) *StripeService {
-	return &StripeService{
+	s := &StripeService{
 		db:            db,
 		webhookSecret: webhookSecret,
+		stock:         NewStockService(db),
+		webhooks:      NewWebhookService(db),
+		loyalty:       NewLoyaltyService(db),
+		giftCards:     NewGiftCardService(db, nil),
+		affiliates:    NewAffiliateService(db),
+		profiles:      NewCustomerProfileService(db),
+		invites:       NewInvitationDiscountService(db),
 	}
+	s.risk = newRiskService(db, s)
+	return s
 }
 
 // HandleWebhook processes Stripe webhook events
@@ -42,6 +62,18 @@ func (s *StripeService) HandleWebhook(ctx context.Context, payload []byte, signa
 	case "payment_intent.payment_failed":
 		return s.handlePaymentFailed(ctx, event.Data.Raw)
 
+	case "payment_intent.canceled":
+		return s.handlePaymentCanceled(ctx, event.Data.Raw)
+
+	case "payment_intent.amount_capturable_updated":
+		return s.handlePaymentAuthorized(ctx, event.Data.Raw)
+
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		return s.handleCheckoutSessionCompleted(ctx, event.Data.Raw)
+
+	case "checkout.session.async_payment_failed", "checkout.session.expired":
+		return s.handleCheckoutSessionFailed(ctx, event.Data.Raw)
+
 	default:
 		// Unhandled event type
 		return nil
@@ -55,6 +87,12 @@ func (s *StripeService) handlePaymentSucceeded(ctx context.Context, rawData json
 		return fmt.Errorf("failed to unmarshal payment intent: %w", err)
 	}
 
+	// Checkout Session orders are paid when the session is completed. This
+	// event only completes them when an order held for review is captured.
+	if pi.Metadata["checkout_session"] == "true" {
+		return s.handleCheckoutPaymentCaptured(ctx, &pi)
+	}
+
 	// Find order by payment intent ID
 	collection := s.db.GetCollection("orders")
 	var order models.Order
@@ -62,10 +100,25 @@ func (s *StripeService) handlePaymentSucceeded(ctx context.Context, rawData json
 		"payment.payment_intent_id": pi.ID,
 	}).Decode(&order)
 
+	if err == mongo.ErrNoDocuments && pi.Metadata["adjustment"] == "true" {
+		return s.updateAdjustmentStatus(ctx, pi.ID, "succeeded")
+	}
 	if err != nil {
 		return fmt.Errorf("order not found for payment intent %s: %w", pi.ID, err)
 	}
 
+	return s.MarkOrderPaid(ctx, &order)
+}
+
+// MarkOrderPaid records that an order was paid and runs everything that
+// follows a payment: stock deduction, loyalty points, gift card issuance,
+// affiliate commission and the order.paid webhook. Orders paid entirely with
+// gift cards never get a payment intent, so they come through here without a
+// Stripe event. Only a pending order is moved to paid, so an event Stripe
+// delivers twice (or two events for the same payment) is handled once.
+func (s *StripeService) MarkOrderPaid(ctx context.Context, order *models.Order) error {
+	collection := s.db.GetCollection("orders")
+
 	// Update order status
 	now := time.Now()
 	update := bson.M{
@@ -77,21 +130,87 @@ func (s *StripeService) handlePaymentSucceeded(ctx context.Context, rawData json
 		},
 	}
 
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": order.ID}, update)
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": order.ID, "status": "pending"}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update order: %w", err)
 	}
 
 	// Deduct stock (MVP: simple approach)
-	if err := s.deductStock(ctx, &order); err != nil {
+	if err := s.deductStock(ctx, order); err != nil {
 		// Log error but don't fail the webhook
 		// In production, you'd want retry logic or alerting
-		fmt.Printf("ERROR: Failed to deduct stock for order %s: %v\n", order.OrderNumber, err)
+		log.Printf("ERROR: Failed to deduct stock for order %s: %v", order.OrderNumber, err)
+	}
+
+	if err := s.loyalty.EarnForOrder(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to award loyalty points for order %s: %v", order.OrderNumber, err)
+	}
+
+	if err := s.giftCards.IssueForOrder(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to issue gift cards for order %s: %v", order.OrderNumber, err)
+	}
+
+	if err := s.affiliates.AccrueForOrder(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to accrue affiliate commission for order %s: %v", order.OrderNumber, err)
+	}
+
+	if err := s.profiles.RecordOrder(ctx, order); err != nil {
+		log.Printf("ERROR: Failed to update customer profile for order %s: %v", order.OrderNumber, err)
 	}
 
+	s.webhooks.Dispatch(ctx, models.WebhookEventOrderPaid, order)
+
 	return nil
 }
 
+// handlePaymentAuthorized marks the payment of an order held for risk review
+// or card checks as authorized, and screens the card. It is captured once the
+// card passes, or when an admin approves the order.
+func (s *StripeService) handlePaymentAuthorized(ctx context.Context, rawData json.RawMessage) error {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(rawData, &pi); err != nil {
+		return fmt.Errorf("failed to unmarshal payment intent: %w", err)
+	}
+
+	// Authorized too, so a failed card screening is retried
+	paymentStatus := bson.M{"$in": bson.A{"pending", "authorized"}}
+	filter := bson.M{
+		"payment.payment_intent_id": pi.ID,
+		"payment.status":            paymentStatus,
+	}
+	set := bson.M{
+		"payment.status": "authorized",
+		"updated_at":     time.Now(),
+	}
+	// A Checkout Session payment can be authorized before the session's
+	// completion links it to the order
+	if pi.Metadata["checkout_session"] == "true" {
+		orderID, err := primitive.ObjectIDFromHex(pi.Metadata["order_id"])
+		if err != nil {
+			return fmt.Errorf("invalid order ID on payment intent %s: %w", pi.ID, err)
+		}
+		filter = bson.M{"_id": orderID, "payment.status": paymentStatus}
+		set["payment.payment_intent_id"] = pi.ID
+	}
+
+	var order models.Order
+	err := s.db.GetCollection("orders").FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	return s.risk.ScreenCard(ctx, &order, &pi)
+}
+
 // handlePaymentFailed handles failed payment
 func (s *StripeService) handlePaymentFailed(ctx context.Context, rawData json.RawMessage) error {
 	var pi stripe.PaymentIntent
@@ -99,6 +218,10 @@ func (s *StripeService) handlePaymentFailed(ctx context.Context, rawData json.Ra
 		return fmt.Errorf("failed to unmarshal payment intent: %w", err)
 	}
 
+	if pi.Metadata["adjustment"] == "true" {
+		return s.updateAdjustmentStatus(ctx, pi.ID, "failed")
+	}
+
 	// Update order payment status
 	collection := s.db.GetCollection("orders")
 	update := bson.M{
@@ -119,14 +242,171 @@ func (s *StripeService) handlePaymentFailed(ctx context.Context, rawData json.Ra
 	return nil
 }
 
-// deductStock deducts stock for all items in an order
+// handlePaymentCanceled records that the payment intent of an unpaid order
+// was cancelled in Stripe (from the dashboard or by Stripe itself). The
+// order can't be paid anymore, so its invitation discount is given back.
+func (s *StripeService) handlePaymentCanceled(ctx context.Context, rawData json.RawMessage) error {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(rawData, &pi); err != nil {
+		return fmt.Errorf("failed to unmarshal payment intent: %w", err)
+	}
+
+	if pi.Metadata["adjustment"] == "true" {
+		return s.updateAdjustmentStatus(ctx, pi.ID, "canceled")
+	}
+
+	return s.abandonPayment(ctx, bson.M{
+		"payment.payment_intent_id": pi.ID,
+		"payment.status":            bson.M{"$in": bson.A{"pending", "failed"}},
+	}, "cancelled")
+}
+
+// abandonPayment sets the payment status of the pending order matching
+// filter once it can't be paid anymore, and gives back the invitation
+// discount it holds. The order itself stays pending until it's cancelled or
+// expires (see ExpirePendingOrders).
+func (s *StripeService) abandonPayment(ctx context.Context, filter bson.M, status string) error {
+	filter["status"] = "pending"
+
+	var order models.Order
+	err := s.db.GetCollection("orders").FindOneAndUpdate(ctx, filter, bson.M{
+		"$set": bson.M{
+			"payment.status": status,
+			"updated_at":     time.Now(),
+		},
+	}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if err := s.invites.Release(ctx, &order); err != nil {
+		log.Printf("ERROR: Failed to release invitation discount for order %s: %v", order.OrderNumber, err)
+	}
+	return nil
+}
+
+// handleCheckoutSessionCompleted links the payment intent of a completed
+// Checkout Session to its order and marks the order paid once the money is
+// in. Delayed payment methods complete the session unpaid and report later
+// with checkout.session.async_payment_succeeded; payments held for review
+// are authorized only and become paid when captured.
+func (s *StripeService) handleCheckoutSessionCompleted(ctx context.Context, rawData json.RawMessage) error {
+	var cs stripe.CheckoutSession
+	if err := json.Unmarshal(rawData, &cs); err != nil {
+		return fmt.Errorf("failed to unmarshal checkout session: %w", err)
+	}
+
+	collection := s.db.GetCollection("orders")
+	var order models.Order
+	err := collection.FindOne(ctx, bson.M{"payment.checkout_session_id": cs.ID}).Decode(&order)
+	if err != nil {
+		return fmt.Errorf("order not found for checkout session %s: %w", cs.ID, err)
+	}
+
+	if cs.PaymentIntent != nil && cs.PaymentIntent.ID != order.Payment.PaymentIntentID {
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+			"$set": bson.M{
+				"payment.payment_intent_id": cs.PaymentIntent.ID,
+				"updated_at":                time.Now(),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+		order.Payment.PaymentIntentID = cs.PaymentIntent.ID
+	}
+
+	// Paid by an earlier delivery, or only authorized while held for review
+	// or card checks
+	if cs.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid || order.Payment.Status != "pending" {
+		return nil
+	}
+	if order.Risk != nil && order.Risk.ReviewStatus == "pending" {
+		return nil
+	}
+
+	return s.MarkOrderPaid(ctx, &order)
+}
+
+// handleCheckoutPaymentCaptured marks a Checkout Session order paid when its
+// authorized payment is captured after a risk review approval
+func (s *StripeService) handleCheckoutPaymentCaptured(ctx context.Context, pi *stripe.PaymentIntent) error {
+	var order models.Order
+	err := s.db.GetCollection("orders").FindOne(ctx, bson.M{
+		"payment.payment_intent_id": pi.ID,
+		"payment.status":            "authorized",
+	}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find order for payment intent %s: %w", pi.ID, err)
+	}
+
+	return s.MarkOrderPaid(ctx, &order)
+}
+
+// handleCheckoutSessionFailed marks the payment of an order failed when its
+// Checkout Session expires unpaid or its delayed payment fails. Neither can
+// be paid again, so the invitation discount is given back.
+func (s *StripeService) handleCheckoutSessionFailed(ctx context.Context, rawData json.RawMessage) error {
+	var cs stripe.CheckoutSession
+	if err := json.Unmarshal(rawData, &cs); err != nil {
+		return fmt.Errorf("failed to unmarshal checkout session: %w", err)
+	}
+
+	return s.abandonPayment(ctx, bson.M{
+		"payment.checkout_session_id": cs.ID,
+		"payment.status":              "pending",
+	}, "failed")
+}
+
+// updateAdjustmentStatus updates an order edit charge once Stripe reports on it
+func (s *StripeService) updateAdjustmentStatus(ctx context.Context, paymentIntentID, status string) error {
+	collection := s.db.GetCollection("orders")
+
+	var order models.Order
+	err := collection.FindOneAndUpdate(ctx, bson.M{
+		"payment_adjustments.payment_intent_id": paymentIntentID,
+	}, bson.M{
+		"$set": bson.M{
+			"payment_adjustments.$.status": status,
+			"updated_at":                   time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update payment adjustment: %w", err)
+	}
+
+	// The charge adds to the customer's spend
+	if status == "succeeded" {
+		if err := s.profiles.RecordOrder(ctx, &order); err != nil {
+			log.Printf("ERROR: Failed to update customer profile for order %s: %v", order.OrderNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// deductStock deducts stock for all items in an order and records which
+// units have to wait for a restock
 func (s *StripeService) deductStock(ctx context.Context, order *models.Order) error {
-	stockTxCollection := s.db.GetCollection("stock_transactions")
+	var failed []string
+	backordersChanged := false
+
+	for i, item := range order.Items {
+		// Custom line items (draft orders) and gift cards aren't stocked
+		if item.Custom || item.ProductType == models.ProductTypeGiftCard {
+			continue
+		}
 
-	for _, item := range order.Items {
-		// Create stock transaction record
 		tx := &models.StockTransaction{
-			ID:          primitive.NewObjectID(),
 			Domain:      order.Domain,
 			ProductID:   item.ProductID,
 			VariantID:   item.VariantID,
@@ -136,21 +416,40 @@ func (s *StripeService) deductStock(ctx context.Context, order *models.Order) er
 			OrderNumber: order.OrderNumber,
 			CreatedBy:   "system",
 			Reason:      "Order payment confirmed",
-			CreatedAt:   time.Now(),
 		}
 
-		// Note: StockBefore and StockAfter would need to be fetched from products API
-		// For MVP, we'll store them as 0 and implement full integration later
-		tx.StockBefore = 0 // TODO: Fetch from products API
-		tx.StockAfter = 0  // TODO: Calculate after deduction
+		// Keep going so one bad item doesn't block the rest of the order
+		if err := s.stock.ApplyTransaction(ctx, tx); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", item.ProductName, err))
+			continue
+		}
 
-		_, err := stockTxCollection.InsertOne(ctx, tx)
+		// Stock may have moved since the order was placed
+		short := item.Quantity - min(max(tx.StockBefore, 0), item.Quantity)
+		if short != item.BackorderedQuantity {
+			order.Items[i].BackorderedQuantity = short
+			if short > 0 && item.Availability != models.InventoryPolicyPreorder {
+				order.Items[i].Availability = models.InventoryPolicyBackorder
+			}
+			backordersChanged = true
+		}
+	}
+
+	if backordersChanged {
+		order.ExpectedShipAt = expectedShipAt(order.Items)
+		_, err := s.db.GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+			"$set": bson.M{
+				"items":            order.Items,
+				"expected_ship_at": order.ExpectedShipAt,
+			},
+		})
 		if err != nil {
-			return fmt.Errorf("failed to create stock transaction: %w", err)
+			failed = append(failed, fmt.Sprintf("backorders: %v", err))
 		}
+	}
 
-		// TODO: Call products API to actually deduct stock
-		// This will be implemented in Task 7
+	if len(failed) > 0 {
+		return fmt.Errorf("%d item(s) failed: %v", len(failed), failed)
 	}
 
 	return nil
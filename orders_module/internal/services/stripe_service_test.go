@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testDomain = "shop.example.com"
+
+// testMongoDB connects to the server in ORDERS_TEST_MONGODB_URI with
+// throwaway databases, dropped when the test ends. Tests that need it are
+// skipped when the variable isn't set.
+func testMongoDB(t *testing.T) *database.MongoDB {
+	t.Helper()
+	uri := os.Getenv("ORDERS_TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("ORDERS_TEST_MONGODB_URI not set")
+	}
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	db, err := database.Connect(uri, "orders_test_"+suffix, "products_test_"+suffix, "auth_test_"+suffix)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		db.Database.Drop(ctx)
+		db.ProductsDB.Drop(ctx)
+		db.AuthDB.Drop(ctx)
+		db.Close()
+	})
+	return db
+}
+
+// insertTestProduct adds a product to the catalog and returns its ID
+func insertTestProduct(t *testing.T, db *database.MongoDB, product models.CatalogProduct) string {
+	t.Helper()
+	product.ID = primitive.NewObjectID()
+	product.Domain = testDomain
+	product.Active = true
+	if _, err := db.GetProductsCollection("products").InsertOne(context.Background(), product); err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	return product.ID.Hex()
+}
+
+// insertTestOrder saves a pending order with the given items
+func insertTestOrder(t *testing.T, db *database.MongoDB, items ...models.OrderItem) *models.Order {
+	t.Helper()
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-TEST-" + primitive.NewObjectID().Hex()[18:],
+		Domain:      testDomain,
+		Customer:    models.Customer{Email: "buyer@example.com", Name: "Buyer"},
+		Items:       items,
+		Status:      "pending",
+		Payment:     models.Payment{Status: "pending"},
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if _, err := db.GetCollection("orders").InsertOne(context.Background(), order); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	return order
+}
+
+func TestMarkOrderPaidOnce(t *testing.T) {
+	db := testMongoDB(t)
+	ctx := context.Background()
+
+	mugID := insertTestProduct(t, db, models.CatalogProduct{
+		Name: "Mug", BasePrice: 12,
+		Variants: []models.CatalogVariant{{ID: "blue", Stock: 5}},
+	})
+	giftCardID := insertTestProduct(t, db, models.CatalogProduct{
+		Name: "Gift card", Type: models.ProductTypeGiftCard,
+		Variants: []models.CatalogVariant{{ID: "25", Price: 25}},
+	})
+	order := insertTestOrder(t, db,
+		models.OrderItem{ProductID: mugID, ProductName: "Mug", VariantID: "blue", Quantity: 2, UnitPrice: 12, Total: 24},
+		models.OrderItem{ProductID: giftCardID, ProductName: "Gift card", VariantID: "25", Quantity: 1, UnitPrice: 25, Total: 25,
+			ProductType: models.ProductTypeGiftCard},
+	)
+
+	// Stripe retries webhooks, and the payment intent and Checkout events
+	// can both arrive for the same order
+	s := NewStripeService(db, "")
+	for attempt := 1; attempt <= 3; attempt++ {
+		delivery := *order
+		delivery.Items = append([]models.OrderItem(nil), order.Items...)
+		if err := s.MarkOrderPaid(ctx, &delivery); err != nil {
+			t.Fatalf("attempt %d: MarkOrderPaid() error = %v", attempt, err)
+		}
+	}
+
+	var paid models.Order
+	if err := db.GetCollection("orders").FindOne(ctx, bson.M{"_id": order.ID}).Decode(&paid); err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if paid.Status != "paid" || paid.Payment.Status != "succeeded" {
+		t.Errorf("order status = %s, payment %s, want paid, succeeded", paid.Status, paid.Payment.Status)
+	}
+
+	counts := []struct {
+		collection string
+		filter     bson.M
+		want       int64
+	}{
+		{"stock_transactions", bson.M{"order_id": order.ID.Hex(), "type": "sale"}, 1},
+		{"gift_cards", bson.M{"order_id": order.ID.Hex()}, 1},
+	}
+	for _, c := range counts {
+		got, err := db.GetCollection(c.collection).CountDocuments(ctx, c.filter)
+		if err != nil {
+			t.Fatalf("count %s: %v", c.collection, err)
+		}
+		if got != c.want {
+			t.Errorf("%s for the order = %d, want %d", c.collection, got, c.want)
+		}
+	}
+
+	product, err := NewCatalogService(db).GetProduct(ctx, mugID, testDomain)
+	if err != nil {
+		t.Fatalf("get product: %v", err)
+	}
+	if stock := product.FindVariant("blue").Stock; stock != 3 {
+		t.Errorf("stock = %d, want 3", stock)
+	}
+}
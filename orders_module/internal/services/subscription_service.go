@@ -0,0 +1,838 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/paymentintent"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSubscriptionNotFound is returned when a subscription or plan doesn't exist for the domain
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// ErrInvalidSubscription is returned when a plan or subscription change is rejected
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+// subscriptionRetryDelays is the dunning schedule: how long to wait before
+// retrying a failed renewal charge. After the last retry fails, the
+// subscription is cancelled.
+var subscriptionRetryDelays = []time.Duration{
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	5 * 24 * time.Hour,
+}
+
+// subscriptionLockDuration is how long the scheduler holds a subscription
+// while renewing it
+const subscriptionLockDuration = 5 * time.Minute
+
+// SubscriptionService manages subscription plans and customer subscriptions,
+// and renews them into orders charged off-session
+type SubscriptionService struct {
+	db        *database.MongoDB
+	orders    *OrderService
+	email     *EmailService
+	catalog   *CatalogService
+	addresses *AddressService
+	customers *PaymentCustomerService
+}
+
+func NewSubscriptionService(db *database.MongoDB, orders *OrderService, email *EmailService) *SubscriptionService {
+	return &SubscriptionService{
+		db:        db,
+		orders:    orders,
+		email:     email,
+		catalog:   NewCatalogService(db),
+		addresses: NewAddressService(db),
+		customers: NewPaymentCustomerService(db),
+	}
+}
+
+// CreatePlan offers a product variant as a subscription
+func (s *SubscriptionService) CreatePlan(ctx context.Context, req *models.CreateSubscriptionPlanRequest, domain, createdBy string) (*models.SubscriptionPlan, error) {
+	product, err := s.catalog.GetProduct(ctx, req.ProductID, domain)
+	if err != nil {
+		return nil, err
+	}
+	if product.FindVariant(req.VariantID) == nil {
+		return nil, fmt.Errorf("%w: variant %s of %s", ErrProductNotFound, req.VariantID, product.Name)
+	}
+
+	now := time.Now()
+	plan := &models.SubscriptionPlan{
+		ID:              primitive.NewObjectID(),
+		Domain:          domain,
+		ProductID:       req.ProductID,
+		VariantID:       req.VariantID,
+		Name:            req.Name,
+		IntervalUnit:    req.IntervalUnit,
+		IntervalCounts:  req.IntervalCounts,
+		DiscountPercent: req.DiscountPercent,
+		Active:          true,
+		CreatedBy:       createdBy,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if plan.Name == "" {
+		plan.Name = product.Name
+	}
+
+	if err := validatePlan(plan); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.GetCollection("subscription_plans").InsertOne(ctx, plan); err != nil {
+		return nil, fmt.Errorf("failed to create subscription plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+// GetPlan retrieves a plan
+func (s *SubscriptionService) GetPlan(ctx context.Context, planID, domain string) (*models.SubscriptionPlan, error) {
+	objectID, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	var plan models.SubscriptionPlan
+	err = s.db.GetCollection("subscription_plans").FindOne(ctx, bson.M{"_id": objectID, "domain": domain}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription plan: %w", err)
+	}
+
+	return &plan, nil
+}
+
+// ListPlans lists a domain's plans, optionally for one product and only active ones
+func (s *SubscriptionService) ListPlans(ctx context.Context, domain, productID string, activeOnly bool) ([]models.SubscriptionPlan, error) {
+	filter := bson.M{"domain": domain}
+	if productID != "" {
+		filter["product_id"] = productID
+	}
+	if activeOnly {
+		filter["active"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := s.db.GetCollection("subscription_plans").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscription plans: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	plans := []models.SubscriptionPlan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription plans: %w", err)
+	}
+
+	return plans, nil
+}
+
+// UpdatePlan changes a plan. Deactivated plans take no new subscribers, but
+// existing subscriptions keep renewing.
+func (s *SubscriptionService) UpdatePlan(ctx context.Context, planID string, req *models.UpdateSubscriptionPlanRequest, domain string) (*models.SubscriptionPlan, error) {
+	plan, err := s.GetPlan(ctx, planID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		plan.Name = *req.Name
+	}
+	if req.IntervalCounts != nil {
+		plan.IntervalCounts = req.IntervalCounts
+	}
+	if req.DiscountPercent != nil {
+		plan.DiscountPercent = *req.DiscountPercent
+	}
+	if req.Active != nil {
+		plan.Active = *req.Active
+	}
+	plan.UpdatedAt = time.Now()
+
+	if err := validatePlan(plan); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.GetCollection("subscription_plans").ReplaceOne(ctx, bson.M{"_id": plan.ID}, plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subscription plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+// CreateSubscription subscribes a logged-in customer to a plan. The first
+// delivery is ordered and charged right away unless it starts later.
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest, customer models.Customer, domain string) (*models.Subscription, error) {
+	plan, err := s.GetPlan(ctx, req.PlanID, domain)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Active {
+		return nil, fmt.Errorf("%w: plan is no longer available", ErrInvalidSubscription)
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.IntervalCount == 0 && len(plan.IntervalCounts) > 0 {
+		req.IntervalCount = plan.IntervalCounts[0]
+	}
+	if req.Quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidSubscription)
+	}
+	if !planAllowsInterval(plan, req.IntervalCount) {
+		return nil, fmt.Errorf("%w: interval_count must be one of %v", ErrInvalidSubscription, plan.IntervalCounts)
+	}
+
+	// Renewals are charged off-session, so the card has to be saved on the
+	// customer's Stripe Customer (from an earlier checkout)
+	if err := s.customers.CheckPaymentMethod(ctx, domain, customer.UserID, req.PaymentMethodID); err != nil {
+		if errors.Is(err, ErrPaymentMethodNotFound) {
+			return nil, fmt.Errorf("%w: payment_method_id must be one of your saved cards", ErrInvalidSubscription)
+		}
+		return nil, err
+	}
+
+	if err := s.addresses.ResolveAddress(ctx, customer.UserID, domain, req.ShippingAddressID, "shipping", &req.ShippingAddress); err != nil {
+		return nil, err
+	}
+	if err := s.addresses.ResolveAddress(ctx, customer.UserID, domain, req.BillingAddressID, "billing", &req.BillingAddress); err != nil {
+		return nil, err
+	}
+	NormalizeAddress(&req.ShippingAddress)
+	NormalizeAddress(&req.BillingAddress)
+	if err := ValidateAddress(req.ShippingAddress); err != nil {
+		return nil, err
+	}
+	if customer.Name == "" {
+		customer.Name = req.ShippingAddress.Name
+	}
+
+	now := time.Now()
+	sub := &models.Subscription{
+		ID:              primitive.NewObjectID(),
+		Domain:          domain,
+		PlanID:          plan.ID.Hex(),
+		Customer:        customer,
+		PaymentMethodID: req.PaymentMethodID,
+		ProductID:       plan.ProductID,
+		VariantID:       plan.VariantID,
+		Quantity:        req.Quantity,
+		IntervalUnit:    plan.IntervalUnit,
+		IntervalCount:   req.IntervalCount,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		Status:          "active",
+		NextRunAt:       now,
+		History:         []models.OrderEvent{newOrderEvent("created", "Subscription created", customer.UserID, nil)},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if req.StartAt != nil && req.StartAt.After(now) {
+		sub.NextRunAt = *req.StartAt
+	}
+
+	if _, err := s.db.GetCollection("subscriptions").InsertOne(ctx, sub); err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	if !sub.NextRunAt.After(now) {
+		if claimed, err := s.claim(ctx, bson.M{"_id": sub.ID}); err != nil {
+			return nil, err
+		} else if claimed != nil {
+			if err := s.renew(ctx, claimed); err != nil {
+				log.Printf("ERROR: Failed to renew subscription %s: %v", claimed.ID.Hex(), err)
+			}
+		}
+	}
+
+	return s.GetSubscription(ctx, sub.ID.Hex(), domain, customer.UserID)
+}
+
+// GetSubscription retrieves a subscription. A non-empty userID limits it to
+// that customer's subscriptions.
+func (s *SubscriptionService) GetSubscription(ctx context.Context, subscriptionID, domain, userID string) (*models.Subscription, error) {
+	objectID, err := primitive.ObjectIDFromHex(subscriptionID)
+	if err != nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "domain": domain}
+	if userID != "" {
+		filter["customer.user_id"] = userID
+	}
+
+	var sub models.Subscription
+	err = s.db.GetCollection("subscriptions").FindOne(ctx, filter).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return &sub, nil
+}
+
+// ListSubscriptions lists a customer's subscriptions (or all of the domain's
+// for an empty userID), optionally filtered by status
+func (s *SubscriptionService) ListSubscriptions(ctx context.Context, domain, userID, status string, limit int64) ([]models.Subscription, error) {
+	filter := bson.M{"domain": domain}
+	if userID != "" {
+		filter["customer.user_id"] = userID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.db.GetCollection("subscriptions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subs := []models.Subscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// UpdateSubscription changes quantity, interval, card, addresses or the next
+// delivery date. A new card on a past-due subscription is retried right away.
+func (s *SubscriptionService) UpdateSubscription(ctx context.Context, subscriptionID string, req *models.UpdateSubscriptionRequest, domain, userID string) (*models.Subscription, error) {
+	sub, err := s.GetSubscription(ctx, subscriptionID, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == "cancelled" {
+		return nil, fmt.Errorf("%w: subscription is cancelled", ErrInvalidSubscription)
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Quantity != nil {
+		if *req.Quantity < 1 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidSubscription)
+		}
+		set["quantity"] = *req.Quantity
+	}
+	if req.IntervalCount != nil {
+		plan, err := s.GetPlan(ctx, sub.PlanID, domain)
+		if err != nil {
+			return nil, err
+		}
+		if !planAllowsInterval(plan, *req.IntervalCount) {
+			return nil, fmt.Errorf("%w: interval_count must be one of %v", ErrInvalidSubscription, plan.IntervalCounts)
+		}
+		set["interval_count"] = *req.IntervalCount
+	}
+	if req.PaymentMethodID != nil {
+		if err := s.customers.CheckPaymentMethod(ctx, domain, sub.Customer.UserID, *req.PaymentMethodID); err != nil {
+			if errors.Is(err, ErrPaymentMethodNotFound) {
+				return nil, fmt.Errorf("%w: payment_method_id must be one of your saved cards", ErrInvalidSubscription)
+			}
+			return nil, err
+		}
+		set["payment_method_id"] = *req.PaymentMethodID
+		if sub.Status == "past_due" {
+			set["next_retry_at"] = time.Now()
+		}
+	}
+	if req.ShippingAddress != nil {
+		NormalizeAddress(req.ShippingAddress)
+		if err := ValidateAddress(*req.ShippingAddress); err != nil {
+			return nil, err
+		}
+		set["shipping_address"] = *req.ShippingAddress
+	}
+	if req.BillingAddress != nil {
+		NormalizeAddress(req.BillingAddress)
+		set["billing_address"] = *req.BillingAddress
+	}
+	if req.NextRunAt != nil {
+		if !req.NextRunAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: next_run_at must be in the future", ErrInvalidSubscription)
+		}
+		set["next_run_at"] = *req.NextRunAt
+	}
+
+	return s.applyUpdate(ctx, sub, bson.M{"$set": set}, newOrderEvent("updated", "Subscription updated", userID, nil))
+}
+
+// PauseSubscription stops deliveries until the given date, or until resumed
+func (s *SubscriptionService) PauseSubscription(ctx context.Context, subscriptionID string, until *time.Time, domain, userID, actor string) (*models.Subscription, error) {
+	sub, err := s.GetSubscription(ctx, subscriptionID, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != "active" {
+		return nil, fmt.Errorf("%w: only active subscriptions can be paused", ErrInvalidSubscription)
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidSubscription)
+	}
+
+	update := bson.M{"$set": bson.M{"status": "paused", "updated_at": time.Now()}}
+	message := "Subscription paused"
+	if until != nil {
+		update["$set"].(bson.M)["paused_until"] = *until
+		message = fmt.Sprintf("Subscription paused until %s", until.Format("2006-01-02"))
+	}
+
+	return s.applyUpdate(ctx, sub, update, newOrderEvent("paused", message, actor, nil))
+}
+
+// ResumeSubscription restarts deliveries. If the next delivery date passed
+// while paused, the next delivery happens on the scheduler's next run.
+func (s *SubscriptionService) ResumeSubscription(ctx context.Context, subscriptionID, domain, userID, actor string) (*models.Subscription, error) {
+	sub, err := s.GetSubscription(ctx, subscriptionID, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != "paused" {
+		return nil, fmt.Errorf("%w: subscription is not paused", ErrInvalidSubscription)
+	}
+
+	return s.applyUpdate(ctx, sub, bson.M{
+		"$set":   bson.M{"status": "active", "updated_at": time.Now()},
+		"$unset": bson.M{"paused_until": ""},
+	}, newOrderEvent("resumed", "Subscription resumed", actor, nil))
+}
+
+// SkipNextDelivery moves the next delivery back by one interval
+func (s *SubscriptionService) SkipNextDelivery(ctx context.Context, subscriptionID, domain, userID, actor string) (*models.Subscription, error) {
+	sub, err := s.GetSubscription(ctx, subscriptionID, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != "active" && sub.Status != "paused" {
+		return nil, fmt.Errorf("%w: only active or paused subscriptions can skip a delivery", ErrInvalidSubscription)
+	}
+
+	next := addInterval(sub.NextRunAt, sub.IntervalUnit, sub.IntervalCount)
+	return s.applyUpdate(ctx, sub, bson.M{
+		"$set": bson.M{"next_run_at": next, "updated_at": time.Now()},
+	}, newOrderEvent("skipped", fmt.Sprintf("Delivery skipped, next delivery %s", next.Format("2006-01-02")), actor, nil))
+}
+
+// CancelSubscription ends a subscription. A renewal still waiting for payment
+// is cancelled with it.
+func (s *SubscriptionService) CancelSubscription(ctx context.Context, subscriptionID, domain, userID, actor, reason string) (*models.Subscription, error) {
+	sub, err := s.GetSubscription(ctx, subscriptionID, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == "cancelled" {
+		return nil, fmt.Errorf("%w: subscription is already cancelled", ErrInvalidSubscription)
+	}
+
+	if sub.PendingOrderID != "" {
+		s.cancelPendingOrder(ctx, sub)
+	}
+
+	now := time.Now()
+	return s.applyUpdate(ctx, sub, bson.M{
+		"$set": bson.M{
+			"status":        "cancelled",
+			"cancelled_at":  now,
+			"cancel_reason": reason,
+			"updated_at":    now,
+		},
+		"$unset": bson.M{"pending_order_id": "", "next_retry_at": ""},
+	}, newOrderEvent("cancelled", "Subscription cancelled", actor, nil))
+}
+
+// RunScheduler renews due subscriptions every interval until ctx is cancelled
+func (s *SubscriptionService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.processDue(ctx)
+		}
+	}
+}
+
+// processDue resumes pauses that ran out, then renews due subscriptions and
+// retries failed renewals one at a time
+func (s *SubscriptionService) processDue(ctx context.Context) {
+	now := time.Now()
+	collection := s.db.GetCollection("subscriptions")
+
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"status": "paused", "paused_until": bson.M{"$lte": now}},
+		bson.M{
+			"$set":   bson.M{"status": "active", "updated_at": now},
+			"$unset": bson.M{"paused_until": ""},
+			"$push":  bson.M{"history": newOrderEvent("resumed", "Pause ended", "system", nil)},
+		},
+	)
+	if err != nil {
+		log.Printf("ERROR: Failed to resume paused subscriptions: %v", err)
+	}
+
+	due := bson.M{"$or": bson.A{
+		bson.M{"status": "active", "next_run_at": bson.M{"$lte": now}},
+		bson.M{"status": "past_due", "next_retry_at": bson.M{"$lte": now}},
+	}}
+
+	// Bounded so one tick can't run forever if renewals keep failing to update
+	for i := 0; i < 100; i++ {
+		sub, err := s.claim(ctx, due)
+		if err != nil {
+			log.Printf("ERROR: Failed to claim due subscription: %v", err)
+			return
+		}
+		if sub == nil {
+			return
+		}
+		if err := s.renew(ctx, sub); err != nil {
+			log.Printf("ERROR: Failed to renew subscription %s: %v", sub.ID.Hex(), err)
+		}
+	}
+}
+
+// claim locks one subscription matching the filter for renewal, or returns
+// nil if there is none
+func (s *SubscriptionService) claim(ctx context.Context, filter bson.M) (*models.Subscription, error) {
+	now := time.Now()
+	claimFilter := bson.M{"$and": bson.A{
+		filter,
+		bson.M{"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lte": now}},
+		}},
+	}}
+
+	var sub models.Subscription
+	err := s.db.GetCollection("subscriptions").FindOneAndUpdate(ctx,
+		claimFilter,
+		bson.M{"$set": bson.M{"locked_until": now.Add(subscriptionLockDuration)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// renew creates the next renewal order (or reuses the one whose payment
+// failed) and charges the saved card off-session. The order becomes paid
+// through the usual payment_intent.succeeded webhook.
+func (s *SubscriptionService) renew(ctx context.Context, sub *models.Subscription) error {
+	order, err := s.renewalOrder(ctx, sub)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			log.Printf("⚠️  Cancelling subscription %s: %v", sub.ID.Hex(), err)
+			return s.finishRenewal(ctx, sub, bson.M{
+				"$set": bson.M{
+					"status":        "cancelled",
+					"cancelled_at":  time.Now(),
+					"cancel_reason": "plan_unavailable",
+				},
+			}, newOrderEvent("cancelled", fmt.Sprintf("Subscription cancelled: %v", err), "system", nil))
+		}
+
+		if errors.Is(err, ErrOutOfStock) {
+			// Variants that can't be backordered are retried daily until restocked
+			return s.finishRenewal(ctx, sub, bson.M{
+				"$set": bson.M{"next_run_at": time.Now().Add(24 * time.Hour)},
+			}, newOrderEvent("postponed", fmt.Sprintf("Renewal postponed: %v", err), "system", nil))
+		}
+
+		// Try again on the next run once the lock expires
+		return fmt.Errorf("failed to create renewal order: %w", err)
+	}
+
+	// A renewal order already paid (the charge went through but the outcome
+	// wasn't saved) isn't charged again. The idempotency key is the same for
+	// every try of one charge attempt, so a repeated request returns the
+	// first result instead of charging twice.
+	switch order.Status {
+	case "cancelled", "refunded":
+		return s.renewalFailed(ctx, sub, order, fmt.Errorf("renewal order %s was %s", order.OrderNumber, order.Status))
+	case "pending":
+		_, err = paymentintent.Confirm(order.Payment.PaymentIntentID, &stripe.PaymentIntentConfirmParams{
+			Params: stripe.Params{
+				IdempotencyKey: stripe.String(fmt.Sprintf("sub-%s-%d-%d", sub.ID.Hex(), sub.RenewalCount+1, sub.FailedAttempts)),
+			},
+			PaymentMethod: stripe.String(sub.PaymentMethodID),
+			OffSession:    stripe.Bool(true),
+		})
+		if err != nil {
+			return s.renewalFailed(ctx, sub, order, err)
+		}
+	}
+
+	return s.finishRenewal(ctx, sub, bson.M{
+		"$set": bson.M{
+			"status":          "active",
+			"next_run_at":     nextRunAfter(sub, time.Now()),
+			"last_order_id":   order.ID.Hex(),
+			"failed_attempts": 0,
+		},
+		"$unset": bson.M{"pending_order_id": "", "next_retry_at": "", "last_failure_reason": ""},
+		"$inc":   bson.M{"renewal_count": 1},
+	}, newOrderEvent("renewed", fmt.Sprintf("Renewal order %s charged", order.OrderNumber), "system",
+		map[string]interface{}{"order_id": order.ID.Hex(), "total": order.Total}))
+}
+
+// renewalOrder returns the renewal waiting for payment, or places a new one
+// priced from the catalog with the plan discount
+func (s *SubscriptionService) renewalOrder(ctx context.Context, sub *models.Subscription) (*models.Order, error) {
+	if sub.PendingOrderID != "" {
+		return s.orders.GetOrder(ctx, sub.PendingOrderID, sub.Domain)
+	}
+
+	plan, err := s.GetPlan(ctx, sub.PlanID, sub.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	item := models.OrderItem{
+		ProductID: sub.ProductID,
+		VariantID: sub.VariantID,
+		Quantity:  sub.Quantity,
+	}
+	if err := s.catalog.PriceItem(ctx, &item, sub.Domain); err != nil {
+		return nil, err
+	}
+	item.Total = roundCents(item.UnitPrice * float64(item.Quantity))
+
+	order := &models.Order{
+		Domain:          sub.Domain,
+		Customer:        sub.Customer,
+		Items:           []models.OrderItem{item},
+		Subtotal:        item.Total,
+		ShippingAddress: sub.ShippingAddress,
+		BillingAddress:  sub.BillingAddress,
+		SubscriptionID:  sub.ID.Hex(),
+		Payment:         models.Payment{PaymentMethodID: sub.PaymentMethodID},
+	}
+	if plan.DiscountPercent > 0 {
+		discount := roundCents(item.Total * plan.DiscountPercent / 100)
+		order.Discount = discount
+		order.Discounts = []models.OrderDiscount{{
+			Type:        "subscription",
+			Description: fmt.Sprintf("Subscribe & save %g%%", plan.DiscountPercent),
+			Amount:      discount,
+		}}
+	}
+
+	if err := s.orders.placeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	// The order and the next run are saved before the card is charged, so a
+	// crash or a failed save after the charge retries this order instead of
+	// placing and charging another one for the same period
+	next := nextRunAfter(sub, time.Now())
+	_, err = s.db.GetCollection("subscriptions").UpdateOne(ctx, bson.M{"_id": sub.ID}, bson.M{
+		"$set": bson.M{
+			"pending_order_id": order.ID.Hex(),
+			"next_run_at":      next,
+			"updated_at":       time.Now(),
+		},
+	})
+	if err != nil {
+		if _, cancelErr := s.orders.CancelOrder(ctx, order.ID.Hex(), sub.Domain, "subscription renewal not saved", "system"); cancelErr != nil {
+			log.Printf("ERROR: Failed to cancel unsaved renewal order %s: %v", order.OrderNumber, cancelErr)
+		}
+		return nil, fmt.Errorf("failed to save renewal order: %w", err)
+	}
+	sub.PendingOrderID = order.ID.Hex()
+	sub.NextRunAt = next
+
+	return order, nil
+}
+
+// nextRunAfter returns the subscription's first run date after now
+func nextRunAfter(sub *models.Subscription, now time.Time) time.Time {
+	next := sub.NextRunAt
+	for !next.After(now) {
+		next = addInterval(next, sub.IntervalUnit, sub.IntervalCount)
+	}
+	return next
+}
+
+// renewalFailed records a declined renewal and schedules the next retry, or
+// cancels the subscription after the last one
+func (s *SubscriptionService) renewalFailed(ctx context.Context, sub *models.Subscription, order *models.Order, chargeErr error) error {
+	reason := chargeErr.Error()
+	var stripeErr *stripe.Error
+	if errors.As(chargeErr, &stripeErr) && stripeErr.Msg != "" {
+		reason = stripeErr.Msg
+	}
+
+	attempts := sub.FailedAttempts + 1
+	productName := sub.ProductID
+	if len(order.Items) > 0 {
+		productName = order.Items[0].ProductName
+	}
+	notice := SubscriptionPaymentFailedEmail{
+		Domain:      sub.Domain,
+		Name:        sub.Customer.Name,
+		ProductName: productName,
+		Amount:      order.Total,
+		Reason:      reason,
+	}
+
+	var err error
+	if attempts > len(subscriptionRetryDelays) {
+		sub.PendingOrderID = order.ID.Hex()
+		s.cancelPendingOrder(ctx, sub)
+
+		err = s.finishRenewal(ctx, sub, bson.M{
+			"$set": bson.M{
+				"status":              "cancelled",
+				"cancelled_at":        time.Now(),
+				"cancel_reason":       "payment_failed",
+				"failed_attempts":     attempts,
+				"last_failure_reason": reason,
+			},
+			"$unset": bson.M{"pending_order_id": "", "next_retry_at": ""},
+		}, newOrderEvent("cancelled", fmt.Sprintf("Subscription cancelled after %d failed payments", attempts), "system", nil))
+
+		notice.Cancelled = true
+	} else {
+		retryAt := time.Now().Add(subscriptionRetryDelays[attempts-1])
+		err = s.finishRenewal(ctx, sub, bson.M{
+			"$set": bson.M{
+				"status":              "past_due",
+				"pending_order_id":    order.ID.Hex(),
+				"failed_attempts":     attempts,
+				"last_failure_reason": reason,
+				"next_retry_at":       retryAt,
+			},
+		}, newOrderEvent("payment_failed", fmt.Sprintf("Renewal payment failed: %s", reason), "system",
+			map[string]interface{}{"order_id": order.ID.Hex(), "attempt": attempts}))
+
+		notice.NextRetryAt = retryAt.Format("January 2, 2006")
+	}
+
+	if sub.Customer.Email != "" {
+		if err := s.email.SendSubscriptionPaymentFailed(sub.Customer.Email, notice); err != nil {
+			log.Printf("ERROR: Failed to send dunning email for subscription %s: %v", sub.ID.Hex(), err)
+		}
+	}
+	return err
+}
+
+// cancelPendingOrder cancels the renewal order waiting for payment and its payment intent
+func (s *SubscriptionService) cancelPendingOrder(ctx context.Context, sub *models.Subscription) {
+	if _, err := s.orders.CancelOrder(ctx, sub.PendingOrderID, sub.Domain, "subscription renewal cancelled", "system"); err != nil {
+		log.Printf("ERROR: Failed to cancel renewal order %s: %v", sub.PendingOrderID, err)
+	}
+}
+
+// finishRenewal saves the outcome of a renewal and releases the scheduler lock
+func (s *SubscriptionService) finishRenewal(ctx context.Context, sub *models.Subscription, update bson.M, event models.OrderEvent) error {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updated_at"] = time.Now()
+
+	unset, _ := update["$unset"].(bson.M)
+	if unset == nil {
+		unset = bson.M{}
+		update["$unset"] = unset
+	}
+	unset["locked_until"] = ""
+
+	update["$push"] = bson.M{"history": event}
+
+	_, err := s.db.GetCollection("subscriptions").UpdateOne(ctx, bson.M{"_id": sub.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription after renewal: %w", err)
+	}
+	return nil
+}
+
+// applyUpdate applies a customer/admin change and records it in the history
+func (s *SubscriptionService) applyUpdate(ctx context.Context, sub *models.Subscription, update bson.M, event models.OrderEvent) (*models.Subscription, error) {
+	update["$push"] = bson.M{"history": event}
+
+	var updated models.Subscription
+	err := s.db.GetCollection("subscriptions").FindOneAndUpdate(ctx,
+		bson.M{"_id": sub.ID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	return &updated, nil
+}
+
+func validatePlan(plan *models.SubscriptionPlan) error {
+	switch plan.IntervalUnit {
+	case "day", "week", "month":
+	default:
+		return fmt.Errorf("%w: interval_unit must be day, week or month", ErrInvalidSubscription)
+	}
+	if len(plan.IntervalCounts) == 0 {
+		return fmt.Errorf("%w: at least one interval count is required", ErrInvalidSubscription)
+	}
+	for _, count := range plan.IntervalCounts {
+		if count < 1 || count > 52 {
+			return fmt.Errorf("%w: interval counts must be between 1 and 52", ErrInvalidSubscription)
+		}
+	}
+	if plan.DiscountPercent < 0 || plan.DiscountPercent >= 100 {
+		return fmt.Errorf("%w: discount_percent must be between 0 and 100", ErrInvalidSubscription)
+	}
+	return nil
+}
+
+func planAllowsInterval(plan *models.SubscriptionPlan, count int) bool {
+	for _, c := range plan.IntervalCounts {
+		if c == count {
+			return true
+		}
+	}
+	return false
+}
+
+// addInterval returns t moved forward by count days, weeks or months
+func addInterval(t time.Time, unit string, count int) time.Time {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, count)
+	case "month":
+		return t.AddDate(0, count, 0)
+	default:
+		return t.AddDate(0, 0, 7*count)
+	}
+}
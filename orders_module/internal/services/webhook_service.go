@@ -0,0 +1,541 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sparque/orders_module/internal/database"
+	"github.com/sparque/orders_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrWebhookNotFound is returned when an endpoint or delivery doesn't exist for the domain
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrInvalidWebhook is returned when an endpoint registration is rejected
+var ErrInvalidWebhook = errors.New("invalid webhook endpoint")
+
+const (
+	// webhookMaxAttempts is how often a delivery is tried before it's marked failed
+	webhookMaxAttempts = 8
+	// webhookRetryBase is the wait after the first failed attempt; it doubles
+	// with every attempt (1m, 2m, 4m, ... ~2h in total)
+	webhookRetryBase = time.Minute
+	// webhookAttemptLease is how long a claimed delivery is reserved for the
+	// worker sending it. Deliveries left "delivering" past it are retried.
+	webhookAttemptLease = time.Minute
+	// webhookMaxResponseBody bounds the response body kept in the delivery log
+	webhookMaxResponseBody = 1024
+)
+
+// WebhookService manages merchant webhook endpoints and delivers signed
+// order events to them
+type WebhookService struct {
+	db     *database.MongoDB
+	client *http.Client
+}
+
+func NewWebhookService(db *database.MongoDB) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// CreateEndpoint registers an endpoint and generates its signing secret
+func (s *WebhookService) CreateEndpoint(ctx context.Context, req *models.CreateWebhookEndpointRequest, domain, createdBy string) (*models.WebhookEndpoint, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	endpoint := &models.WebhookEndpoint{
+		ID:          primitive.NewObjectID(),
+		Domain:      domain,
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      req.Events,
+		Active:      true,
+		Secret:      secret,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if _, err := s.db.GetCollection("webhook_endpoints").InsertOne(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// GetEndpoint retrieves an endpoint
+func (s *WebhookService) GetEndpoint(ctx context.Context, endpointID, domain string) (*models.WebhookEndpoint, error) {
+	objectID, err := primitive.ObjectIDFromHex(endpointID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	var endpoint models.WebhookEndpoint
+	err = s.db.GetCollection("webhook_endpoints").FindOne(ctx, bson.M{"_id": objectID, "domain": domain}).Decode(&endpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook endpoint: %w", err)
+	}
+
+	return &endpoint, nil
+}
+
+// ListEndpoints lists a domain's endpoints
+func (s *WebhookService) ListEndpoints(ctx context.Context, domain string) ([]models.WebhookEndpoint, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := s.db.GetCollection("webhook_endpoints").Find(ctx, bson.M{"domain": domain}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	endpoints := []models.WebhookEndpoint{}
+	if err := cursor.All(ctx, &endpoints); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook endpoints: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// UpdateEndpoint changes an endpoint's URL, events, description or active flag
+func (s *WebhookService) UpdateEndpoint(ctx context.Context, endpointID string, req *models.UpdateWebhookEndpointRequest, domain string) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetEndpoint(ctx, endpointID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		set["url"] = *req.URL
+	}
+	if req.Events != nil {
+		if err := validateWebhookEvents(req.Events); err != nil {
+			return nil, err
+		}
+		set["events"] = req.Events
+	}
+	if req.Description != nil {
+		set["description"] = *req.Description
+	}
+	if req.Active != nil {
+		set["active"] = *req.Active
+	}
+
+	_, err = s.db.GetCollection("webhook_endpoints").UpdateOne(ctx, bson.M{"_id": endpoint.ID}, bson.M{"$set": set})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook endpoint: %w", err)
+	}
+
+	return s.GetEndpoint(ctx, endpointID, domain)
+}
+
+// DeleteEndpoint removes an endpoint. Its delivery log is kept.
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, endpointID, domain string) error {
+	endpoint, err := s.GetEndpoint(ctx, endpointID, domain)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.GetCollection("webhook_endpoints").DeleteOne(ctx, bson.M{"_id": endpoint.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	// Nothing left to deliver to
+	_, err = s.db.GetCollection("webhook_deliveries").UpdateMany(ctx,
+		bson.M{"endpoint_id": endpoint.ID, "status": bson.M{"$in": []string{"pending", "delivering"}}},
+		bson.M{"$set": bson.M{"status": "failed", "error": "endpoint deleted", "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns an endpoint's delivery log, newest first, optionally
+// filtered by status
+func (s *WebhookService) ListDeliveries(ctx context.Context, endpointID, domain, status string, limit int64) ([]models.WebhookDelivery, error) {
+	endpoint, err := s.GetEndpoint(ctx, endpointID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"endpoint_id": endpoint.ID}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.db.GetCollection("webhook_deliveries").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver sends a logged delivery again as a new delivery with the same
+// event ID and payload, and returns it after the first attempt
+func (s *WebhookService) Redeliver(ctx context.Context, endpointID, deliveryID, domain string) (*models.WebhookDelivery, error) {
+	endpoint, err := s.GetEndpoint(ctx, endpointID, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	collection := s.db.GetCollection("webhook_deliveries")
+	var original models.WebhookDelivery
+	err = collection.FindOne(ctx, bson.M{"_id": objectID, "endpoint_id": endpoint.ID}).Decode(&original)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		Domain:        domain,
+		EndpointID:    endpoint.ID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		OrderID:       original.OrderID,
+		Payload:       original.Payload,
+		Status:        "pending",
+		NextAttemptAt: now,
+		RedeliveryOf:  original.ID.Hex(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := collection.InsertOne(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	s.attempt(ctx, delivery.ID)
+
+	if err := collection.FindOne(ctx, bson.M{"_id": delivery.ID}).Decode(delivery); err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return delivery, nil
+}
+
+// Dispatch queues an order event for every active endpoint of the order's
+// domain that subscribes to it and sends it right away in the background.
+// Failures are logged; they never fail the order operation that triggered them.
+func (s *WebhookService) Dispatch(ctx context.Context, event string, order *models.Order) {
+	cursor, err := s.db.GetCollection("webhook_endpoints").Find(ctx, bson.M{
+		"domain": order.Domain,
+		"active": true,
+		"events": event,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to find webhook endpoints for %s: %v", order.Domain, err)
+		return
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := cursor.All(ctx, &endpoints); err != nil {
+		log.Printf("ERROR: Failed to decode webhook endpoints for %s: %v", order.Domain, err)
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	payload, eventID, err := buildWebhookPayload(event, order)
+	if err != nil {
+		log.Printf("ERROR: Failed to build %s webhook for order %s: %v", event, order.OrderNumber, err)
+		return
+	}
+
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		delivery := models.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			Domain:        order.Domain,
+			EndpointID:    endpoint.ID,
+			EventID:       eventID,
+			Event:         event,
+			OrderID:       order.ID.Hex(),
+			Payload:       payload,
+			Status:        "pending",
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if _, err := s.db.GetCollection("webhook_deliveries").InsertOne(ctx, delivery); err != nil {
+			log.Printf("ERROR: Failed to queue %s webhook for order %s: %v", event, order.OrderNumber, err)
+			continue
+		}
+
+		// The request context ends with the request, so send detached from it
+		go s.attempt(context.Background(), delivery.ID)
+	}
+}
+
+// RunDeliveryWorker retries due deliveries every interval until ctx is cancelled
+func (s *WebhookService) RunDeliveryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deliverDue(ctx)
+		}
+	}
+}
+
+// deliverDue attempts every delivery whose next attempt is due
+func (s *WebhookService) deliverDue(ctx context.Context) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(100)
+	cursor, err := s.db.GetCollection("webhook_deliveries").Find(ctx, bson.M{
+		"status":          bson.M{"$in": []string{"pending", "delivering"}},
+		"next_attempt_at": bson.M{"$lte": time.Now()},
+	}, opts)
+	if err != nil {
+		log.Printf("ERROR: Failed to list due webhook deliveries: %v", err)
+		return
+	}
+
+	var due []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &due); err != nil {
+		log.Printf("ERROR: Failed to decode due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		s.attempt(ctx, d.ID)
+	}
+}
+
+// attempt claims a due delivery, sends it and records the outcome. Claiming
+// moves next_attempt_at forward by the lease, so the background send and the
+// worker never send the same attempt twice.
+func (s *WebhookService) attempt(ctx context.Context, deliveryID primitive.ObjectID) {
+	collection := s.db.GetCollection("webhook_deliveries")
+	now := time.Now()
+
+	var delivery models.WebhookDelivery
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":             deliveryID,
+			"status":          bson.M{"$in": []string{"pending", "delivering"}},
+			"next_attempt_at": bson.M{"$lte": now},
+		},
+		bson.M{
+			"$set": bson.M{
+				"status":          "delivering",
+				"next_attempt_at": now.Add(webhookAttemptLease),
+				"last_attempt_at": now,
+				"updated_at":      now,
+			},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return // Not due, or another worker has it
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to claim webhook delivery %s: %v", deliveryID.Hex(), err)
+		return
+	}
+
+	var endpoint models.WebhookEndpoint
+	err = s.db.GetCollection("webhook_endpoints").FindOne(ctx, bson.M{"_id": delivery.EndpointID}).Decode(&endpoint)
+	if err != nil {
+		s.recordAttempt(ctx, &delivery, 0, "", fmt.Errorf("endpoint not found: %w", err), true)
+		return
+	}
+
+	status, body, err := s.send(ctx, &endpoint, &delivery)
+	if err == nil && (status < 200 || status >= 300) {
+		err = fmt.Errorf("endpoint responded with HTTP %d", status)
+	}
+	s.recordAttempt(ctx, &delivery, status, body, err, false)
+}
+
+// send POSTs the payload with its signature headers
+func (s *WebhookService) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to build request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sparque-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-Webhook-Signature", fmt.Sprintf("t=%d,v1=%s", timestamp, SignWebhookPayload(endpoint.Secret, timestamp, delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	return resp.StatusCode, string(body), nil
+}
+
+// recordAttempt stores the outcome of an attempt and schedules the next one
+// with exponential backoff, or gives up after webhookMaxAttempts
+func (s *WebhookService) recordAttempt(ctx context.Context, delivery *models.WebhookDelivery, status int, body string, sendErr error, giveUp bool) {
+	now := time.Now()
+	set := bson.M{
+		"response_status": status,
+		"response_body":   body,
+		"updated_at":      now,
+	}
+
+	switch {
+	case sendErr == nil:
+		set["status"] = "succeeded"
+		set["error"] = ""
+	case giveUp || delivery.Attempts >= webhookMaxAttempts:
+		set["status"] = "failed"
+		set["error"] = sendErr.Error()
+		log.Printf("⚠️  Webhook %s for order %s failed after %d attempts: %v", delivery.Event, delivery.OrderID, delivery.Attempts, sendErr)
+	default:
+		set["status"] = "pending"
+		set["error"] = sendErr.Error()
+		set["next_attempt_at"] = now.Add(webhookRetryBase << (delivery.Attempts - 1))
+	}
+
+	_, err := s.db.GetCollection("webhook_deliveries").UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("ERROR: Failed to record webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "timestamp.payload".
+// Receivers recompute it with their endpoint secret to verify a delivery.
+func SignWebhookPayload(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildWebhookPayload renders the event body. Payment client secrets and
+// Checkout URLs are stripped, they're only meant for the customer's browser,
+// and so is the risk assessment, which stays internal.
+func buildWebhookPayload(event string, order *models.Order) (string, string, error) {
+	sanitized := *order
+	sanitized.Payment.ClientSecret = ""
+	sanitized.Payment.CheckoutURL = ""
+	sanitized.Risk = nil
+	sanitized.PaymentAdjustments = make([]models.PaymentAdjustment, len(order.PaymentAdjustments))
+	for i, adjustment := range order.PaymentAdjustments {
+		adjustment.ClientSecret = ""
+		sanitized.PaymentAdjustments[i] = adjustment
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"order": sanitized})
+	if err != nil {
+		return "", "", err
+	}
+
+	eventID := "evt_" + primitive.NewObjectID().Hex()
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        eventID,
+		Type:      event,
+		Domain:    order.Domain,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(payload), eventID, nil
+}
+
+// generateWebhookSecret creates an endpoint signing secret
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+
+	for _, event := range events {
+		known := false
+		for _, e := range models.WebhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	return nil
+}
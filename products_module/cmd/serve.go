@@ -57,7 +57,7 @@ func runServer() {
 	}))
 
 	// Routes
-	setupRoutes(e, db, cfg)
+	adminHandler := setupRoutes(e, db, cfg)
 
 	// Start server with graceful shutdown
 	go func() {
@@ -81,22 +81,33 @@ func runServer() {
 	if err := e.Shutdown(ctx); err != nil {
 		log.Fatal(err)
 	}
+	adminHandler.Shutdown(ctx)
 
 	log.Println("Server stopped")
 }
 
-func setupRoutes(e *echo.Echo, db *database.DB, cfg *config.Config) {
+// setupRoutes registers the routes and returns the admin handler, whose
+// background price-drop checks are waited for on shutdown
+func setupRoutes(e *echo.Echo, db *database.DB, cfg *config.Config) *handlers.AdminHandler {
 	// Initialize services
 	productService := services.NewProductService(db)
 	reviewService := services.NewReviewService(db.Database)
 	contactService := services.NewContactService(db.Database)
 
+	var priceDropNotifier services.PriceDropNotifier = services.LogPriceDropNotifier{}
+	if cfg.Wishlist.PriceDropWebhookURL != "" {
+		priceDropNotifier = services.NewWebhookPriceDropNotifier(cfg.Wishlist.PriceDropWebhookURL)
+	}
+	wishlistService := services.NewWishlistService(db, priceDropNotifier)
+
 	// Initialize handlers
-	adminHandler := handlers.NewAdminHandler(productService)
+	adminHandler := handlers.NewAdminHandler(productService, wishlistService)
 	publicHandler := handlers.NewPublicHandler(productService, reviewService, contactService)
+	wishlistHandler := handlers.NewWishlistHandler(wishlistService)
 
 	// Initialize middleware
 	apiKeyAuth := middleware.APIKeyMiddleware(cfg)
+	userAuth := middleware.JWTAuth(cfg)
 	requireWrite := middleware.RequirePermission("products.write")
 	requireRead := middleware.RequirePermission("products.read")
 
@@ -126,6 +137,17 @@ func setupRoutes(e *echo.Echo, db *database.DB, cfg *config.Config) {
 	// Contact form endpoint
 	public.POST("/contact", publicHandler.CreateContact)
 
+	// Shared wishlist links
+	public.GET("/wishlists/:token", wishlistHandler.GetSharedWishlist)
+
+	// Customer wishlist (user JWT required, domain from the token)
+	wishlist := v1.Group("/wishlist", userAuth)
+	wishlist.GET("", wishlistHandler.GetWishlist)
+	wishlist.POST("/items", wishlistHandler.AddItem)
+	wishlist.DELETE("/items/:productId", wishlistHandler.RemoveItem)
+	wishlist.POST("/share", wishlistHandler.Share)
+	wishlist.DELETE("/share", wishlistHandler.Unshare)
+
 	// Admin API (API key required)
 	admin := v1.Group("/products", apiKeyAuth)
 
@@ -145,5 +167,9 @@ func setupRoutes(e *echo.Echo, db *database.DB, cfg *config.Config) {
 	log.Println("   Public API: /api/v1/public/:domain/products")
 	log.Println("   Public API: /api/v1/public/:domain/reviews")
 	log.Println("   Public API: /api/v1/public/:domain/contact")
+	log.Println("   Public API: /api/v1/public/:domain/wishlists/:token")
+	log.Println("   Wishlist API: /api/v1/wishlist (requires user JWT)")
 	log.Println("   Admin API: /api/v1/products (requires API key)")
+
+	return adminHandler
 }
@@ -9,11 +9,12 @@ import (
 
 // Config holds all configuration
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	MongoDB MongoDBConfig `mapstructure:"mongodb"`
-	JWT     JWTConfig     `mapstructure:"jwt"`
-	CORS    CORSConfig    `mapstructure:"cors"`
-	Auth    AuthConfig    `mapstructure:"auth"`
+	Server   ServerConfig   `mapstructure:"server"`
+	MongoDB  MongoDBConfig  `mapstructure:"mongodb"`
+	JWT      JWTConfig      `mapstructure:"jwt"`
+	CORS     CORSConfig     `mapstructure:"cors"`
+	Auth     AuthConfig     `mapstructure:"auth"`
+	Wishlist WishlistConfig `mapstructure:"wishlist"`
 }
 
 // ServerConfig holds server settings
@@ -46,6 +47,11 @@ type AuthConfig struct {
 	DomainsCollection string `mapstructure:"domains_collection"` // domains collection name
 }
 
+// WishlistConfig holds wishlist settings
+type WishlistConfig struct {
+	PriceDropWebhookURL string `mapstructure:"price_drop_webhook_url"` // Price drops are only logged when empty
+}
+
 var cfg *Config
 
 // Load reads configuration from file and environment variables
@@ -86,6 +92,7 @@ func Load(configPath string) (*Config, error) {
 	v.BindEnv("cors.allowed_origins", "PRODUCTS_CORS_ALLOWED_ORIGINS")
 	v.BindEnv("auth.base_url", "PRODUCTS_AUTH_BASE_URL")
 	v.BindEnv("auth.domains_db", "PRODUCTS_AUTH_DOMAINS_DB")
+	v.BindEnv("wishlist.price_drop_webhook_url", "PRODUCTS_WISHLIST_PRICE_DROP_WEBHOOK_URL")
 
 	// Unmarshal config
 	cfg = &Config{}
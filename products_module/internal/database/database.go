@@ -12,11 +12,12 @@ import (
 
 // DB holds MongoDB collections
 type DB struct {
-	Client      *mongo.Client
-	Database    *mongo.Database
-	Products    *mongo.Collection
-	AuthDB      *mongo.Database // Reference to auth_module database
-	Domains     *mongo.Collection // Read-only access to domains
+	Client    *mongo.Client
+	Database  *mongo.Database
+	Products  *mongo.Collection
+	Wishlists *mongo.Collection
+	AuthDB    *mongo.Database   // Reference to auth_module database
+	Domains   *mongo.Collection // Read-only access to domains
 }
 
 // Connect establishes connection to MongoDB and returns DB instance
@@ -42,11 +43,12 @@ func Connect(uri, dbName, authDBName string) (*DB, error) {
 	authDB := client.Database(authDBName)
 
 	db := &DB{
-		Client:   client,
-		Database: database,
-		Products: database.Collection("products"),
-		AuthDB:   authDB,
-		Domains:  authDB.Collection("domains"),
+		Client:    client,
+		Database:  database,
+		Products:  database.Collection("products"),
+		Wishlists: database.Collection("wishlists"),
+		AuthDB:    authDB,
+		Domains:   authDB.Collection("domains"),
 	}
 
 	// Create indexes
@@ -98,5 +100,33 @@ func (db *DB) createIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create products attributes index: %w", err)
 	}
 
+	// Wishlists: one per customer per domain
+	_, err = db.Wishlists.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create wishlists domain/user index: %w", err)
+	}
+
+	// Wishlists: unique share token for public links (only shared wishlists have one)
+	_, err = db.Wishlists.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "share_token", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"share_token": bson.M{"$exists": true},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create wishlists share token index: %w", err)
+	}
+
+	// Wishlists: find the wishlists holding a product on price drops
+	_, err = db.Wishlists.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "items.product_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create wishlists product index: %w", err)
+	}
+
 	return nil
 }
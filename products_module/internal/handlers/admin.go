@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sparque/products_module/internal/models"
@@ -10,14 +15,43 @@ import (
 
 // AdminHandler handles admin product operations (requires API key)
 type AdminHandler struct {
-	productService *services.ProductService
+	productService  *services.ProductService
+	wishlistService *services.WishlistService
+
+	// Price-drop checks running in the background, cancelled on shutdown
+	notifyCtx  context.Context
+	stopNotify context.CancelFunc
+	notifying  sync.WaitGroup
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(productService *services.ProductService) *AdminHandler {
+func NewAdminHandler(productService *services.ProductService, wishlistService *services.WishlistService) *AdminHandler {
+	notifyCtx, stopNotify := context.WithCancel(context.Background())
 	return &AdminHandler{
-		productService: productService,
+		productService:  productService,
+		wishlistService: wishlistService,
+		notifyCtx:       notifyCtx,
+		stopNotify:      stopNotify,
+	}
+}
+
+// Shutdown waits for the price-drop checks still running. Once ctx is done
+// the rest are cancelled; the drops they didn't send are sent on the
+// product's next update.
+func (h *AdminHandler) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		h.notifying.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
 	}
+	h.stopNotify()
+	<-done
 }
 
 // CreateProduct creates a new product
@@ -35,7 +69,11 @@ func (h *AdminHandler) CreateProduct(c echo.Context) error {
 
 	product, err := h.productService.CreateProduct(c.Request().Context(), domain, req, apiKeyID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidVariant) || errors.Is(err, services.ErrInvalidProduct) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
 			"error": err.Error(),
 		})
 	}
@@ -100,14 +138,40 @@ func (h *AdminHandler) UpdateProduct(c echo.Context) error {
 
 	product, err := h.productService.UpdateProduct(c.Request().Context(), domain, productID, req)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidVariant) || errors.Is(err, services.ErrInvalidProduct) {
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, map[string]string{
 			"error": err.Error(),
 		})
 	}
 
+	// Price and discount changes may make wishlisted items cheaper; customers
+	// are notified in the background
+	h.notifying.Add(1)
+	go func() {
+		defer h.notifying.Done()
+		h.notifyPriceDrops(product)
+	}()
+
 	return c.JSON(http.StatusOK, product)
 }
 
+// notifyPriceDrops tells customers with the product in their wishlist that it got cheaper
+func (h *AdminHandler) notifyPriceDrops(product *models.Product) {
+	ctx, cancel := context.WithTimeout(h.notifyCtx, 5*time.Minute)
+	defer cancel()
+
+	notified, err := h.wishlistService.CheckPriceDrops(ctx, product)
+	if err != nil {
+		log.Printf("⚠️  Failed to check wishlist price drops for product %s: %v", product.ID.Hex(), err)
+	}
+	if notified > 0 {
+		log.Printf("📉 Notified %d wishlist price drops for product %s", notified, product.ID.Hex())
+	}
+}
+
 // DeleteProduct deletes a product
 func (h *AdminHandler) DeleteProduct(c echo.Context) error {
 	domain, _ := c.Get("domain").(string)
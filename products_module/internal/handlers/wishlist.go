@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/products_module/internal/models"
+	"github.com/sparque/products_module/internal/services"
+)
+
+// WishlistHandler handles customer wishlists (requires a user JWT) and the
+// public shared wishlist links
+type WishlistHandler struct {
+	wishlistService *services.WishlistService
+}
+
+// NewWishlistHandler creates a new wishlist handler
+func NewWishlistHandler(wishlistService *services.WishlistService) *WishlistHandler {
+	return &WishlistHandler{
+		wishlistService: wishlistService,
+	}
+}
+
+// GetWishlist returns the customer's wishlist with current prices and stock
+func (h *WishlistHandler) GetWishlist(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	wishlist, err := h.wishlistService.GetWishlist(c.Request().Context(), domain, userID)
+	if err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, wishlist)
+}
+
+// AddItem saves a product or variant to the customer's wishlist
+func (h *WishlistHandler) AddItem(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+	email, _ := c.Get("email").(string)
+
+	var req models.AddWishlistItemRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	if req.ProductID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "product_id is required",
+		})
+	}
+
+	wishlist, err := h.wishlistService.AddItem(c.Request().Context(), domain, userID, email, req)
+	if err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, wishlist)
+}
+
+// RemoveItem removes a product from the customer's wishlist. A saved variant
+// is removed with ?variant_id=.
+func (h *WishlistHandler) RemoveItem(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	wishlist, err := h.wishlistService.RemoveItem(c.Request().Context(), domain, userID, c.Param("productId"), c.QueryParam("variant_id"))
+	if err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, wishlist)
+}
+
+// Share enables the wishlist's public link
+func (h *WishlistHandler) Share(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	token, err := h.wishlistService.Share(c.Request().Context(), domain, userID)
+	if err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"share_token": token,
+		"path":        "/api/v1/public/" + domain + "/wishlists/" + token,
+	})
+}
+
+// Unshare disables the wishlist's public link
+func (h *WishlistHandler) Unshare(c echo.Context) error {
+	domain, _ := c.Get("domain").(string)
+	userID, _ := c.Get("user_id").(string)
+
+	if err := h.wishlistService.Unshare(c.Request().Context(), domain, userID); err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Wishlist is no longer shared",
+	})
+}
+
+// GetSharedWishlist returns a shared wishlist (public access)
+func (h *WishlistHandler) GetSharedWishlist(c echo.Context) error {
+	domain := c.Param("domain")
+	token := c.Param("token")
+
+	wishlist, err := h.wishlistService.GetSharedWishlist(c.Request().Context(), domain, token)
+	if err != nil {
+		return wishlistError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, wishlist)
+}
+
+func wishlistError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrWishlistNotFound) || errors.Is(err, services.ErrWishlistItemNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidWishlistItem):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusInternalServerError, map[string]string{
+		"error": err.Error(),
+	})
+}
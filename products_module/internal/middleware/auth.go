@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sparque/products_module/config"
+)
+
+// UserClaims represents the claims in a user JWT issued by auth_module
+type UserClaims struct {
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Domain      string   `json:"domain"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuth validates user JWTs for customer operations (wishlists). API keys
+// are rejected: they don't belong to a customer.
+func JWTAuth(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Missing authorization header",
+				})
+			}
+
+			tokenString := extractToken(authHeader)
+			if tokenString == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid authorization header format",
+				})
+			}
+
+			claims, err := validateJWT(tokenString, cfg.JWT.Secret)
+			if err != nil || claims.UserID == "" || claims.Domain == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid or expired token",
+				})
+			}
+
+			// Set context values
+			c.Set("user_id", claims.UserID)
+			c.Set("email", claims.Email)
+			c.Set("domain", claims.Domain)
+			c.Set("role", claims.Role)
+			c.Set("permissions", claims.Permissions)
+
+			return next(c)
+		}
+	}
+}
+
+// validateJWT validates a user JWT and returns the claims
+func validateJWT(tokenString, secret string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
@@ -11,6 +11,7 @@ type Product struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Domain      string             `bson:"domain" json:"domain"`
 	Name        string             `bson:"name" json:"name"`
+	Type        string             `bson:"type,omitempty" json:"type,omitempty"` // physical (default) or gift_card
 	Description string             `bson:"description,omitempty" json:"description,omitempty"`
 	BasePrice   float64            `bson:"base_price" json:"base_price"`
 	Images      []string           `bson:"images,omitempty" json:"images,omitempty"`
@@ -40,6 +41,30 @@ type ProductVariant struct {
 	Stock      int               `bson:"stock" json:"stock"`                             // Available inventory
 	SKU        string            `bson:"sku,omitempty" json:"sku,omitempty"`            // Stock Keeping Unit
 	ImageIndex int               `bson:"image_index,omitempty" json:"image_index,omitempty"` // Index into product images array
+
+	// What happens when the variant is out of stock
+	InventoryPolicy string     `bson:"inventory_policy,omitempty" json:"inventory_policy,omitempty"` // deny (default), backorder, preorder
+	ExpectedAt      *time.Time `bson:"expected_at,omitempty" json:"expected_at,omitempty"`           // Restock / release date shown to customers
+	PreorderLimit   int        `bson:"preorder_limit,omitempty" json:"preorder_limit,omitempty"`     // Max units on pre-order (0 = no cap)
+}
+
+// Product types. Gift cards aren't stocked: each variant is a denomination
+// and buying one issues a gift card code with the variant's price as balance.
+const (
+	ProductTypePhysical = "physical"
+	ProductTypeGiftCard = "gift_card"
+)
+
+// Inventory policies for out-of-stock variants
+const (
+	InventoryPolicyDeny      = "deny"
+	InventoryPolicyBackorder = "backorder"
+	InventoryPolicyPreorder  = "preorder"
+)
+
+// IsGiftCard checks if the product is a gift card
+func (p *Product) IsGiftCard() bool {
+	return p.Type == ProductTypeGiftCard
 }
 
 // GetEffectivePrice returns the variant price if available, otherwise base price
@@ -55,6 +80,12 @@ func (v *ProductVariant) IsInStock() bool {
 	return v.Stock > 0
 }
 
+// CanPurchase checks if the variant can be ordered, either from stock or on
+// backorder / pre-order
+func (v *ProductVariant) CanPurchase() bool {
+	return v.IsInStock() || (v.InventoryPolicy != "" && v.InventoryPolicy != InventoryPolicyDeny)
+}
+
 // IsDiscountActive checks if the discount is currently active and valid
 func (d *ProductDiscount) IsDiscountActive() bool {
 	if d == nil || !d.Active {
@@ -78,22 +109,47 @@ func (d *ProductDiscount) IsDiscountActive() bool {
 
 // GetDiscountedPrice calculates the discounted price based on discount type
 func (p *Product) GetDiscountedPrice() float64 {
+	return p.applyDiscount(p.BasePrice)
+}
+
+// GetVariantPrice returns what a customer pays for one unit of the variant:
+// its effective price with the product discount applied. Without a variant
+// it's the discounted base price.
+func (p *Product) GetVariantPrice(variant *ProductVariant) float64 {
+	if variant == nil {
+		return p.GetDiscountedPrice()
+	}
+	return p.applyDiscount(variant.GetEffectivePrice(p.BasePrice))
+}
+
+// FindVariant returns the variant with the given ID, or nil
+func (p *Product) FindVariant(variantID string) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == variantID {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// applyDiscount applies the product discount, if active, to a price
+func (p *Product) applyDiscount(price float64) float64 {
 	if p.Discount == nil || !p.Discount.IsDiscountActive() {
-		return p.BasePrice
+		return price
 	}
 
 	switch p.Discount.Type {
 	case "percentage":
-		discount := p.BasePrice * (p.Discount.Value / 100.0)
-		return p.BasePrice - discount
+		discount := price * (p.Discount.Value / 100.0)
+		return price - discount
 	case "fixed":
-		discounted := p.BasePrice - p.Discount.Value
+		discounted := price - p.Discount.Value
 		if discounted < 0 {
 			return 0
 		}
 		return discounted
 	default:
-		return p.BasePrice
+		return price
 	}
 }
 
@@ -116,6 +172,7 @@ func (p *Product) GetDiscountPercentage() int {
 // CreateProductRequest represents the request to create a product
 type CreateProductRequest struct {
 	Name        string                   `json:"name" validate:"required"`
+	Type        string                   `json:"type" validate:"omitempty,oneof=physical gift_card"`
 	Description string                   `json:"description"`
 	BasePrice   float64                  `json:"base_price" validate:"required,gt=0"`
 	Images      []string                 `json:"images"`
@@ -131,11 +188,16 @@ type CreateVariantRequest struct {
 	Stock      int               `json:"stock" validate:"gte=0"`
 	SKU        string            `json:"sku"`
 	ImageIndex int               `json:"image_index"`
+
+	InventoryPolicy string     `json:"inventory_policy" validate:"omitempty,oneof=deny backorder preorder"`
+	ExpectedAt      *time.Time `json:"expected_at"`
+	PreorderLimit   int        `json:"preorder_limit" validate:"gte=0"`
 }
 
 // UpdateProductRequest represents the request to update a product
 type UpdateProductRequest struct {
 	Name        *string                  `json:"name"`
+	Type        *string                  `json:"type"`
 	Description *string                  `json:"description"`
 	BasePrice   *float64                 `json:"base_price"`
 	Images      *[]string                `json:"images"`
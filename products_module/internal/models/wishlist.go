@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Wishlist is a customer's list of products saved for later, one per user
+// per domain. Only product and variant IDs are stored: prices, discounts
+// and stock are read from the catalog every time the wishlist is shown.
+type Wishlist struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Domain     string             `bson:"domain" json:"domain"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Email      string             `bson:"email,omitempty" json:"email,omitempty"`             // For price-drop notifications
+	ShareToken string             `bson:"share_token,omitempty" json:"share_token,omitempty"` // Set while the public link is enabled
+	Items      []WishlistItem     `bson:"items" json:"items"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// WishlistItem is a saved product or variant. AlertPrice is the price the
+// next price drop is measured against: the price when it was added, lowered
+// each time the customer is notified of a drop.
+type WishlistItem struct {
+	ProductID  string    `bson:"product_id" json:"product_id"`
+	VariantID  string    `bson:"variant_id,omitempty" json:"variant_id,omitempty"`
+	PriceAtAdd float64   `bson:"price_at_add" json:"price_at_add"`
+	AlertPrice float64   `bson:"alert_price" json:"-"`
+	AddedAt    time.Time `bson:"added_at" json:"added_at"`
+}
+
+// Wishlist item availability
+const (
+	WishlistInStock     = "in_stock"
+	WishlistBackorder   = "backorder"
+	WishlistPreorder    = "preorder"
+	WishlistOutOfStock  = "out_of_stock"
+	WishlistUnavailable = "unavailable" // Product deactivated, deleted or variant removed
+)
+
+// WishlistLine is a wishlist item with its current catalog price and stock
+type WishlistLine struct {
+	ProductID          string            `json:"product_id"`
+	VariantID          string            `json:"variant_id,omitempty"`
+	Name               string            `json:"name,omitempty"`
+	Image              string            `json:"image,omitempty"`
+	VariantAttributes  map[string]string `json:"variant_attributes,omitempty"`
+	Price              float64           `json:"price"`         // Current price, discount applied
+	RegularPrice       float64           `json:"regular_price"` // Current price before the discount
+	DiscountPercentage int               `json:"discount_percentage,omitempty"`
+	PriceAtAdd         float64           `json:"price_at_add"`
+	PriceDropped       bool              `json:"price_dropped"` // Cheaper now than when it was added
+	Availability       string            `json:"availability"`  // in_stock | backorder | preorder | out_of_stock | unavailable
+	ExpectedAt         *time.Time        `json:"expected_at,omitempty"`
+	AddedAt            time.Time         `json:"added_at"`
+}
+
+// WishlistView is a wishlist with live prices and stock. The share token is
+// only shown to the owner.
+type WishlistView struct {
+	Domain     string         `json:"domain"`
+	Items      []WishlistLine `json:"items"`
+	Count      int            `json:"count"`
+	ShareToken string         `json:"share_token,omitempty"`
+	UpdatedAt  *time.Time     `json:"updated_at,omitempty"`
+}
+
+// AddWishlistItemRequest represents the request to save a product or variant
+type AddWishlistItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+}
+
+// PriceDrop is sent to the price-drop notification hook when a saved item
+// gets cheaper than the customer last saw it
+type PriceDrop struct {
+	Domain      string    `json:"domain"`
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email,omitempty"`
+	ProductID   string    `json:"product_id"`
+	VariantID   string    `json:"variant_id,omitempty"`
+	ProductName string    `json:"product_name"`
+	OldPrice    float64   `json:"old_price"`
+	NewPrice    float64   `json:"new_price"`
+	PriceAtAdd  float64   `json:"price_at_add"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sparque/products_module/internal/models"
+)
+
+// PriceDropNotifier is told when a wishlisted product gets cheaper, so the
+// customer can be emailed or pushed a notification
+type PriceDropNotifier interface {
+	NotifyPriceDrop(ctx context.Context, drop models.PriceDrop) error
+}
+
+// LogPriceDropNotifier logs price drops (used when no webhook is configured)
+type LogPriceDropNotifier struct{}
+
+// NotifyPriceDrop logs the price drop
+func (LogPriceDropNotifier) NotifyPriceDrop(ctx context.Context, drop models.PriceDrop) error {
+	log.Printf("📉 Price drop for %s (%s): %s %.2f -> %.2f", drop.UserID, drop.Domain, drop.ProductName, drop.OldPrice, drop.NewPrice)
+	return nil
+}
+
+// WebhookPriceDropNotifier POSTs each price drop as JSON to a URL, e.g. the
+// service that sends the domain's customer emails
+type WebhookPriceDropNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPriceDropNotifier creates a notifier posting to url
+func NewWebhookPriceDropNotifier(url string) *WebhookPriceDropNotifier {
+	return &WebhookPriceDropNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotifyPriceDrop posts the price drop. Any non-2xx response is an error.
+func (n *WebhookPriceDropNotifier) NotifyPriceDrop(ctx context.Context, drop models.PriceDrop) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event": "wishlist.price_drop",
+		"data":  drop,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode price drop: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post price drop: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("price drop webhook returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,6 +14,12 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrInvalidProduct is returned when a product's type doesn't fit its variants
+var ErrInvalidProduct = errors.New("invalid product")
+
+// ErrInvalidVariant is returned when a variant's inventory settings are invalid
+var ErrInvalidVariant = errors.New("invalid variant")
+
 // ProductService handles product operations
 type ProductService struct {
 	db *database.DB
@@ -36,16 +43,12 @@ func (s *ProductService) CreateProduct(ctx context.Context, domain string, req m
 	}
 
 	// Create variants with generated IDs
-	variants := make([]models.ProductVariant, len(req.Variants))
-	for i, v := range req.Variants {
-		variants[i] = models.ProductVariant{
-			ID:         uuid.New().String(),
-			Attributes: v.Attributes,
-			Price:      v.Price,
-			Stock:      v.Stock,
-			SKU:        v.SKU,
-			ImageIndex: v.ImageIndex,
-		}
+	variants, err := newVariants(req.Variants)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProductType(req.Type, variants); err != nil {
+		return nil, err
 	}
 
 	// Create product
@@ -53,6 +56,7 @@ func (s *ProductService) CreateProduct(ctx context.Context, domain string, req m
 		ID:          primitive.NewObjectID(),
 		Domain:      domain,
 		Name:        req.Name,
+		Type:        req.Type,
 		Description: req.Description,
 		BasePrice:   req.BasePrice,
 		Images:      req.Images,
@@ -178,19 +182,30 @@ func (s *ProductService) UpdateProduct(ctx context.Context, domain, productID st
 	}
 	if req.Variants != nil {
 		// Regenerate variant IDs
-		variants := make([]models.ProductVariant, len(*req.Variants))
-		for i, v := range *req.Variants {
-			variants[i] = models.ProductVariant{
-				ID:         uuid.New().String(),
-				Attributes: v.Attributes,
-				Price:      v.Price,
-				Stock:      v.Stock,
-				SKU:        v.SKU,
-				ImageIndex: v.ImageIndex,
-			}
+		variants, err := newVariants(*req.Variants)
+		if err != nil {
+			return nil, err
 		}
 		update["$set"].(bson.M)["variants"] = variants
 	}
+	if req.Type != nil || req.Variants != nil {
+		// The type is checked against the variants the product ends up with
+		current, err := s.GetProduct(ctx, domain, productID)
+		if err != nil {
+			return nil, err
+		}
+		productType, variants := current.Type, current.Variants
+		if req.Type != nil {
+			productType = *req.Type
+			update["$set"].(bson.M)["type"] = productType
+		}
+		if v, ok := update["$set"].(bson.M)["variants"].([]models.ProductVariant); ok {
+			variants = v
+		}
+		if err := validateProductType(productType, variants); err != nil {
+			return nil, err
+		}
+	}
 	if req.Discount != nil {
 		update["$set"].(bson.M)["discount"] = req.Discount
 	}
@@ -282,3 +297,57 @@ func (s *ProductService) UpdateStock(ctx context.Context, domain, productID, var
 
 	return nil
 }
+
+// newVariants builds variants with generated IDs from the request
+func newVariants(reqs []models.CreateVariantRequest) ([]models.ProductVariant, error) {
+	variants := make([]models.ProductVariant, len(reqs))
+	for i, v := range reqs {
+		switch v.InventoryPolicy {
+		case "", models.InventoryPolicyDeny, models.InventoryPolicyBackorder:
+		case models.InventoryPolicyPreorder:
+			if v.ExpectedAt == nil {
+				return nil, fmt.Errorf("%w: pre-order variants need an expected_at date", ErrInvalidVariant)
+			}
+		default:
+			return nil, fmt.Errorf("%w: inventory_policy must be deny, backorder or preorder", ErrInvalidVariant)
+		}
+		if v.PreorderLimit < 0 {
+			return nil, fmt.Errorf("%w: preorder_limit can't be negative", ErrInvalidVariant)
+		}
+
+		variants[i] = models.ProductVariant{
+			ID:              uuid.New().String(),
+			Attributes:      v.Attributes,
+			Price:           v.Price,
+			Stock:           v.Stock,
+			SKU:             v.SKU,
+			ImageIndex:      v.ImageIndex,
+			InventoryPolicy: v.InventoryPolicy,
+			ExpectedAt:      v.ExpectedAt,
+			PreorderLimit:   v.PreorderLimit,
+		}
+	}
+	return variants, nil
+}
+
+// validateProductType checks the product type. Gift cards are sold in fixed
+// denominations, one per variant.
+func validateProductType(productType string, variants []models.ProductVariant) error {
+	switch productType {
+	case "", models.ProductTypePhysical:
+		return nil
+	case models.ProductTypeGiftCard:
+	default:
+		return fmt.Errorf("%w: type must be physical or gift_card", ErrInvalidProduct)
+	}
+
+	if len(variants) == 0 {
+		return fmt.Errorf("%w: gift cards need at least one denomination variant", ErrInvalidProduct)
+	}
+	for _, v := range variants {
+		if v.Price <= 0 {
+			return fmt.Errorf("%w: every gift card variant needs a price (its denomination)", ErrInvalidProduct)
+		}
+	}
+	return nil
+}
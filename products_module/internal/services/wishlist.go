@@ -0,0 +1,536 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sparque/products_module/internal/database"
+	"github.com/sparque/products_module/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidWishlistItem is returned when a product can't be saved to a wishlist
+var ErrInvalidWishlistItem = errors.New("invalid wishlist item")
+
+// ErrWishlistItemNotFound is returned when a product isn't in the wishlist
+var ErrWishlistItemNotFound = errors.New("wishlist item not found")
+
+// ErrWishlistNotFound is returned when a shared wishlist link doesn't exist (anymore)
+var ErrWishlistNotFound = errors.New("wishlist not found")
+
+// maxWishlistItems caps how many products a wishlist can hold
+const maxWishlistItems = 200
+
+// WishlistService handles customer wishlists
+type WishlistService struct {
+	db       *database.DB
+	notifier PriceDropNotifier
+}
+
+// NewWishlistService creates a new wishlist service. Price drops are only
+// looked for when a notifier is set.
+func NewWishlistService(db *database.DB, notifier PriceDropNotifier) *WishlistService {
+	return &WishlistService{db: db, notifier: notifier}
+}
+
+// GetWishlist returns a customer's wishlist with current prices and stock
+func (s *WishlistService) GetWishlist(ctx context.Context, domain, userID string) (*models.WishlistView, error) {
+	wishlist, err := s.findWishlist(ctx, bson.M{"domain": domain, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	if wishlist == nil {
+		return &models.WishlistView{Domain: domain, Items: []models.WishlistLine{}}, nil
+	}
+
+	return s.view(ctx, wishlist)
+}
+
+// AddItem saves an active product, or one of its variants, to the customer's
+// wishlist. Saving it again leaves the wishlist as it is.
+func (s *WishlistService) AddItem(ctx context.Context, domain, userID, email string, req models.AddWishlistItemRequest) (*models.WishlistView, error) {
+	product, err := s.getProduct(ctx, domain, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || !product.Active {
+		return nil, fmt.Errorf("%w: product %s not found", ErrInvalidWishlistItem, req.ProductID)
+	}
+	var variant *models.ProductVariant
+	if req.VariantID != "" {
+		if variant = product.FindVariant(req.VariantID); variant == nil {
+			return nil, fmt.Errorf("%w: variant %s of %s not found", ErrInvalidWishlistItem, req.VariantID, product.Name)
+		}
+	}
+
+	wishlist, err := s.loadOrCreate(ctx, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+	if email != "" {
+		wishlist.Email = email
+	}
+
+	if findWishlistItem(wishlist.Items, req.ProductID, req.VariantID) < 0 {
+		if len(wishlist.Items) >= maxWishlistItems {
+			return nil, fmt.Errorf("%w: a wishlist can hold at most %d products", ErrInvalidWishlistItem, maxWishlistItems)
+		}
+		price := product.GetVariantPrice(variant)
+		wishlist.Items = append(wishlist.Items, models.WishlistItem{
+			ProductID:  req.ProductID,
+			VariantID:  req.VariantID,
+			PriceAtAdd: price,
+			AlertPrice: price,
+			AddedAt:    time.Now(),
+		})
+	}
+
+	if err := s.save(ctx, wishlist); err != nil {
+		return nil, err
+	}
+
+	return s.view(ctx, wishlist)
+}
+
+// RemoveItem removes a product, or one of its variants, from the customer's wishlist
+func (s *WishlistService) RemoveItem(ctx context.Context, domain, userID, productID, variantID string) (*models.WishlistView, error) {
+	wishlist, err := s.findWishlist(ctx, bson.M{"domain": domain, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	if wishlist == nil {
+		return nil, ErrWishlistItemNotFound
+	}
+
+	i := findWishlistItem(wishlist.Items, productID, variantID)
+	if i < 0 {
+		return nil, ErrWishlistItemNotFound
+	}
+	wishlist.Items = append(wishlist.Items[:i], wishlist.Items[i+1:]...)
+
+	if err := s.save(ctx, wishlist); err != nil {
+		return nil, err
+	}
+
+	return s.view(ctx, wishlist)
+}
+
+// Share enables the wishlist's public link and returns its token. Sharing
+// an already shared wishlist returns the same token.
+func (s *WishlistService) Share(ctx context.Context, domain, userID string) (string, error) {
+	wishlist, err := s.loadOrCreate(ctx, domain, userID)
+	if err != nil {
+		return "", err
+	}
+	if wishlist.ShareToken != "" {
+		return wishlist.ShareToken, nil
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return "", err
+	}
+	wishlist.ShareToken = token
+
+	if err := s.save(ctx, wishlist); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Unshare disables the wishlist's public link. Sharing it again gives a new link.
+func (s *WishlistService) Unshare(ctx context.Context, domain, userID string) error {
+	_, err := s.db.Wishlists.UpdateOne(ctx, bson.M{
+		"domain":  domain,
+		"user_id": userID,
+	}, bson.M{
+		"$unset": bson.M{"share_token": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unshare wishlist: %w", err)
+	}
+
+	return nil
+}
+
+// GetSharedWishlist returns the wishlist behind a public link, without the
+// owner's details
+func (s *WishlistService) GetSharedWishlist(ctx context.Context, domain, token string) (*models.WishlistView, error) {
+	if token == "" {
+		return nil, ErrWishlistNotFound
+	}
+
+	wishlist, err := s.findWishlist(ctx, bson.M{"domain": domain, "share_token": token})
+	if err != nil {
+		return nil, err
+	}
+	if wishlist == nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	view, err := s.view(ctx, wishlist)
+	if err != nil {
+		return nil, err
+	}
+	view.ShareToken = ""
+
+	return view, nil
+}
+
+// CheckPriceDrops notifies every customer with the product in their wishlist
+// whose price is now lower than they last saw it, and returns how many were
+// notified. Each item's alert price is lowered before its customer is
+// notified, so concurrent checks send every drop once. A failed notification
+// is logged, its alert price put back so it's retried on the product's next
+// update, and the other customers are still notified.
+func (s *WishlistService) CheckPriceDrops(ctx context.Context, product *models.Product) (int, error) {
+	if s.notifier == nil || !product.Active {
+		return 0, nil
+	}
+
+	productID := product.ID.Hex()
+	cursor, err := s.db.Wishlists.Find(ctx, bson.M{
+		"domain":           product.Domain,
+		"items.product_id": productID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find wishlists: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	notified := 0
+	for cursor.Next(ctx) {
+		var wishlist models.Wishlist
+		if err := cursor.Decode(&wishlist); err != nil {
+			log.Printf("⚠️  Failed to decode wishlist: %v", err)
+			continue
+		}
+
+		for i := range wishlist.Items {
+			item := &wishlist.Items[i]
+			if item.ProductID != productID {
+				continue
+			}
+			var variant *models.ProductVariant
+			if item.VariantID != "" {
+				if variant = product.FindVariant(item.VariantID); variant == nil {
+					continue
+				}
+			}
+
+			price := product.GetVariantPrice(variant)
+			if !isPriceDrop(item.AlertPrice, price) {
+				continue
+			}
+
+			claimed, err := s.swapAlertPrice(ctx, wishlist.ID, item, item.AlertPrice, price)
+			if err != nil {
+				log.Printf("⚠️  Failed to update alert price in wishlist %s: %v", wishlist.ID.Hex(), err)
+				continue
+			}
+			if !claimed {
+				// Another check already notified this drop, or the item changed
+				continue
+			}
+
+			err = s.notifier.NotifyPriceDrop(ctx, models.PriceDrop{
+				Domain:      wishlist.Domain,
+				UserID:      wishlist.UserID,
+				Email:       wishlist.Email,
+				ProductID:   productID,
+				VariantID:   item.VariantID,
+				ProductName: product.Name,
+				OldPrice:    item.AlertPrice,
+				NewPrice:    price,
+				PriceAtAdd:  item.PriceAtAdd,
+				DetectedAt:  time.Now(),
+			})
+			if err != nil {
+				log.Printf("⚠️  Failed to notify price drop to %s for product %s: %v", wishlist.UserID, productID, err)
+				if _, err := s.swapAlertPrice(context.WithoutCancel(ctx), wishlist.ID, item, price, item.AlertPrice); err != nil {
+					log.Printf("⚠️  Failed to restore alert price in wishlist %s: %v", wishlist.ID.Hex(), err)
+				}
+				continue
+			}
+			notified++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return notified, fmt.Errorf("failed to read wishlists: %w", err)
+	}
+
+	return notified, nil
+}
+
+// swapAlertPrice sets a wishlist item's alert price to next if it is still
+// from, and reports whether it did. Only the item is matched: the customer
+// may be editing the wishlist.
+func (s *WishlistService) swapAlertPrice(ctx context.Context, wishlistID primitive.ObjectID, item *models.WishlistItem, from, next float64) (bool, error) {
+	variantFilter := interface{}(item.VariantID)
+	if item.VariantID == "" {
+		variantFilter = nil
+	}
+	itemFilter := bson.M{"product_id": item.ProductID, "variant_id": variantFilter, "alert_price": from}
+
+	result, err := s.db.Wishlists.UpdateOne(ctx,
+		bson.M{"_id": wishlistID, "items": bson.M{"$elemMatch": itemFilter}},
+		bson.M{"$set": bson.M{"items.$[item].alert_price": next}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"item.product_id": item.ProductID, "item.variant_id": variantFilter, "item.alert_price": from}},
+		}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// view prices a wishlist's items from the catalog
+func (s *WishlistService) view(ctx context.Context, wishlist *models.Wishlist) (*models.WishlistView, error) {
+	products, err := s.getProducts(ctx, wishlist.Domain, wishlist.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &models.WishlistView{
+		Domain:     wishlist.Domain,
+		Items:      make([]models.WishlistLine, 0, len(wishlist.Items)),
+		Count:      len(wishlist.Items),
+		ShareToken: wishlist.ShareToken,
+		UpdatedAt:  &wishlist.UpdatedAt,
+	}
+	for _, item := range wishlist.Items {
+		view.Items = append(view.Items, wishlistLine(item, products[item.ProductID]))
+	}
+
+	return view, nil
+}
+
+// wishlistLine prices a wishlist item and checks its availability. A product
+// saved without a variant is priced from its discounted base price and is
+// available when any of its variants is.
+func wishlistLine(item models.WishlistItem, product *models.Product) models.WishlistLine {
+	line := models.WishlistLine{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		PriceAtAdd:   item.PriceAtAdd,
+		Availability: models.WishlistUnavailable,
+		AddedAt:      item.AddedAt,
+	}
+	if product == nil {
+		return line
+	}
+
+	line.Name = product.Name
+	if len(product.Images) > 0 {
+		line.Image = product.Images[0]
+	}
+	if !product.Active {
+		return line
+	}
+
+	var variant *models.ProductVariant
+	if item.VariantID != "" {
+		if variant = product.FindVariant(item.VariantID); variant == nil {
+			return line
+		}
+		line.VariantAttributes = variant.Attributes
+		if variant.ImageIndex > 0 && variant.ImageIndex < len(product.Images) {
+			line.Image = product.Images[variant.ImageIndex]
+		}
+	}
+
+	line.Price = product.GetVariantPrice(variant)
+	line.RegularPrice = product.BasePrice
+	if variant != nil {
+		line.RegularPrice = variant.GetEffectivePrice(product.BasePrice)
+	}
+	if line.Price < line.RegularPrice {
+		line.DiscountPercentage = product.GetDiscountPercentage()
+	}
+	line.PriceDropped = isPriceDrop(item.PriceAtAdd, line.Price)
+
+	switch {
+	case product.IsGiftCard():
+		// Gift cards aren't stocked
+		line.Availability = models.WishlistInStock
+	case variant != nil:
+		line.Availability, line.ExpectedAt = variantAvailability(variant)
+	case len(product.Variants) == 0:
+		line.Availability = models.WishlistInStock
+	default:
+		line.Availability = models.WishlistOutOfStock
+		for i := range product.Variants {
+			availability, expectedAt := variantAvailability(&product.Variants[i])
+			if availability == models.WishlistInStock {
+				line.Availability, line.ExpectedAt = availability, nil
+				break
+			}
+			if availability != models.WishlistOutOfStock && line.Availability == models.WishlistOutOfStock {
+				line.Availability, line.ExpectedAt = availability, expectedAt
+			}
+		}
+	}
+
+	return line
+}
+
+// variantAvailability returns whether a variant is in stock, can be
+// backordered or pre-ordered, or is out of stock
+func variantAvailability(variant *models.ProductVariant) (string, *time.Time) {
+	switch {
+	case variant.IsInStock():
+		return models.WishlistInStock, nil
+	case variant.CanPurchase():
+		return variant.InventoryPolicy, variant.ExpectedAt
+	default:
+		return models.WishlistOutOfStock, variant.ExpectedAt
+	}
+}
+
+// isPriceDrop reports whether a price went down by at least a cent
+func isPriceDrop(was, now float64) bool {
+	return was-now >= 0.005
+}
+
+// findWishlistItem returns the index of a product / variant in the items, or -1
+func findWishlistItem(items []models.WishlistItem, productID, variantID string) int {
+	for i, item := range items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			return i
+		}
+	}
+	return -1
+}
+
+// getProduct retrieves a product of the domain, or nil if it doesn't exist
+func (s *WishlistService) getProduct(ctx context.Context, domain, productID string) (*models.Product, error) {
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID", ErrInvalidWishlistItem)
+	}
+
+	var product models.Product
+	err = s.db.Products.FindOne(ctx, bson.M{"_id": objID, "domain": domain}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return &product, nil
+}
+
+// getProducts retrieves the products of the items, keyed by ID. Products
+// that no longer exist are left out.
+func (s *WishlistService) getProducts(ctx context.Context, domain string, items []models.WishlistItem) (map[string]*models.Product, error) {
+	products := make(map[string]*models.Product, len(items))
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		if objID, err := primitive.ObjectIDFromHex(item.ProductID); err == nil {
+			ids = append(ids, objID)
+		}
+	}
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	cursor, err := s.db.Products.Find(ctx, bson.M{
+		"_id":    bson.M{"$in": ids},
+		"domain": domain,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var found []models.Product
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("failed to decode products: %w", err)
+	}
+	for i := range found {
+		products[found[i].ID.Hex()] = &found[i]
+	}
+
+	return products, nil
+}
+
+// findWishlist returns the wishlist matching the filter, or nil
+func (s *WishlistService) findWishlist(ctx context.Context, filter bson.M) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := s.db.Wishlists.FindOne(ctx, filter).Decode(&wishlist)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+
+	return &wishlist, nil
+}
+
+// loadOrCreate returns the customer's wishlist, creating an empty one if needed
+func (s *WishlistService) loadOrCreate(ctx context.Context, domain, userID string) (*models.Wishlist, error) {
+	now := time.Now()
+	var wishlist models.Wishlist
+	err := s.db.Wishlists.FindOneAndUpdate(ctx, bson.M{
+		"domain":  domain,
+		"user_id": userID,
+	}, bson.M{
+		"$setOnInsert": bson.M{
+			"items":      []models.WishlistItem{},
+			"created_at": now,
+			"updated_at": now,
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&wishlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+
+	return &wishlist, nil
+}
+
+// save stores the wishlist's items, email and share token
+func (s *WishlistService) save(ctx context.Context, wishlist *models.Wishlist) error {
+	wishlist.UpdatedAt = time.Now()
+
+	set := bson.M{
+		"items":      wishlist.Items,
+		"email":      wishlist.Email,
+		"updated_at": wishlist.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if wishlist.ShareToken != "" {
+		set["share_token"] = wishlist.ShareToken
+	} else {
+		// The share token index is unique, so unshared wishlists have none
+		update["$unset"] = bson.M{"share_token": ""}
+	}
+
+	_, err := s.db.Wishlists.UpdateOne(ctx, bson.M{"_id": wishlist.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to save wishlist: %w", err)
+	}
+
+	return nil
+}
+
+// newShareToken generates an unguessable token for a public wishlist link
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}